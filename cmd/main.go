@@ -5,23 +5,43 @@ import (
 	"bytes"
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/lliamscholtz/env-sync/internal/audit"
 	"github.com/lliamscholtz/env-sync/internal/auth"
 	"github.com/lliamscholtz/env-sync/internal/config"
 	"github.com/lliamscholtz/env-sync/internal/crypto"
 	"github.com/lliamscholtz/env-sync/internal/deps"
+	"github.com/lliamscholtz/env-sync/internal/direnv"
+	"github.com/lliamscholtz/env-sync/internal/githook"
+	"github.com/lliamscholtz/env-sync/internal/hooks"
+	"github.com/lliamscholtz/env-sync/internal/keychain"
+	"github.com/lliamscholtz/env-sync/internal/kms"
+	"github.com/lliamscholtz/env-sync/internal/notify"
 	"github.com/lliamscholtz/env-sync/internal/sync"
 	"github.com/lliamscholtz/env-sync/internal/utils"
 	"github.com/lliamscholtz/env-sync/internal/vault"
 	"github.com/lliamscholtz/env-sync/internal/watcher"
+	"github.com/lliamscholtz/env-sync/pkg/envsync"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/term"
 )
 
 var (
@@ -29,10 +49,22 @@ var (
 	version = "dev"
 	commit  = "none"
 	date    = "unknown"
-	
-	cfgFile  string
-	cliKey   string
-	syncFile string // Sync configuration file for multi-file support
+
+	cfgFile               string
+	cliKey                string
+	keyFormat             string        // Encoding of --key, --new-key and the configured key source
+	syncFile              string        // Sync configuration file for multi-file support
+	timeout               time.Duration // Timeout for Azure Key Vault operations
+	verbose               bool          // Enable debug output
+	quiet                 bool          // Suppress info and success output
+	noColor               bool          // Disable colored output
+	logFormat             string        // Message format: text or json
+	skipChecks            bool          // Skip dependency and authentication pre-flight checks
+	envName               string        // Value of {{.Env}} in secret_name templates
+	branchName            string        // Value of {{.Branch}} in secret_name templates (default: current git branch)
+	vaultURL              string        // Overrides vault_url for this invocation
+	fixPerms              bool          // Restrict env and key files readable by other users instead of warning
+	enableManagedIdentity bool          // Try Azure managed identity even without MSI_ENDPOINT or IDENTITY_ENDPOINT
 )
 
 var rootCmd = &cobra.Command{
@@ -51,8 +83,55 @@ Multi-File Support:
     env-sync pull --sync-file .env-sync.qa.yaml
     env-sync watch --sync-file .env-sync.prod.yaml`,
 	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		applyLogLevel()
+		// JSON records go to stderr, which keeps stdout for piped env content
+		if err := utils.SetLogFormat(logFormat, os.Stderr); err != nil {
+			return err
+		}
+		utils.ConfigureColor(noColor)
+		// Keep stdout clean when it carries env content
+		toStdout, _ := cmd.Flags().GetBool("stdout")
+		utils.SetMessagesToStderr(toStdout || cmd == getCmd)
+		config.SetTemplateVars(config.TemplateVars{Env: envName, Branch: branchName})
+		// init defines its own --vault-url, which shadows this one
+		if vaultURL != "" {
+			if err := vault.ValidateVaultURL(vaultURL); err != nil {
+				return fmt.Errorf("invalid --vault-url: %w", err)
+			}
+		}
+		config.SetOverrides(config.Overrides{VaultURL: vaultURL})
+
+		// A missing or invalid config is reported by the commands that need it
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			cfg = nil
+		}
+		if err := registerConfiguredDependencies(cfg); err != nil {
+			return err
+		}
+		applyManagedIdentity(cmd, cfg)
+		auth.SetTimeout(timeout)
+
 		// Commands that don't need pre-flight checks
-		if cmd.Name() == "install-deps" || cmd.Name() == "generate-key" || cmd.Name() == "help" || cmd.Name() == "init" || cmd.Name() == "version" {
+		if cmd.Name() == "install-deps" || cmd.Name() == "generate-key" || cmd.Name() == "help" || cmd.Name() == "init" || cmd.Name() == "version" || cmd.Name() == "install-hook" || cmd.Name() == "clean" || cmd.Name() == "whoami" {
+			return nil
+		}
+		// A check-only doctor run reports missing dependencies and logins instead of fixing them
+		if cmd == doctorCmd && doctorCheckOnly(cmd) {
+			return nil
+		}
+		// Recipient management and config editing only touch the config file
+		if cmd.HasParent() && (cmd.Parent() == recipientsCmd || cmd.Parent() == configCmd) {
+			return nil
+		}
+		// Shell completion must stay fast and silent
+		if cmd == completionCmd || cmd.Name() == cobra.ShellCompRequestCmd || cmd.Name() == cobra.ShellCompNoDescRequestCmd {
+			return nil
+		}
+
+		// Air-gapped setups supply credentials without az; let commands fail naturally if something is missing
+		if skipPreflightChecks() {
+			utils.PrintDebug("Skipping dependency and authentication pre-flight checks\n")
 			return nil
 		}
 
@@ -66,18 +145,70 @@ Multi-File Support:
 	},
 }
 
+// Exit codes let automation tell failure classes apart
+const (
+	exitError      = 1 // Any failure not covered below
+	exitAuth       = 2 // Not authenticated with Azure
+	exitConfig     = 3 // Invalid configuration or encryption key
+	exitConflict   = 4 // Unresolved conflict with the remote secret
+	exitVault      = 5 // Key Vault or network failure, including a missing secret
+	exitDecryption = 6 // Content could not be decrypted with the loaded key
+)
+
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		if logFormat == "json" {
+			utils.PrintError("%v", err)
+		} else {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(exitCode(err))
+	}
+}
+
+// exitCode maps an error to the exit code of its failure class.
+// More specific classes are checked first, since e.g. a vault error may wrap an authentication failure.
+func exitCode(err error) int {
+	var authErr *azidentity.AuthenticationFailedError
+	var responseErr *azcore.ResponseError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, auth.ErrNotAuthenticated) || errors.As(err, &authErr):
+		return exitAuth
+	case errors.Is(err, sync.ErrConflict) || errors.Is(err, sync.ErrRemoteChanged) || errors.Is(err, vault.ErrConcurrentModification):
+		return exitConflict
+	case errors.Is(err, crypto.ErrDecryption) || errors.Is(err, crypto.ErrUnknownContentType):
+		return exitDecryption
+	case errors.Is(err, vault.ErrSecretNotFound) || errors.Is(err, vault.ErrSecretExpired) || errors.Is(err, vault.ErrSecretNotYetActive) || errors.Is(err, vault.ErrVersionTagNotFound) || errors.As(err, &responseErr) || errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded):
+		return exitVault
+	case errors.Is(err, config.ErrInvalidConfig) || errors.Is(err, crypto.ErrInvalidRecipient) || errors.Is(err, crypto.ErrKeyEncoding) || errors.Is(err, crypto.ErrKeySize) || errors.Is(err, crypto.ErrWeakKey):
+		return exitConfig
+	default:
+		return exitError
 	}
 }
 
 func init() {
 	cobra.OnInitialize(initConfig)
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is ./.env-sync.yaml)")
-	rootCmd.PersistentFlags().StringVar(&cliKey, "key", "", "Base64 encoded encryption key (overrides all other key sources)")
+	rootCmd.PersistentFlags().StringVar(&cliKey, "key", "", "Base64 or hex encoded encryption key (overrides all other key sources)")
+	rootCmd.PersistentFlags().StringVar(&keyFormat, "key-format", "", "Encoding of the encryption key: auto, base64 or hex (overrides key_format)")
+	rootCmd.RegisterFlagCompletionFunc("key-format", fixedCompletions(crypto.KeyFormats))
 	rootCmd.PersistentFlags().StringVar(&syncFile, "sync-file", "", "sync configuration file (default is ./.env-sync.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&verbose, "verbose", false, "Enable verbose debug output")
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "Only print warnings and errors")
+	rootCmd.MarkFlagsMutuallyExclusive("verbose", "quiet")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "Message format: text (colored) or json (one structured record per message, on stderr)")
+	rootCmd.RegisterFlagCompletionFunc("log-format", fixedCompletions(utils.LogFormats))
+	rootCmd.PersistentFlags().BoolVar(&noColor, "no-color", false, "Disable colored output (also honors NO_COLOR)")
+	rootCmd.PersistentFlags().BoolVar(&skipChecks, "skip-checks", false, "Skip dependency and Azure authentication pre-flight checks (also honors ENVSYNC_SKIP_CHECKS)")
+	rootCmd.PersistentFlags().BoolVar(&enableManagedIdentity, "enable-managed-identity", false, "Try Azure managed identity (default: only when MSI_ENDPOINT or IDENTITY_ENDPOINT is set; overrides enable_managed_identity)")
+	rootCmd.PersistentFlags().BoolVar(&skipChecks, "offline", false, "Alias for --skip-checks, for air-gapped environments")
+	rootCmd.PersistentFlags().StringVar(&envName, "env", "", "Environment name substituted for {{.Env}} in secret_name")
+	rootCmd.PersistentFlags().StringVar(&branchName, "branch", "", "Branch name substituted for {{.Branch}} in secret_name (default: current git branch)")
+	rootCmd.PersistentFlags().StringVar(&vaultURL, "vault-url", "", "Use this Key Vault instead of the configured vault_url")
+	rootCmd.PersistentFlags().BoolVar(&fixPerms, "fix-perms", false, "Restrict env and key files with more permissive modes to their configured mode (default 0600) instead of warning")
+	rootCmd.PersistentFlags().DurationVar(&timeout, "timeout", 30*time.Second, "Timeout for Azure authentication and Key Vault operations (0 disables the timeout)")
 
 	// Add commands
 	rootCmd.AddCommand(initCmd)
@@ -86,46 +217,216 @@ func init() {
 	rootCmd.AddCommand(doctorCmd)
 	rootCmd.AddCommand(pushCmd)
 	rootCmd.AddCommand(pullCmd)
+	rootCmd.AddCommand(setCmd)
+	rootCmd.AddCommand(getCmd)
 	rootCmd.AddCommand(watchCmd)
 	rootCmd.AddCommand(authCmd)
+	rootCmd.AddCommand(whoamiCmd)
 	rootCmd.AddCommand(statusCmd)
 	rootCmd.AddCommand(rotateKeyCmd)
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.AddCommand(verifyCmd)
+	rootCmd.AddCommand(installHookCmd)
+	rootCmd.AddCommand(recipientsCmd)
+	rootCmd.AddCommand(versionsCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(cleanCmd)
+	rootCmd.AddCommand(restoreCmd)
+	recipientsCmd.AddCommand(recipientsKeygenCmd, recipientsAddCmd, recipientsRemoveCmd, recipientsListCmd)
+	rootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configShowCmd, configSetCmd)
 
 	// --- Flag Definitions ---
 
 	// 'init' command flags
 	initCmd.Flags().String("vault-url", "", "Azure Key Vault URL")
 	initCmd.Flags().String("secret-name", "", "The name for the secret in Key Vault")
-	initCmd.Flags().String("key-source", "", "Source for the encryption key (env, file, prompt)")
+	initCmd.Flags().String("key-source", "", "Source for the encryption key (env, file, prompt, kms, keychain, command)")
 	initCmd.Flags().String("key-file", ".env-sync-key", "Path to the key file (if key-source is 'file')")
+	initCmd.Flags().String("kms-key-id", "", "Azure Key Vault key ID used to wrap the data key (if key-source is 'kms')")
+	initCmd.Flags().String("keychain-account", "", "OS keyring account holding the key (if key-source is 'keychain', default \""+config.DefaultKeychainAccount+"\")")
+	initCmd.Flags().String("key-command", "", "Shell command that prints the key (if key-source is 'command')")
 	initCmd.Flags().String("env-file", ".env", "Path to the local .env file")
+	initCmd.Flags().Bool("no-verify", false, "Write the configuration without contacting Azure; the key is still checked locally")
 
 	// 'generate-key' command flags
 	generateKeyCmd.Flags().StringP("output", "o", "", "Save key to a file instead of displaying it")
 	generateKeyCmd.Flags().StringP("format", "f", "base64", "Output format for the key (base64 or hex)")
+	generateKeyCmd.Flags().Bool("to-keychain", false, "Store the key in the OS keyring for key_source 'keychain' instead of displaying it")
+	generateKeyCmd.Flags().String("keychain-account", "", "OS keyring account to store the key under (default: the configured keychain_account)")
+	generateKeyCmd.MarkFlagsMutuallyExclusive("output", "to-keychain")
 
 	// 'install-deps' command flags
 	installDepsCmd.Flags().BoolP("yes", "y", false, "Skip interactive prompts and install all missing dependencies")
-	installDepsCmd.Flags().String("only", "", "Only install specific dependency (azure-cli, tilt)")
+	installDepsCmd.Flags().String("only", "", "Only install specific dependency (azure-cli, tilt, or the command of a configured dependency)")
+	installDepsCmd.RegisterFlagCompletionFunc("only", fixedCompletions(installableDependencies))
 
 	// 'doctor' command flags
-	doctorCmd.Flags().String("check", "", "Check specific component (azure-cli, tilt, auth, config)")
+	doctorCmd.Flags().String("check", "", "Check specific component (azure-cli, tilt, auth, config, key, vault)")
 	doctorCmd.Flags().Bool("fix", false, "Automatically fix detected issues")
+	doctorCmd.Flags().Bool("check-only", false, "Only report status: never prompt, install dependencies or run 'az login' (for CI readiness checks)")
+	doctorCmd.MarkFlagsMutuallyExclusive("fix", "check-only")
+	doctorCmd.RegisterFlagCompletionFunc("check", fixedCompletions(checkComponents))
+
+	// 'push' command flags
+	pushCmd.Flags().String("strategy", "", "Override the configured conflict strategy (manual, local, remote, merge, backup)")
+	pushCmd.Flags().Bool("force", false, "Push even if the file contains conflict markers or plaintext key material, the remote changed since the last pull, or the remote secret wasn't written by env-sync")
+	pushCmd.Flags().Bool("allow-empty", false, "Push an empty or whitespace-only file, clearing the remote secret")
+	pushCmd.Flags().String("backup-before-push", "", "Save the remote secret, still encrypted, to this file before overwriting it ('env-sync restore <file>' pushes it back)")
+	pushCmd.Flags().Bool("show-values", false, "Show conflicting values in full instead of redacted")
+	pushCmd.Flags().String("conflict-report", "", "Write conflicts as JSON to this file and fail with exit code 4 instead of prompting (for CI)")
+	pushCmd.Flags().Bool("stdin", false, "Read the plaintext .env content from stdin instead of the env file")
+	pushCmd.Flags().String("secret-name", "", "Push to this secret instead of the configured secret_name")
+	pushCmd.Flags().String("env-file", "", "Push this file instead of the configured env_file")
+	pushCmd.Flags().String("format", sync.FormatDotenv, "Format of the pushed file or stdin (dotenv, json, yaml); json and yaml objects are flattened to KEY=value")
+	pushCmd.Flags().Bool("stringify", false, "With --format json or yaml, store lists as JSON strings instead of rejecting them")
+	pushCmd.Flags().StringP("message", "m", "", "Note on why the content changed, shown by 'env-sync versions'")
+	pushCmd.Flags().Duration("wait-for-propagation", 0, "After pushing, re-read the secret until the new content is returned, for up to this long (30s when given without a value)")
+	pushCmd.Flags().Lookup("wait-for-propagation").NoOptDefVal = "30s"
+	pushCmd.Flags().String("tag", "", "Move this version tag, such as stable, to the pushed version (or the current one if nothing changed)")
+	pushCmd.RegisterFlagCompletionFunc("strategy", fixedCompletions(strategyNames()))
+	pushCmd.RegisterFlagCompletionFunc("format", fixedCompletions(sync.Formats))
+
+	// 'set' command flags
+	setCmd.Flags().StringArray("delete", nil, "Remove this key from the remote secret (repeatable)")
+	setCmd.Flags().String("secret-name", "", "Edit this secret instead of the configured secret_name")
+	setCmd.Flags().Bool("force", false, "Edit even if the remote secret wasn't written by env-sync or the result contains conflict markers or plaintext key material")
+	setCmd.Flags().StringP("message", "m", "", "Note on why the content changed, shown by 'env-sync versions'")
+
+	// 'get' command flags
+	getCmd.Flags().String("default", "", "Print this instead of failing when the key is absent")
+	getCmd.Flags().String("secret-name", "", "Read this secret instead of the configured secret_name")
+
+	// 'pull' command flags
+	pullCmd.Flags().Bool("stdout", false, "Write the decrypted content to stdout instead of the env file")
+	pullCmd.Flags().String("secret-name", "", "Pull from this secret instead of the configured secret_name")
+	pullCmd.Flags().String("env-file", "", "Write to this file instead of the configured env_file")
+	pullCmd.Flags().String("format", sync.FormatDotenv, "Output format with --stdout or --output (dotenv, json, yaml)")
+	pullCmd.Flags().Bool("force", false, "Pull even if the secret's content type says it wasn't written by env-sync")
+	pullCmd.Flags().Bool("direnv", false, "Make .envrc load the pulled env files and run 'direnv allow' (also set by direnv: true)")
+	pullCmd.Flags().StringP("output", "o", "", "Write the decrypted content to this file instead of the env file, without updating the sync state")
+	pullCmd.Flags().Bool("force-pull", false, "Overwrite the env file with the remote content as-is, backing up a differing local file first")
+	pullCmd.Flags().String("tag", "", "Pull the newest version carrying this version tag, such as stable, instead of the latest version")
+	pullCmd.MarkFlagsMutuallyExclusive("stdout", "output")
+	pullCmd.MarkFlagsMutuallyExclusive("force-pull", "stdout")
+	pullCmd.MarkFlagsMutuallyExclusive("force-pull", "output")
+	pullCmd.RegisterFlagCompletionFunc("format", fixedCompletions(sync.Formats))
+
+	// 'status' command flags
+	statusCmd.Flags().String("secret-name", "", "Check this secret instead of the configured secret_name")
+	statusCmd.Flags().String("env-file", "", "Compare this file instead of the configured env_file")
 
 	// 'rotate-key' command flags
-	rotateKeyCmd.Flags().String("new-key", "", "The new base64 encoded key for re-encryption (required)")
-	rotateKeyCmd.MarkFlagRequired("new-key")
+	rotateKeyCmd.Flags().String("new-key", "", "The new base64 or hex encoded key for re-encryption (generated if omitted)")
+	rotateKeyCmd.Flags().StringP("output", "o", "", "Save the generated key to a file instead of displaying it")
+	rotateKeyCmd.Flags().StringP("format", "f", "base64", "Output format for the generated key (base64 or hex)")
+	rotateKeyCmd.Flags().String("secret-name", "", "Rotate this secret instead of the configured secret_name")
+	rotateKeyCmd.Flags().Bool("rollback", false, "Restore the secrets saved before the last rotation (needs the old key)")
+	rotateKeyCmd.Flags().Bool("dry-run", false, "Check that every secret would rotate cleanly without storing anything")
+	rotateKeyCmd.Flags().Bool("keep-old-readable", false, "Save the old key and add it to previous_keys, so content pushed with it can still be decrypted")
+	rotateKeyCmd.MarkFlagsMutuallyExclusive("rollback", "keep-old-readable")
+	rotateKeyCmd.MarkFlagsMutuallyExclusive("rollback", "new-key")
+	rotateKeyCmd.MarkFlagsMutuallyExclusive("rollback", "output")
+	rotateKeyCmd.MarkFlagsMutuallyExclusive("rollback", "dry-run")
+	rotateKeyCmd.MarkFlagsMutuallyExclusive("dry-run", "output")
 
 	// 'watch' command flags
 	watchCmd.Flags().Bool("push", true, "Enable push on file changes (default: true, with confirmation prompts)")
 	watchCmd.Flags().Bool("confirm", true, "Prompt for confirmation before pushing changes (default: true)")
+	watchCmd.Flags().Bool("confirm-push", true, "Same as --confirm; prompt before each push (requires --push)")
 	watchCmd.Flags().Bool("debug", false, "Enable debug logging for troubleshooting file change detection")
+	watchCmd.Flags().String("strategy", "", "Override the configured conflict strategy (manual, local, remote, merge, backup)")
+	watchCmd.Flags().Bool("show-values", false, "Show conflicting values in full instead of redacted")
+	watchCmd.Flags().String("env-file", "", "Watch and sync this file instead of the configured env_file")
+	watchCmd.Flags().Bool("fail-on-error", false, "Exit at the first failed push or pull instead of retrying")
+	watchCmd.Flags().String("metrics-addr", "", "Serve /healthz and Prometheus /metrics on this address (e.g. :9090)")
+	watchCmd.Flags().String("dir", "", "Watch every env file under this directory matching --pattern, each synced with its own secret")
+	watchCmd.Flags().String("pattern", "*/.env", "Glob, relative to --dir, matching the env files to watch")
+	watchCmd.MarkFlagsMutuallyExclusive("dir", "env-file")
+	watchCmd.RegisterFlagCompletionFunc("strategy", fixedCompletions(strategyNames()))
+
+	// 'versions' command flags
+	versionsCmd.Flags().String("secret-name", "", "List versions of this secret instead of the configured secret_name")
+	versionsCmd.Flags().String("since", "", "Only show versions created after this duration ago (36h, 7d) or date (2024-05-01)")
+	versionsCmd.Flags().Int("limit", 0, "Show at most this many versions (0 for all)")
+	versionsCmd.Flags().Duration("page-delay", 0, "Pause between pages of versions to avoid Key Vault throttling on long histories (counts against --timeout)")
+
+	// 'diff' command flags
+	diffCmd.Flags().String("version", "", "Version to compare with the current version (see 'env-sync versions')")
+	diffCmd.Flags().String("secret-name", "", "Compare versions of this secret instead of the configured secret_name")
+	diffCmd.Flags().Bool("show-values", false, "Show values in full instead of redacted")
+	diffCmd.MarkFlagRequired("version")
+
+	// 'clean' command flags
+	cleanCmd.Flags().BoolP("yes", "y", false, "Remove the files without asking for confirmation")
+	cleanCmd.Flags().Bool("include-env", false, "Also remove the synced env files")
+
+	// 'restore' command flags
+	restoreCmd.Flags().Bool("force", false, "Restore a backup taken from another vault than the configured one")
+
+	// install-hook command flags
+	installHookCmd.Flags().Bool("uninstall", false, "Remove the env-sync pre-commit hook")
+
+	// 'recipients keygen' command flags
+	recipientsKeygenCmd.Flags().StringP("output", "o", "", "Save the private key to a file instead of displaying it")
+	recipientsKeygenCmd.Flags().StringP("format", "f", "base64", "Output format for the private key (base64 or hex)")
+
+	// Config flags
+	configShowCmd.Flags().StringP("format", "f", "yaml", "Output format (yaml, json or toml)")
+	configShowCmd.Flags().Bool("show-values", false, "Show key_command and notify.webhook_url instead of redacting them")
+	configShowCmd.RegisterFlagCompletionFunc("format", fixedCompletions([]string{"yaml", "json", "toml"}))
 }
 
 func main() {
 	Execute()
 }
 
+// registerConfiguredDependencies adds the tools declared under 'dependencies' in cfg to the
+// built-in dependency set. cfg is nil when the config is missing or invalid.
+func registerConfiguredDependencies(cfg *config.Config) error {
+	if cfg == nil {
+		return deps.SetExtraDependencies(nil)
+	}
+	return deps.SetExtraDependencies(cfg.ExtraDependencies())
+}
+
+// applyManagedIdentity decides whether Azure credentials try managed identity: the
+// --enable-managed-identity flag wins over enable_managed_identity, and without either the auth
+// package detects an Azure host. cfg is nil when the config is missing or invalid.
+func applyManagedIdentity(cmd *cobra.Command, cfg *config.Config) {
+	if cmd.Flags().Changed("enable-managed-identity") {
+		enabled := enableManagedIdentity
+		auth.SetManagedIdentity(&enabled)
+		return
+	}
+	if cfg == nil {
+		auth.SetManagedIdentity(nil)
+		return
+	}
+	auth.SetManagedIdentity(cfg.EnableManagedIdentity)
+}
+
+// skipPreflightChecks reports whether --skip-checks, --offline or ENVSYNC_SKIP_CHECKS disable the pre-flight checks
+func skipPreflightChecks() bool {
+	if skipChecks {
+		return true
+	}
+	value := strings.ToLower(strings.TrimSpace(os.Getenv("ENVSYNC_SKIP_CHECKS")))
+	return value != "" && value != "0" && value != "false" && value != "no"
+}
+
+// applyLogLevel sets the shared log level from the --verbose and --quiet flags
+func applyLogLevel() {
+	switch {
+	case verbose:
+		utils.SetLogLevel(utils.LogLevelDebug)
+	case quiet:
+		utils.SetLogLevel(utils.LogLevelQuiet)
+	default:
+		utils.SetLogLevel(utils.LogLevelNormal)
+	}
+}
+
 // getConfigFile returns the configuration file path, prioritizing --sync-file over --config
 func getConfigFile() string {
 	if syncFile != "" {
@@ -134,6 +435,57 @@ func getConfigFile() string {
 	return cfgFile
 }
 
+// checkComponents lists the components accepted by 'doctor --check'
+var checkComponents = []string{"azure-cli", "tilt", "auth", "config", "key", "vault"}
+
+// installableDependencies lists the dependencies accepted by 'install-deps --only'
+var installableDependencies = []string{"azure-cli", "tilt"}
+
+// strategyNames returns the valid conflict strategy names
+func strategyNames() []string {
+	names := make([]string, len(sync.ValidStrategies))
+	for i, strategy := range sync.ValidStrategies {
+		names[i] = string(strategy)
+	}
+	return names
+}
+
+// fixedCompletions returns a flag completion function offering a fixed set of values
+func fixedCompletions(values []string) func(*cobra.Command, []string, string) ([]string, cobra.ShellCompDirective) {
+	return func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return values, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// doctorCheckOnly reports whether doctor runs with --check-only
+func doctorCheckOnly(cmd *cobra.Command) bool {
+	checkOnly, _ := cmd.Flags().GetBool("check-only")
+	return checkOnly
+}
+
+// doctorSeverity lists exit codes from the most to the least severe failure: without a valid
+// configuration and key nothing works, and without a login the vault can't be reached either
+var doctorSeverity = []int{exitConfig, exitAuth, exitVault, exitError}
+
+// mostSevere returns the failure whose exit code comes first in doctorSeverity, or the first failure on a tie
+func mostSevere(failures []error) error {
+	rank := func(err error) int {
+		for i, code := range doctorSeverity {
+			if exitCode(err) == code {
+				return i
+			}
+		}
+		return len(doctorSeverity)
+	}
+	worst := failures[0]
+	for _, err := range failures[1:] {
+		if rank(err) < rank(worst) {
+			worst = err
+		}
+	}
+	return worst
+}
+
 // runSpecificCheck runs a check for a specific component
 func runSpecificCheck(component string, autoFix bool) error {
 	switch component {
@@ -145,8 +497,12 @@ func runSpecificCheck(component string, autoFix bool) error {
 		return checkAuth(autoFix)
 	case "config":
 		return checkConfig(autoFix)
+	case "key":
+		return checkKey(autoFix)
+	case "vault":
+		return checkVault(autoFix)
 	default:
-		return fmt.Errorf("unknown component: %s. Valid options: azure-cli, tilt, auth, config", component)
+		return fmt.Errorf("unknown component: %s. Valid options: %s", component, strings.Join(checkComponents, ", "))
 	}
 }
 
@@ -217,6 +573,386 @@ func checkConfig(autoFix bool) error {
 	return nil
 }
 
+func checkKey(autoFix bool) error {
+	utils.PrintInfo("🔍 Checking encryption key...\n")
+	cfg, err := config.LoadConfig(getConfigFile())
+	if err != nil {
+		utils.PrintError("❌ Cannot check the key without a valid configuration: %v\n", err)
+		return err
+	}
+	if autoFix {
+		utils.PrintInfo("🔑 Key issues cannot be auto-fixed. Use 'env-sync generate-key' to create a key.\n")
+	}
+	return reportKeyStatus(cfg)
+}
+
+// reportKeyStatus loads the configured key and reports whether it is usable, without printing it
+func reportKeyStatus(cfg *config.Config) error {
+	applyKeyFormat(cfg)
+	source := keySourceDescription(cfg)
+	if cliKey == "" && cfg.KeySource == "prompt" {
+		utils.PrintInfo("ℹ️ The key is entered at a prompt when needed, so it can't be checked in advance.\n")
+		return nil
+	}
+
+	ctx, cancel := vaultContext()
+	defer cancel()
+	key, err := cfg.LoadAndValidateKey(ctx, cliKey)
+	if err != nil {
+		err = describeKeyError(err)
+		utils.PrintError("❌ Could not load a valid key from %s: %v\n", source, err)
+		return err
+	}
+	utils.PrintSuccess("✅ Encryption key from %s is valid (%d bytes, fingerprint %s)\n", source, len(key), crypto.KeyFingerprint(key))
+	return nil
+}
+
+func checkVault(autoFix bool) error {
+	utils.PrintInfo("🔍 Checking Key Vault access...\n")
+	cfg, err := config.LoadConfig(getConfigFile())
+	if err != nil {
+		utils.PrintError("❌ Cannot check the vault without a valid configuration: %v\n", err)
+		return err
+	}
+	if autoFix {
+		utils.PrintInfo("🔐 Vault access issues cannot be auto-fixed. Check the network and your Key Vault role assignments.\n")
+	}
+	return reportVaultStatus(cfg)
+}
+
+// reportVaultStatus probes the configured vault and reports whether it is reachable and readable,
+// telling permission problems apart from network problems
+func reportVaultStatus(cfg *config.Config) error {
+	cred, err := auth.CreateAzureCredential()
+	if err != nil {
+		utils.PrintError("❌ Could not create Azure credentials: %v\n", err)
+		return err
+	}
+	return probeVault(cfg, cred)
+}
+
+// probeVault reports whether the configured vault is reachable and readable with cred
+func probeVault(cfg *config.Config, cred azcore.TokenCredential) error {
+	vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+	if err != nil {
+		utils.PrintError("❌ Could not create a client for %s: %v\n", cfg.VaultURL, err)
+		return err
+	}
+
+	ctx, cancel := vaultContext()
+	defer cancel()
+	result, err := vaultClient.Probe(ctx, cfg.SecretName)
+
+	var authErr *azidentity.AuthenticationFailedError
+	switch {
+	case errors.As(err, &authErr):
+		utils.PrintError("❌ Could not authenticate to %s. Run 'az login' or check your credentials.\n", cfg.VaultURL)
+	case result == vault.ProbeOK:
+		utils.PrintSuccess("✅ %s is reachable with read access to '%s' (write access is not checked)\n", cfg.VaultURL, cfg.SecretName)
+	case result == vault.ProbeForbidden:
+		utils.PrintError("❌ %s is reachable but forbidden. Ask for a Key Vault role that can get and set secrets (e.g. 'Key Vault Secrets Officer').\n", cfg.VaultURL)
+	default:
+		utils.PrintError("❌ %s is unreachable. Check the URL, your network and the vault's firewall settings.\n", cfg.VaultURL)
+	}
+	if err != nil {
+		return describeVaultError(ctx, err)
+	}
+	return nil
+}
+
+// verifyInitKey loads the encryption key init was given and checks that it round-trips content
+func verifyInitKey(cfg *config.Config) ([]byte, error) {
+	keyCtx, cancel := vaultContext()
+	encryptionKey, err := cfg.GetEncryptionKey(keyCtx, cliKey)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load encryption key: %w", describeKeyError(err))
+	}
+	if err := crypto.ValidateEncryptionKey(encryptionKey); err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", describeKeyError(err))
+	}
+
+	testData := []byte("encryption test")
+	encrypted, err := crypto.EncryptEnvContent(testData, encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption test failed: %w", err)
+	}
+	decrypted, err := crypto.DecryptEnvContent(encrypted, encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("decryption test failed: %w", err)
+	}
+	if !bytes.Equal(testData, decrypted) {
+		return nil, fmt.Errorf("encryption/decryption mismatch. The key is likely invalid")
+	}
+	utils.PrintSuccess("✅ Encryption key validated successfully.\n")
+	return encryptionKey, nil
+}
+
+// verifyExistingSecret checks that the secret init configures, if it already exists, holds
+// env-sync content this key decrypts, so a teammate with the wrong key finds out before pulling
+func verifyExistingSecret(cfg *config.Config, store envsync.SecretStore, key []byte) error {
+	ctx, cancel := vaultContext()
+	defer cancel()
+	secret, err := store.GetSecretWithProperties(ctx, cfg.SecretName)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		utils.PrintInfo("ℹ️ Secret '%s' doesn't exist yet; 'env-sync push' will create it.\n", cfg.SecretName)
+		return nil
+	}
+	if err != nil {
+		return describeVaultError(ctx, err)
+	}
+	if err := crypto.CheckContentType(secret.ContentType); err != nil {
+		return fmt.Errorf("'%s': %w (use --no-verify to write the configuration anyway)", cfg.SecretName, err)
+	}
+	if _, err := cfg.DecryptContent(secret.Value, key); err != nil {
+		return fmt.Errorf("secret '%s' exists but cannot be decrypted with this key; check you have the team's key (or use --no-verify to write the configuration anyway): %w", cfg.SecretName, err)
+	}
+	utils.PrintSuccess("✅ Existing secret '%s' decrypts with this key.\n", cfg.SecretName)
+	return nil
+}
+
+// authenticateInit creates the Azure credential init checks the vault with, printing login help
+// when it has no valid token
+func authenticateInit() (azcore.TokenCredential, error) {
+	cred, err := auth.CreateAzureCredential()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure credentials during init: %w", err)
+	}
+	if err := auth.CheckToken(context.Background(), cred); err != nil {
+		if errors.Is(err, auth.ErrTimeout) {
+			return nil, err
+		}
+		utils.PrintError("❌ Azure authentication failed. Please run 'az login' and try again.\n")
+		auth.PrintAuthHelp()
+		return nil, fmt.Errorf("authentication required")
+	}
+	return cred, nil
+}
+
+// initKeySources lists the key sources init accepts
+var initKeySources = []string{"env", "file", "prompt", "kms", "keychain", "command"}
+
+// interactiveInit reports whether init may ask for missing flags: only with a terminal on stdin
+// and stdout, so scripts and CI fail fast instead of waiting for input
+var interactiveInit = func() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// initAnswers holds the settings the init wizard fills in
+type initAnswers struct {
+	VaultURL        string
+	SecretName      string
+	KeySource       string
+	KeyFile         string
+	KMSKeyID        string
+	KeychainAccount string
+	KeyCommand      string
+}
+
+// initWizard asks for the init settings missing from the flags, checking each answer before
+// moving on to the next
+type initWizard struct {
+	in           *bufio.Reader
+	out          io.Writer
+	checkVault   func(cfg *config.Config) error // Checks the vault and secret are readable; nil skips the check
+	vaultChecked bool                           // checkVault passed for the final vault URL and secret name
+}
+
+// run asks for each empty vault URL, secret name and key source in a, then for the details of a
+// key source it asked for, offering to generate a key when that source holds none yet
+func (w *initWizard) run(a *initAnswers) error {
+	fmt.Fprintln(w.out, "🧙 Let's set up env-sync. Press Enter to accept the [default], or Ctrl+C to cancel.")
+	askURL, askName, askSource := a.VaultURL == "", a.SecretName == "", a.KeySource == ""
+
+	for {
+		var err error
+		if askURL {
+			if a.VaultURL, err = w.ask("Azure Key Vault URL (e.g. https://myvault.vault.azure.net)", a.VaultURL, vault.ValidateVaultURL); err != nil {
+				return err
+			}
+		}
+		if askName {
+			if a.SecretName, err = w.ask("Secret name", a.SecretName, vault.ValidateSecretName); err != nil {
+				return err
+			}
+		}
+		if w.checkVault == nil {
+			break
+		}
+		err = w.checkVault(&config.Config{VaultURL: a.VaultURL, SecretName: a.SecretName})
+		if err == nil {
+			w.vaultChecked = true
+			break
+		}
+		if !askURL && !askName {
+			return fmt.Errorf("failed to connect to Key Vault '%s': %w", a.VaultURL, err)
+		}
+		// Enter on the same answers retries, e.g. once a role assignment has propagated
+		fmt.Fprintln(w.out, "Fix the vault's access and press Enter to retry, or enter different values.")
+	}
+
+	if askSource {
+		var err error
+		a.KeySource, err = w.ask("Key source ("+strings.Join(initKeySources, ", ")+")", "env", func(source string) error {
+			if !slices.Contains(initKeySources, source) {
+				return fmt.Errorf("unknown key source '%s': expected one of %s", source, strings.Join(initKeySources, ", "))
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return w.askKey(a, askSource)
+}
+
+// askKey asks for the settings the key source needs, and offers to generate a key where the
+// source has none. Details given as flags, or defaulted by them, are only asked for along with
+// the key source itself.
+func (w *initWizard) askKey(a *initAnswers, askSource bool) error {
+	var err error
+	switch a.KeySource {
+	case "env":
+		envVar := config.DefaultKeyEnvVar
+		if cliKey != "" || os.Getenv(envVar) != "" {
+			return nil
+		}
+		return w.offerKey(fmt.Sprintf("%s is not set. Generate a new key", envVar), func(key []byte, format string) error {
+			keyString, err := crypto.KeyToString(key, format)
+			if err != nil {
+				return err
+			}
+			if err := outputKey(key, format, "", envVar, 0); err != nil {
+				return err
+			}
+			// Lets this init check the key; later commands need it exported in the shell
+			utils.PrintInfo("💡 %s is set for this init only. Export it in your shell before running other commands.\n", envVar)
+			return os.Setenv(envVar, keyString)
+		})
+	case "file":
+		if askSource {
+			if a.KeyFile, err = w.ask("Key file", a.KeyFile, required("key file")); err != nil {
+				return err
+			}
+		}
+		if _, statErr := os.Stat(a.KeyFile); cliKey != "" || !errors.Is(statErr, os.ErrNotExist) {
+			return nil
+		}
+		return w.offerKey(fmt.Sprintf("'%s' does not exist. Generate a new key into it", a.KeyFile), func(key []byte, format string) error {
+			return outputKey(key, format, a.KeyFile, config.DefaultKeyEnvVar, (&config.Config{}).KeyFilePerm())
+		})
+	case "keychain":
+		if askSource {
+			account := a.KeychainAccount
+			if account == "" {
+				account = config.DefaultKeychainAccount
+			}
+			if a.KeychainAccount, err = w.ask("OS keyring account", account, required("keyring account")); err != nil {
+				return err
+			}
+		}
+		if _, getErr := keychain.Get(a.KeychainAccount); cliKey != "" || !errors.Is(getErr, keychain.ErrNotFound) {
+			return nil
+		}
+		return w.offerKey(fmt.Sprintf("The OS keyring holds no key for '%s'. Generate one", a.KeychainAccount), func(key []byte, format string) error {
+			return storeKeyInKeychain(key, format, a.KeychainAccount)
+		})
+	case "kms":
+		// ensureWrappedDataKey creates the data key itself when the vault holds none
+		if a.KMSKeyID == "" {
+			a.KMSKeyID, err = w.ask("Key Vault key ID that wraps the data key", "", required("key ID"))
+		}
+	case "command":
+		if a.KeyCommand == "" {
+			a.KeyCommand, err = w.ask("Command that prints the key", "", required("command"))
+		}
+	}
+	return err
+}
+
+// offerKey asks whether to generate a key and, if so, passes a new one to save, in hex when
+// --key-format asks for it and base64 otherwise
+func (w *initWizard) offerKey(question string, save func(key []byte, format string) error) error {
+	answer, err := w.ask(question+"? [Y/n]", "", func(answer string) error {
+		if !slices.Contains([]string{"", "y", "yes", "n", "no"}, strings.ToLower(answer)) {
+			return fmt.Errorf("answer y or n")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if answer = strings.ToLower(answer); answer == "n" || answer == "no" {
+		return nil
+	}
+	key, err := crypto.GenerateEncryptionKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	format := crypto.KeyFormatBase64
+	if keyFormat == crypto.KeyFormatHex {
+		format = crypto.KeyFormatHex
+	}
+	return save(key, format)
+}
+
+// ask prompts until validate accepts the answer, taking def for an empty one. It fails when the
+// input ends first.
+func (w *initWizard) ask(question, def string, validate func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", question)
+		}
+		line, err := w.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(w.out)
+			return "", fmt.Errorf("init canceled: %w", err)
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if err := validate(answer); err != nil {
+			fmt.Fprintf(w.out, "❌ %v\n", err)
+			continue
+		}
+		return answer, nil
+	}
+}
+
+// required rejects an empty answer
+func required(what string) func(string) error {
+	return func(answer string) error {
+		if answer == "" {
+			return fmt.Errorf("a %s is required", what)
+		}
+		return nil
+	}
+}
+
+// keySourceDescription describes where the encryption key is loaded from
+func keySourceDescription(cfg *config.Config) string {
+	if cliKey != "" {
+		return "the --key flag"
+	}
+	switch cfg.KeySource {
+	case "env":
+		return fmt.Sprintf("environment variable %s", cfg.KeyEnvVarName())
+	case "file":
+		return fmt.Sprintf("key file '%s'", cfg.KeyFile)
+	case "kms":
+		return fmt.Sprintf("KMS key %s", cfg.KMSKeyID)
+	case "keychain":
+		return fmt.Sprintf("OS keyring account '%s'", cfg.KeychainAccountName())
+	case "command":
+		return "key_command" // The command line may hold credentials
+	default:
+		return fmt.Sprintf("key source '%s'", cfg.KeySource)
+	}
+}
+
 // autoFixIssues attempts to automatically fix detected issues
 func autoFixIssues(issues []string) error {
 	for _, issue := range issues {
@@ -250,7 +986,15 @@ func installSpecificDependency(depName string, yes bool) error {
 
 	command, exists := commandMap[depName]
 	if !exists {
-		return fmt.Errorf("unknown dependency: %s. Valid options: azure-cli, tilt", depName)
+		// Dependencies declared in the config file are selected by their command
+		for _, dep := range deps.Dependencies() {
+			if dep.Command == depName {
+				command, exists = dep.Command, true
+			}
+		}
+	}
+	if !exists {
+		return fmt.Errorf("unknown dependency: %s. Valid options: %s", depName, strings.Join(installableDependencies, ", "))
 	}
 
 	// Check if it's already installed
@@ -293,62 +1037,114 @@ var initCmd = &cobra.Command{
 	Short: "Initialize project configuration (.env-sync.yaml)",
 	Long: `Initializes the project by creating a .env-sync.yaml configuration file.
 You must provide the Azure Key Vault URL, a name for the secret, and a source for the encryption key.
+Run in a terminal without them, init asks for each one instead, checks the answers as it goes and
+offers to generate a key. Without a terminal the flags stay required, so scripts never hang.
+The vault URL must be an https Key Vault URL such as https://myvault.vault.azure.net, and the
+vault must be reachable with read access to the secret before the configuration is written.
+If the secret already exists, it must decrypt with the given key.
+
+Use --no-verify to write the configuration without contacting Azure, e.g. on a restricted
+network. The key is still loaded and checked locally, except for a KMS-wrapped key.
 
 Use --sync-file to create a configuration file with a custom name:
-  env-sync init --sync-file .env-sync.dev.yaml --vault-url <url> --secret-name <name> --key-source <source>`,
+  env-sync init --sync-file .env-sync.dev.yaml --vault-url <url> --secret-name <name> --key-source <source>
+
+The file is written as TOML or JSON when its name ends in .toml or .json, and as YAML otherwise:
+  env-sync init --sync-file .env-sync.toml --vault-url <url> --secret-name <name> --key-source <source>`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		vaultURL, _ := cmd.Flags().GetString("vault-url")
 		secretName, _ := cmd.Flags().GetString("secret-name")
 		keySource, _ := cmd.Flags().GetString("key-source")
 		keyFile, _ := cmd.Flags().GetString("key-file")
 		envFile, _ := cmd.Flags().GetString("env-file")
+		kmsKeyID, _ := cmd.Flags().GetString("kms-key-id")
+		keychainAccount, _ := cmd.Flags().GetString("keychain-account")
+		keyCommand, _ := cmd.Flags().GetString("key-command")
+		noVerify, _ := cmd.Flags().GetBool("no-verify")
 
+		var cred azcore.TokenCredential
+		vaultChecked := false
 		if vaultURL == "" || secretName == "" || keySource == "" {
-			return fmt.Errorf("--vault-url, --secret-name, and --key-source are required")
-		}
-
-		utils.PrintInfo("🚀 Initializing env-sync configuration...\n")
-
-		// 1. Create credential and vault client to test connectivity
-		cred, err := auth.CreateAzureCredential()
-		if err != nil {
-			return fmt.Errorf("failed to create Azure credentials during init: %w", err)
+			if !interactiveInit() {
+				return fmt.Errorf("--vault-url, --secret-name, and --key-source are required")
+			}
+			wizard := &initWizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+			if !noVerify {
+				// Authenticate first, so the vault can be checked as soon as it is entered
+				var err error
+				if cred, err = authenticateInit(); err != nil {
+					return err
+				}
+				wizard.checkVault = func(cfg *config.Config) error { return probeVault(cfg, cred) }
+			}
+			answers := initAnswers{VaultURL: vaultURL, SecretName: secretName, KeySource: keySource, KeyFile: keyFile, KMSKeyID: kmsKeyID, KeychainAccount: keychainAccount, KeyCommand: keyCommand}
+			if err := wizard.run(&answers); err != nil {
+				return err
+			}
+			vaultURL, secretName, keySource, keyFile = answers.VaultURL, answers.SecretName, answers.KeySource, answers.KeyFile
+			kmsKeyID, keychainAccount, keyCommand = answers.KMSKeyID, answers.KeychainAccount, answers.KeyCommand
+			vaultChecked = wizard.vaultChecked
 		}
-		if !auth.IsAuthenticated(cred) {
-			utils.PrintError("❌ Azure authentication failed. Please run 'az login' and try again.\n")
-			auth.PrintAuthHelp()
-			return fmt.Errorf("authentication required")
+		if keySource == "kms" && kmsKeyID == "" {
+			return fmt.Errorf("--kms-key-id is required when --key-source is 'kms'")
 		}
-		_, err = vault.NewClient(vaultURL, cred)
-		if err != nil {
-			return fmt.Errorf("failed to connect to Key Vault '%s'. Check URL and permissions: %w", vaultURL, err)
+		if keySource == "command" && keyCommand == "" {
+			return fmt.Errorf("--key-command is required when --key-source is 'command'")
 		}
-		utils.PrintSuccess("✅ Azure Key Vault connection successful.\n")
 
-		// 2. Load and validate the encryption key
-		tempConfig := &config.Config{KeySource: keySource, KeyFile: keyFile}
-		encryptionKey, err := tempConfig.GetEncryptionKey(cliKey)
-		if err != nil {
-			return fmt.Errorf("failed to load encryption key: %w", err)
+		// A typo'd URL would otherwise only surface on the first push
+		if err := vault.ValidateVaultURL(vaultURL); err != nil {
+			return fmt.Errorf("invalid --vault-url: %w", err)
 		}
-		if err := crypto.ValidateEncryptionKey(encryptionKey); err != nil {
-			return fmt.Errorf("invalid encryption key: %w", err)
+		tempConfig := &config.Config{VaultURL: vaultURL, SecretName: secretName, KeySource: keySource, KeyFile: keyFile, KeyFormat: keyFormat, KMSKeyID: kmsKeyID, KeychainAccount: keychainAccount, KeyCommand: keyCommand}
+		if err := tempConfig.Validate(); err != nil {
+			return err
 		}
 
-		// 3. Test encryption/decryption with the key
-		testData := []byte("encryption test")
-		encrypted, err := crypto.EncryptEnvContent(testData, encryptionKey)
-		if err != nil {
-			return fmt.Errorf("encryption test failed: %w", err)
-		}
-		decrypted, err := crypto.DecryptEnvContent(encrypted, encryptionKey)
-		if err != nil {
-			return fmt.Errorf("decryption test failed: %w", err)
-		}
-		if !bytes.Equal(testData, decrypted) {
-			return fmt.Errorf("encryption/decryption mismatch. The key is likely invalid")
+		utils.PrintInfo("🚀 Initializing env-sync configuration...\n")
+
+		if noVerify {
+			// Config authoring must work without network access to Azure
+			utils.PrintWarning("⚠️ Skipping the Azure authentication and Key Vault checks (--no-verify).\n")
+			if keySource == "kms" && cliKey == "" {
+				utils.PrintWarning("⚠️ The KMS-wrapped key cannot be checked offline; run 'env-sync doctor --check key' once Azure is reachable.\n")
+			} else if _, err := verifyInitKey(tempConfig); err != nil {
+				return err
+			}
+		} else {
+			// 1. Check authentication and that the vault is reachable
+			if cred == nil {
+				var err error
+				if cred, err = authenticateInit(); err != nil {
+					return err
+				}
+			}
+			if !vaultChecked {
+				if err := probeVault(tempConfig, cred); err != nil {
+					return fmt.Errorf("failed to connect to Key Vault '%s': %w", vaultURL, err)
+				}
+			}
+
+			// 2. Load and validate the encryption key
+			if keySource == "kms" && cliKey == "" {
+				if err := ensureWrappedDataKey(tempConfig); err != nil {
+					return err
+				}
+			}
+			encryptionKey, err := verifyInitKey(tempConfig)
+			if err != nil {
+				return err
+			}
+
+			// 3. Make sure an existing secret was encrypted with this key
+			vaultClient, err := vault.NewClient(vaultURL, cred)
+			if err != nil {
+				return err
+			}
+			if err := verifyExistingSecret(tempConfig, vaultClient, encryptionKey); err != nil {
+				return err
+			}
 		}
-		utils.PrintSuccess("✅ Encryption key validated successfully.\n")
 
 		// 4. Create and write the configuration file
 		finalConfig := &config.Config{
@@ -358,6 +1154,10 @@ Use --sync-file to create a configuration file with a custom name:
 			SyncInterval:     15 * time.Minute,
 			KeySource:        keySource,
 			KeyFile:          keyFile,
+			KeyFormat:        keyFormat,
+			KMSKeyID:         kmsKeyID,
+			KeychainAccount:  keychainAccount,
+			KeyCommand:       keyCommand,
 			ConflictStrategy: "manual",
 			AutoBackup:       false,
 		}
@@ -379,20 +1179,143 @@ Use --sync-file to create a configuration file with a custom name:
 	},
 }
 
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate a shell completion script",
+	Long: `Generates a completion script for the given shell.
+
+Examples:
+  # Bash (current session)
+  source <(env-sync completion bash)
+
+  # Zsh (add to ~/.zshrc)
+  source <(env-sync completion zsh)
+
+  # Fish
+  env-sync completion fish > ~/.config/fish/completions/env-sync.fish
+
+  # PowerShell
+  env-sync completion powershell | Out-String | Invoke-Expression`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	DisableFlagsInUseLine: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		out := os.Stdout
+		switch args[0] {
+		case "bash":
+			return cmd.Root().GenBashCompletionV2(out, true)
+		case "zsh":
+			return cmd.Root().GenZshCompletion(out)
+		case "fish":
+			return cmd.Root().GenFishCompletion(out, true)
+		case "powershell":
+			return cmd.Root().GenPowerShellCompletionWithDesc(out)
+		}
+		return nil
+	},
+}
+
 var generateKeyCmd = &cobra.Command{
 	Use:   "generate-key",
 	Short: "Generate a new 256-bit AES encryption key",
-	Long:  `Generates a cryptographically secure 256-bit key for AES encryption. The key can be displayed in base64 or hex format for manual distribution or saved directly to a file.`,
+	Long: `Generates a cryptographically secure 256-bit key for AES encryption. The key can be displayed in base64 or hex format for manual distribution or saved directly to a file.
+
+Use --to-keychain to store it in the OS keyring (macOS keychain, or the Secret Service through
+secret-tool on Linux) for key_source 'keychain', so it never touches the disk:
+  env-sync generate-key --to-keychain --keychain-account myapp`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		output, _ := cmd.Flags().GetString("output")
 		format, _ := cmd.Flags().GetString("format")
+		toKeychain, _ := cmd.Flags().GetBool("to-keychain")
 
 		key, err := crypto.GenerateEncryptionKey()
 		if err != nil {
 			return fmt.Errorf("failed to generate key: %w", err)
 		}
 
-		keyString, err := crypto.KeyToString(key, format)
+		if toKeychain {
+			account, _ := cmd.Flags().GetString("keychain-account")
+			if account == "" {
+				account = configuredKeychainAccount()
+			}
+			return storeKeyInKeychain(key, format, account)
+		}
+		cfg := configuredOrDefault()
+		return outputKey(key, format, output, cfg.KeyEnvVarName(), cfg.KeyFilePerm())
+	},
+}
+
+// configuredKeychainAccount returns the keychain account from the config file, if one can be loaded
+func configuredKeychainAccount() string {
+	return configuredOrDefault().KeychainAccountName()
+}
+
+// storeKeyInKeychain stores a key in the OS keyring under account, refusing to replace an existing key
+func storeKeyInKeychain(key []byte, format, account string) error {
+	keyString, err := crypto.KeyToString(key, format)
+	if err != nil {
+		return err
+	}
+	// Overwriting a key would leave every secret encrypted with it unreadable
+	if _, err := keychain.Get(account); err == nil {
+		return fmt.Errorf("the OS keyring already holds a key for account '%s'; pass a different --keychain-account", account)
+	} else if !errors.Is(err, keychain.ErrNotFound) {
+		return err
+	}
+	if err := keychain.Set(account, keyString); err != nil {
+		return err
+	}
+
+	utils.PrintSuccess("✅ Encryption key stored in the OS keyring (service '%s', account '%s').\n", keychain.Service, account)
+	if account == config.DefaultKeychainAccount {
+		utils.PrintInfo("📋 Use it by setting key_source: keychain in your configuration.\n")
+	} else {
+		utils.PrintInfo("📋 Use it by setting key_source: keychain and keychain_account: %s in your configuration.\n", account)
+	}
+	return nil
+}
+
+// configuredOrDefault loads the config for commands that work without one, returning an empty
+// config, whose accessors give the defaults, when it is missing or invalid
+func configuredOrDefault() *config.Config {
+	cfg, err := config.LoadConfig(getConfigFile())
+	if err != nil {
+		return &config.Config{}
+	}
+	return cfg
+}
+
+var recipientsCmd = &cobra.Command{
+	Use:   "recipients",
+	Short: "Manage the public keys each push is encrypted to",
+	Long: `With recipients configured, every push wraps its data key to each recipient's public key and
+each team member decrypts with their own private key, so removing someone doesn't mean
+distributing a new shared key. The private key is loaded from the configured key source.
+
+Examples:
+  env-sync recipients keygen -o .env-sync-key    # Create your keypair and print your public key
+  env-sync recipients add envsync1...            # Add a team member's public key
+  env-sync recipients remove envsync1...         # Remove a team member, then push again
+  env-sync recipients list                       # Show the configured recipients`,
+}
+
+var recipientsKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a private key and print its public key",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		output, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+
+		key, err := crypto.GenerateEncryptionKey()
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		publicKey, err := crypto.RecipientPublicKey(key)
+		if err != nil {
+			return err
+		}
+		keyString, err := crypto.KeyToString(key, format)
 		if err != nil {
 			return err
 		}
@@ -401,20 +1324,206 @@ var generateKeyCmd = &cobra.Command{
 			if err := os.WriteFile(output, []byte(keyString), 0600); err != nil {
 				return fmt.Errorf("failed to write key to file '%s': %w", output, err)
 			}
-			utils.PrintSuccess("✅ Encryption key saved to: %s\n", output)
-			utils.PrintWarning("⚠️ IMPORTANT: This file contains a secret. Add it to your .gitignore and do not commit it!\n")
+			utils.PrintSuccess("✅ Private key saved to: %s\n", output)
+			utils.PrintWarning("⚠️ IMPORTANT: This file contains your private key. Add it to your .gitignore and never share it!\n")
 		} else {
-			utils.PrintInfo("🔑 Generated Encryption Key (%s):\n", format)
+			utils.PrintInfo("🔑 Private key (%s), load it through your key source and never share it:\n", format)
 			fmt.Println(keyString)
 			fmt.Println()
-			utils.PrintInfo("📋 Team Distribution Instructions:\n")
-			fmt.Println("1. Share this key securely with your team (e.g., using a password manager).")
-			fmt.Println("2. Each team member should save it as:")
-			fmt.Printf("   a) An environment variable: export ENVSYNC_ENCRYPTION_KEY=\"%s\"\n", keyString)
-			fmt.Printf("   b) Or in a file (e.g., .env-sync-key): echo \"%s\" > .env-sync-key\n", keyString)
-			fmt.Println("3. If using a file, add its name to .gitignore.")
-			fmt.Println()
-			utils.PrintWarning("⚠️ SECURITY: Never commit this key to version control!\n")
+		}
+		utils.PrintInfo("📋 Public key, share it with your team to be added with 'env-sync recipients add':\n")
+		fmt.Println(publicKey)
+		return nil
+	},
+}
+
+var recipientsAddCmd = &cobra.Command{
+	Use:   "add <pubkey>...",
+	Short: "Add public keys to the recipient list",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return updateRecipients(func(cfg *config.Config) ([]string, error) {
+			recipients := cfg.Recipients
+			for _, publicKey := range args {
+				publicKey = strings.TrimSpace(publicKey)
+				if _, err := crypto.ParseRecipient(publicKey); err != nil {
+					return nil, err
+				}
+				if slices.Contains(recipients, publicKey) {
+					utils.PrintInfo("ℹ️ %s is already a recipient.\n", publicKey)
+					continue
+				}
+				recipients = append(recipients, publicKey)
+				utils.PrintSuccess("✅ Added recipient %s\n", publicKey)
+			}
+			return recipients, nil
+		})
+	},
+}
+
+var recipientsRemoveCmd = &cobra.Command{
+	Use:   "remove <pubkey>...",
+	Short: "Remove public keys from the recipient list",
+	Args:  cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		err := updateRecipients(func(cfg *config.Config) ([]string, error) {
+			recipients := cfg.Recipients
+			for _, publicKey := range args {
+				publicKey = strings.TrimSpace(publicKey)
+				i := slices.Index(recipients, publicKey)
+				if i < 0 {
+					return nil, fmt.Errorf("%s is not a recipient", publicKey)
+				}
+				recipients = slices.Delete(recipients, i, i+1)
+				utils.PrintSuccess("✅ Removed recipient %s\n", publicKey)
+			}
+			return recipients, nil
+		})
+		if err != nil {
+			return err
+		}
+		utils.PrintWarning("⚠️ Removed members can still decrypt the versions already stored and anything they pulled; rotate the values they had access to.\n")
+		return nil
+	},
+}
+
+var recipientsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the configured recipients",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if len(cfg.Recipients) == 0 {
+			utils.PrintInfo("ℹ️ No recipients are configured; pushes are encrypted with the shared key.\n")
+			return nil
+		}
+		for _, recipient := range cfg.Recipients {
+			fmt.Println(recipient)
+		}
+		return nil
+	},
+}
+
+// updateRecipients loads the configuration, lets update compute the new recipient list and writes
+// it back to the config file
+func updateRecipients(update func(cfg *config.Config) ([]string, error)) error {
+	path := getConfigFile()
+	if path == "" {
+		path = ".env-sync.yaml"
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	recipients, err := update(cfg)
+	if err != nil {
+		return err
+	}
+	if err := config.WriteRecipients(path, recipients); err != nil {
+		return err
+	}
+	utils.PrintInfo("ℹ️ Push again to re-encrypt the secrets for the new recipient list.\n")
+	return nil
+}
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Show or edit the configuration",
+	Long: `Shows the configuration commands run with, or changes single settings in the config file.
+
+Examples:
+  env-sync config show                       # Print the effective configuration
+  env-sync config show --format json         # Print it as JSON
+  env-sync config set sync_interval=30m      # Change a setting in the config file
+  env-sync config set notify.webhook_url=    # Unset a setting`,
+}
+
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration",
+	Long: `Prints the configuration as commands see it: the config file with defaults applied, secret
+name templates expanded and ENVSYNC_* environment variables taken into account.
+
+key_command and notify.webhook_url can carry credentials, so they are redacted unless
+--show-values is given.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		format, _ := cmd.Flags().GetString("format")
+		showValues, _ := cmd.Flags().GetBool("show-values")
+		if !slices.Contains([]string{"yaml", "json", "toml"}, format) {
+			return fmt.Errorf("unknown format '%s': expected yaml, json or toml", format)
+		}
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if !showValues {
+			if cfg.KeyCommand != "" {
+				cfg.KeyCommand = "[redacted]"
+			}
+			if cfg.Notify.WebhookURL != "" {
+				cfg.Notify.WebhookURL = "[redacted]"
+			}
+		}
+		data, err := cfg.Marshal(format)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set <key>=<value>...",
+	Short: "Change settings in the config file",
+	Long: `Sets keys in the config file, such as sync_interval or notify.webhook_url, and saves it once
+the result is a valid configuration. Durations are written like 15m, lists comma-separated,
+and an empty value unsets a key. File mappings are edited in the config file itself.
+
+The file is rewritten from its settings, so comments in it are not kept.`,
+	Args: cobra.MinimumNArgs(1),
+	ValidArgsFunction: func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		var keys []string
+		for _, key := range config.SettableKeys() {
+			keys = append(keys, key+"=")
+		}
+		return keys, cobra.ShellCompDirectiveNoSpace
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if _, err := parseAssignments(args); err != nil {
+			return err
+		}
+		path := getConfigFile()
+		if path == "" {
+			path = ".env-sync.yaml"
+		}
+		cfg, err := config.ReadConfigFile(path)
+		if err != nil {
+			return err
+		}
+		for _, arg := range args {
+			key, value, _ := strings.Cut(arg, "=")
+			if err := cfg.SetValue(key, value); err != nil {
+				return err
+			}
+		}
+		if err := cfg.ValidateFile(); err != nil {
+			return err
+		}
+		if err := cfg.WriteToFile(path); err != nil {
+			return err
+		}
+		for _, arg := range args {
+			key, value, _ := strings.Cut(arg, "=")
+			if value == "" {
+				utils.PrintSuccess("✅ Unset %s in %s\n", key, path)
+			} else {
+				utils.PrintSuccess("✅ Set %s in %s\n", key, path)
+			}
 		}
 		return nil
 	},
@@ -449,13 +1558,20 @@ var doctorCmd = &cobra.Command{
 It verifies:
 - Installation of required dependencies (Azure CLI)
 - Installation of optional dependencies (Tilt)
+- Installation of any tools declared under 'dependencies' in the config file
 - Azure authentication status
 - Validity of the '.env-sync.yaml' configuration file
+- That the configured key source yields a valid encryption key
+- That the configured Key Vault is reachable and readable
 
 Examples:
   env-sync doctor                    # Full system check
   env-sync doctor --check azure-cli # Check only Azure CLI
-  env-sync doctor --fix             # Automatically fix detected issues`,
+  env-sync doctor --fix             # Automatically fix detected issues
+  env-sync doctor --check-only      # Readiness gate: no prompts, installs or logins
+
+With --check-only, the exit code is that of the most severe failure: 3 for configuration or
+key problems, then 2 for Azure authentication, 5 for Key Vault access and 1 for anything else.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		checkComponent, _ := cmd.Flags().GetString("check")
 		autoFix, _ := cmd.Flags().GetBool("fix")
@@ -465,7 +1581,7 @@ Examples:
 		}
 
 		utils.PrintInfo("🩺 Running system health check...\n\n")
-		hasIssues := false
+		var failures []error
 		var fixableIssues []string
 
 		// 1. Check dependencies
@@ -477,11 +1593,13 @@ Examples:
 		}
 		missing, installed := dm.CheckDependencies()
 		if len(missing) > 0 {
-			hasIssues = true
+			names := make([]string, len(missing))
 			utils.PrintWarning("\nFound %d missing dependencies.\n", len(missing))
-			for _, dep := range missing {
+			for i, dep := range missing {
 				utils.PrintWarning("  - %s (%s)\n", dep.Name, dep.Command)
+				names[i] = dep.Name
 			}
+			failures = append(failures, fmt.Errorf("missing dependencies: %s", strings.Join(names, ", ")))
 			utils.PrintInfo("🔧 To fix, run: env-sync install-deps\n")
 			fixableIssues = append(fixableIssues, "dependencies")
 		} else {
@@ -491,7 +1609,7 @@ Examples:
 		// 2. Check Azure authentication
 		utils.PrintInfo("\n--- Checking Azure Authentication ---\n")
 		if err := auth.CheckAzLoginStatus(); err != nil {
-			hasIssues = true
+			failures = append(failures, fmt.Errorf("%w: %v", auth.ErrNotAuthenticated, err))
 			utils.PrintError("❌ Azure login check failed: %v\n", err)
 			auth.PrintAuthHelp()
 			fixableIssues = append(fixableIssues, "auth")
@@ -503,21 +1621,39 @@ Examples:
 		utils.PrintInfo("\n--- Checking Configuration ---\n")
 		cfg, err := config.LoadConfig(cfgFile)
 		if err != nil {
+			failures = append(failures, err)
 			// It's not a fatal error if the config file doesn't exist yet
 			if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-				hasIssues = true
 				utils.PrintWarning("-> Config file (.env-sync.yaml) not found. Run 'env-sync init' to create one.\n")
 			} else {
-				hasIssues = true
 				utils.PrintError("❌ Could not load config file: %v\n", err)
 			}
 		} else if err := cfg.Validate(); err != nil {
-			hasIssues = true
+			failures = append(failures, err)
 			utils.PrintError("❌ Config file (.env-sync.yaml) is invalid: %v\n", err)
 		} else {
 			utils.PrintSuccess("✅ Config file (.env-sync.yaml) found and is valid.\n")
-			utils.PrintInfo("  - Vault URL: %s\n", cfg.VaultURL)
+			if vaultURL != "" {
+				utils.PrintInfo("  - Vault URL: %s (overridden by --vault-url)\n", cfg.VaultURL)
+			} else {
+				utils.PrintInfo("  - Vault URL: %s\n", cfg.VaultURL)
+			}
 			utils.PrintInfo("  - Secret Name: %s\n", cfg.SecretName)
+			if cfg.ReadOnly {
+				utils.PrintInfo("  - 🔒 Read-only mode: push, rotate-key and watcher pushes are refused\n")
+			}
+
+			// 4. Check the encryption key
+			utils.PrintInfo("\n--- Checking Encryption Key ---\n")
+			if err := reportKeyStatus(cfg); err != nil {
+				failures = append(failures, err)
+			}
+
+			// 5. Check that the vault is reachable and readable
+			utils.PrintInfo("\n--- Checking Key Vault Access ---\n")
+			if err := reportVaultStatus(cfg); err != nil {
+				failures = append(failures, err)
+			}
 		}
 
 		// Auto-fix if requested
@@ -527,8 +1663,11 @@ Examples:
 		}
 
 		// Final summary
-		if hasIssues {
+		if len(failures) > 0 {
 			utils.PrintWarning("\n🩺 Doctor check completed with issues. Please address the items marked with ❌.\n")
+			if doctorCheckOnly(cmd) {
+				return fmt.Errorf("doctor check failed: %w", mostSevere(failures))
+			}
 			if len(fixableIssues) > 0 {
 				utils.PrintInfo("💡 Tip: Use --fix flag to automatically resolve some issues.\n")
 			}
@@ -547,466 +1686,2246 @@ var pushCmd = &cobra.Command{
 uploads it as a new secret version to the specified Azure Key Vault.
 
 Use --sync-file to specify a different configuration file:
-  env-sync push --sync-file .env-sync.dev.yaml`,
+  env-sync push --sync-file .env-sync.dev.yaml
+
+Use --stdin to push content piped from another command, e.g. in CI:
+  cat .env | env-sync push --stdin
+
+Use --format to push a JSON or YAML object instead of a .env file. Nested keys are joined
+with an underscore, so {"db": {"host": "x"}} is stored as db_host=x:
+  env-sync push --format json --env-file config.json
+
+Use --message to record why the content changed; 'env-sync versions' shows it:
+  env-sync push -m "Rotate the Stripe key"
+
+Use --wait-for-propagation to confirm teammates pulling right after will get the new content:
+  env-sync push --wait-for-propagation=1m
+
+Use --conflict-report in CI to write conflicts as JSON instead of prompting; the push then
+fails with exit code 4 (values are redacted unless --show-values is given):
+  env-sync push --conflict-report conflicts.json
+
+Use --backup-before-push to keep the remote secret you are about to overwrite; it stays
+encrypted, and 'env-sync restore' pushes it back if the push was wrong:
+  env-sync push --backup-before-push before-push.json`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		return pushWithConflictDetection(cmd, args, false) // false = not from watcher
 	},
 }
 
-var pullCmd = &cobra.Command{
-	Use:   "pull",
-	Short: "Download and decrypt the .env file from Azure Key Vault",
-	Long: `Retrieves the encrypted secret from Azure Key Vault, decrypts it using the configured key, and writes the content to the local .env file.
+var setCmd = &cobra.Command{
+	Use:   "set KEY=VALUE [KEY=VALUE...]",
+	Short: "Set or delete individual keys in Azure Key Vault without pushing the .env file",
+	Long: `Reads the remote secret, changes only the given keys and stores it again. Every other key,
+comment and line is kept as it is remotely, so local changes that aren't ready are never uploaded.
+The store fails if someone else pushes in between, rather than overwriting their change.
 
-Use --sync-file to specify a different configuration file:
-  env-sync pull --sync-file .env-sync.qa.yaml`,
+  env-sync set STRIPE_KEY=sk_live_123 FEATURE_FLAG=on
+  env-sync set --delete LEGACY_TOKEN
+
+The local .env file is not changed; run 'env-sync pull' to get the edit.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.LoadConfig(getConfigFile())
 		if err != nil {
 			return fmt.Errorf("failed to load configuration: %w", err)
 		}
+		// Fail before the key is loaded or the vault is contacted
+		if err := cfg.CheckWritable("set keys"); err != nil {
+			return err
+		}
+		if err := applySecretNameOverride(cmd, cfg); err != nil {
+			return err
+		}
 		if err := cfg.Validate(); err != nil {
 			return err
 		}
 
-		utils.PrintInfo("⬇️  Pulling secret from %s/%s...\n", cfg.VaultURL, cfg.SecretName)
-
-		key, err := cfg.LoadAndValidateKey(cliKey)
+		deletes, _ := cmd.Flags().GetStringArray("delete")
+		values, err := parseAssignments(args)
 		if err != nil {
 			return err
 		}
+		if len(values) == 0 && len(deletes) == 0 {
+			return fmt.Errorf("nothing to change: pass KEY=VALUE arguments or --delete KEY")
+		}
+		force, _ := cmd.Flags().GetBool("force")
+		message, _ := cmd.Flags().GetString("message")
 
-		cred, err := auth.CreateAzureCredential()
+		key, err := loadKey(cfg)
 		if err != nil {
 			return err
 		}
-		vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+		cred, err := auth.CreateAzureCredential()
 		if err != nil {
 			return err
 		}
-
-		ctx := context.Background()
-		encrypted, err := vaultClient.GetSecret(ctx, cfg.SecretName)
+		store, err := newSecretStore(cfg, cred)
 		if err != nil {
-			return fmt.Errorf("failed to get secret from Key Vault: %w", err)
+			return err
 		}
+		return setKeys(cfg, store, key, primaryMapping(cfg, "set"), envsync.SetOptions{Set: values, Delete: deletes, Force: force, Message: message})
+	},
+}
 
-		// Decrypt the content before writing to file
-		decrypted, err := crypto.DecryptEnvContent(encrypted, key)
-		if err != nil {
-			return fmt.Errorf("failed to decrypt secret: %w", err)
+// parseAssignments parses KEY=VALUE arguments. The value is taken verbatim, so quote it for the shell only.
+func parseAssignments(args []string) (map[string]string, error) {
+	values := make(map[string]string, len(args))
+	for _, arg := range args {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid argument '%s': expected KEY=VALUE", utils.RedactSecrets(arg))
+		}
+		if _, dup := values[name]; dup {
+			return nil, fmt.Errorf("%s is given more than once", name)
 		}
+		values[name] = value
+	}
+	return values, nil
+}
 
-		// Optional: backup existing file
-		// os.Rename(cfg.EnvFile, cfg.EnvFile+".bak")
+// setKeys edits keys of a single secret in place and reports the change
+func setKeys(cfg *config.Config, store envsync.SecretStore, key []byte, mapping config.FileMapping, opts envsync.SetOptions) (err error) {
+	auditEntry := audit.Entry{Action: audit.ActionPush, SecretName: mapping.SecretName}
+	defer func() { recordAudit(cfg, auditEntry, err) }()
 
-		if err := os.WriteFile(cfg.EnvFile, decrypted, 0644); err != nil {
-			return fmt.Errorf("failed to write to env file '%s': %w", cfg.EnvFile, err)
+	opts.Timeout = timeout
+	result, err := envsync.Set(context.Background(), cfg, store, key, mapping, opts)
+	if err != nil {
+		if errors.Is(err, vault.ErrConcurrentModification) {
+			return fmt.Errorf("someone else pushed '%s' at the same time; run the command again to apply your change on top of theirs: %w", mapping.SecretName, err)
 		}
-
-		utils.PrintSuccess("✅ Successfully pulled and decrypted .env from Azure Key Vault.\n")
+		return describePushError(mapping, err)
+	}
+	auditEntry.ContentHash = result.ContentHash
+	if !result.Pushed {
 		return nil
-	},
-}
-
-var watchCmd = &cobra.Command{
-	Use:   "watch",
-	Short: "Monitor the .env file and automatically sync on changes",
-	Long: `Starts a long-running process that watches the local .env file for modifications.
+	}
 
-By default, pushes are enabled with confirmation prompts for safety.
-Use --push=false to disable pushes and only perform periodic pulls.
-Use --confirm flag to control whether you're prompted before each push (default: true).
+	for _, change := range []struct {
+		label string
+		keys  []string
+	}{{"added", result.Added}, {"changed", result.Changed}, {"deleted", result.Deleted}} {
+		if len(change.keys) > 0 {
+			utils.PrintInfo("  %s: %s\n", change.label, strings.Join(change.keys, ", "))
+		}
+	}
+	utils.PrintSuccess("✅ Updated '%s'. Run 'env-sync pull' to bring '%s' up to date.\n", mapping.SecretName, mapping.EnvFile)
+	sendNotification(cfg, notify.Event{Type: notify.EventPush, SecretName: mapping.SecretName, VaultURL: cfg.VaultURL})
+	return nil
+}
 
-The watcher performs periodic pulls at a configurable interval and pushes on file changes.
+var getCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print the value of a single key from Azure Key Vault",
+	Long: `Fetches and decrypts the secret and prints only the value of KEY to stdout, without writing
+the .env file. It fails if the key is absent, unless --default gives a value to print instead.
 
-Use --sync-file to specify a different configuration file:
-  env-sync watch --sync-file .env-sync.prod.yaml
-  env-sync watch --push=false             # Pull-only mode  
-  env-sync watch --confirm=false          # Auto-push without prompts
-  env-sync watch --debug                  # Enable debug logging for troubleshooting`,
+  export DATABASE_URL="$(env-sync get DATABASE_URL)"
+  env-sync get FEATURE_FLAG --default off`,
+	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.LoadConfig(getConfigFile())
 		if err != nil {
-			return fmt.Errorf("failed to load configuration for watcher: %w", err)
+			return fmt.Errorf("failed to load configuration: %w", err)
 		}
-		if err := cfg.Validate(); err != nil {
+		if err := applySecretNameOverride(cmd, cfg); err != nil {
 			return err
 		}
-
-		// Get the push, confirm, and debug flags
-		enablePush, _ := cmd.Flags().GetBool("push")
-		confirmPush, _ := cmd.Flags().GetBool("confirm")
-		debugMode, _ := cmd.Flags().GetBool("debug")
-		
-		// Enable debug logging if requested
-		if debugMode {
-			utils.SetDebugMode(true)
-			utils.PrintDebug("🐛 Debug mode enabled for file watcher\n")
+		if err := cfg.Validate(); err != nil {
+			return err
 		}
 
-		// Ensure the .env file exists before starting the watcher
-		if _, err := os.Stat(cfg.EnvFile); os.IsNotExist(err) {
-			utils.PrintWarning("⚠️ '.env' file not found. Creating an empty one to watch.\n")
-			if err := os.WriteFile(cfg.EnvFile, []byte{}, 0644); err != nil {
-				return fmt.Errorf("failed to create placeholder .env file: %w", err)
-			}
+		key, err := loadKey(cfg)
+		if err != nil {
+			return err
 		}
-
-		ctx, cancel := context.WithCancel(context.Background())
-		defer cancel()
-
-		// Listen for interrupt signals for graceful shutdown
-		sigChan := make(chan os.Signal, 1)
-		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-		go func() {
-			<-sigChan
-			utils.PrintInfo("🛑 Received interrupt signal, shutting down watcher...\n")
-			cancel()
-		}()
-
-		pushFunc := func() error {
-			// Use the enhanced push function with conflict detection
-			return pushWithConflictDetection(cmd, args, true) // true = from watcher
+		cred, err := auth.CreateAzureCredential()
+		if err != nil {
+			return err
 		}
-
-		pullFunc := func() error {
-			// Create a new command to avoid flag parsing issues in a loop
-			pullCmd_instance := &cobra.Command{}
-			*pullCmd_instance = *pullCmd
-			return pullCmd_instance.RunE(cmd, args)
+		store, err := newSecretStore(cfg, cred)
+		if err != nil {
+			return err
 		}
 
-		// Default debounce and sync intervals if not set
-		debounceTime := 5 * time.Second
-		syncInterval := cfg.SyncInterval
-		if syncInterval == 0 {
-			syncInterval = 15 * time.Minute
+		value, err := getKey(cfg, store, key, primaryMapping(cfg, "get"), args[0])
+		if errors.Is(err, envsync.ErrKeyNotFound) && cmd.Flags().Changed("default") {
+			value, err = cmd.Flags().GetString("default")
 		}
-
-		w, err := watcher.NewFileWatcher(cfg.EnvFile, syncInterval, debounceTime, pushFunc, pullFunc, enablePush, confirmPush)
 		if err != nil {
-			return fmt.Errorf("failed to create file watcher: %w", err)
-		}
-
-		utils.PrintInfo("🕐 Starting watcher with a %s pull interval and %s debounce time.\n", syncInterval, debounceTime)
-		if enablePush {
-			utils.PrintInfo("📋 File changes will push to Azure Key Vault, periodic syncs will pull from Azure Key Vault.\n")
-		} else {
-			utils.PrintInfo("📋 File change push disabled - only periodic pulls from Azure Key Vault are active.\n")
+			return err
 		}
-		return w.Start(ctx)
-	},
-}
-
-var authCmd = &cobra.Command{
-	Use:   "auth",
-	Short: "Check Azure authentication status",
-	Long:  `Verifies the current authentication status with Azure by attempting to acquire a token. It provides helpful guidance if authentication fails.`,
-	RunE: func(cmd *cobra.Command, args []string) error {
-		// The PersistentPreRunE already handles the auth check,
-		// so we just need to confirm it passed.
-		utils.PrintSuccess("✅ Azure authentication is configured and valid.\n")
+		fmt.Println(value)
 		return nil
 	},
 }
 
-var statusCmd = &cobra.Command{
-	Use:   "status",
-	Short: "Show a summary of the current configuration and sync status",
-	Long: `Displays the current configuration from the .env-sync.yaml file. It also compares the local .env file's modification time with the secret's last updated time in Azure Key Vault to determine sync status.
+// getKey reads a single key of a secret, recording the read like a pull
+func getKey(cfg *config.Config, store envsync.SecretStore, key []byte, mapping config.FileMapping, name string) (value string, err error) {
+	auditEntry := audit.Entry{Action: audit.ActionPull, SecretName: mapping.SecretName}
+	defer func() { recordAudit(cfg, auditEntry, err) }()
 
-Use --sync-file to specify a different configuration file:
-  env-sync status --sync-file .env-sync.dev.yaml`,
+	ctx, cancel := vaultContext()
+	defer cancel()
+	value, err = envsync.Get(ctx, cfg, store, key, mapping, name)
+	if err != nil && !errors.Is(err, envsync.ErrKeyNotFound) {
+		return "", describeVaultError(ctx, err)
+	}
+	return value, err
+}
+
+var pullCmd = &cobra.Command{
+	Use:   "pull",
+	Short: "Download and decrypt the .env file from Azure Key Vault",
+	Long: `Retrieves the encrypted secret from Azure Key Vault, decrypts it using the configured key, and writes the content to the local .env file.
+
+Use --sync-file to specify a different configuration file:
+  env-sync pull --sync-file .env-sync.qa.yaml
+
+Use --stdout to write the decrypted content to stdout instead of a file:
+  env-sync pull --stdout > .env
+
+Use --format with --stdout or --output to convert it to JSON or YAML for other tools:
+  env-sync pull --stdout --format json | jq .DATABASE_URL
+  env-sync pull --format yaml --output config.yaml
+
+Use --direnv (or 'direnv: true' in the config) to have direnv load the pulled files: .envrc in the
+current directory gets a 'dotenv' line for each env file and 'direnv allow' is run.
+
+Pull never merges: the env file is replaced by the remote content, whatever conflict_strategy says.
+Use --force-pull when the local file is known to be wrong and should still be kept somewhere: it is
+copied to .env-sync-backups beside the env file (or backup_dir) before being overwritten, if it differs.
+  env-sync pull --force-pull
+
+Use --tag to pull the version a promotion tagged, set with 'env-sync push --tag', instead of the
+latest version:
+  env-sync pull --tag stable`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		utils.PrintInfo("📊 --- env-sync Status ---\n")
 		cfg, err := config.LoadConfig(getConfigFile())
 		if err != nil {
 			return fmt.Errorf("failed to load configuration: %w", err)
 		}
+		if err := applySecretNameOverride(cmd, cfg); err != nil {
+			return err
+		}
+		if err := applyEnvFileOverride(cmd, cfg); err != nil {
+			return err
+		}
 		if err := cfg.Validate(); err != nil {
 			return err
 		}
 
-		// Print configuration
-		configFile := getConfigFile()
-		if configFile == "" {
-			configFile = ".env-sync.yaml"
+		toStdout, _ := cmd.Flags().GetBool("stdout")
+		output, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+		force, _ := cmd.Flags().GetBool("force")
+		forcePull, _ := cmd.Flags().GetBool("force-pull")
+		tag, _ := cmd.Flags().GetString("tag")
+		if cmd.Flags().Changed("tag") {
+			if err := vault.ValidateVersionTag(tag); err != nil {
+				return fmt.Errorf("invalid --tag: %w", err)
+			}
 		}
-		utils.PrintInfo("⚙️ Configuration loaded from '%s':\n", configFile)
-		fmt.Printf("  - Vault URL: %s\n", cfg.VaultURL)
-		fmt.Printf("  - Secret Name: %s\n", cfg.SecretName)
-		fmt.Printf("  - Local Env File: %s\n", cfg.EnvFile)
-		fmt.Printf("  - Key Source: %s\n", cfg.KeySource)
-		if cfg.KeySource == "file" {
-			fmt.Printf("  - Key File: %s\n", cfg.KeyFile)
+		if !slices.Contains(sync.Formats, format) {
+			return fmt.Errorf("invalid --format '%s'. Must be one of: %s", format, strings.Join(sync.Formats, ", "))
+		}
+		// Converted content in the env file would be pushed back as-is
+		if format != sync.FormatDotenv && !toStdout && output == "" {
+			return fmt.Errorf("--format %s needs --stdout or --output; the env file is always written as dotenv", format)
 		}
-		fmt.Println()
 
-		// Compare local and remote timestamps
-		// Local file info
-		localFileInfo, err := os.Stat(cfg.EnvFile)
-		if os.IsNotExist(err) {
-			utils.PrintWarning("⚠️ Local .env file not found. Run 'env-sync pull' to fetch it.\n")
-			return nil
-		} else if err != nil {
-			return fmt.Errorf("could not stat local env file: %w", err)
+		key, err := loadKey(cfg)
+		if err != nil {
+			return err
 		}
 
-		// Remote secret info
 		cred, err := auth.CreateAzureCredential()
 		if err != nil {
 			return err
 		}
-		vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+		vaultClient, err := newSecretStore(cfg, cred)
 		if err != nil {
 			return err
 		}
-		secret, err := vaultClient.GetSecret(context.Background(), cfg.SecretName)
-		if err != nil {
-			utils.PrintWarning("⚠️ Could not retrieve remote secret. It may not have been pushed yet.\n")
-			utils.PrintInfo("📁 Local file '%s' exists but has not been synced.\n", cfg.EnvFile)
+
+		if toStdout {
+			return pullMapping(cfg, vaultClient, key, primaryMapping(cfg, "--stdout"), envsync.PullOptions{Out: os.Stdout, Format: format, Force: force, Tag: tag})
+		}
+		if output != "" {
+			if err := pullToFile(cfg, vaultClient, key, primaryMapping(cfg, "--output"), output, envsync.PullOptions{Format: format, Force: force, Tag: tag}); err != nil {
+				return err
+			}
+			utils.PrintSuccess("✅ Wrote the decrypted content as %s to '%s'.\n", format, output)
 			return nil
 		}
 
-		// This is a proxy for the last update time, as the SDK doesn't directly expose it on GetSecret.
-		// A more accurate check would involve GetSecretProperties, but this is a reasonable approximation for status.
-		_, err = crypto.DecryptEnvContent(secret, []byte(cliKey)) // We don't have the key here, so this check is tricky.
-		// For a real implementation, we would just compare timestamps if the SDK provided it easily.
-		// Let's just report what we have.
+		err = forEachMapping("Pulling", cfg.Mappings(), cfg.MaxConcurrency, func(mapping config.FileMapping) error {
+			return pullMapping(cfg, vaultClient, key, mapping, envsync.PullOptions{Force: force, Backup: forcePull, Cache: watchPullCache, Tag: tag})
+		})
+		if err != nil {
+			return err
+		}
+		if useDirenv, _ := cmd.Flags().GetBool("direnv"); useDirenv || cfg.Direnv {
+			return setupDirenv(cfg.Mappings())
+		}
+		return nil
+	},
+}
 
-		fmt.Println("Sync Status:")
-		fmt.Printf("  - Local file last modified: %s\n", localFileInfo.ModTime().Format(time.RFC1123))
-		utils.PrintInfo("☁️ Remote secret is present in Key Vault.\n")
-		utils.PrintWarning("⚠️ To see if content is in sync, please use a diff tool after pulling.\n")
+// pullToFile pulls a secret in opts.Format and writes it to output once the pull succeeded, so a
+// failure keeps the previous export
+func pullToFile(cfg *config.Config, vaultClient envsync.SecretStore, key []byte, mapping config.FileMapping, output string, opts envsync.PullOptions) error {
+	var content bytes.Buffer
+	opts.Out = &content
+	if err := pullMapping(cfg, vaultClient, key, mapping, opts); err != nil {
+		return err
+	}
+	if err := utils.WriteFileMode(output, content.Bytes(), utils.SecretFileMode); err != nil {
+		return fmt.Errorf("failed to write output file '%s': %w", output, err)
+	}
+	return nil
+}
 
+// setupDirenv makes the .envrc in the current directory load every env file and allows it, or
+// prints the lines to add when direnv isn't installed
+func setupDirenv(mappings []config.FileMapping) error {
+	if !direnv.Installed() {
+		utils.PrintWarning("⚠️ direnv is not installed. Once it is, add this to %s and run 'direnv allow':\n", direnv.Envrc)
+		for _, mapping := range mappings {
+			utils.PrintInfo("  %s\n", direnv.DotenvLine(direnv.RelativeEnvFile(".", mapping.EnvFile)))
+		}
 		return nil
-	},
+	}
+
+	for _, mapping := range mappings {
+		changed, err := direnv.EnsureDotenv(".", mapping.EnvFile)
+		if err != nil {
+			return err
+		}
+		if changed {
+			utils.PrintSuccess("✅ %s now loads '%s'.\n", direnv.Envrc, mapping.EnvFile)
+		}
+	}
+	// Allowing is cheap and covers an .envrc that someone else added the lines to
+	if err := direnv.Allow("."); err != nil {
+		return err
+	}
+	utils.PrintDebug("Ran 'direnv allow' for %s\n", direnv.Envrc)
+	return nil
 }
 
-var rotateKeyCmd = &cobra.Command{
-	Use:   "rotate-key",
-	Short: "Generate a new key and re-encrypt the secret in Azure Key Vault",
-	Long: `Rotates the encryption key. It fetches the secret, decrypts it with the old (currently configured) key,
-re-encrypts it with a new key provided via a flag, and updates the secret in Azure Key Vault.
-The new key must then be manually distributed to the team.
+// primaryMapping returns the primary env file mapping, warning that any additional files are ignored by flag
+func primaryMapping(cfg *config.Config, flag string) config.FileMapping {
+	mappings := cfg.Mappings()
+	if len(mappings) > 1 {
+		utils.PrintWarning("⚠️ %s only syncs the primary env file '%s'; the other %d configured files are skipped.\n", flag, mappings[0].EnvFile, len(mappings)-1)
+	}
+	return mappings[0]
+}
+
+// pullMapping pulls a single secret and writes it decrypted to its env file,
+// or to opts.Out in opts.Format instead when it is not nil
+func pullMapping(cfg *config.Config, vaultClient envsync.SecretStore, key []byte, mapping config.FileMapping, opts envsync.PullOptions) (err error) {
+	auditEntry := audit.Entry{Action: audit.ActionPull, SecretName: mapping.SecretName}
+	defer func() { recordAudit(cfg, auditEntry, err) }()
+	log := utils.With("secret", mapping.SecretName, "file", mapping.EnvFile)
+
+	log.PrintInfo("⬇️  Pulling secret from %s/%s...\n", cfg.VaultURL, mapping.SecretName)
+
+	ctx, cancel := vaultContext()
+	defer cancel()
+	result, err := envsync.Pull(ctx, cfg, vaultClient, key, mapping, opts)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		log.PrintWarning("⚠️ No remote secret '%s' yet — run 'env-sync push' first.\n", mapping.SecretName)
+		return nil
+	}
+	if errors.Is(err, crypto.ErrUnknownContentType) {
+		return fmt.Errorf("%w (use --force if it does hold env-sync content)", err)
+	}
+	if err != nil {
+		return describeVaultError(ctx, err)
+	}
+	auditEntry.ContentHash = result.ContentHash
+	if result.Unchanged {
+		log.PrintInfo("✅ '%s' is unchanged since the last pull.\n", mapping.EnvFile)
+		return nil
+	}
+	if result.BackupPath != "" {
+		log.PrintInfo("💾 Backed up the previous '%s' to '%s'.\n", mapping.EnvFile, result.BackupPath)
+	}
+
+	if opts.Out == nil {
+		utils.CheckFilePermissions(mapping.EnvFile, cfg.EnvFilePerm(), fixPerms)
+		log.PrintSuccess("✅ Successfully pulled and decrypted '%s' from Azure Key Vault.\n", mapping.EnvFile)
+		runSyncHook(hooks.EventPostPull, cfg.PostPullHook, mapping.EnvFile)
+	}
+	sendNotification(cfg, notify.Event{Type: notify.EventPull, SecretName: mapping.SecretName, VaultURL: cfg.VaultURL})
+	return nil
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Monitor the .env file and automatically sync on changes",
+	Long: `Starts a long-running process that watches the local .env file for modifications.
+
+By default, pushes are enabled with confirmation prompts for safety.
+Use --push=false to disable pushes and only perform periodic pulls.
+Use --confirm (or --confirm-push) to control whether you're prompted before each push (default: true).
+Confirmation only applies when pushes are enabled with --push.
+
+The watcher performs periodic pulls at a configurable interval and pushes on file changes.
+If the last periodic pull before shutdown failed, watch exits with a non-zero code so a process
+supervisor can tell a degraded watcher apart; --fail-on-error exits at the first failed sync instead.
+--metrics-addr serves /healthz (200 while the watcher runs and its last pull succeeded, 503
+otherwise) and Prometheus counters of pushes, pulls, conflicts and errors on /metrics.
+
+--dir watches every file under a directory matching --pattern (default */.env) instead of the
+configured env files. Each file syncs independently with a secret named after its path relative
+to the directory, appended to secret_name: with secret_name myapp, services/api/.env syncs with
+myapp-api-env. Files created while watching are picked up and synced from then on.
 
 Use --sync-file to specify a different configuration file:
-  env-sync rotate-key --new-key <key> --sync-file .env-sync.prod.yaml`,
+  env-sync watch --sync-file .env-sync.prod.yaml
+  env-sync watch --push=false             # Pull-only mode  
+  env-sync watch --confirm=false          # Auto-push without prompts
+  env-sync watch --debug                  # Enable debug logging for troubleshooting
+  env-sync watch --fail-on-error          # Let a supervisor restart the watcher on sync errors
+  env-sync watch --metrics-addr :9090     # Expose health and metrics endpoints
+  env-sync watch --dir services --pattern '*/.env'  # Sync each service's .env separately`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		cfg, err := config.LoadConfig(getConfigFile())
 		if err != nil {
-			return fmt.Errorf("failed to load configuration: %w", err)
+			return fmt.Errorf("failed to load configuration for watcher: %w", err)
+		}
+		if err := applyEnvFileOverride(cmd, cfg); err != nil {
+			return err
 		}
 		if err := cfg.Validate(); err != nil {
 			return err
 		}
 
-		// 1. Load the old key from the currently configured source
-		utils.PrintInfo("🔑 Loading current (old) encryption key...\n")
-		oldKey, err := cfg.LoadAndValidateKey(cliKey) // cliKey will be empty if not passed, respecting priority
-		if err != nil {
-			return fmt.Errorf("could not load the old key from source '%s': %w", cfg.KeySource, err)
+		// Get the push, confirm, and debug flags
+		enablePush, _ := cmd.Flags().GetBool("push")
+		confirmPush, _ := cmd.Flags().GetBool("confirm")
+		if cmd.Flags().Changed("confirm-push") {
+			confirmPush, _ = cmd.Flags().GetBool("confirm-push")
+			if confirmPush && !enablePush {
+				utils.PrintWarning("⚠️ --confirm-push has no effect with --push=false\n")
+			}
+		}
+		debugMode, _ := cmd.Flags().GetBool("debug")
+		
+		// Enable debug logging if requested
+		if debugMode {
+			utils.SetDebugMode(true)
+			utils.PrintDebug("🐛 Debug mode enabled for file watcher\n")
 		}
 
-		// 2. Get the new key from the flag
-		newKeyRaw, _ := cmd.Flags().GetString("new-key")
-		if newKeyRaw == "" {
-			return fmt.Errorf("--new-key flag is required and must contain the new base64 encoded key")
+		dir, _ := cmd.Flags().GetString("dir")
+		pattern, _ := cmd.Flags().GetString("pattern")
+		if cmd.Flags().Changed("pattern") && dir == "" {
+			return fmt.Errorf("--pattern needs --dir")
 		}
-		newKey, err := base64.StdEncoding.DecodeString(newKeyRaw)
-		if err != nil {
-			return fmt.Errorf("invalid base64 format for --new-key: %w", err)
+
+		// Ensure the .env file exists before starting the watcher
+		if _, err := os.Stat(cfg.EnvFile); dir == "" && os.IsNotExist(err) {
+			utils.PrintWarning("⚠️ '%s' not found. Creating an empty one to watch.\n", cfg.EnvFile)
+			if err := os.WriteFile(cfg.EnvFile, []byte{}, cfg.EnvFilePerm()); err != nil {
+				return fmt.Errorf("failed to create placeholder .env file: %w", err)
+			}
 		}
-		if err := crypto.ValidateEncryptionKey(newKey); err != nil {
-			return fmt.Errorf("new key is invalid: %w", err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// Listen for interrupt signals for graceful shutdown
+		sigChan := make(chan os.Signal, 1)
+		signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+		go func() {
+			<-sigChan
+			utils.PrintInfo("🛑 Received interrupt signal, shutting down watcher...\n")
+			cancel()
+		}()
+
+		pushFunc := func() error {
+			// Use the enhanced push function with conflict detection
+			return recordWatchConflict(pushWithConflictDetection(cmd, args, true)) // true = from watcher
 		}
 
-		if bytes.Equal(oldKey, newKey) {
-			return fmt.Errorf("the new key cannot be the same as the old key")
+		// Periodic pulls skip decrypting and rewriting files whose secret hasn't changed
+		watchPullCache = envsync.NewPullCache()
+		defer func() { watchPullCache = nil }()
+
+
+		// Default debounce and sync intervals if not set
+		debounceTime := cfg.DebounceInterval
+		if debounceTime == 0 {
+			debounceTime = config.DefaultDebounceInterval
+		}
+		syncInterval := cfg.SyncInterval
+		if syncInterval == 0 {
+			syncInterval = 15 * time.Minute
+		}
+		if debounceTime >= syncInterval {
+			utils.PrintWarning("⚠️ debounce_interval (%s) is not shorter than sync_interval (%s); periodic pulls may run before changes are pushed.\n", debounceTime, syncInterval)
+		}
+
+		var metrics *watcher.Metrics
+		if metricsAddr, _ := cmd.Flags().GetString("metrics-addr"); metricsAddr != "" {
+			metrics = watcher.NewMetrics()
+			stopped, err := metrics.Serve(ctx, metricsAddr)
+			if err != nil {
+				return err
+			}
+			watchMetrics = metrics
+			defer func() {
+				watchMetrics = nil
+				cancel()
+				<-stopped
+			}()
+		}
+
+		failOnError, _ := cmd.Flags().GetBool("fail-on-error")
+		newWatcher := func(envFile string, push, pull func() error) (*watcher.FileWatcher, error) {
+			w, err := watcher.NewFileWatcher(envFile, syncInterval, debounceTime, push, pull, enablePush, confirmPush)
+			if err != nil {
+				return nil, fmt.Errorf("failed to create file watcher: %w", err)
+			}
+			if cfg.PostPullQuiet > 0 {
+				w.PostPullQuiet = cfg.PostPullQuiet
+			}
+			if cfg.LocalOverlay != "" {
+				w.IgnorePaths = append(w.IgnorePaths, cfg.LocalOverlay)
+			}
+			w.FailOnError = failOnError
+			w.Metrics = metrics
+			return w, nil
 		}
-		utils.PrintSuccess("✅ New key loaded and validated.\n")
 
-		// 3. Fetch the secret from Key Vault
-		utils.PrintInfo("⬇️ Fetching current secret from Azure Key Vault...\n")
+		utils.PrintInfo("🕐 Starting watcher with a %s pull interval and %s debounce time.\n", syncInterval, debounceTime)
+		if enablePush && cfg.ReadOnly {
+			utils.PrintWarning("🔒 Read-only mode is active: file changes will be refused instead of pushed; use --push=false to watch for pulls only.\n")
+		} else if enablePush {
+			utils.PrintInfo("📋 File changes will push to Azure Key Vault, periodic syncs will pull from Azure Key Vault.\n")
+		} else {
+			utils.PrintInfo("📋 File change push disabled - only periodic pulls from Azure Key Vault are active.\n")
+		}
+		if dir != "" {
+			return watchDir(ctx, cmd, cfg, dir, pattern, newWatcher)
+		}
+		key, err := loadKey(cfg)
+		if err != nil {
+			return fmt.Errorf("failed to load encryption key: %w", err)
+		}
 		cred, err := auth.CreateAzureCredential()
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to create Azure credentials: %w", err)
 		}
-		vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+		vaultClient, err := newSecretStore(cfg, cred)
 		if err != nil {
-			return err
+			return fmt.Errorf("failed to create Key Vault client: %w", err)
 		}
-		ctx := context.Background()
-		encryptedContent, err := vaultClient.GetSecret(ctx, cfg.SecretName)
+		w, err := newWatcher(cfg.EnvFile, pushFunc, watchPull(cfg, vaultClient, key))
 		if err != nil {
-			return fmt.Errorf("failed to get secret '%s' for rotation: %w", cfg.SecretName, err)
+			return err
 		}
+		return w.Start(ctx)
+	},
+}
 
-		// 4. Perform the rotation (decrypt with old, encrypt with new)
-		utils.PrintInfo("🔄 Re-encrypting secret with the new key...\n")
-		newEncryptedContent, err := crypto.RotateKey(oldKey, newKey, encryptedContent)
+// watchPull returns the watcher's periodic pull of every configured env file
+func watchPull(cfg *config.Config, vaultClient envsync.SecretStore, key []byte) func() error {
+	return func() error {
+		err := forEachMapping("Pulling", cfg.Mappings(), cfg.MaxConcurrency, func(mapping config.FileMapping) error {
+			return pullMapping(cfg, vaultClient, key, mapping, envsync.PullOptions{Cache: watchPullCache})
+		})
 		if err != nil {
-			return fmt.Errorf("key rotation failed during re-encryption: %w", err)
+			return err
 		}
-
-		// 5. Store the newly encrypted secret back in the vault
-		if err := vaultClient.StoreSecret(ctx, cfg.SecretName, newEncryptedContent); err != nil {
-			return fmt.Errorf("failed to store re-encrypted secret in Key Vault: %w", err)
+		if cfg.Direnv {
+			return setupDirenv(cfg.Mappings())
 		}
-
-		utils.PrintSuccess("\n🎉 Key rotated successfully in Azure Key Vault!\n")
-		utils.PrintWarning("🚨 IMPORTANT: You must now securely distribute the new key to your team.\n")
-		utils.PrintInfo("🔧 They will need to update their key source (e.g., ENVSYNC_ENCRYPTION_KEY) before they can 'pull' again.\n")
 		return nil
-	},
+	}
 }
 
-// pushWithConflictDetection performs a push operation with conflict detection and resolution
-func pushWithConflictDetection(cmd *cobra.Command, args []string, fromWatcher bool) error {
-	cfg, err := config.LoadConfig(getConfigFile())
+// watchDir syncs every env file under dir matching pattern with its own secret, starting a file
+// watcher for each one as it is found, until ctx is done or a watcher fails
+func watchDir(ctx context.Context, cmd *cobra.Command, cfg *config.Config, dir, pattern string, newWatcher func(envFile string, push, pull func() error) (*watcher.FileWatcher, error)) error {
+	dir, err := filepath.Abs(dir)
 	if err != nil {
-		return fmt.Errorf("failed to load configuration: %w", err)
+		return fmt.Errorf("invalid --dir: %w", err)
 	}
-
-	// Get the encryption key
-	key, err := cfg.LoadAndValidateKey(cliKey)
+	if strategy, _ := cmd.Flags().GetString("strategy"); strategy != "" {
+		if !sync.IsValidStrategy(strategy) {
+			return fmt.Errorf("invalid --strategy '%s'. Valid options: %s", strategy, strings.Join(strategyNames(), ", "))
+		}
+		cfg.ConflictStrategy = strategy
+	}
+	key, err := loadKey(cfg)
 	if err != nil {
 		return fmt.Errorf("failed to load encryption key: %w", err)
 	}
-
-	// Create Azure credentials and vault client
 	cred, err := auth.CreateAzureCredential()
 	if err != nil {
 		return fmt.Errorf("failed to create Azure credentials: %w", err)
 	}
-
-	vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+	vaultClient, err := newSecretStore(cfg, cred)
 	if err != nil {
 		return fmt.Errorf("failed to create Key Vault client: %w", err)
 	}
+	opts := pushOptions{fromWatcher: true}
+	opts.showValues, _ = cmd.Flags().GetBool("show-values")
 
-	ctx := context.Background()
-
-	// Read the current local .env file
-	localContent, err := os.ReadFile(cfg.EnvFile)
+	g, ctx := errgroup.WithContext(ctx)
+	synced := make(map[string]string) // Env file of each secret; only used by the directory watcher's goroutine
+	dirWatcher, err := watcher.NewDirWatcher(dir, pattern, func(envFile string) {
+		mapping, err := cfg.DirMapping(dir, envFile)
+		if err != nil {
+			utils.PrintWarning("⚠️ Skipping '%s': %v\n", envFile, err)
+			return
+		}
+		if other, ok := synced[mapping.SecretName]; ok {
+			utils.PrintWarning("⚠️ Skipping '%s': '%s' already syncs with secret '%s'\n", envFile, other, mapping.SecretName)
+			return
+		}
+		w, err := newWatcher(envFile,
+			func() error { return recordWatchConflict(pushMapping(cfg, vaultClient, key, mapping, opts)) },
+			func() error {
+				return pullMapping(cfg, vaultClient, key, mapping, envsync.PullOptions{Cache: watchPullCache})
+			},
+		)
+		if err != nil {
+			utils.PrintWarning("⚠️ Skipping '%s': %v\n", envFile, err)
+			return
+		}
+		synced[mapping.SecretName] = envFile
+		utils.PrintInfo("📂 Syncing '%s' with secret '%s'\n", envFile, mapping.SecretName)
+		g.Go(func() error {
+			if err := w.Start(ctx); err != nil {
+				return fmt.Errorf("%s: %w", envFile, err)
+			}
+			return nil
+		})
+	})
 	if err != nil {
-		return fmt.Errorf("failed to read .env file from '%s': %w", cfg.EnvFile, err)
+		return err
 	}
+	utils.PrintInfo("🔍 Watching '%s' for files matching '%s'\n", dir, pattern)
+	g.Go(func() error { return dirWatcher.Start(ctx) })
+	return g.Wait()
+}
 
-	// Try to get the current remote version to check for conflicts
-	var remoteContent []byte
-	var hasRemote bool
-	
-	if encrypted, err := vaultClient.GetSecret(ctx, cfg.SecretName); err == nil {
-		if decrypted, err := crypto.DecryptEnvContent(encrypted, key); err == nil {
-			remoteContent = decrypted
-			hasRemote = true
-		} else {
-			utils.PrintWarning("⚠️ Could not decrypt remote content (possible key mismatch), proceeding with push...\n")
-		}
-	} else {
-		utils.PrintInfo("ℹ️ No remote version found, this will be the first push.\n")
+// recordWatchConflict counts a watcher push the remote refused because it changed meanwhile, for
+// --metrics-addr, and returns err
+func recordWatchConflict(err error) error {
+	if errors.Is(err, sync.ErrRemoteChanged) || errors.Is(err, vault.ErrConcurrentModification) {
+		watchMetrics.RecordConflict()
 	}
+	return err
+}
+
+var authCmd = &cobra.Command{
+	Use:   "auth",
+	Short: "Check Azure authentication status",
+	Long:  `Verifies the current authentication status with Azure by attempting to acquire a token. It provides helpful guidance if authentication fails.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// The PersistentPreRunE already handles the auth check,
+		// so we just need to confirm it passed.
+		utils.PrintSuccess("✅ Azure authentication is configured and valid.\n")
+		return nil
+	},
+}
 
-	// Check for conflicts if we have both local and remote content
-	if hasRemote && len(remoteContent) > 0 {
-		// Create conflict resolver
-		conflictStrategy := sync.ConflictStrategyManual
-		if cfg.ConflictStrategy != "" {
-			switch cfg.ConflictStrategy {
-			case "local":
-				conflictStrategy = sync.ConflictStrategyLocal
-			case "remote":
-				conflictStrategy = sync.ConflictStrategyRemote
-			case "merge":
-				conflictStrategy = sync.ConflictStrategyMerge
-			case "backup":
-				conflictStrategy = sync.ConflictStrategyBackup
+var whoamiCmd = &cobra.Command{
+	Use:   "whoami",
+	Short: "Show the Azure identity and tenant env-sync authenticates as",
+	Long: `Tries the credential chain env-sync uses (Azure CLI, then managed identity if enabled, then
+the AZURE_* environment variables) and reports which credential acquired a Key Vault token,
+together with the identity and tenant in that token. Run it before pushing to production to
+make sure you are not signed in to the wrong account or tenant.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		identity, err := auth.WhoAmI(context.Background())
+		if err != nil {
+			if !errors.Is(err, auth.ErrTimeout) {
+				auth.PrintAuthHelp()
 			}
+			return err
 		}
 
-		// For push operations, we want to detect actual key conflicts, not just content differences
-		// We'll check if local and remote have different values for the same keys
-		localEnv, err := parseEnvContentForPush(string(localContent))
-		if err != nil {
-			return fmt.Errorf("failed to parse local .env content: %w", err)
+		if identity.Name != "" {
+			utils.PrintInfo("👤 Identity:   %s\n", identity.Name)
 		}
-		
-		remoteEnv, err := parseEnvContentForPush(string(remoteContent))
+		if identity.AppID != "" {
+			utils.PrintInfo("🤖 App ID:     %s\n", identity.AppID)
+		}
+		utils.PrintInfo("🆔 Object ID:  %s\n", identity.ObjectID)
+		utils.PrintInfo("🏢 Tenant:     %s\n", identity.TenantID)
+		utils.PrintInfo("🔑 Credential: %s\n", identity.Credential)
+		utils.PrintDebug("Token expires at %s\n", identity.ExpiresOn.Local().Format(time.RFC3339))
+		return nil
+	},
+}
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show a summary of the current configuration and sync status",
+	Long: `Displays the current configuration from the .env-sync.yaml file. It also compares the local .env file's modification time with the secret's last updated time in Azure Key Vault to report which side is newer.
+
+Use --sync-file to specify a different configuration file:
+  env-sync status --sync-file .env-sync.dev.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		utils.PrintInfo("📊 --- env-sync Status ---\n")
+		cfg, err := config.LoadConfig(getConfigFile())
 		if err != nil {
-			return fmt.Errorf("failed to parse remote .env content: %w", err)
+			return fmt.Errorf("failed to load configuration: %w", err)
 		}
-		
-		// Find actual conflicts (same key, different values)
-		var conflictingKeys []string
-		for key, localValue := range localEnv {
-			if remoteValue, exists := remoteEnv[key]; exists && localValue != remoteValue {
-				conflictingKeys = append(conflictingKeys, key)
-			}
+		if err := applySecretNameOverride(cmd, cfg); err != nil {
+			return err
 		}
-		
-		var conflict *ConflictInfo
-		if len(conflictingKeys) > 0 {
-			conflict = &ConflictInfo{
-				ConflictTime:  time.Now(),
-				LocalChanges:  localEnv,
-				RemoteChanges: remoteEnv,
-				Conflicts:     conflictingKeys,
-			}
+		if err := applyEnvFileOverride(cmd, cfg); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
 		}
 
-		if conflict != nil {
-			utils.PrintWarning("⚠️ Conflict detected! Remote version has different values.\n\n")
-			
-			// Show the conflicts
-			utils.PrintInfo("🔍 Conflicting keys:\n")
-			for _, key := range conflict.Conflicts {
-				localValue := conflict.LocalChanges[key]
-				remoteValue := conflict.RemoteChanges[key]
-				utils.PrintInfo("  • %s:\n", key)
-				utils.PrintInfo("    Local:  %s\n", localValue)
-				utils.PrintInfo("    Remote: %s\n", remoteValue)
-			}
-			utils.PrintInfo("\n")
-
-			// Ask user what to do
-			if fromWatcher {
-				// In watcher mode, respect the configured strategy or ask
-				if conflictStrategy == sync.ConflictStrategyManual {
-					if !promptUserForConflictResolution("Push with local changes") {
-						utils.PrintInfo("⏭️ Push cancelled by user.\n")
-						return nil
-					}
-				} else {
-					utils.PrintInfo("🔧 Using configured conflict strategy: %s\n", cfg.ConflictStrategy)
-				}
-			} else {
-				// In manual push mode, always ask for confirmation
-				if !promptUserForConflictResolution("Push with local changes (this will overwrite remote)") {
-					utils.PrintInfo("⏭️ Push cancelled by user.\n")
-					return nil
+		// Print configuration
+		configFile := getConfigFile()
+		if configFile == "" {
+			configFile = ".env-sync.yaml"
+		}
+		utils.PrintInfo("⚙️ Configuration loaded from '%s':\n", configFile)
+		fmt.Printf("  - Vault URL: %s\n", cfg.VaultURL)
+		if cfg.SecretPrefix != "" {
+			fmt.Printf("  - Secret Name: %s (secret_prefix '%s')\n", cfg.SecretName, cfg.SecretPrefix)
+		} else {
+			fmt.Printf("  - Secret Name: %s\n", cfg.SecretName)
+		}
+		fmt.Printf("  - Local Env File: %s\n", cfg.EnvFile)
+		if cfg.LocalOverlay != "" {
+			fmt.Printf("  - Local Overlay (never synced): %s\n", cfg.LocalOverlay)
+		}
+		fmt.Printf("  - Key Source: %s\n", cfg.KeySource)
+		if cfg.KeySource == "file" {
+			fmt.Printf("  - Key File: %s\n", cfg.KeyFile)
+		}
+		fmt.Println()
+
+		// Compare local and remote timestamps
+		cred, err := auth.CreateAzureCredential()
+		if err != nil {
+			return err
+		}
+		vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := vaultContext()
+		defer cancel()
+		status, err := envsync.Status(ctx, cfg, vaultClient, cfg.Mappings()[0])
+		if err != nil {
+			return describeVaultError(ctx, err)
+		}
+		if !status.LocalExists {
+			utils.PrintWarning("⚠️ Local .env file not found. Run 'env-sync pull' to fetch it.\n")
+			return nil
+		}
+		if !status.RemoteExists {
+			utils.PrintWarning("⚠️ Could not retrieve remote secret. It may not have been pushed yet.\n")
+			utils.PrintInfo("📁 Local file '%s' exists but has not been synced.\n", cfg.EnvFile)
+			return nil
+		}
+
+		fmt.Println("Sync Status:")
+		fmt.Printf("  - Local file last modified: %s\n", status.LocalModTime.Format(time.RFC1123))
+		if !status.UpdatedOn.IsZero() {
+			fmt.Printf("  - Remote secret last updated: %s\n", status.UpdatedOn.Local().Format(time.RFC1123))
+		}
+		if pushedBy, ok := status.Tags[vault.TagPushedBy]; ok {
+			fmt.Printf("  - Last pushed by: %s\n", pushedBy)
+		}
+		if hostname, ok := status.Tags[vault.TagHostname]; ok {
+			fmt.Printf("  - Pushed from host: %s\n", hostname)
+		}
+		if contentHash, ok := status.Tags[vault.TagContentHash]; ok {
+			fmt.Printf("  - Content hash: %s\n", contentHash)
+		}
+		if notBefore := status.Attributes.NotBefore; !notBefore.IsZero() {
+			fmt.Printf("  - Active from: %s\n", notBefore.Local().Format(time.RFC1123))
+		}
+		if expires := status.Attributes.Expires; !expires.IsZero() {
+			fmt.Printf("  - Expires: %s\n", expires.Local().Format(time.RFC1123))
+		}
+		fmt.Println()
+
+		if warning := secretExpiryWarning(cfg.SecretName, status.Attributes, time.Now()); warning != "" {
+			utils.PrintWarning("%s\n", warning)
+		}
+
+		switch status.Comparison {
+		case envsync.LocalNewer:
+			utils.PrintWarning("⬆️ Local file is newer than the remote secret. Run 'env-sync push' to upload your changes.\n")
+		case envsync.RemoteNewer:
+			utils.PrintWarning("⬇️ Remote secret is newer than the local file. Run 'env-sync pull' to fetch the latest version.\n")
+		case envsync.Unknown:
+			utils.PrintInfo("☁️ Remote secret is present in Key Vault, but its update time is unavailable.\n")
+		default:
+			utils.PrintSuccess("✅ Local file and remote secret are in sync.\n")
+		}
+
+		return nil
+	},
+}
+
+// expiryWarningWindow is how long before a secret's expiry date status starts warning about it
+const expiryWarningWindow = 7 * 24 * time.Hour
+
+// secretExpiryWarning describes why a secret can't be pulled at now, or that it expires soon.
+// It returns an empty string if the secret is fine.
+func secretExpiryWarning(secretName string, attrs vault.SecretAttributes, now time.Time) string {
+	switch {
+	case !attrs.NotBefore.IsZero() && now.Before(attrs.NotBefore):
+		return fmt.Sprintf("⏳ '%s' is not active until %s; pulls fail until then.", secretName, attrs.NotBefore.Local().Format(time.RFC1123))
+	case attrs.Expires.IsZero():
+		return ""
+	case !now.Before(attrs.Expires):
+		return fmt.Sprintf("⚠️ '%s' expired on %s; pulls fail until it is pushed again.", secretName, attrs.Expires.Local().Format(time.RFC1123))
+	case attrs.Expires.Sub(now) <= expiryWarningWindow:
+		return fmt.Sprintf("⚠️ '%s' expires in %s, on %s; push it again to renew it.", secretName, attrs.Expires.Sub(now).Round(time.Minute), attrs.Expires.Local().Format(time.RFC1123))
+	default:
+		return ""
+	}
+}
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Verify that the remote secret decrypts and parses with your key",
+	Long: `Fetches every configured secret from Azure Key Vault, decrypts it with the configured key,
+and parses the result as .env content. Reports the number of keys on success, or the precise
+failure (missing secret, base64 decoding, key mismatch, GCM authentication, or parse error).
+Exits non-zero on any failure, making it suitable for CI checks before a deploy.
+
+Use --sync-file to specify a different configuration file:
+  env-sync verify --sync-file .env-sync.prod.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		key, err := loadKey(cfg)
+		if err != nil {
+			return err
+		}
+
+		cred, err := auth.CreateAzureCredential()
+		if err != nil {
+			return err
+		}
+		vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+		if err != nil {
+			return err
+		}
+
+		vaultClient.MaxConcurrency = cfg.MaxConcurrency
+
+		ctx, cancel := vaultContext()
+		defer cancel()
+		mappings := cfg.Mappings()
+		names := make([]string, len(mappings))
+		for i, mapping := range mappings {
+			names[i] = mapping.SecretName
+		}
+		secrets, fetchErr := vaultClient.GetSecrets(ctx, names)
+
+		var errs []error
+		if fetchErr != nil {
+			errs = append(errs, describeVaultError(ctx, fetchErr))
+		}
+		for _, mapping := range mappings {
+			encrypted, ok := secrets[mapping.SecretName]
+			if !ok {
+				utils.PrintError("❌ %s: could not fetch secret\n", mapping.SecretName)
+				continue
+			}
+
+			keyCount, err := verifySecret(encrypted, key)
+			if err != nil {
+				utils.PrintError("❌ %s: %v\n", mapping.SecretName, err)
+				if len(mappings) > 1 {
+					err = fmt.Errorf("%s: %w", mapping.EnvFile, err)
 				}
+				errs = append(errs, err)
+				continue
+			}
+
+			utils.PrintSuccess("✅ %s: decrypts and parses successfully (%d keys)\n", mapping.SecretName, keyCount)
+		}
+		return errors.Join(errs...)
+	},
+}
+
+var versionsCmd = &cobra.Command{
+	Use:   "versions",
+	Short: "List the stored versions of the remote secret",
+	Long: `Lists every version of the configured secret in Azure Key Vault, newest first, with when it
+was created and who pushed it. Values are not fetched or decrypted.
+
+Use --since to only show versions created after a point in time, given as a duration
+(e.g. 36h or 7d) or a date (2024-05-01 or RFC 3339), and --limit to cap the output:
+  env-sync versions --since 7d
+  env-sync versions --limit 5`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if err := applySecretNameOverride(cmd, cfg); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		var since time.Time
+		if value, _ := cmd.Flags().GetString("since"); value != "" {
+			if since, err = parseSince(value, time.Now()); err != nil {
+				return err
+			}
+		}
+		limit, _ := cmd.Flags().GetInt("limit")
+		if limit < 0 {
+			return fmt.Errorf("--limit must not be negative")
+		}
+		pageDelay, _ := cmd.Flags().GetDuration("page-delay")
+		if pageDelay < 0 {
+			return fmt.Errorf("--page-delay must not be negative")
+		}
+
+		cred, err := auth.CreateAzureCredential()
+		if err != nil {
+			return err
+		}
+		vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+		if err != nil {
+			return err
+		}
+		vaultClient.PageDelay = pageDelay
+
+		ctx, cancel := vaultContext()
+		defer cancel()
+		versions, err := vaultClient.ListSecretVersions(ctx, cfg.SecretName)
+		if err != nil {
+			return describeVaultError(ctx, err)
+		}
+		total := len(versions)
+		versions = filterVersions(versions, since, limit)
+
+		utils.PrintInfo("📜 Versions of '%s' (showing %d of %d):\n", cfg.SecretName, len(versions), total)
+		printVersions(os.Stdout, versions)
+		return nil
+	},
+}
+
+// parseSince parses a --since value: a duration before now such as 36h or 7d, or a date
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(value); err == nil && d >= 0 {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since '%s': use a duration such as 36h or 7d, or a date such as 2024-05-01", value)
+}
+
+// filterVersions keeps the versions created after since (when set), at most limit of them (when positive)
+func filterVersions(versions []vault.SecretVersion, since time.Time, limit int) []vault.SecretVersion {
+	var filtered []vault.SecretVersion
+	for _, version := range versions {
+		if !since.IsZero() && version.CreatedOn.Before(since) {
+			continue
+		}
+		if limit > 0 && len(filtered) == limit {
+			break
+		}
+		filtered = append(filtered, version)
+	}
+	return filtered
+}
+
+// printVersions writes one line per version with its creation time, push tags and version tags
+func printVersions(out io.Writer, versions []vault.SecretVersion) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tCREATED\tPUSHED BY\tHOST\tCONTENT HASH\tMESSAGE")
+	for _, version := range versions {
+		id := version.Version
+		if !version.Enabled {
+			id += " (disabled)"
+		}
+		if tags := vault.VersionTags(version.Tags); len(tags) > 0 {
+			id += " [" + strings.Join(tags, ", ") + "]"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", id, version.CreatedOn.Local().Format(time.RFC1123),
+			orDash(version.Tags[vault.TagPushedBy]), orDash(version.Tags[vault.TagHostname]), orDash(shortHash(version.Tags[vault.TagContentHash])),
+			orDash(version.Tags[vault.TagMessage]))
+	}
+	w.Flush()
+}
+
+// orDash returns value, or "-" when it is empty
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+// shortHash shortens a content hash for display
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+var cleanCmd = &cobra.Command{
+	Use:   "clean",
+	Short: "Remove env-sync's local files, for when a project stops using it",
+	Long: `Lists the files env-sync keeps next to your project (the configuration file, sync state,
+locks, conflict and rotation backups, and the key file) and removes them after confirmation.
+The env files are kept unless --include-env is given. Secrets in Key Vault are never touched.
+
+Examples:
+  env-sync clean                  # List the files and ask before removing them
+  env-sync clean --yes            # Remove them without asking
+  env-sync clean --include-env    # Also remove the synced env files`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		yes, _ := cmd.Flags().GetBool("yes")
+		includeEnv, _ := cmd.Flags().GetBool("include-env")
+
+		configFile := getConfigFile()
+		if configFile == "" {
+			configFile = ".env-sync.yaml"
+		}
+		// A broken or half-removed config still leaves the default files to clean up
+		cfg, err := config.LoadConfig(configFile)
+		if err != nil {
+			utils.PrintWarning("⚠️ Could not load '%s', looking for the default files only: %v\n", configFile, err)
+			cfg = &config.Config{EnvFile: ".env", KeySource: "file", KeyFile: ".env-sync-key"}
+		}
+
+		artifacts := cleanArtifacts(cfg, configFile, includeEnv)
+		if len(artifacts) == 0 {
+			utils.PrintInfo("ℹ️ No env-sync files found.\n")
+			return nil
+		}
+
+		utils.PrintInfo("🧹 These files will be removed (secrets in Key Vault are kept):\n")
+		for _, path := range artifacts {
+			fmt.Printf("  %s\n", path)
+		}
+		if !includeEnv {
+			utils.PrintInfo("ℹ️ Env files are kept; pass --include-env to remove them too.\n")
+		}
+		if cfg.KeySource == "file" && slices.Contains(artifacts, filepath.Clean(cfg.KeyFile)) {
+			utils.PrintWarning("⚠️ This includes the key file '%s'. Without another copy of the key, the pushed secrets can't be decrypted.\n", cfg.KeyFile)
+		}
+		if !yes && !promptUserForConflictResolution(fmt.Sprintf("Remove %d file(s)", len(artifacts))) {
+			utils.PrintInfo("⏭️ Nothing removed.\n")
+			return nil
+		}
+
+		var failed int
+		for _, path := range artifacts {
+			if err := os.RemoveAll(path); err != nil {
+				utils.PrintError("❌ Failed to remove '%s': %v\n", path, err)
+				failed++
+				continue
+			}
+			utils.PrintSuccess("🗑️ Removed %s\n", path)
+		}
+		if failed > 0 {
+			return fmt.Errorf("failed to remove %d of %d file(s)", failed, len(artifacts))
+		}
+		return nil
+	},
+}
+
+// cleanArtifacts returns the local files env-sync created for cfg that exist, in removal order.
+// Env files are only included with includeEnv.
+func cleanArtifacts(cfg *config.Config, configFile string, includeEnv bool) []string {
+	if cfg.EnvFile == "" {
+		cfg.EnvFile = ".env"
+	}
+	var candidates []string
+	for _, mapping := range cfg.Mappings() {
+		candidates = append(candidates,
+			sync.ConfiguredStatePath(cfg, mapping.EnvFile),
+			sync.LockPath(mapping.EnvFile),
+		)
+		// A configured backup_dir may hold other files, so only the backups themselves go
+		if cfg.BackupDir == "" {
+			candidates = append(candidates, cfg.BackupDirFor(mapping.EnvFile))
+		} else if backups, err := cfg.BackupFiles(mapping.EnvFile); err == nil {
+			candidates = append(candidates, backups...)
+		}
+		if includeEnv {
+			candidates = append(candidates, mapping.EnvFile)
+		}
+	}
+	candidates = append(candidates, envsync.RotationBackupPath(cfg), ".env-sync-backups")
+	if cfg.KeySource == "file" && cfg.KeyFile != "" {
+		candidates = append(candidates, cfg.KeyFile)
+	}
+	candidates = append(candidates, configFile)
+
+	var artifacts []string
+	seen := make(map[string]bool)
+	for _, path := range candidates {
+		// filepath.Clean turns an empty path into ".", the whole directory
+		if path == "" {
+			continue
+		}
+		path = filepath.Clean(path)
+		if seen[path] {
+			continue
+		}
+		seen[path] = true
+		if _, err := os.Lstat(path); err == nil {
+			artifacts = append(artifacts, path)
+		}
+	}
+	return artifacts
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show what changed between a stored version and the current secret",
+	Long: `Decrypts a historical version of the secret and the current version, and lists the keys
+that were added, removed or changed between them. Values are redacted unless --show-values
+is given. List version IDs with 'env-sync versions'.
+
+Examples:
+  env-sync diff --version 3f2a...        # What changed since version 3f2a...
+  env-sync diff --version 3f2a... --show-values`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		if err := applySecretNameOverride(cmd, cfg); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		version, _ := cmd.Flags().GetString("version")
+		showValues, _ := cmd.Flags().GetBool("show-values")
+
+		key, err := loadKey(cfg)
+		if err != nil {
+			return err
+		}
+
+		cred, err := auth.CreateAzureCredential()
+		if err != nil {
+			return err
+		}
+		vaultClient, err := vault.NewClient(cfg.VaultURL, cred)
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := vaultContext()
+		defer cancel()
+		diff, older, newer, err := diffVersion(ctx, vaultClient, key, cfg.SecretName, version)
+		if err != nil {
+			return describeVaultError(ctx, err)
+		}
+
+		utils.PrintInfo("🔍 Changes from version %s to the current version of '%s':\n", version, cfg.SecretName)
+		printEnvDiff(os.Stdout, diff, older, newer, showValues)
+		return nil
+	},
+}
+
+// versionReader reads the current and historical values of a secret
+type versionReader interface {
+	GetSecret(ctx context.Context, secretName string) (string, error)
+	GetSecretVersion(ctx context.Context, secretName, version string) (string, error)
+}
+
+// diffVersion decrypts a historical version and the current version of a secret and compares them
+func diffVersion(ctx context.Context, store versionReader, key []byte, secretName, version string) (*sync.EnvDiff, map[string]string, map[string]string, error) {
+	encryptedOld, err := store.GetSecretVersion(ctx, secretName, version)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	encryptedCurrent, err := store.GetSecret(ctx, secretName)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	older, err := decryptEnv(encryptedOld, key)
+	if err != nil {
+		if errors.Is(err, crypto.ErrDecryption) {
+			return nil, nil, nil, fmt.Errorf("cannot decrypt version %s with the current key; it may predate a key rotation: %w", version, err)
+		}
+		return nil, nil, nil, fmt.Errorf("version %s: %w", version, err)
+	}
+	newer, err := decryptEnv(encryptedCurrent, key)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("current version: %w", err)
+	}
+	return sync.DiffEnv(older, newer), older, newer, nil
+}
+
+// decryptEnv decrypts and parses an encrypted secret value
+func decryptEnv(encrypted string, key []byte) (map[string]string, error) {
+	decrypted, err := crypto.DecryptEnvContent(encrypted, key)
+	if err != nil {
+		return nil, err
+	}
+	env, err := sync.ParseEnvContent(string(decrypted))
+	if err != nil {
+		return nil, fmt.Errorf("decrypted content is not valid .env content: %w", err)
+	}
+	return env, nil
+}
+
+// printEnvDiff writes one line per added (+), removed (-) or changed (~) key
+func printEnvDiff(out io.Writer, diff *sync.EnvDiff, older, newer map[string]string, showValues bool) {
+	if diff.Empty() {
+		fmt.Fprintln(out, "No differences.")
+		return
+	}
+	display := func(value string) string {
+		if showValues {
+			return value
+		}
+		return utils.Redact(value)
+	}
+	for _, key := range diff.Added {
+		fmt.Fprintf(out, "+ %s=%s\n", key, display(newer[key]))
+	}
+	for _, key := range diff.Removed {
+		fmt.Fprintf(out, "- %s=%s\n", key, display(older[key]))
+	}
+	for _, key := range diff.Changed {
+		fmt.Fprintf(out, "~ %s: %s → %s\n", key, display(older[key]), display(newer[key]))
+	}
+	fmt.Fprintf(out, "%d added, %d removed, %d changed\n", len(diff.Added), len(diff.Removed), len(diff.Changed))
+}
+
+var installHookCmd = &cobra.Command{
+	Use:   "install-hook",
+	Short: "Install a git pre-commit hook that blocks committing plaintext secrets",
+	Long: `Installs a git pre-commit hook that refuses commits which would add the configured
+.env files or key file in plaintext. Existing hook content is preserved, and running the
+command again updates the protected paths instead of installing a second copy.
+
+Remove the hook with:
+  env-sync install-hook --uninstall`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uninstall, _ := cmd.Flags().GetBool("uninstall")
+
+		repoDir, err := os.Getwd()
+		if err != nil {
+			return err
+		}
+
+		if uninstall {
+			found, err := githook.Uninstall(repoDir)
+			if err != nil {
+				return err
+			}
+			if !found {
+				utils.PrintInfo("ℹ️ No env-sync pre-commit hook is installed.\n")
+				return nil
+			}
+			utils.PrintSuccess("✅ Removed the env-sync pre-commit hook.\n")
+			return nil
+		}
+
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+
+		var paths []string
+		for _, mapping := range cfg.Mappings() {
+			paths = append(paths, mapping.EnvFile)
+		}
+		paths = append(paths, cfg.LocalOverlay, cfg.KeyFile)
+
+		protected, err := githook.RepoRelativePaths(repoDir, paths)
+		if err != nil {
+			return err
+		}
+		if len(protected) == 0 {
+			return fmt.Errorf("none of the configured env or key files are inside this git repository")
+		}
+
+		alreadyInstalled, err := githook.Install(repoDir, protected)
+		if err != nil {
+			return err
+		}
+		if alreadyInstalled {
+			utils.PrintInfo("ℹ️ The env-sync pre-commit hook was already installed; protected files updated.\n")
+		} else {
+			utils.PrintSuccess("✅ Installed the env-sync pre-commit hook.\n")
+		}
+		utils.PrintInfo("   Protected files: %s\n", strings.Join(protected, ", "))
+		return nil
+	},
+}
+
+// verifySecret decrypts and parses an encrypted secret, returning the number of keys.
+// Errors identify which stage failed.
+func verifySecret(encrypted string, key []byte) (int, error) {
+	decrypted, err := crypto.DecryptEnvContent(encrypted, key)
+	if err != nil {
+		var corrupt base64.CorruptInputError
+		var mismatch *crypto.KeyMismatchError
+		var notRecipient *crypto.NotRecipientError
+		switch {
+		case errors.As(err, &corrupt):
+			return 0, fmt.Errorf("base64 decode failed: %w", err)
+		case errors.As(err, &mismatch):
+			return 0, fmt.Errorf("key mismatch: %w", err)
+		case errors.As(err, &notRecipient):
+			return 0, fmt.Errorf("not a recipient: %w", err)
+		default:
+			return 0, fmt.Errorf("GCM authentication failed (wrong key or corrupted data): %w", err)
+		}
+	}
+
+	env, err := sync.ParseEnvContent(string(decrypted))
+	if err != nil {
+		return 0, fmt.Errorf("decrypted content is not valid .env content: %w", err)
+	}
+	return len(env), nil
+}
+
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Generate a new key and re-encrypt the secrets in Azure Key Vault",
+	Long: `Rotates the encryption key. It fetches every configured secret (secret_name and any 'files' mappings),
+decrypts them with the old (currently configured) key, re-encrypts them with a new key, and updates them in Azure Key Vault.
+Secrets are only stored once all of them have been re-encrypted successfully.
+If --new-key is omitted, a fresh random key is generated and displayed (or saved with --output).
+The new key must then be manually distributed to the team.
+
+With key_source 'kms', the new data key is instead wrapped with kms_key_id and stored in the
+wrapped key secret once the re-encrypted secrets are stored, so there is nothing to distribute.
+
+Before storing anything, the encrypted secrets are saved to .env-sync-rotation-backup.json next to
+the env file. If distributing the new key goes wrong, --rollback restores them; it needs the old key
+(from the configured source or --key), except with kms, where the saved wrapped key is unwrapped.
+
+--dry-run goes through every step up to storing: it loads both keys, fetches each secret, checks
+that it decrypts with the old key and that the re-encrypted content decrypts with the new key.
+Nothing is written to the vault or to the backup file, and a generated key is discarded.
+
+--keep-old-readable starts a grace period for members who haven't got the new key yet: the old key
+is saved to .env-sync-previous-key-<time> next to the env file and added to previous_keys in the
+config file. Pulls and pushes try those keys when the current key fails, so content a straggler
+pushes with the old key can still be read by everyone with the new key (and is moved to the new
+key when pushed again). Stragglers themselves still need the new key to read anything rotated.
+The tradeoff: until the entry and the file are removed, anyone who holds the old key (perhaps the
+reason for rotating) can still push content the team will accept, so keep the grace period short.
+
+Examples:
+  env-sync rotate-key                              # Generate a new key and rotate
+  env-sync rotate-key --dry-run --new-key <key>    # Check that a rotation would succeed
+  env-sync rotate-key --output .env-sync-key.new   # Save the generated key to a file
+  env-sync rotate-key --new-key <key>              # Rotate to a key you provide
+  env-sync rotate-key --rollback --key <old-key>   # Undo the last rotation
+  env-sync rotate-key --keep-old-readable          # Keep reading content pushed with the old key
+
+Use --sync-file to specify a different configuration file:
+  env-sync rotate-key --new-key <key> --sync-file .env-sync.prod.yaml`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		applyKeyFormat(cfg)
+		if err := applySecretNameOverride(cmd, cfg); err != nil {
+			return err
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		if err := cfg.CheckWritable("rotate the key"); err != nil {
+			return err
+		}
+		if len(cfg.Recipients) > 0 {
+			return fmt.Errorf("rotate-key needs a shared key, but recipients are configured; use 'env-sync recipients add/remove' and push again instead")
+		}
+		if rollback, _ := cmd.Flags().GetBool("rollback"); rollback {
+			return rollbackRotation(cfg)
+		}
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if dryRun {
+			utils.PrintInfo("🧪 Dry run: nothing will be stored in Azure Key Vault.\n")
+		}
+		keepOldReadable, _ := cmd.Flags().GetBool("keep-old-readable")
+		if keepOldReadable && cfg.KeySource == "kms" {
+			return fmt.Errorf("--keep-old-readable is not needed with key_source 'kms': everyone unwraps the new key on their next pull")
+		}
+
+		// 1. Load the old key from the currently configured source
+		utils.PrintInfo("🔑 Loading current (old) encryption key...\n")
+		keyCtx, cancel := vaultContext()
+		oldKey, err := cfg.GetEncryptionKey(keyCtx, cliKey) // cliKey will be empty if not passed, respecting priority
+		cancel()
+		if err == nil {
+			err = crypto.ValidateKeySize(oldKey)
+		}
+		if err != nil {
+			return fmt.Errorf("could not load the old key from source '%s': %w", cfg.KeySource, describeKeyError(err))
+		}
+		// A weak old key is exactly what rotation should move away from, so only warn
+		if err := crypto.ValidateEncryptionKey(oldKey); err != nil {
+			utils.PrintWarning("⚠️ The current key is weak (%v); rotating to a stronger key.\n", err)
+		}
+
+		// 2. Get the new key from the flag, or generate one
+		newKeyRaw, _ := cmd.Flags().GetString("new-key")
+		output, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+		generated := newKeyRaw == ""
+
+		var newKey []byte
+		if generated {
+			newKey, err = crypto.GenerateEncryptionKey()
+			if err != nil {
+				return fmt.Errorf("failed to generate new key: %w", err)
+			}
+			// Fail on a bad format before touching the vault
+			if _, err := crypto.KeyToString(newKey, format); err != nil {
+				return err
+			}
+		} else {
+			newKey, err = crypto.DecodeKeyFormat(newKeyRaw, cfg.KeyFormat)
+			if err != nil {
+				return fmt.Errorf("invalid --new-key: %w", describeKeyError(err))
+			}
+		}
+		if err := crypto.ValidateEncryptionKey(newKey); err != nil {
+			return fmt.Errorf("new key is invalid: %w", describeKeyError(err))
+		}
+
+		if bytes.Equal(oldKey, newKey) {
+			return fmt.Errorf("the new key cannot be the same as the old key")
+		}
+		utils.PrintSuccess("✅ New key loaded and validated.\n")
+
+		// With kms the secrets are only readable through the wrapped data key, so wrap the
+		// new key up front: a KMS failure then stops the rotation before anything changes
+		var keyProvider *kms.EnvelopeKeyProvider
+		var wrappedNewKey string
+		if cfg.KeySource == "kms" {
+			keyProvider, err = cfg.KeyProvider()
+			if err != nil {
+				return err
+			}
+			wrapCtx, cancel := vaultContext()
+			wrappedNewKey, err = keyProvider.WrapDataKey(wrapCtx, newKey)
+			cancel()
+			if err != nil {
+				return fmt.Errorf("failed to wrap the new data key with '%s': %w", cfg.KMSKeyID, err)
+			}
+		}
+
+		// 3. Fetch every mapped secret from Key Vault
+		utils.PrintInfo("⬇️ Fetching current secrets from Azure Key Vault...\n")
+		cred, err := auth.CreateAzureCredential()
+		if err != nil {
+			return err
+		}
+		vaultClient, err := newSecretStore(cfg, cred)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := vaultContext()
+		defer cancel()
+		mappings := cfg.Mappings()
+
+		// 4. Re-encrypt all secrets before storing any of them,
+		// so a failure cannot leave some secrets on the old key and some on the new
+		utils.PrintInfo("🔄 Re-encrypting %d secret(s) with the new key...\n", len(mappings))
+		rotateOpts := envsync.RotateOptions{BackupFile: envsync.RotationBackupPath(cfg), DryRun: dryRun}
+		if keyProvider != nil {
+			rotateOpts.BackupSecrets = []string{keyProvider.WrappedKeySecret}
+		}
+		result, err := envsync.Rotate(ctx, cfg, vaultClient, oldKey, newKey, rotateOpts)
+		if dryRun {
+			if err != nil {
+				return fmt.Errorf("rotation would fail: %w", describeVaultError(ctx, err))
+			}
+			for _, secretName := range result.Verified {
+				fmt.Printf("   • %s\n", secretName)
+			}
+			utils.PrintSuccess("✅ Rotation would succeed: %d secret(s) decrypt with the old key and re-encrypt cleanly with the new one. Nothing was changed.\n", len(result.Verified))
+			return nil
+		}
+		if result != nil {
+			for _, stored := range result.Stored {
+				recordAudit(cfg, audit.Entry{Action: audit.ActionRotate, SecretName: stored.SecretName, ContentHash: stored.ContentHash}, nil)
+			}
+			if result.Failed != "" {
+				recordAudit(cfg, audit.Entry{Action: audit.ActionRotate, SecretName: result.Failed}, err)
+				utils.PrintError("❌ Rotation incomplete: %d of %d secret(s) are already on the new key.\n", len(result.Stored), len(mappings))
+				if len(result.Stored) > 0 {
+					showRecoveryKey(newKey, format, cfg.KeyEnvVarName())
+				}
+			}
+		}
+		if err != nil {
+			return describeVaultError(ctx, err)
+		}
+
+		// Switch the wrapped data key last, once every secret is readable with it
+		if keyProvider != nil {
+			if err := keyProvider.StoreWrappedDataKey(ctx, wrappedNewKey); err != nil {
+				utils.PrintError("❌ Rotation incomplete: all secrets are on the new key, but it could not be stored in '%s'.\n", keyProvider.WrappedKeySecret)
+				showRecoveryKey(newKey, format, cfg.KeyEnvVarName())
+				return fmt.Errorf("failed to store the wrapped data key: %w", describeVaultError(ctx, err))
+			}
+			utils.PrintSuccess("✅ New data key wrapped with '%s' and stored in '%s'.\n", cfg.KMSKeyID, keyProvider.WrappedKeySecret)
+		}
+
+		utils.PrintInfo("📋 Rotated secrets:\n")
+		for _, mapping := range mappings {
+			fmt.Printf("   • %s (%s)\n", mapping.SecretName, mapping.EnvFile)
+		}
+
+		sendNotification(cfg, notify.Event{Type: notify.EventRotate, SecretName: cfg.SecretName, VaultURL: cfg.VaultURL})
+
+		utils.PrintSuccess("\n🎉 Key rotated successfully in Azure Key Vault!\n")
+		utils.PrintInfo("💾 The previous secrets are saved in '%s'; 'env-sync rotate-key --rollback' restores them.\n", rotateOpts.BackupFile)
+		if keepOldReadable {
+			if err := keepOldKeyReadable(cfg, oldKey); err != nil {
+				utils.PrintWarning("⚠️ The old key could not be kept readable: %v\n", err)
+			}
+		}
+		if keyProvider != nil {
+			// The KMS hands the new key to everyone with access, so it is only written out on request
+			if output != "" {
+				if err := outputKey(newKey, format, output, cfg.KeyEnvVarName(), cfg.KeyFilePerm()); err != nil {
+					utils.PrintWarning("⚠️ %v\n", err)
+				}
+			}
+			utils.PrintInfo("🔐 Team members need no changes: the new key is unwrapped with '%s' on their next pull.\n", cfg.KMSKeyID)
+			return nil
+		}
+		if generated {
+			if err := outputKey(newKey, format, output, cfg.KeyEnvVarName(), cfg.KeyFilePerm()); err != nil {
+				// The vault already uses the new key, so never lose it
+				utils.PrintWarning("⚠️ %v\n", err)
+				if err := outputKey(newKey, format, "", cfg.KeyEnvVarName(), cfg.KeyFilePerm()); err != nil {
+					return fmt.Errorf("key was rotated but could not be displayed: %w", err)
+				}
+			}
+		}
+		utils.PrintWarning("🚨 IMPORTANT: You must now securely distribute the new key to your team.\n")
+		utils.PrintInfo("🔧 They will need to update their key source (e.g., %s) before they can 'pull' again.\n", cfg.KeyEnvVarName())
+		return nil
+	},
+}
+
+// keepOldKeyReadable saves a key retired by rotate-key to a file and lists it in previous_keys, so
+// content pushed with it can still be decrypted until the entry is removed
+func keepOldKeyReadable(cfg *config.Config, oldKey []byte) error {
+	path := getConfigFile()
+	if path == "" {
+		path = ".env-sync.yaml"
+	}
+	keyFile := filepath.Join(filepath.Dir(cfg.EnvFile), ".env-sync-previous-key-"+time.Now().Format("20060102-150405"))
+	// Written so that key_format decodes it, as the previous_keys files are read with it
+	format := crypto.KeyFormatBase64
+	if cfg.KeyFormat == crypto.KeyFormatHex {
+		format = crypto.KeyFormatHex
+	}
+	keyString, err := crypto.KeyToString(oldKey, format)
+	if err != nil {
+		return err
+	}
+	if err := utils.WriteFileMode(keyFile, []byte(keyString), cfg.KeyFilePerm()); err != nil {
+		return fmt.Errorf("failed to save the old key to '%s': %w", keyFile, err)
+	}
+	if err := config.WritePreviousKeys(path, append(cfg.PreviousKeys, keyFile)); err != nil {
+		return err
+	}
+	utils.PrintInfo("🕰️ The old key is saved in '%s' and listed in previous_keys, so content pushed with it can still be decrypted.\n", keyFile)
+	utils.PrintWarning("⚠️ Anyone with the old key can push readable content until then: remove the previous_keys entry and delete '%s' once everyone has the new key.\n", keyFile)
+	return nil
+}
+
+// rollbackRotation restores the secrets saved by the last rotate-key
+func rollbackRotation(cfg *config.Config) error {
+	backupFile := envsync.RotationBackupPath(cfg)
+	backup, err := envsync.LoadRotationBackup(backupFile)
+	if err != nil {
+		return err
+	}
+	utils.PrintInfo("⏪ Rolling back the rotation of %s...\n", backup.CreatedAt.Local().Format(time.RFC1123))
+
+	cred, err := auth.CreateAzureCredential()
+	if err != nil {
+		return err
+	}
+	vaultClient, err := newSecretStore(cfg, cred)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := vaultContext()
+	defer cancel()
+
+	// The configured kms key is already the new one, but the backup holds the old wrapped key
+	var oldKey []byte
+	if cfg.KeySource == "kms" && cliKey == "" {
+		keyProvider, err := cfg.KeyProvider()
+		if err != nil {
+			return err
+		}
+		envelope := backup.Find(keyProvider.WrappedKeySecret)
+		if envelope == nil {
+			return fmt.Errorf("the rotation backup has no wrapped data key '%s'; pass the old key with --key", keyProvider.WrappedKeySecret)
+		}
+		oldKey, err = keyProvider.UnwrapDataKey(ctx, envelope.Value)
+		if err != nil {
+			return fmt.Errorf("could not unwrap the old data key: %w", describeVaultError(ctx, err))
+		}
+	} else {
+		oldKey, err = cfg.GetEncryptionKey(ctx, cliKey)
+		if err != nil {
+			return fmt.Errorf("could not load the old key from source '%s': %w", cfg.KeySource, describeKeyError(err))
+		}
+	}
+
+	restored, err := envsync.Rollback(ctx, vaultClient, oldKey, backup)
+	for _, secretName := range restored {
+		recordAudit(cfg, audit.Entry{Action: audit.ActionRollback, SecretName: secretName}, nil)
+	}
+	if err != nil {
+		if len(restored) > 0 {
+			utils.PrintError("❌ Rollback incomplete: %d secret(s) were restored; run 'env-sync rotate-key --rollback' again.\n", len(restored))
+		}
+		return describeVaultError(ctx, err)
+	}
+
+	if err := os.Remove(backupFile); err != nil {
+		utils.PrintWarning("⚠️ Could not remove the rotation backup: %v\n", err)
+	}
+	utils.PrintSuccess("✅ Restored %d secret(s) from before the rotation.\n", len(restored))
+	if cfg.KeySource != "kms" {
+		utils.PrintWarning("🚨 Team members who already switched to the new key must switch back to the old one.\n")
+	}
+	return nil
+}
+
+// showRecoveryKey displays the new key after a partial rotation, since some secrets can only be decrypted with it
+func showRecoveryKey(key []byte, format, keyEnvVar string) {
+	utils.PrintWarning("⚠️ Keep the new key below: it is needed to decrypt the secrets that were already rotated (use --key).\n")
+	if err := outputKey(key, format, "", keyEnvVar, utils.SecretFileMode); err != nil {
+		utils.PrintError("❌ Could not display the new key: %v\n", err)
+	}
+}
+
+// applySecretNameOverride overrides the configured secret_name with --secret-name when given,
+// prepending secret_prefix like it is for configured names
+func applySecretNameOverride(cmd *cobra.Command, cfg *config.Config) error {
+	if !cmd.Flags().Changed("secret-name") {
+		return nil
+	}
+	name, _ := cmd.Flags().GetString("secret-name")
+	name = cfg.PrefixedSecretName(name)
+	if err := vault.ValidateSecretName(name); err != nil {
+		return fmt.Errorf("invalid --secret-name: %w", err)
+	}
+	cfg.SecretName = name
+	return nil
+}
+
+// applyEnvFileOverride overrides the configured env_file with --env-file when given.
+// Relative paths are resolved against the current working directory.
+func applyEnvFileOverride(cmd *cobra.Command, cfg *config.Config) error {
+	if !cmd.Flags().Changed("env-file") {
+		return nil
+	}
+	envFile, _ := cmd.Flags().GetString("env-file")
+	if envFile == "" {
+		return fmt.Errorf("--env-file must not be empty")
+	}
+	absPath, err := filepath.Abs(envFile)
+	if err != nil {
+		return fmt.Errorf("invalid --env-file '%s': %w", envFile, err)
+	}
+	cfg.EnvFile = absPath
+	return nil
+}
+
+// applyKeyFormat overrides the configured key_format with --key-format when given
+func applyKeyFormat(cfg *config.Config) {
+	if keyFormat != "" {
+		cfg.KeyFormat = keyFormat
+	}
+}
+
+// loadKey loads and validates the encryption key, honoring --key and --key-format
+func loadKey(cfg *config.Config) ([]byte, error) {
+	applyKeyFormat(cfg)
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.KeySource == "file" && cliKey == "" {
+		utils.CheckFilePermissions(cfg.KeyFile, cfg.KeyFilePerm(), fixPerms)
+	}
+	ctx, cancel := vaultContext()
+	defer cancel()
+	key, err := cfg.LoadAndValidateKey(ctx, cliKey)
+	if err != nil {
+		return nil, describeKeyError(err)
+	}
+	return key, nil
+}
+
+// describeKeyError adds an actionable remedy to key decoding and validation errors
+func describeKeyError(err error) error {
+	switch {
+	case errors.Is(err, crypto.ErrKeyEncoding):
+		return fmt.Errorf("%w. Keys must be base64 or hex encoded, as printed by 'env-sync generate-key'", err)
+	case errors.Is(err, crypto.ErrKeySize):
+		return fmt.Errorf("%w. The key may have been truncated when copied; it must decode to exactly %d bytes", err, crypto.KeySize)
+	case errors.Is(err, crypto.ErrWeakKey):
+		return fmt.Errorf("%w. Generate a random key with 'env-sync generate-key'", err)
+	default:
+		return err
+	}
+}
+
+// outputKey writes a key to a file with mode or displays it with team distribution instructions
+func outputKey(key []byte, format, output, keyEnvVar string, mode os.FileMode) error {
+	keyString, err := crypto.KeyToString(key, format)
+	if err != nil {
+		return err
+	}
+
+	if output != "" {
+		if err := utils.WriteFileMode(output, []byte(keyString), mode); err != nil {
+			return fmt.Errorf("failed to write key to file '%s': %w", output, err)
+		}
+		utils.PrintSuccess("✅ Encryption key saved to: %s\n", output)
+		utils.PrintWarning("⚠️ IMPORTANT: This file contains a secret. Add it to your .gitignore and do not commit it!\n")
+	} else {
+		utils.PrintInfo("🔑 Generated Encryption Key (%s):\n", format)
+		fmt.Println(keyString)
+		fmt.Println()
+		utils.PrintInfo("📋 Team Distribution Instructions:\n")
+		fmt.Println("1. Share this key securely with your team (e.g., using a password manager).")
+		fmt.Println("2. Each team member should save it as:")
+		fmt.Printf("   a) An environment variable: export %s=\"%s\"\n", keyEnvVar, keyString)
+		fmt.Printf("   b) Or in a file (e.g., .env-sync-key): echo \"%s\" > .env-sync-key\n", keyString)
+		fmt.Println("3. If using a file, add its name to .gitignore.")
+		fmt.Println()
+		utils.PrintWarning("⚠️ SECURITY: Never commit this key to version control!\n")
+	}
+	return nil
+}
+
+// pushWithConflictDetection performs a push operation with conflict detection and resolution
+func pushWithConflictDetection(cmd *cobra.Command, args []string, fromWatcher bool) error {
+	cfg, err := config.LoadConfig(getConfigFile())
+	if err != nil {
+		return fmt.Errorf("failed to load configuration: %w", err)
+	}
+	// Fail before the key is loaded or the vault is contacted
+	if err := cfg.CheckWritable("push"); err != nil {
+		return err
+	}
+	if err := applySecretNameOverride(cmd, cfg); err != nil {
+		return err
+	}
+	if err := applyEnvFileOverride(cmd, cfg); err != nil {
+		return err
+	}
+
+	if strategy, _ := cmd.Flags().GetString("strategy"); strategy != "" {
+		if !sync.IsValidStrategy(strategy) {
+			return fmt.Errorf("invalid --strategy '%s'. Valid options: %s", strategy, strings.Join(strategyNames(), ", "))
+		}
+		cfg.ConflictStrategy = strategy
+	}
+	tag, _ := cmd.Flags().GetString("tag")
+	if cmd.Flags().Changed("tag") {
+		if err := vault.ValidateVersionTag(tag); err != nil {
+			return fmt.Errorf("invalid --tag: %w", err)
+		}
+	}
+
+	// Get the encryption key
+	key, err := loadKey(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to load encryption key: %w", err)
+	}
+
+	// Create Azure credentials and vault client
+	cred, err := auth.CreateAzureCredential()
+	if err != nil {
+		return fmt.Errorf("failed to create Azure credentials: %w", err)
+	}
+
+	vaultClient, err := newSecretStore(cfg, cred)
+	if err != nil {
+		return fmt.Errorf("failed to create Key Vault client: %w", err)
+	}
+
+	// The watcher only reacts to changes in the primary env file
+	mappings := cfg.Mappings()
+	if fromWatcher {
+		mappings = mappings[:1]
+	}
+
+	opts := pushOptions{fromWatcher: fromWatcher}
+	// The watcher has no --force flag, so it always refuses unsafe content
+	opts.force, _ = cmd.Flags().GetBool("force")
+	opts.allowEmpty, _ = cmd.Flags().GetBool("allow-empty")
+	opts.showValues, _ = cmd.Flags().GetBool("show-values")
+	opts.waitForPropagation, _ = cmd.Flags().GetDuration("wait-for-propagation")
+	opts.message, _ = cmd.Flags().GetString("message")
+	opts.conflictReport, _ = cmd.Flags().GetString("conflict-report")
+	opts.tag = tag
+	opts.backupFile, _ = cmd.Flags().GetString("backup-before-push")
+
+	if fromStdin, _ := cmd.Flags().GetBool("stdin"); fromStdin {
+		content, err := io.ReadAll(cmd.InOrStdin())
+		if err != nil {
+			return fmt.Errorf("failed to read .env content from stdin: %w", err)
+		}
+		opts.content = content
+		mappings = []config.FileMapping{primaryMapping(cfg, "--stdin")}
+	}
+
+	// Structured sources are converted to .env content before anything else sees them
+	if format, _ := cmd.Flags().GetString("format"); format != "" && format != sync.FormatDotenv {
+		stringify, _ := cmd.Flags().GetBool("stringify")
+		mapping := primaryMapping(cfg, "--format")
+		source := opts.content
+		if source == nil {
+			source, err = os.ReadFile(mapping.EnvFile)
+			if err != nil {
+				return fmt.Errorf("failed to read %s file from '%s': %w", format, mapping.EnvFile, err)
 			}
-		} else {
-			utils.PrintInfo("✅ No conflicts detected with remote version.\n")
 		}
+		opts.content, err = sync.ConvertToEnvContent(source, format, stringify)
+		if err != nil {
+			return fmt.Errorf("failed to convert '%s' from %s: %w", mapping.EnvFile, format, err)
+		}
+		mappings = []config.FileMapping{mapping}
+	}
+
+	// A backup file holds a single secret
+	if opts.backupFile != "" && len(mappings) > 1 {
+		mappings = []config.FileMapping{primaryMapping(cfg, "--backup-before-push")}
+	}
+
+	return forEachMapping("Pushing", mappings, cfg.MaxConcurrency, func(mapping config.FileMapping) error {
+		return pushMapping(cfg, vaultClient, key, mapping, opts)
+	})
+}
+
+// pushOptions controls how pushMapping handles unsafe content and conflicts
+type pushOptions struct {
+	fromWatcher    bool   // Triggered by a file change rather than 'env-sync push'
+	force          bool   // Push despite conflict markers or plaintext key material
+	allowEmpty     bool   // Push empty content, clearing the remote secret
+	showValues     bool   // Print conflicting values in full instead of redacted
+	content        []byte // Content read from stdin; when nil the env file is read
+	message        string // Note stored with the pushed version
+	tag            string // Version tag moved to the pushed version
+	backupFile     string // File the remote secret is saved to before it is overwritten
+	conflictReport string // JSON file conflicts are written to instead of prompting
+
+	waitForPropagation time.Duration // How long to wait for the pushed content to be readable
+}
+
+// pushMapping pushes a single env file to its secret, detecting conflicts with the remote version
+func pushMapping(cfg *config.Config, vaultClient envsync.SecretStore, key []byte, mapping config.FileMapping, opts pushOptions) (err error) {
+	auditEntry := audit.Entry{Action: audit.ActionPush, SecretName: mapping.SecretName}
+	defer func() { recordAudit(cfg, auditEntry, err) }()
+
+	// Read the current local .env file, unless the content was piped in
+	localContent := opts.content
+	if localContent == nil {
+		utils.CheckFilePermissions(mapping.EnvFile, cfg.EnvFilePerm(), fixPerms)
+		localContent, err = os.ReadFile(mapping.EnvFile)
+		if err != nil {
+			return fmt.Errorf("failed to read .env file from '%s': %w", mapping.EnvFile, err)
+		}
+	}
+	auditEntry.ContentHash = sync.ContentHash(localContent)
+
+	result, err := envsync.Push(context.Background(), cfg, vaultClient, key, mapping, envsync.PushOptions{
+		Content:    localContent,
+		Force:      opts.force,
+		AllowEmpty: opts.allowEmpty,
+		Message:    opts.message,
+		Timeout:    timeout,
+		ResolveConflict: func(conflict *envsync.Conflict) (bool, error) {
+			return resolvePushConflict(cfg, conflict, opts)
+		},
+		WaitForPropagation: opts.waitForPropagation,
+		Tag:                opts.tag,
+		BackupFile:         opts.backupFile,
+	})
+	if err != nil {
+		return describePushError(mapping, err)
+	}
+	if result.Cancelled {
+		utils.With("secret", mapping.SecretName, "file", mapping.EnvFile).PrintInfo("⏭️ Push cancelled by user.\n")
+		auditEntry.Result = audit.ResultCancelled
+		return nil
+	}
+	if !result.Pushed {
+		return nil
+	}
+	if opts.backupFile != "" && !result.FirstPush {
+		utils.PrintInfo("ℹ️ 'env-sync restore %s' pushes the previous version back if this push was wrong.\n", opts.backupFile)
+	}
+
+	runSyncHook(hooks.EventPostPush, cfg.PostPushHook, mapping.EnvFile)
+	sendNotification(cfg, notify.Event{Type: notify.EventPush, SecretName: mapping.SecretName, VaultURL: cfg.VaultURL})
+	return nil
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore <file>",
+	Short: "Push back a remote secret saved by push --backup-before-push",
+	Long: `Stores the secret saved by 'env-sync push --backup-before-push' as a new version, undoing a
+push that went wrong. The backup is stored as it was saved, still encrypted, so restoring it
+doesn't need the key. Run 'env-sync pull' afterwards to update your env file.
+
+Examples:
+  env-sync push --backup-before-push before-push.json
+  env-sync restore before-push.json`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		cfg, err := config.LoadConfig(getConfigFile())
+		if err != nil {
+			return fmt.Errorf("failed to load configuration: %w", err)
+		}
+		backup, err := envsync.LoadPushBackup(args[0])
+		if err != nil {
+			return err
+		}
+		utils.PrintInfo("⏪ Restoring '%s' as it was on %s...\n", backup.SecretName, backup.CreatedAt.Local().Format(time.RFC1123))
+
+		cred, err := auth.CreateAzureCredential()
+		if err != nil {
+			return err
+		}
+		vaultClient, err := newSecretStore(cfg, cred)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := vaultContext()
+		defer cancel()
+
+		err = envsync.Restore(ctx, cfg, vaultClient, backup, envsync.RestoreOptions{Force: force})
+		recordAudit(cfg, audit.Entry{Action: audit.ActionRestore, SecretName: backup.SecretName, ContentHash: backup.Tags[vault.TagContentHash]}, err)
+		if errors.Is(err, envsync.ErrOtherVault) {
+			return fmt.Errorf("%w (use --force to restore it there anyway)", err)
+		}
+		if err != nil {
+			return describeVaultError(ctx, err)
+		}
+		utils.PrintSuccess("✅ Restored '%s' from '%s'.\n", backup.SecretName, args[0])
+		utils.PrintInfo("ℹ️ Run 'env-sync pull' to update your env file to the restored content.\n")
+		return nil
+	},
+}
+
+// describePushError adds the CLI's advice to the errors envsync.Push reports
+func describePushError(mapping config.FileMapping, err error) error {
+	var unsafe *sync.UnsafeContentError
+	switch {
+	case errors.As(err, &unsafe):
+		return fmt.Errorf("%w (fix the file or use --force to push anyway)", err)
+	case errors.Is(err, envsync.ErrEmptyContent):
+		return fmt.Errorf("%w. Populate the file first, or use --allow-empty to clear the remote on purpose", err)
+	case errors.Is(err, crypto.ErrUnknownContentType):
+		return fmt.Errorf("%w; pushing would overwrite it (use --force if it does hold env-sync content)", err)
+	case errors.Is(err, sync.ErrRemoteChanged):
+		return fmt.Errorf("%w. It changed since your last pull but '%s' did not; run 'env-sync pull' first (or use --force to overwrite it)", err, mapping.EnvFile)
+	case errors.Is(err, vault.ErrConcurrentModification):
+		return fmt.Errorf("someone else pushed '%s' while you were working. Run 'env-sync pull' to review their changes, then push again: %w", mapping.SecretName, err)
+	default:
+		return describeVaultError(context.Background(), err)
+	}
+}
+
+// resolvePushConflict reports a conflict and decides, from the configured strategy or by asking,
+// whether the push may overwrite the remote values
+func resolvePushConflict(cfg *config.Config, conflict *envsync.Conflict, opts pushOptions) (bool, error) {
+	conflictStrategy := sync.ConflictStrategyManual
+	if cfg.ConflictStrategy != "" {
+		switch cfg.ConflictStrategy {
+		case "local":
+			conflictStrategy = sync.ConflictStrategyLocal
+		case "remote":
+			conflictStrategy = sync.ConflictStrategyRemote
+		case "merge":
+			conflictStrategy = sync.ConflictStrategyMerge
+		case "backup":
+			conflictStrategy = sync.ConflictStrategyBackup
+		}
+	}
+
+	// Keep the report and prompt for one file together when pushing several at once
+	conflictPromptLock <- struct{}{}
+	defer func() { <-conflictPromptLock }()
+
+	utils.PrintWarning("⚠️ Conflict detected in '%s'! Remote version has different values.\n\n", conflict.EnvFile)
+
+	// Show the conflicts
+	utils.PrintInfo("🔍 Conflicting keys:\n")
+	for _, key := range conflict.Keys {
+		localValue := conflict.Local[key]
+		remoteValue := conflict.Remote[key]
+		utils.PrintInfo("  • %s:\n", key)
+		if !opts.showValues {
+			localValue, remoteValue = utils.Redact(localValue), utils.Redact(remoteValue)
+		}
+		utils.PrintInfo("    Local:  %s\n", localValue)
+		utils.PrintInfo("    Remote: %s\n", remoteValue)
+	}
+	utils.PrintInfo("\n")
+
+	sendNotification(cfg, notify.Event{
+		Type:            notify.EventConflict,
+		SecretName:      conflict.SecretName,
+		VaultURL:        cfg.VaultURL,
+		ConflictingKeys: conflict.Keys,
+	})
+
+	// Ask user what to do
+	if opts.fromWatcher {
+		watchMetrics.RecordConflict()
+		// In watcher mode, respect the configured strategy or ask
+		if conflictStrategy == sync.ConflictStrategyManual {
+			return promptUserForConflictResolution("Push with local changes"), nil
+		}
+		utils.PrintInfo("🔧 Using configured conflict strategy: %s\n", cfg.ConflictStrategy)
+		return true, nil
+	}
+	if opts.conflictReport != "" {
+		// Pipelines can't answer a prompt, so the conflict is reported for them to act on
+		if conflictStrategy == sync.ConflictStrategyLocal {
+			utils.PrintInfo("🔧 Overwriting conflicting remote values (--strategy local)\n")
+			return true, nil
+		}
+		if err := appendConflictReport(opts.conflictReport, conflict.Report(opts.showValues)); err != nil {
+			return false, err
+		}
+		utils.PrintInfo("📝 Wrote the conflict report to '%s'.\n", opts.conflictReport)
+		return false, fmt.Errorf("%w: remote secret '%s' has conflicting values for %s (see '%s')", sync.ErrConflict, conflict.SecretName, strings.Join(conflict.Keys, ", "), opts.conflictReport)
+	}
+	if opts.content != nil {
+		// Stdin carries the content, so there is no one to answer a prompt
+		if conflictStrategy != sync.ConflictStrategyLocal {
+			return false, fmt.Errorf("%w: remote secret '%s' has conflicting values; pass --strategy local to overwrite them when pushing from stdin", sync.ErrConflict, conflict.SecretName)
+		}
+		utils.PrintInfo("🔧 Overwriting conflicting remote values (--strategy local)\n")
+		return true, nil
+	}
+	// In manual push mode, always ask for confirmation
+	return promptUserForConflictResolution("Push with local changes (this will overwrite remote)"), nil
+}
+
+// watchMetrics counts the watcher's conflicts while 'watch --metrics-addr' runs; nil otherwise
+var watchMetrics *watcher.Metrics
+
+// watchPullCache lets the watcher's periodic pulls skip secrets that haven't changed; nil outside 'watch'
+var watchPullCache *envsync.PullCache
+
+// conflictPromptLock serializes conflict reports and prompts across concurrent pushes
+var conflictPromptLock = make(chan struct{}, 1)
+
+// conflictReports holds the conflicts written to --conflict-report so far; guarded by conflictPromptLock
+var conflictReports []envsync.ConflictReport
+
+// appendConflictReport adds a conflict to the report file, rewriting it with every conflict of this
+// push so a multi-file push leaves one document. Values may be unredacted, so it is private to the user.
+func appendConflictReport(path string, report envsync.ConflictReport) error {
+	conflictReports = append(conflictReports, report)
+	data, err := json.MarshalIndent(struct {
+		Conflicts []envsync.ConflictReport `json:"conflicts"`
+	}{conflictReports}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the conflict report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), utils.SecretFileMode); err != nil {
+		return fmt.Errorf("failed to write the conflict report to '%s': %w", path, err)
+	}
+	return nil
+}
+
+// forEachMapping runs fn for every file mapping using a bounded worker pool.
+// All mappings are attempted; failures are aggregated into a single error.
+// Workers share one vault client, which (like its Azure credential) is safe for concurrent use.
+func forEachMapping(label string, mappings []config.FileMapping, maxConcurrency int, fn func(config.FileMapping) error) error {
+	if maxConcurrency <= 0 {
+		maxConcurrency = config.DefaultMaxConcurrency
+	}
+
+	// A single file needs no progress indicator
+	var progress *utils.Progress
+	if len(mappings) > 1 {
+		progress = utils.NewProgress(label, len(mappings))
+		defer progress.Finish()
+	}
+
+	var g errgroup.Group
+	g.SetLimit(maxConcurrency)
+
+	errs := make([]error, len(mappings))
+	for i, mapping := range mappings {
+		g.Go(func() error {
+			if err := fn(mapping); err != nil {
+				if len(mappings) > 1 {
+					err = fmt.Errorf("%s: %w", mapping.EnvFile, err)
+				}
+				errs[i] = err
+			}
+			if progress != nil {
+				progress.Increment()
+			}
+			return nil
+		})
+	}
+	g.Wait()
+
+	return errors.Join(errs...)
+}
+
+// vaultContext returns a context bounded by the --timeout flag for vault operations
+func vaultContext() (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(context.Background())
 	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// newSecretStore creates the store pushes, pulls and rotations go through: the configured vault,
+// mirrored to fallback_vault_url when one is set
+func newSecretStore(cfg *config.Config, cred azcore.TokenCredential) (envsync.SecretStore, error) {
+	primary, err := vault.NewClient(cfg.VaultURL, cred)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.FallbackVaultURL == "" {
+		return primary, nil
+	}
+	secondary, err := vault.NewClient(cfg.FallbackVaultURL, cred)
+	if err != nil {
+		return nil, fmt.Errorf("fallback vault: %w", err)
+	}
+	mirror := vault.NewMirrorStore(primary, secondary)
+	mirror.Logf = utils.PrintWarning
+	return mirror, nil
+}
 
-	// Proceed with the push
-	encrypted, err := crypto.EncryptEnvContent(localContent, key)
+// describeVaultError distinguishes timeouts and authentication failures from other vault errors
+func describeVaultError(ctx context.Context, err error) error {
+	var authErr *azidentity.AuthenticationFailedError
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("timed out after %s waiting for Azure Key Vault (increase with --timeout): %w", timeout, err)
+	case errors.As(err, &authErr):
+		return fmt.Errorf("Azure authentication failed (run 'az login' or check your credentials): %w", err)
+	default:
+		return err
+	}
+}
+
+// ensureWrappedDataKey creates and stores a KMS-wrapped data key if one does not exist yet
+func ensureWrappedDataKey(cfg *config.Config) error {
+	provider, err := cfg.KeyProvider()
 	if err != nil {
-		return fmt.Errorf("failed to encrypt .env file: %w", err)
+		return err
 	}
 
-	utils.PrintInfo("🔒 Pushing encrypted content to Azure Key Vault...\n")
-	if err := vaultClient.StoreSecret(ctx, cfg.SecretName, encrypted); err != nil {
-		return fmt.Errorf("failed to store secret in Key Vault: %w", err)
+	ctx, cancel := vaultContext()
+	defer cancel()
+
+	_, err = provider.GetKey(ctx)
+	if err == nil {
+		utils.PrintSuccess("✅ Found existing wrapped data key in secret '%s'.\n", provider.WrappedKeySecret)
+		return nil
+	}
+	if !errors.Is(err, kms.ErrNoWrappedKey) {
+		return fmt.Errorf("failed to load wrapped data key: %w", err)
 	}
 
+	utils.PrintInfo("🔐 Generating a new data key wrapped with %s...\n", cfg.KMSKeyID)
+	if _, err := provider.CreateKey(ctx); err != nil {
+		return fmt.Errorf("failed to create wrapped data key: %w", err)
+	}
+	utils.PrintSuccess("✅ Wrapped data key stored in secret '%s'.\n", provider.WrappedKeySecret)
 	return nil
 }
 
+// recordAudit appends an entry to the configured audit log. The result is taken from err unless
+// already set. Failures to write are reported as warnings so they never block the sync itself.
+func recordAudit(cfg *config.Config, entry audit.Entry, err error) {
+	if cfg.AuditLog == "" {
+		return
+	}
+	entry.User = auth.CurrentUser()
+	if err != nil {
+		entry.Result = audit.ResultFailure
+		entry.Error = err.Error()
+	} else if entry.Result == "" {
+		entry.Result = audit.ResultSuccess
+	}
+	if err := audit.Append(cfg.AuditLog, entry); err != nil {
+		utils.PrintWarning("⚠️ Could not write audit log: %v\n", err)
+	}
+}
+
+// sendNotification delivers a webhook notification, reporting failures as warnings
+func sendNotification(cfg *config.Config, event notify.Event) {
+	if err := cfg.Notifier().Send(event); err != nil {
+		utils.PrintWarning("⚠️ Failed to send %s notification: %v\n", event.Type, err)
+	}
+}
+
+// runSyncHook runs a configured post-sync hook, reporting failures as warnings
+func runSyncHook(event, command, envFile string) {
+	if err := hooks.Run(event, command, envFile); err != nil {
+		utils.PrintWarning("⚠️ %v\n", err)
+	}
+}
+
 // promptUserForConflictResolution prompts the user to confirm an action when conflicts exist
 func promptUserForConflictResolution(action string) bool {
 	fmt.Printf("\n🚀 %s? [y/N]: ", action)
@@ -1021,47 +3940,3 @@ func promptUserForConflictResolution(action string) bool {
 	response = strings.TrimSpace(strings.ToLower(response))
 	return response == "y" || response == "yes"
 }
-
-// ConflictInfo represents information about a detected conflict
-type ConflictInfo struct {
-	ConflictTime  time.Time
-	LocalChanges  map[string]string
-	RemoteChanges map[string]string
-	Conflicts     []string
-}
-
-// parseEnvContentForPush parses .env content into key-value pairs for conflict detection
-func parseEnvContentForPush(content string) (map[string]string, error) {
-	env := make(map[string]string)
-	lines := strings.Split(content, "\n")
-	
-	for lineNum, line := range lines {
-		line = strings.TrimSpace(line)
-		
-		// Skip empty lines and comments
-		if line == "" || strings.HasPrefix(line, "#") {
-			continue
-		}
-		
-		// Find the first = sign
-		equalIndex := strings.Index(line, "=")
-		if equalIndex == -1 {
-			return nil, fmt.Errorf("invalid .env format at line %d: missing '=' in '%s'", lineNum+1, line)
-		}
-		
-		key := strings.TrimSpace(line[:equalIndex])
-		value := line[equalIndex+1:] // Keep the value as-is (including quotes)
-		
-		// Remove surrounding quotes if present
-		if len(value) >= 2 {
-			if (value[0] == '"' && value[len(value)-1] == '"') ||
-			   (value[0] == '\'' && value[len(value)-1] == '\'') {
-				value = value[1 : len(value)-1]
-			}
-		}
-		
-		env[key] = value
-	}
-	
-	return env, nil
-}
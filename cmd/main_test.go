@@ -1,12 +1,30 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/lliamscholtz/env-sync/internal/audit"
+	"github.com/lliamscholtz/env-sync/internal/auth"
+	"github.com/lliamscholtz/env-sync/internal/config"
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/sync"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+	"github.com/lliamscholtz/env-sync/pkg/envsync"
+	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -75,6 +93,159 @@ func TestInitCommandNoFlags(t *testing.T) {
 	assert.Error(t, err, "init should fail without required flags")
 }
 
+func TestInitCommandRejectsInvalidVaultURL(t *testing.T) {
+	defer func() {
+		for _, name := range []string{"vault-url", "secret-name", "key-source"} {
+			initCmd.Flags().Set(name, "")
+		}
+	}()
+
+	for url, message := range map[string]string{
+		"http://myvault.vault.azure.net":          "must use https",
+		"https://myvault.example.com":             "is not a Key Vault URL",
+		"https://myvault.vault.azure.net/secrets": "must not include a path",
+	} {
+		_, err := execute("init", "--vault-url", url, "--secret-name", "myapp-env", "--key-source", "env")
+		if assert.Error(t, err, url) {
+			assert.Contains(t, err.Error(), "invalid --vault-url")
+			assert.Contains(t, err.Error(), message)
+		}
+	}
+}
+
+func TestInitCommandNoVerify(t *testing.T) {
+	defer func() {
+		for _, name := range []string{"vault-url", "secret-name", "key-source", "no-verify"} {
+			initCmd.Flags().Set(name, "")
+		}
+		initCmd.Flags().Set("key-file", ".env-sync-key")
+		syncFile = ""
+	}()
+
+	dir := t.TempDir()
+	key, err := crypto.GenerateEncryptionKey()
+	assert.NoError(t, err)
+	keyPath := filepath.Join(dir, "env-sync.key")
+	assert.NoError(t, os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+	configPath := filepath.Join(dir, ".env-sync.yaml")
+
+	// Azure is never contacted, so this succeeds without credentials
+	output, err := execute("init", "--no-verify", "--sync-file", configPath, "--vault-url", "https://myvault.vault.azure.net",
+		"--secret-name", "myapp-env", "--key-source", "file", "--key-file", keyPath)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "--no-verify")
+	cfg, err := config.LoadConfig(configPath)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "https://myvault.vault.azure.net", cfg.VaultURL)
+		assert.Equal(t, "myapp-env", cfg.SecretName)
+	}
+
+	// The key is still checked locally
+	assert.NoError(t, os.WriteFile(keyPath, []byte("not a key\n"), 0600))
+	_, err = execute("init", "--no-verify", "--sync-file", filepath.Join(dir, "other.yaml"), "--vault-url", "https://myvault.vault.azure.net",
+		"--secret-name", "myapp-env", "--key-source", "file", "--key-file", keyPath)
+	assert.ErrorContains(t, err, "failed to load encryption key")
+}
+
+func TestInitWizard(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "env-sync.key")
+	input := strings.Join([]string{
+		"http://myvault.vault.azure.net", // Rejected: not https
+		"https://myvault.vault.azure.net",
+		"my_app", // Rejected: Key Vault names have no underscores
+		"myapp-env",
+		"", "", // The vault check fails once; Enter keeps both answers to retry
+		"vault", // Rejected: not a key source
+		"file",
+		keyPath,
+		"y",
+	}, "\n") + "\n"
+
+	var out bytes.Buffer
+	checks := 0
+	wizard := &initWizard{in: bufio.NewReader(strings.NewReader(input)), out: &out, checkVault: func(cfg *config.Config) error {
+		checks++
+		assert.Equal(t, "https://myvault.vault.azure.net", cfg.VaultURL)
+		assert.Equal(t, "myapp-env", cfg.SecretName)
+		if checks == 1 {
+			return errors.New("forbidden")
+		}
+		return nil
+	}}
+	answers := initAnswers{KeyFile: ".env-sync-key"}
+	assert.NoError(t, wizard.run(&answers))
+
+	assert.Equal(t, initAnswers{VaultURL: "https://myvault.vault.azure.net", SecretName: "myapp-env", KeySource: "file", KeyFile: keyPath}, answers)
+	assert.Equal(t, 2, checks)
+	assert.True(t, wizard.vaultChecked)
+	assert.Contains(t, out.String(), "must use https")
+	assert.Contains(t, out.String(), "only allows letters, digits and dashes")
+	assert.Contains(t, out.String(), "unknown key source 'vault'")
+
+	// The generated key is written where the configuration will look for it
+	key, err := (&config.Config{KeySource: "file", KeyFile: keyPath}).GetEncryptionKey(context.Background(), "")
+	if assert.NoError(t, err) {
+		assert.NoError(t, crypto.ValidateEncryptionKey(key))
+	}
+}
+
+func TestInitWizardAsksOnlyForMissingFlags(t *testing.T) {
+	t.Setenv(config.DefaultKeyEnvVar, "")
+
+	// With the vault given as flags, a failed check is an error rather than a question
+	wizard := &initWizard{in: bufio.NewReader(strings.NewReader("")), out: io.Discard, checkVault: func(*config.Config) error {
+		return errors.New("unreachable")
+	}}
+	answers := initAnswers{VaultURL: "https://myvault.vault.azure.net", SecretName: "myapp-env", KeySource: "env"}
+	assert.ErrorContains(t, wizard.run(&answers), "unreachable")
+
+	// Declining the key leaves the env var unset, for init to report
+	wizard = &initWizard{in: bufio.NewReader(strings.NewReader("https://myvault.vault.azure.net\nn\n")), out: io.Discard}
+	answers = initAnswers{SecretName: "myapp-env", KeySource: "env"}
+	assert.NoError(t, wizard.run(&answers))
+	assert.Equal(t, "https://myvault.vault.azure.net", answers.VaultURL)
+	assert.False(t, wizard.vaultChecked)
+	assert.Empty(t, os.Getenv(config.DefaultKeyEnvVar))
+
+	// Input ending early cancels instead of writing a partial configuration
+	wizard = &initWizard{in: bufio.NewReader(strings.NewReader("https://myvault.vault.azure.net\n")), out: io.Discard}
+	answers = initAnswers{}
+	assert.ErrorContains(t, wizard.run(&answers), "init canceled")
+}
+
+func TestVerifyExistingSecret(t *testing.T) {
+	t.Setenv("TESTING", "1")
+	key, err := crypto.GenerateEncryptionKey()
+	assert.NoError(t, err)
+	otherKey, err := crypto.GenerateEncryptionKey()
+	assert.NoError(t, err)
+	cfg := &config.Config{VaultURL: "https://myvault.vault.azure.net", SecretName: "myapp-env"}
+	store := vault.NewFakeStore()
+
+	// A secret that doesn't exist yet is created by the first push
+	assert.NoError(t, verifyExistingSecret(cfg, store, key))
+
+	encrypted, err := crypto.EncryptEnvContent([]byte("KEY=value\n"), key)
+	assert.NoError(t, err)
+	assert.NoError(t, store.StoreSecret(context.Background(), cfg.SecretName, encrypted, nil, vault.SecretAttributes{}))
+	assert.NoError(t, verifyExistingSecret(cfg, store, key))
+
+	err = verifyExistingSecret(cfg, store, otherKey)
+	assert.ErrorContains(t, err, "cannot be decrypted with this key")
+	assert.ErrorIs(t, err, crypto.ErrDecryption)
+}
+
+func TestSecretExpiryWarning(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Empty(t, secretExpiryWarning("app-env", vault.SecretAttributes{}, now))
+	assert.Empty(t, secretExpiryWarning("app-env", vault.SecretAttributes{Expires: now.Add(30 * 24 * time.Hour)}, now))
+	assert.Contains(t, secretExpiryWarning("app-env", vault.SecretAttributes{Expires: now.Add(48 * time.Hour)}, now), "expires in 48h0m0s")
+	assert.Contains(t, secretExpiryWarning("app-env", vault.SecretAttributes{Expires: now}, now), "expired on")
+	assert.Contains(t, secretExpiryWarning("app-env", vault.SecretAttributes{NotBefore: now.Add(time.Hour)}, now), "is not active until")
+}
+
 func TestHelpCommand(t *testing.T) {
 	output, err := execute("help")
 	assert.NoError(t, err)
@@ -136,6 +307,15 @@ func TestSyncFileFlag(t *testing.T) {
 	})
 }
 
+func TestRotateKeyGeneratesKeyByDefault(t *testing.T) {
+	output, err := execute("rotate-key", "--help")
+	assert.NoError(t, err)
+	assert.Contains(t, output, "generated if omitted")
+	assert.Contains(t, output, "--output")
+	assert.Contains(t, output, "--format")
+	assert.Nil(t, rotateKeyCmd.Flags().Lookup("new-key").Annotations[cobra.BashCompOneRequiredFlag])
+}
+
 func TestVersionFlag(t *testing.T) {
 	// Test the actual version flag now that it exists
 	output, err := execute("--version")
@@ -197,6 +377,41 @@ func TestDoctorCommandWithFlags(t *testing.T) {
 	})
 }
 
+func TestDoctorCheckOnly(t *testing.T) {
+	originalCfgFile := cfgFile
+	defer func() {
+		cfgFile = originalCfgFile
+		doctorCmd.Flags().Set("check-only", "false")
+		doctorCmd.Flags().Set("fix", "false")
+	}()
+	// Earlier tests leave their doctor flags set
+	doctorCmd.Flags().Set("check", "")
+	doctorCmd.Flags().Set("help", "false")
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("vault_url: https://myvault.vault.azure.net/\nsecret_name: app-env\n"), 0644))
+
+	output, err := execute("doctor", "--check-only", "--config", configPath)
+	assert.Error(t, err)
+	assert.Equal(t, exitConfig, exitCode(err), "the invalid config outranks any auth or dependency failure")
+	assert.NotContains(t, output, "Verifying Azure authentication", "no pre-flight checks")
+	assert.Contains(t, output, "--- Checking Configuration ---")
+
+	_, err = execute("doctor", "--check-only", "--fix")
+	assert.ErrorContains(t, err, "none of the others can be")
+}
+
+func TestMostSevere(t *testing.T) {
+	deps := errors.New("missing dependencies: Tilt")
+	login := fmt.Errorf("%w: az failed", auth.ErrNotAuthenticated)
+	vaultErr := fmt.Errorf("probe failed: %w", context.DeadlineExceeded)
+	invalid := fmt.Errorf("%w: key_source is required", config.ErrInvalidConfig)
+
+	assert.Equal(t, deps, mostSevere([]error{deps}))
+	assert.Equal(t, login, mostSevere([]error{deps, login, vaultErr}))
+	assert.Equal(t, vaultErr, mostSevere([]error{deps, vaultErr}))
+	assert.Equal(t, invalid, mostSevere([]error{deps, login, invalid, vaultErr}))
+}
+
 func TestInstallDepsWithFlags(t *testing.T) {
 	t.Run("install specific dependency", func(t *testing.T) {
 		// Test the --only flag
@@ -221,3 +436,801 @@ func TestInstallDepsWithFlags(t *testing.T) {
 		assert.Contains(t, output, "Examples:")
 	})
 }
+
+func TestDescribeVaultError(t *testing.T) {
+	originalTimeout := timeout
+	defer func() { timeout = originalTimeout }()
+	timeout = 5 * time.Second
+
+	t.Run("deadline is reported as a timeout", func(t *testing.T) {
+		err := describeVaultError(context.Background(), fmt.Errorf("get secret: %w", context.DeadlineExceeded))
+		assert.Contains(t, err.Error(), "timed out after 5s")
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+
+	t.Run("other errors are unchanged", func(t *testing.T) {
+		original := errors.New("forbidden")
+		assert.Equal(t, original, describeVaultError(context.Background(), original))
+	})
+}
+
+func TestDescribeKeyError(t *testing.T) {
+	_, encodingErr := crypto.DecodeKey("not base64!")
+	sizeErr := crypto.ValidateEncryptionKey([]byte("short"))
+	weakErr := crypto.ValidateEncryptionKey(make([]byte, crypto.KeySize))
+
+	assert.Contains(t, describeKeyError(encodingErr).Error(), "must be base64 or hex encoded")
+	assert.Contains(t, describeKeyError(sizeErr).Error(), "truncated")
+	assert.Contains(t, describeKeyError(weakErr).Error(), "generate-key")
+	assert.ErrorIs(t, describeKeyError(weakErr), crypto.ErrWeakKey)
+
+	original := errors.New("permission denied")
+	assert.Equal(t, original, describeKeyError(original))
+}
+
+func TestExitCode(t *testing.T) {
+	wrongKey := make([]byte, crypto.KeySize)
+	for i := range wrongKey {
+		wrongKey[i] = byte(i + 1)
+	}
+	_, decryptErr := crypto.DecryptEnvContent(base64.StdEncoding.EncodeToString([]byte("not encrypted content")), wrongKey)
+	invalidCfg := (&config.Config{}).Validate()
+
+	tests := []struct {
+		name     string
+		err      error
+		expected int
+	}{
+		{"generic failure", errors.New("boom"), exitError},
+		{"not authenticated", fmt.Errorf("pre-flight: %w", auth.ErrNotAuthenticated), exitAuth},
+		{"invalid config", fmt.Errorf("failed to load configuration: %w", invalidCfg), exitConfig},
+		{"invalid key", fmt.Errorf("failed to load encryption key: %w", crypto.ErrKeySize), exitConfig},
+		{"unresolved conflict", fmt.Errorf("push: %w", sync.ErrConflict), exitConflict},
+		{"concurrent push", fmt.Errorf("store: %w", vault.ErrConcurrentModification), exitConflict},
+		{"missing secret", fmt.Errorf("get: %w", vault.ErrSecretNotFound), exitVault},
+		{"timeout", describeVaultError(context.Background(), context.DeadlineExceeded), exitVault},
+		{"decryption failure", fmt.Errorf("failed to decrypt secret: %w", decryptErr), exitDecryption},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, exitCode(tt.err))
+		})
+	}
+}
+
+func TestApplySecretNameOverride(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{Use: "test"}
+		cmd.Flags().String("secret-name", "", "")
+		cmd.Flags().Parse(args)
+		return cmd
+	}
+
+	cfg := &config.Config{SecretName: "configured"}
+	assert.NoError(t, applySecretNameOverride(newCmd(), cfg))
+	assert.Equal(t, "configured", cfg.SecretName)
+
+	assert.NoError(t, applySecretNameOverride(newCmd("--secret-name", "one-off-secret"), cfg))
+	assert.Equal(t, "one-off-secret", cfg.SecretName)
+
+	err := applySecretNameOverride(newCmd("--secret-name", "bad_name"), cfg)
+	assert.ErrorContains(t, err, "invalid --secret-name")
+	assert.Equal(t, "one-off-secret", cfg.SecretName)
+
+	assert.Error(t, applySecretNameOverride(newCmd("--secret-name", ""), cfg))
+}
+
+func TestApplyEnvFileOverride(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{Use: "test"}
+		cmd.Flags().String("env-file", "", "")
+		cmd.Flags().Parse(args)
+		return cmd
+	}
+
+	cfg := &config.Config{EnvFile: ".env"}
+	assert.NoError(t, applyEnvFileOverride(newCmd(), cfg))
+	assert.Equal(t, ".env", cfg.EnvFile)
+
+	wd, err := os.Getwd()
+	assert.NoError(t, err)
+	assert.NoError(t, applyEnvFileOverride(newCmd("--env-file", "config/.env.ci"), cfg))
+	assert.Equal(t, filepath.Join(wd, "config", ".env.ci"), cfg.EnvFile)
+
+	assert.Error(t, applyEnvFileOverride(newCmd("--env-file", ""), cfg))
+}
+
+func TestVaultContext(t *testing.T) {
+	originalTimeout := timeout
+	defer func() { timeout = originalTimeout }()
+
+	timeout = time.Minute
+	ctx, cancel := vaultContext()
+	_, hasDeadline := ctx.Deadline()
+	cancel()
+	assert.True(t, hasDeadline)
+
+	timeout = 0
+	ctx, cancel = vaultContext()
+	_, hasDeadline = ctx.Deadline()
+	cancel()
+	assert.False(t, hasDeadline)
+}
+
+func TestForEachMapping(t *testing.T) {
+	mappings := []config.FileMapping{
+		{EnvFile: ".env", SecretName: "app"},
+		{EnvFile: ".env.worker", SecretName: "worker"},
+		{EnvFile: ".env.api", SecretName: "api"},
+		{EnvFile: ".env.web", SecretName: "web"},
+	}
+
+	t.Run("respects the concurrency limit", func(t *testing.T) {
+		var running, peak int32
+		err := forEachMapping("Testing", mappings, 2, func(mapping config.FileMapping) error {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(20 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return nil
+		})
+		assert.NoError(t, err)
+		assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(2))
+	})
+
+	t.Run("aggregates errors from every mapping", func(t *testing.T) {
+		var attempted int32
+		err := forEachMapping("Testing", mappings, 4, func(mapping config.FileMapping) error {
+			atomic.AddInt32(&attempted, 1)
+			if mapping.SecretName == "worker" || mapping.SecretName == "web" {
+				return errors.New("vault unreachable")
+			}
+			return nil
+		})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), ".env.worker: vault unreachable")
+		assert.Contains(t, err.Error(), ".env.web: vault unreachable")
+		assert.Equal(t, int32(len(mappings)), atomic.LoadInt32(&attempted))
+	})
+}
+
+func TestCompletionCommand(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish", "powershell"} {
+		t.Run(shell, func(t *testing.T) {
+			output, err := execute("completion", shell)
+			assert.NoError(t, err)
+			assert.NotEmpty(t, strings.TrimSpace(output))
+			assert.Contains(t, output, "env-sync")
+		})
+	}
+
+	t.Run("invalid shell", func(t *testing.T) {
+		_, err := execute("completion", "tcsh")
+		assert.Error(t, err)
+	})
+}
+
+func TestFlagCompletions(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"push", "--strategy", ""}, []string{"manual", "local", "remote", "merge", "backup"}},
+		{[]string{"doctor", "--check", ""}, []string{"azure-cli", "tilt", "auth", "config"}},
+		{[]string{"install-deps", "--only", ""}, []string{"azure-cli", "tilt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.args[0], func(t *testing.T) {
+			// Earlier tests may have left --help set on the shared command, which suppresses completions
+			if c, _, err := rootCmd.Find(tt.args[:1]); err == nil {
+				if help := c.Flags().Lookup("help"); help != nil {
+					help.Value.Set("false")
+					help.Changed = false
+				}
+			}
+
+			output, err := execute(append([]string{cobra.ShellCompNoDescRequestCmd}, tt.args...)...)
+			assert.NoError(t, err)
+			for _, value := range tt.expected {
+				assert.Contains(t, output, value)
+			}
+		})
+	}
+}
+
+func TestQuietFlag(t *testing.T) {
+	defer func() {
+		quiet = false
+		rootCmd.PersistentFlags().Lookup("quiet").Changed = false
+		utils.SetLogLevel(utils.LogLevelNormal)
+	}()
+
+	output, err := execute("generate-key", "--quiet")
+	assert.NoError(t, err)
+	assert.NotContains(t, output, "📋 Team Distribution Instructions")
+	assert.Contains(t, output, "SECURITY") // Warnings are still shown
+}
+
+func TestVerboseAndQuietAreExclusive(t *testing.T) {
+	defer func() {
+		verbose, quiet = false, false
+		rootCmd.PersistentFlags().Lookup("verbose").Changed = false
+		rootCmd.PersistentFlags().Lookup("quiet").Changed = false
+		utils.SetLogLevel(utils.LogLevelNormal)
+	}()
+
+	_, err := execute("generate-key", "--verbose", "--quiet")
+	assert.Error(t, err)
+}
+
+func TestVerifySecret(t *testing.T) {
+	key, _ := crypto.GenerateEncryptionKey()
+	otherKey, _ := crypto.GenerateEncryptionKey()
+
+	valid, _ := crypto.EncryptEnvContent([]byte("KEY1=value1\nKEY2=value2\n"), key)
+	invalidEnv, _ := crypto.EncryptEnvContent([]byte("NOT_AN_ENV_LINE\n"), key)
+
+	t.Run("valid secret reports key count", func(t *testing.T) {
+		count, err := verifySecret(valid, key)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("base64 failure", func(t *testing.T) {
+		_, err := verifySecret("not base64!", key)
+		assert.ErrorContains(t, err, "base64 decode failed")
+	})
+
+	t.Run("key mismatch", func(t *testing.T) {
+		_, err := verifySecret(valid, otherKey)
+		assert.ErrorContains(t, err, "key mismatch")
+	})
+
+	t.Run("authentication failure", func(t *testing.T) {
+		_, err := verifySecret(base64.StdEncoding.EncodeToString(make([]byte, 64)), key)
+		assert.ErrorContains(t, err, "GCM authentication failed")
+	})
+
+	t.Run("parse failure", func(t *testing.T) {
+		_, err := verifySecret(invalidEnv, key)
+		assert.ErrorContains(t, err, "not valid .env content")
+	})
+
+	t.Run("not a recipient", func(t *testing.T) {
+		publicKey, _ := crypto.RecipientPublicKey(key)
+		encrypted, _ := crypto.EncryptForRecipients([]byte("KEY1=value1\n"), []string{publicKey})
+		_, err := verifySecret(encrypted, otherKey)
+		assert.ErrorContains(t, err, "not a recipient")
+	})
+}
+
+func TestRecipientsCommands(t *testing.T) {
+	originalCfgFile := cfgFile
+	defer func() { cfgFile = originalCfgFile }()
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("vault_url: https://myvault.vault.azure.net/\nsecret_name: app-env\nkey_source: file\nkey_file: .env-sync-key\n"), 0644))
+
+	output, err := execute("recipients", "keygen")
+	assert.NoError(t, err)
+	assert.Contains(t, output, crypto.RecipientPrefix)
+
+	key, _ := crypto.GenerateEncryptionKey()
+	publicKey, _ := crypto.RecipientPublicKey(key)
+
+	_, err = execute("recipients", "add", "not-a-key", "--config", configPath)
+	assert.ErrorIs(t, err, crypto.ErrInvalidRecipient)
+
+	_, err = execute("recipients", "add", publicKey, "--config", configPath)
+	assert.NoError(t, err)
+	cfg, err := config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{publicKey}, cfg.Recipients)
+
+	output, err = execute("recipients", "list", "--config", configPath)
+	assert.NoError(t, err)
+	assert.Contains(t, output, publicKey)
+
+	_, err = execute("recipients", "remove", publicKey, "--config", configPath)
+	assert.NoError(t, err)
+	cfg, err = config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Empty(t, cfg.Recipients)
+
+	_, err = execute("recipients", "remove", publicKey, "--config", configPath)
+	assert.ErrorContains(t, err, "is not a recipient")
+}
+
+func TestCleanCommand(t *testing.T) {
+	originalCfgFile := cfgFile
+	defer func() { cfgFile = originalCfgFile }()
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	keyFile := filepath.Join(dir, ".env-sync-key")
+	configPath := filepath.Join(dir, ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(fmt.Sprintf("vault_url: https://myvault.vault.azure.net/\nsecret_name: app-env\nenv_file: %s\nkey_source: file\nkey_file: %s\n", envFile, keyFile)), 0644))
+	for _, path := range []string{envFile, keyFile, filepath.Join(dir, ".env-sync-state.json"), filepath.Join(dir, ".env-sync-rotation-backup.json")} {
+		assert.NoError(t, os.WriteFile(path, []byte("x"), 0600))
+	}
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, ".env-sync-backups", "conflict"), 0700))
+
+	cfg, err := config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Len(t, cleanArtifacts(cfg, configPath, false), 5)
+	assert.NotContains(t, cleanArtifacts(cfg, configPath, false), envFile)
+	assert.Contains(t, cleanArtifacts(cfg, configPath, true), envFile)
+
+	_, err = execute("clean", "--yes", "--config", configPath)
+	assert.NoError(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1, "only the env file is kept")
+	assert.FileExists(t, envFile)
+}
+
+func TestCleanKeepsOtherFilesInBackupDir(t *testing.T) {
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "shared")
+	assert.NoError(t, os.MkdirAll(backupDir, 0700))
+	cfg := &config.Config{EnvFile: filepath.Join(dir, ".env"), SecretName: "app-env", BackupDir: backupDir}
+	backup, err := cfg.BackupPath(cfg.EnvFile, "local", time.Now())
+	assert.NoError(t, err)
+	other := filepath.Join(backupDir, "notes.txt")
+	for _, path := range []string{backup, other} {
+		assert.NoError(t, os.WriteFile(path, []byte("x"), 0600))
+	}
+
+	artifacts := cleanArtifacts(cfg, filepath.Join(dir, ".env-sync.yaml"), false)
+	assert.Contains(t, artifacts, backup)
+	assert.NotContains(t, artifacts, backupDir)
+	assert.NotContains(t, artifacts, other)
+}
+
+func TestHexKeyRoundTrip(t *testing.T) {
+	keyPath := t.TempDir() + "/hex.key"
+	defer func() {
+		generateKeyCmd.Flags().Set("format", "base64")
+		generateKeyCmd.Flags().Set("output", "")
+	}()
+
+	_, err := execute("generate-key", "--format", "hex", "--output", keyPath)
+	assert.NoError(t, err)
+	hexKey, err := os.ReadFile(keyPath)
+	assert.NoError(t, err)
+
+	mustLoadKey := func(cfg *config.Config) []byte {
+		key, err := loadKey(cfg)
+		assert.NoError(t, err)
+		return key
+	}
+
+	// A hex key from a file is detected automatically and usable to push and pull
+	cfg := &config.Config{VaultURL: "a", SecretName: "b", KeySource: "file", KeyFile: keyPath}
+	key := mustLoadKey(cfg)
+	encrypted, err := crypto.EncryptEnvContent([]byte("KEY=value\n"), key)
+	assert.NoError(t, err)
+
+	// The same key passed via --key with an explicit format decrypts it
+	originalKey, originalFormat := cliKey, keyFormat
+	defer func() { cliKey, keyFormat = originalKey, originalFormat }()
+	cliKey, keyFormat = string(hexKey), "hex"
+	decrypted, err := crypto.DecryptEnvContent(encrypted, mustLoadKey(&config.Config{VaultURL: "a", SecretName: "b", KeySource: "env"}))
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=value\n", string(decrypted))
+
+	// Forcing base64 rejects the hex key with an actionable size error
+	keyFormat = "base64"
+	_, err = loadKey(&config.Config{VaultURL: "a", SecretName: "b", KeySource: "env"})
+	assert.ErrorIs(t, err, crypto.ErrKeySize)
+}
+
+func TestSkipChecks(t *testing.T) {
+	defer func() {
+		skipChecks, syncFile = false, ""
+		rootCmd.PersistentFlags().Lookup("skip-checks").Changed = false
+		rootCmd.PersistentFlags().Lookup("sync-file").Changed = false
+	}()
+
+	t.Setenv("ENVSYNC_SKIP_CHECKS", "")
+	assert.False(t, skipPreflightChecks())
+	t.Setenv("ENVSYNC_SKIP_CHECKS", "false")
+	assert.False(t, skipPreflightChecks())
+	t.Setenv("ENVSYNC_SKIP_CHECKS", "1")
+	assert.True(t, skipPreflightChecks())
+	t.Setenv("ENVSYNC_SKIP_CHECKS", "")
+
+	// The command runs past the pre-flight checks and fails on its own missing config instead
+	output, err := execute("verify", "--skip-checks", "--sync-file", t.TempDir()+"/missing.yaml")
+	assert.Error(t, err)
+	assert.NotContains(t, output, "Checking dependencies")
+	assert.Contains(t, err.Error(), "configuration")
+}
+
+func TestReportKeyStatus(t *testing.T) {
+	t.Setenv("TESTING", "1")
+
+	key, err := crypto.GenerateEncryptionKey()
+	assert.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "env-sync.key")
+	assert.NoError(t, os.WriteFile(keyPath, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600))
+
+	assert.NoError(t, reportKeyStatus(&config.Config{KeySource: "file", KeyFile: keyPath}))
+	assert.NoError(t, reportKeyStatus(&config.Config{KeySource: "prompt"}))
+
+	t.Setenv("ENVSYNC_ENCRYPTION_KEY", "")
+	err = reportKeyStatus(&config.Config{KeySource: "env"})
+	assert.ErrorContains(t, err, "ENVSYNC_ENCRYPTION_KEY")
+
+	err = reportKeyStatus(&config.Config{KeySource: "file", KeyFile: filepath.Join(t.TempDir(), "missing.key")})
+	assert.ErrorContains(t, err, "missing.key")
+}
+
+func TestPushMappingRemoteChanged(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	synced := "KEY1=value1\n"
+	remote := "KEY1=value1\nKEY2=added-remotely\n"
+
+	setup := func(t *testing.T, local string) (config.FileMapping, *vault.FakeStore) {
+		t.Helper()
+		mapping := config.FileMapping{EnvFile: filepath.Join(t.TempDir(), ".env"), SecretName: "app-env"}
+		if err := os.WriteFile(mapping.EnvFile, []byte(local), 0600); err != nil {
+			t.Fatalf("Failed to write env file: %v", err)
+		}
+		if err := sync.RecordSyncState(sync.StatePath(mapping.EnvFile), utils.SecretFileMode, mapping.SecretName, synced, "pull"); err != nil {
+			t.Fatalf("Failed to record sync state: %v", err)
+		}
+		encrypted, err := crypto.EncryptEnvContent([]byte(remote), key)
+		if err != nil {
+			t.Fatalf("Failed to encrypt remote content: %v", err)
+		}
+		store := vault.NewFakeStore()
+		if err := store.StoreSecret(context.Background(), mapping.SecretName, encrypted, nil, vault.SecretAttributes{}); err != nil {
+			t.Fatalf("Failed to store remote content: %v", err)
+		}
+		return mapping, store
+	}
+
+	t.Run("remote moved and local did not", func(t *testing.T) {
+		mapping, store := setup(t, synced)
+		err := pushMapping(&config.Config{}, store, key, mapping, pushOptions{})
+		assert.ErrorIs(t, err, sync.ErrRemoteChanged)
+		assert.Equal(t, exitConflict, exitCode(err))
+		assert.Equal(t, 1, store.Versions(mapping.SecretName))
+	})
+
+	t.Run("force overwrites", func(t *testing.T) {
+		mapping, store := setup(t, synced)
+		assert.NoError(t, pushMapping(&config.Config{}, store, key, mapping, pushOptions{force: true}))
+		assert.Equal(t, 2, store.Versions(mapping.SecretName))
+	})
+
+	t.Run("local changed too", func(t *testing.T) {
+		local := "KEY1=value1\nKEY3=added-locally\n"
+		mapping, store := setup(t, local)
+		assert.NoError(t, pushMapping(&config.Config{}, store, key, mapping, pushOptions{}))
+		assert.Equal(t, 2, store.Versions(mapping.SecretName))
+
+		// The push becomes the new baseline for the next check
+		state, err := sync.LoadState(sync.StatePath(mapping.EnvFile))
+		assert.NoError(t, err)
+		assert.ErrorIs(t, sync.CheckRemoteChanged(local, "KEY1=changed-later\n", state.KnownHash(mapping.SecretName)), sync.ErrRemoteChanged)
+	})
+}
+
+func TestPushMappingConflictReport(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	dir := t.TempDir()
+	mapping := config.FileMapping{EnvFile: filepath.Join(dir, ".env"), SecretName: "app-env"}
+	if err := os.WriteFile(mapping.EnvFile, []byte("API_TOKEN=local-token-value\n"), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	if err := sync.RecordSyncState(sync.StatePath(mapping.EnvFile), utils.SecretFileMode, mapping.SecretName, "API_TOKEN=synced-token-value\n", "pull"); err != nil {
+		t.Fatalf("Failed to record sync state: %v", err)
+	}
+	encrypted, err := crypto.EncryptEnvContent([]byte("API_TOKEN=remote-token-value\n"), key)
+	if err != nil {
+		t.Fatalf("Failed to encrypt remote content: %v", err)
+	}
+	store := vault.NewFakeStore()
+	if err := store.StoreSecret(context.Background(), mapping.SecretName, encrypted, nil, vault.SecretAttributes{}); err != nil {
+		t.Fatalf("Failed to store remote content: %v", err)
+	}
+	t.Cleanup(func() { conflictReports = nil })
+
+	reportPath := filepath.Join(dir, "conflicts.json")
+	err = pushMapping(&config.Config{}, store, key, mapping, pushOptions{conflictReport: reportPath})
+	assert.ErrorIs(t, err, sync.ErrConflict)
+	assert.Equal(t, exitConflict, exitCode(err))
+	assert.Equal(t, 1, store.Versions(mapping.SecretName))
+
+	data, err := os.ReadFile(reportPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "token-value", "values are redacted by default")
+	var report struct {
+		Conflicts []envsync.ConflictReport `json:"conflicts"`
+	}
+	assert.NoError(t, json.Unmarshal(data, &report))
+	if assert.Len(t, report.Conflicts, 1) {
+		assert.Equal(t, "app-env", report.Conflicts[0].SecretName)
+		assert.True(t, report.Conflicts[0].Redacted)
+		assert.Equal(t, "API_TOKEN", report.Conflicts[0].Keys[0].Key)
+	}
+}
+
+func TestPushMappingSkipsIdenticalContent(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	content := "KEY1=value1\n"
+	mapping := config.FileMapping{EnvFile: filepath.Join(t.TempDir(), ".env"), SecretName: "app-env"}
+	if err := os.WriteFile(mapping.EnvFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	store := vault.NewFakeStore()
+
+	// First push: nothing to compare against
+	assert.NoError(t, pushMapping(&config.Config{}, store, key, mapping, pushOptions{}))
+	assert.Equal(t, 1, store.Versions(mapping.SecretName))
+
+	// Unchanged content is not uploaded again
+	assert.NoError(t, pushMapping(&config.Config{}, store, key, mapping, pushOptions{}))
+	assert.Equal(t, 1, store.Versions(mapping.SecretName))
+
+	if err := os.WriteFile(mapping.EnvFile, []byte(content+"KEY2=value2\n"), 0600); err != nil {
+		t.Fatalf("Failed to update env file: %v", err)
+	}
+	assert.NoError(t, pushMapping(&config.Config{}, store, key, mapping, pushOptions{}))
+	assert.Equal(t, 2, store.Versions(mapping.SecretName))
+}
+
+func TestPushMappingWritesAuditLog(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	dir := t.TempDir()
+	content := "API_TOKEN=super-secret-value\n"
+	mapping := config.FileMapping{EnvFile: filepath.Join(dir, ".env"), SecretName: "app-env"}
+	if err := os.WriteFile(mapping.EnvFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+	cfg := &config.Config{AuditLog: filepath.Join(dir, "audit.jsonl")}
+
+	assert.NoError(t, pushMapping(cfg, vault.NewFakeStore(), key, mapping, pushOptions{}))
+
+	data, err := os.ReadFile(cfg.AuditLog)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "super-secret-value")
+
+	var entry audit.Entry
+	assert.NoError(t, json.Unmarshal(bytes.TrimSpace(data), &entry))
+	assert.Equal(t, audit.ActionPush, entry.Action)
+	assert.Equal(t, "app-env", entry.SecretName)
+	assert.Equal(t, sync.ContentHash([]byte(content)), entry.ContentHash)
+	assert.Equal(t, audit.ResultSuccess, entry.Result)
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+
+	for value, expected := range map[string]time.Time{
+		"36h":                  now.Add(-36 * time.Hour),
+		"7d":                   now.AddDate(0, 0, -7),
+		"2024-05-01T00:00:00Z": time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		"2024-05-01":           time.Date(2024, 5, 1, 0, 0, 0, 0, time.Local),
+	} {
+		since, err := parseSince(value, now)
+		assert.NoError(t, err, value)
+		assert.True(t, expected.Equal(since), "%s: expected %v, got %v", value, expected, since)
+	}
+
+	for _, value := range []string{"", "yesterday", "-5h", "7w"} {
+		_, err := parseSince(value, now)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseAssignments(t *testing.T) {
+	values, err := parseAssignments([]string{"A=1", "URL=postgres://h/db?x=y", "EMPTY="})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"A": "1", "URL": "postgres://h/db?x=y", "EMPTY": ""}, values)
+
+	for _, args := range [][]string{{"NOVALUE"}, {"=x"}, {"A=1", "A=2"}} {
+		_, err := parseAssignments(args)
+		assert.Error(t, err, args)
+	}
+}
+
+func TestFilterVersions(t *testing.T) {
+	store := vault.NewFakeStore()
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for day := 0; day < 5; day++ {
+		store.Now = func() time.Time { return created.AddDate(0, 0, day) }
+		assert.NoError(t, store.StoreSecret(context.Background(), "app-env", "value", map[string]string{vault.TagPushedBy: "alice", vault.TagMessage: "Add the Stripe key"}, vault.SecretAttributes{}))
+	}
+	versions, err := store.ListSecretVersions(context.Background(), "app-env")
+	assert.NoError(t, err)
+
+	ids := func(versions []vault.SecretVersion) []string {
+		var ids []string
+		for _, version := range versions {
+			ids = append(ids, version.Version)
+		}
+		return ids
+	}
+	assert.Equal(t, []string{"5", "4", "3", "2", "1"}, ids(filterVersions(versions, time.Time{}, 0)))
+	assert.Equal(t, []string{"5", "4", "3"}, ids(filterVersions(versions, created.AddDate(0, 0, 2), 0)))
+	assert.Equal(t, []string{"5", "4"}, ids(filterVersions(versions, created.AddDate(0, 0, 2), 2)))
+	assert.Empty(t, filterVersions(versions, created.AddDate(0, 0, 10), 0))
+
+	var out bytes.Buffer
+	printVersions(&out, filterVersions(versions, time.Time{}, 1))
+	assert.Contains(t, out.String(), "PUSHED BY")
+	assert.Contains(t, out.String(), "alice")
+	assert.Contains(t, out.String(), "Add the Stripe key")
+
+	// Version tags are shown with the version carrying them
+	assert.NoError(t, vault.MoveVersionTag(context.Background(), store, "app-env", "stable", "5"))
+	versions, err = store.ListSecretVersions(context.Background(), "app-env")
+	assert.NoError(t, err)
+	out.Reset()
+	printVersions(&out, versions[:1])
+	assert.Contains(t, out.String(), "5 [stable]")
+}
+
+func TestDiffVersion(t *testing.T) {
+	ctx := context.Background()
+	key, _ := crypto.GenerateEncryptionKey()
+	store := vault.NewFakeStore()
+	store.StoreSecret(ctx, "app-env", mustEncrypt(t, "KEEP=same\nCHANGED=old\nREMOVED=gone\n", key), nil, vault.SecretAttributes{})
+	store.StoreSecret(ctx, "app-env", mustEncrypt(t, "KEEP=same\nCHANGED=new\nADDED=fresh\n", key), nil, vault.SecretAttributes{})
+
+	diff, older, newer, err := diffVersion(ctx, store, key, "app-env", "1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"ADDED"}, diff.Added)
+	assert.Equal(t, []string{"REMOVED"}, diff.Removed)
+	assert.Equal(t, []string{"CHANGED"}, diff.Changed)
+
+	var out bytes.Buffer
+	printEnvDiff(&out, diff, older, newer, true)
+	assert.Equal(t, "+ ADDED=fresh\n- REMOVED=gone\n~ CHANGED: old → new\n1 added, 1 removed, 1 changed\n", out.String())
+	out.Reset()
+	printEnvDiff(&out, diff, older, newer, false)
+	assert.NotContains(t, out.String(), "fresh")
+
+	diff, older, newer, err = diffVersion(ctx, store, key, "app-env", "2")
+	assert.NoError(t, err)
+	out.Reset()
+	printEnvDiff(&out, diff, older, newer, false)
+	assert.Equal(t, "No differences.\n", out.String())
+
+	// A version from before a key rotation
+	oldKey, _ := crypto.GenerateEncryptionKey()
+	store.StoreSecret(ctx, "rotated-env", mustEncrypt(t, "KEY=old\n", oldKey), nil, vault.SecretAttributes{})
+	store.StoreSecret(ctx, "rotated-env", mustEncrypt(t, "KEY=new\n", key), nil, vault.SecretAttributes{})
+	_, _, _, err = diffVersion(ctx, store, key, "rotated-env", "1")
+	assert.ErrorContains(t, err, "cannot decrypt version 1 with the current key")
+	assert.ErrorIs(t, err, crypto.ErrDecryption)
+
+	_, _, _, err = diffVersion(ctx, store, key, "app-env", "9")
+	assert.ErrorIs(t, err, vault.ErrSecretNotFound)
+}
+
+func mustEncrypt(t *testing.T, content string, key []byte) string {
+	t.Helper()
+	encrypted, err := crypto.EncryptEnvContent([]byte(content), key)
+	if err != nil {
+		t.Fatalf("Failed to encrypt: %v", err)
+	}
+	return encrypted
+}
+
+func TestConfigCommands(t *testing.T) {
+	originalCfgFile := cfgFile
+	defer func() { cfgFile = originalCfgFile }()
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("vault_url: https://myvault.vault.azure.net/\nsecret_name: app-env\nkey_source: command\nkey_command: op read op://team/env-sync/key\n"), 0644))
+
+	output, err := execute("config", "show", "--config", configPath)
+	assert.NoError(t, err)
+	assert.Contains(t, output, "sync_interval: 15m0s")
+	assert.Contains(t, output, "[redacted]")
+	assert.NotContains(t, output, "op://team")
+
+	output, err = execute("config", "show", "--format", "json", "--show-values", "--config", configPath)
+	assert.NoError(t, err)
+	assert.Contains(t, output, `"key_command": "op read op://team/env-sync/key"`)
+
+	_, err = execute("config", "set", "sync_interval=30m", "notify.events=push, conflict", "--config", configPath)
+	assert.NoError(t, err)
+	cfg, err := config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Minute, cfg.SyncInterval)
+	assert.Equal(t, []string{"push", "conflict"}, cfg.Notify.Events)
+	data, err := os.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "env_file: .env", "defaults must not be written to the file")
+
+	_, err = execute("config", "set", "sync_interval=often", "--config", configPath)
+	assert.ErrorContains(t, err, "expected a duration")
+	_, err = execute("config", "set", "vault_url=", "--config", configPath)
+	assert.ErrorIs(t, err, config.ErrInvalidConfig)
+	_, err = execute("config", "set", "files=.env", "--config", configPath)
+	assert.ErrorContains(t, err, "edit the config file instead")
+	cfg, err = config.LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://myvault.vault.azure.net/", cfg.VaultURL, "a failed set must leave the file alone")
+}
+
+func TestWatchPull(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	dir := t.TempDir()
+	cfg := &config.Config{
+		EnvFile:    filepath.Join(dir, ".env"),
+		SecretName: "app-env",
+		Files:      []config.FileMapping{{EnvFile: filepath.Join(dir, ".env.test"), SecretName: "app-env-test"}},
+	}
+	store := vault.NewFakeStore()
+	for _, mapping := range cfg.Mappings() {
+		encrypted, err := crypto.EncryptEnvContent([]byte("KEY1="+mapping.SecretName+"\n"), key)
+		assert.NoError(t, err)
+		assert.NoError(t, store.StoreSecret(context.Background(), mapping.SecretName, encrypted, nil, vault.SecretAttributes{}))
+	}
+
+	// The watcher has none of pull's flags, so its pulls must not depend on them
+	pull := watchPull(cfg, store, key)
+	assert.NoError(t, pull())
+	for _, mapping := range cfg.Mappings() {
+		data, err := os.ReadFile(mapping.EnvFile)
+		assert.NoError(t, err)
+		assert.Equal(t, "KEY1="+mapping.SecretName+"\n", string(data))
+	}
+
+	// A failed pull is reported
+	otherKey := make([]byte, 32)
+	assert.Error(t, watchPull(cfg, store, otherKey)())
+}
+
+func TestPullToFileKeepsPreviousExportOnFailure(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	dir := t.TempDir()
+	mapping := config.FileMapping{EnvFile: filepath.Join(dir, ".env"), SecretName: "app-env"}
+	encrypted, err := crypto.EncryptEnvContent([]byte("KEY1=value1\n"), key)
+	assert.NoError(t, err)
+	store := vault.NewFakeStore()
+	assert.NoError(t, store.StoreSecret(context.Background(), mapping.SecretName, encrypted, nil, vault.SecretAttributes{}))
+	output := filepath.Join(dir, "export.json")
+	assert.NoError(t, os.WriteFile(output, []byte(`{"KEY1":"previous"}`), 0644))
+
+	assert.Error(t, pullToFile(&config.Config{}, store, make([]byte, 32), mapping, output, envsync.PullOptions{Format: sync.FormatJSON}))
+	data, err := os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Equal(t, `{"KEY1":"previous"}`, string(data))
+
+	assert.NoError(t, pullToFile(&config.Config{}, store, key, mapping, output, envsync.PullOptions{Format: sync.FormatJSON}))
+	data, err = os.ReadFile(output)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `"value1"`)
+	info, err := os.Stat(output)
+	assert.NoError(t, err)
+	assert.Equal(t, utils.SecretFileMode, info.Mode().Perm())
+}
@@ -0,0 +1,69 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// ActionPush records an upload of an env file to Key Vault.
+	ActionPush = "push"
+	// ActionPull records a download of a secret to an env file.
+	ActionPull = "pull"
+	// ActionRotate records the re-encryption of a secret with a new key.
+	ActionRotate = "rotate"
+	// ActionRollback records the restore of a secret from before a key rotation.
+	ActionRollback = "rollback"
+	// ActionRestore records a secret pushed back from a backup taken before a push.
+	ActionRestore = "restore"
+	// ActionDelete records the removal of a secret or local sync data.
+	ActionDelete = "delete"
+
+	// ResultSuccess marks an action that completed.
+	ResultSuccess = "success"
+	// ResultFailure marks an action that returned an error.
+	ResultFailure = "failure"
+	// ResultCancelled marks an action the user declined at a prompt.
+	ResultCancelled = "cancelled"
+)
+
+// Entry is one line of the audit log. It identifies content only by hash and never holds secret values.
+type Entry struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	SecretName  string    `json:"secret_name"`
+	ContentHash string    `json:"content_hash,omitempty"` // SHA-256 of the plaintext env content
+	User        string    `json:"user"`
+	Result      string    `json:"result"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// Append writes entry as a single JSON line at the end of the log at path,
+// creating the file (readable only by the owner) and its directory if needed.
+func Append(path string, entry Entry) error {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	// One write per entry keeps lines from concurrent pushes intact
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log '%s': %w", path, err)
+	}
+	return nil
+}
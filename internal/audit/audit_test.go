@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+
+	require.NoError(t, Append(path, Entry{Action: ActionPush, SecretName: "app-env", ContentHash: "abc", User: "dev", Result: ResultSuccess}))
+	require.NoError(t, Append(path, Entry{Action: ActionPull, SecretName: "app-env", User: "dev", Result: ResultFailure, Error: "timed out"}))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry Entry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+
+	require.Len(t, entries, 2)
+	assert.Equal(t, ActionPush, entries[0].Action)
+	assert.Equal(t, "abc", entries[0].ContentHash)
+	assert.False(t, entries[0].Time.IsZero())
+	assert.Equal(t, ResultFailure, entries[1].Result)
+	assert.Equal(t, "timed out", entries[1].Error)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	if info.Mode().Perm()&0077 != 0 {
+		t.Errorf("Expected audit log to be private, got %v", info.Mode().Perm())
+	}
+}
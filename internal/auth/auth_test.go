@@ -1,8 +1,13 @@
 package auth
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -55,4 +60,72 @@ func TestPrintAuthHelp(t *testing.T) {
 		PrintAuthHelp()
 		// If we get here, the function completed without panicking
 	})
-} 
\ No newline at end of file
+}
+
+func TestCurrentUser(t *testing.T) {
+	// Hide the Azure CLI so the local user name is used
+	t.Setenv("PATH", t.TempDir())
+
+	t.Run("falls back to USER", func(t *testing.T) {
+		t.Setenv("USER", "test-user")
+		t.Setenv("USERNAME", "other-user")
+		assert.Equal(t, "test-user", CurrentUser())
+	})
+
+	t.Run("falls back to USERNAME", func(t *testing.T) {
+		t.Setenv("USER", "")
+		t.Setenv("USERNAME", "windows-user")
+		assert.Equal(t, "windows-user", CurrentUser())
+	})
+}
+
+func TestManagedIdentityEnabled(t *testing.T) {
+	t.Cleanup(func() { SetManagedIdentity(nil) })
+	t.Setenv("MSI_ENDPOINT", "")
+	t.Setenv("IDENTITY_ENDPOINT", "")
+	assert.False(t, ManagedIdentityEnabled(), "laptops don't wait for IMDS")
+
+	t.Setenv("IDENTITY_ENDPOINT", "http://localhost:42356/msi/token")
+	assert.True(t, ManagedIdentityEnabled(), "Azure hosts are detected")
+
+	disabled, enabled := false, true
+	SetManagedIdentity(&disabled)
+	assert.False(t, ManagedIdentityEnabled())
+	t.Setenv("IDENTITY_ENDPOINT", "")
+	SetManagedIdentity(&enabled)
+	assert.True(t, ManagedIdentityEnabled(), "VMs without the variables can opt in")
+}
+
+// stubCredential returns err, or blocks until released when hang is set, ignoring its context
+type stubCredential struct {
+	err  error
+	hang chan struct{}
+}
+
+func (s *stubCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	if s.hang != nil {
+		<-s.hang
+	}
+	return azcore.AccessToken{Token: "token"}, s.err
+}
+
+func TestCheckToken(t *testing.T) {
+	t.Cleanup(func() { SetTimeout(DefaultTimeout) })
+	SetTimeout(20 * time.Millisecond)
+
+	assert.NoError(t, CheckToken(context.Background(), &stubCredential{}))
+	assert.True(t, IsAuthenticated(&stubCredential{}))
+
+	err := CheckToken(context.Background(), &stubCredential{err: errors.New("az login required")})
+	assert.ErrorIs(t, err, ErrNotAuthenticated)
+	assert.NotErrorIs(t, err, ErrTimeout)
+
+	// A credential that ignores its context can't hold the check past the timeout
+	hang := make(chan struct{})
+	defer close(hang)
+	start := time.Now()
+	err = CheckToken(context.Background(), &stubCredential{hang: hang})
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -2,8 +2,11 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
@@ -13,18 +16,72 @@ import (
 	"github.com/lliamscholtz/env-sync/internal/utils"
 )
 
-// CreateAzureCredential creates a new credential object for Azure authentication.
-// It uses a chain of credential sources for flexibility.
-func CreateAzureCredential() (azcore.TokenCredential, error) {
+// ErrNotAuthenticated is returned when no Azure credential can acquire a token.
+var ErrNotAuthenticated = errors.New("not authenticated with Azure")
+
+// managedIdentityEndpointVars are set by Azure hosts that serve managed identity tokens, such as
+// App Service, Functions, Container Apps, Arc and Cloud Shell
+var managedIdentityEndpointVars = []string{"MSI_ENDPOINT", "IDENTITY_ENDPOINT"}
+
+// managedIdentity overrides whether the credential chain includes managed identity; nil detects it
+var managedIdentity *bool
+
+// SetManagedIdentity includes managed identity in the credential chain or leaves it out. Nil
+// restores the default, see ManagedIdentityEnabled.
+func SetManagedIdentity(enabled *bool) {
+	managedIdentity = enabled
+}
+
+// ManagedIdentityEnabled reports whether CreateAzureCredential tries managed identity. Unless set
+// with SetManagedIdentity, it is only tried when MSI_ENDPOINT or IDENTITY_ENDPOINT is set: elsewhere
+// the first token request waits for the IMDS endpoint to time out, which slows every command.
+// Azure VMs serve tokens through IMDS without these variables, so they have to opt in.
+func ManagedIdentityEnabled() bool {
+	if managedIdentity != nil {
+		return *managedIdentity
+	}
+	for _, name := range managedIdentityEndpointVars {
+		if os.Getenv(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Names of the credentials in the chain, in the order they are tried.
+const (
+	CredentialAzureCLI        = "Azure CLI"
+	CredentialManagedIdentity = "Managed Identity"
+	CredentialEnvironment     = "Environment"
+)
+
+// namedCredential is a credential in the chain together with its name for reporting
+type namedCredential struct {
+	name string
+	cred azcore.TokenCredential
+}
+
+// credentialChain creates the credentials CreateAzureCredential chains, skipping any that fail to initialize
+func credentialChain() []namedCredential {
+	var creds []namedCredential
+
 	// The new SDK versions require creating the actual credential type, not its options.
 	cliCred, err := azidentity.NewAzureCLICredential(nil)
 	if err != nil {
 		utils.PrintWarning("⚠️ Could not create Azure CLI credential: %v\n", err)
+	} else {
+		creds = append(creds, namedCredential{CredentialAzureCLI, cliCred})
 	}
 
-	managedIDCred, err := azidentity.NewManagedIdentityCredential(nil)
-	if err != nil {
-		utils.PrintWarning("⚠️ Could not create Managed Identity credential: %v\n", err)
+	if ManagedIdentityEnabled() {
+		managedIDCred, err := azidentity.NewManagedIdentityCredential(nil)
+		if err != nil {
+			utils.PrintWarning("⚠️ Could not create Managed Identity credential: %v\n", err)
+		} else {
+			creds = append(creds, namedCredential{CredentialManagedIdentity, managedIDCred})
+		}
+	} else {
+		utils.PrintDebug("🔧 Skipping Managed Identity credential (set enable_managed_identity to use it)\n")
 	}
 
 	envCred, err := azidentity.NewEnvironmentCredential(nil)
@@ -32,24 +89,24 @@ func CreateAzureCredential() (azcore.TokenCredential, error) {
 		// Suppress warning for missing environment variables as this is expected
 		// when using Azure CLI authentication
 		utils.PrintDebug("🔧 Could not create Environment credential: %v\n", err)
+	} else {
+		creds = append(creds, namedCredential{CredentialEnvironment, envCred})
 	}
+	return creds
+}
 
-	// Filter out any credentials that failed to initialize
-	creds := []azcore.TokenCredential{}
-	if cliCred != nil {
-		creds = append(creds, cliCred)
-	}
-	if managedIDCred != nil {
-		creds = append(creds, managedIDCred)
-	}
-	if envCred != nil {
-		creds = append(creds, envCred)
+// CreateAzureCredential creates a new credential object for Azure authentication.
+// It uses a chain of credential sources for flexibility.
+func CreateAzureCredential() (azcore.TokenCredential, error) {
+	chain := credentialChain()
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("all credential types failed to initialize: %w", ErrNotAuthenticated)
 	}
 
-	if len(creds) == 0 {
-		return nil, fmt.Errorf("all credential types failed to initialize")
+	creds := make([]azcore.TokenCredential, len(chain))
+	for i, named := range chain {
+		creds[i] = named.cred
 	}
-
 	cred, err := azidentity.NewChainedTokenCredential(creds, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create Azure credential chain: %w", err)
@@ -57,14 +114,69 @@ func CreateAzureCredential() (azcore.TokenCredential, error) {
 	return cred, nil
 }
 
+// DefaultTimeout bounds token acquisition when SetTimeout hasn't been called.
+const DefaultTimeout = 30 * time.Second
+
+// timeout bounds each token acquisition by IsAuthenticated and EnsureAzureAuth
+var timeout = DefaultTimeout
+
+// SetTimeout sets how long verifying authentication may take across the whole credential chain.
+// Zero disables the timeout.
+func SetTimeout(d time.Duration) {
+	timeout = d
+}
+
+// keyVaultScope is the scope tokens are requested for, so they carry the identity Key Vault sees
+var keyVaultScope = policy.TokenRequestOptions{Scopes: []string{"https://vault.azure.net/.default"}}
+
+// ErrTimeout is returned by CheckToken when the credential chain doesn't produce a token in time.
+var ErrTimeout = errors.New("timed out acquiring an Azure token")
+
+// CheckToken acquires a Key Vault token with cred, bounded by ctx and the timeout set with
+// SetTimeout. It returns as soon as the deadline passes, even if a credential in the chain
+// ignores its context. Failures wrap ErrTimeout or ErrNotAuthenticated.
+func CheckToken(ctx context.Context, cred azcore.TokenCredential) error {
+	_, err := getToken(ctx, cred)
+	return err
+}
+
+// getToken acquires a Key Vault token as CheckToken describes
+func getToken(ctx context.Context, cred azcore.TokenCredential) (azcore.AccessToken, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		token azcore.AccessToken
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		token, err := cred.GetToken(ctx, keyVaultScope)
+		results <- result{token, err}
+	}()
+
+	var res result
+	select {
+	case res = <-results:
+	case <-ctx.Done():
+		res.err = ctx.Err()
+	}
+	switch {
+	case res.err == nil:
+		return res.token, nil
+	case errors.Is(res.err, context.DeadlineExceeded) || errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return azcore.AccessToken{}, fmt.Errorf("%w after %s (a slow credential such as managed identity may be the cause; increase with --timeout): %w", ErrTimeout, timeout, res.err)
+	default:
+		return azcore.AccessToken{}, fmt.Errorf("%w: %w", ErrNotAuthenticated, res.err)
+	}
+}
+
 // IsAuthenticated checks if the provided credential can acquire a token.
 func IsAuthenticated(cred azcore.TokenCredential) bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	// Use the correctly imported policy.TokenRequestOptions
-	_, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{"https://vault.azure.net/.default"}})
-	return err == nil
+	return CheckToken(context.Background(), cred) == nil
 }
 
 // EnsureAzureAuth is a high-level function that checks for Azure CLI and authentication status.
@@ -101,10 +213,14 @@ func checkAuthStatus() error {
 		return err
 	}
 
-	if !IsAuthenticated(cred) {
+	if err := CheckToken(context.Background(), cred); err != nil {
+		if errors.Is(err, ErrTimeout) {
+			utils.PrintError("❌ Verifying Azure authentication timed out.\n")
+			return err
+		}
 		utils.PrintError("❌ Not authenticated with Azure.\n")
 		PrintAuthHelp()
-		return fmt.Errorf("authentication failed")
+		return fmt.Errorf("authentication failed: %w", ErrNotAuthenticated)
 	}
 
 	utils.PrintSuccess("✅ Azure authentication successful.\n")
@@ -121,6 +237,23 @@ func CheckAzLoginStatus() error {
 	return nil
 }
 
+// CurrentUser returns the signed-in Azure CLI user (UPN), falling back to the local user name.
+func CurrentUser() string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	output, err := exec.CommandContext(ctx, "az", "account", "show", "--query", "user.name", "-o", "tsv").Output()
+	if err == nil {
+		if user := strings.TrimSpace(string(output)); user != "" {
+			return user
+		}
+	}
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return os.Getenv("USERNAME")
+}
+
 // PrintAuthHelp provides guidance on how to authenticate.
 func PrintAuthHelp() {
 	utils.PrintInfo("🔑 Please authenticate using one of the following methods:\n")
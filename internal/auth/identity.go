@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Identity is who Azure credentials authenticate as, read from the claims of a Key Vault token.
+type Identity struct {
+	Credential string    // Credential in the chain that produced the token, e.g. CredentialAzureCLI
+	Name       string    // User principal name, or empty for service principals and managed identities
+	AppID      string    // Application (client) ID of a service principal or managed identity
+	ObjectID   string    // Object ID of the user or service principal
+	TenantID   string    // Tenant the token was issued by
+	ExpiresOn  time.Time // When the token expires
+}
+
+// tokenClaims are the Entra ID access token claims that identify the caller
+type tokenClaims struct {
+	UPN               string `json:"upn"`
+	UniqueName        string `json:"unique_name"`
+	PreferredUsername string `json:"preferred_username"`
+	AppID             string `json:"appid"`
+	AzpAppID          string `json:"azp"`
+	ObjectID          string `json:"oid"`
+	TenantID          string `json:"tid"`
+}
+
+// WhoAmI tries the credentials of the chain CreateAzureCredential builds, in order, and describes
+// the identity of the first that acquires a token, the way the chain itself would pick it. Each
+// attempt is bounded by ctx and the timeout set with SetTimeout.
+func WhoAmI(ctx context.Context) (*Identity, error) {
+	chain := credentialChain()
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("all credential types failed to initialize: %w", ErrNotAuthenticated)
+	}
+	return identityFromChain(ctx, chain)
+}
+
+// identityFromChain returns the identity of the first credential in chain that acquires a token
+func identityFromChain(ctx context.Context, chain []namedCredential) (*Identity, error) {
+	var errs []error
+	for _, named := range chain {
+		token, err := getToken(ctx, named.cred)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", named.name, err))
+			continue
+		}
+		claims, err := parseTokenClaims(token.Token)
+		if err != nil {
+			return nil, fmt.Errorf("%s returned a token env-sync can't read: %w", named.name, err)
+		}
+		identity := &Identity{
+			Credential: named.name,
+			Name:       firstNonEmpty(claims.UPN, claims.PreferredUsername, claims.UniqueName),
+			AppID:      firstNonEmpty(claims.AppID, claims.AzpAppID),
+			ObjectID:   claims.ObjectID,
+			TenantID:   claims.TenantID,
+			ExpiresOn:  token.ExpiresOn,
+		}
+		return identity, nil
+	}
+	// Each failure wraps ErrNotAuthenticated or ErrTimeout already
+	return nil, fmt.Errorf("no credential in the chain acquired a token: %w", errors.Join(errs...))
+}
+
+// parseTokenClaims decodes the payload of a JWT access token. The signature isn't verified: the
+// claims are only displayed, and Key Vault verifies the token itself.
+func parseTokenClaims(token string) (*tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, fmt.Errorf("invalid token payload: %w", err)
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	return &claims, nil
+}
+
+// firstNonEmpty returns the first of values that isn't empty
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
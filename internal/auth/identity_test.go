@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenCredential returns a token carrying claims
+type tokenCredential struct {
+	claims string
+}
+
+func (c *tokenCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	token := "eyJhbGciOiJub25lIn0." + base64.RawURLEncoding.EncodeToString([]byte(c.claims)) + ".sig"
+	return azcore.AccessToken{Token: token, ExpiresOn: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}, nil
+}
+
+func TestIdentityFromChain(t *testing.T) {
+	user := &tokenCredential{claims: `{"upn":"alice@contoso.com","oid":"1111","tid":"tenant-a"}`}
+	app := &tokenCredential{claims: `{"appid":"app-1","oid":"2222","tid":"tenant-b"}`}
+
+	// The first credential that acquires a token wins, as in the chain
+	identity, err := identityFromChain(context.Background(), []namedCredential{
+		{CredentialAzureCLI, &stubCredential{err: errors.New("run az login")}},
+		{CredentialEnvironment, user},
+		{CredentialManagedIdentity, app},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, &Identity{
+		Credential: CredentialEnvironment,
+		Name:       "alice@contoso.com",
+		ObjectID:   "1111",
+		TenantID:   "tenant-a",
+		ExpiresOn:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+	}, identity)
+
+	identity, err = identityFromChain(context.Background(), []namedCredential{{CredentialManagedIdentity, app}})
+	assert.NoError(t, err)
+	assert.Equal(t, "", identity.Name)
+	assert.Equal(t, "app-1", identity.AppID)
+
+	_, err = identityFromChain(context.Background(), []namedCredential{{CredentialAzureCLI, &stubCredential{err: errors.New("run az login")}}})
+	assert.ErrorIs(t, err, ErrNotAuthenticated)
+	assert.ErrorContains(t, err, "Azure CLI: ")
+
+	_, err = identityFromChain(context.Background(), []namedCredential{{CredentialAzureCLI, &stubCredential{}}})
+	assert.ErrorContains(t, err, "can't read")
+}
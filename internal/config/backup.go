@@ -0,0 +1,153 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultBackupDir is the directory next to each env file that backups are written to when
+// backup_dir is unset.
+const DefaultBackupDir = ".env-sync-backups"
+
+// DefaultBackupName is the backup file name template used when backup_name is unset.
+const DefaultBackupName = "{{.Side}}-{{.Timestamp}}.env"
+
+// BackupTimestampFormat is the time layout of {{.Timestamp}} in backup file names.
+const BackupTimestampFormat = "20060102-150405"
+
+// BackupNameVars holds the values available to backup_name templates.
+type BackupNameVars struct {
+	Name      string // Base name of the backed up env file, e.g. .env.test
+	Timestamp string // When the backup was taken, formatted with BackupTimestampFormat
+	Side      string // "local" or "remote": which version of the file the backup holds
+}
+
+// BackupNameVariables lists the variables available to backup_name templates.
+var BackupNameVariables = []string{"Name", "Timestamp", "Side"}
+
+// BackupDirFor returns the directory backups of envFile are written to: backup_dir, or
+// DefaultBackupDir next to envFile.
+func (c *Config) BackupDirFor(envFile string) string {
+	if c.BackupDir != "" {
+		return c.BackupDir
+	}
+	return filepath.Join(filepath.Dir(envFile), DefaultBackupDir)
+}
+
+// BackupPath returns the file a backup of envFile taken at is written to. side is "local" or
+// "remote".
+func (c *Config) BackupPath(envFile, side string, at time.Time) (string, error) {
+	return BackupPath(c.BackupDirFor(envFile), c.BackupName, envFile, side, at)
+}
+
+// BackupPath returns the file in dir that the backup_name template name gives a backup of
+// envFile taken at. An empty name uses DefaultBackupName.
+func BackupPath(dir, name, envFile, side string, at time.Time) (string, error) {
+	file, err := ExpandBackupName(name, BackupNameVars{
+		Name:      filepath.Base(envFile),
+		Timestamp: at.Format(BackupTimestampFormat),
+		Side:      side,
+	})
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, file), nil
+}
+
+// BackupFiles returns the backups of envFile in backup_dir, matched by backup_name. Other files
+// there are not env-sync's. Without backup_dir it returns nil: the whole default directory is.
+func (c *Config) BackupFiles(envFile string) ([]string, error) {
+	if c.BackupDir == "" {
+		return nil, nil
+	}
+	var files []string
+	for _, side := range []string{"local", "remote"} {
+		pattern, err := ExpandBackupName(c.BackupName, BackupNameVars{Name: globEscape(filepath.Base(envFile)), Timestamp: "*", Side: side})
+		if err != nil {
+			return nil, err
+		}
+		matches, err := filepath.Glob(filepath.Join(globEscape(c.BackupDir), pattern))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// ExpandBackupName expands a backup_name template into a file name. An empty template uses
+// DefaultBackupName. The result must be a file name, not a path.
+func ExpandBackupName(name string, vars BackupNameVars) (string, error) {
+	if name == "" {
+		name = DefaultBackupName
+	}
+	tmpl, err := template.New("backup_name").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid backup_name template '%s': %w", name, err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		if strings.Contains(err.Error(), "can't evaluate field") {
+			return "", fmt.Errorf("unknown variable in backup_name template '%s'. Available variables: {{.%s}}", name, strings.Join(BackupNameVariables, "}}, {{."))
+		}
+		return "", fmt.Errorf("failed to expand backup_name template '%s': %w", name, err)
+	}
+	expanded := b.String()
+	if expanded == "" || expanded == "." || expanded == ".." || strings.ContainsAny(expanded, `/\`) {
+		return "", fmt.Errorf("backup_name template '%s' must expand to a file name, got '%s'", name, expanded)
+	}
+	return expanded, nil
+}
+
+// validateBackupName checks that a backup_name template expands to a file name that differs
+// between the local and remote side and between backups, so no backup overwrites another
+func validateBackupName(name string) error {
+	vars := BackupNameVars{Name: ".env", Timestamp: "20240501-123000", Side: "local"}
+	base, err := ExpandBackupName(name, vars)
+	if err != nil {
+		return err
+	}
+	for _, change := range []struct {
+		variable string
+		vars     BackupNameVars
+	}{
+		{"{{.Side}}", BackupNameVars{Name: vars.Name, Timestamp: vars.Timestamp, Side: "remote"}},
+		{"{{.Timestamp}}", BackupNameVars{Name: vars.Name, Timestamp: "20240501-123001", Side: vars.Side}},
+	} {
+		if other, err := ExpandBackupName(name, change.vars); err != nil || other == base {
+			return fmt.Errorf("backup_name template '%s' must use %s, or backups would overwrite each other", name, change.variable)
+		}
+	}
+	return nil
+}
+
+// validateBackupDir refuses backup directories that can't be env-sync's own, such as the current
+// or root directory, where backups would mix with everything else
+func validateBackupDir(dir string) error {
+	if strings.HasPrefix(dir, "~") {
+		return fmt.Errorf("backup_dir '%s': ~ is not expanded; use an absolute or relative path", dir)
+	}
+	clean := filepath.Clean(dir)
+	if clean == "." || clean == ".." || filepath.Dir(clean) == clean {
+		return fmt.Errorf("backup_dir '%s' must be a directory of its own, not the current, parent or root directory", dir)
+	}
+	return nil
+}
+
+// globEscape makes the filepath.Match metacharacters in s match themselves. Brackets work on
+// every platform, unlike a backslash, which is the path separator on Windows.
+func globEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune("*?[", r) {
+			b.WriteString("[" + string(r) + "]")
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupPath(t *testing.T) {
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	cfg := &Config{}
+	path, err := cfg.BackupPath(filepath.Join("api", ".env"), "local", at)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("api", ".env-sync-backups", "local-20240501-123000.env"), path)
+
+	cfg = &Config{BackupDir: "backups", BackupName: "{{.Name}}.{{.Side}}.{{.Timestamp}}"}
+	path, err = cfg.BackupPath(filepath.Join("api", ".env.test"), "remote", at)
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("backups", ".env.test.remote.20240501-123000"), path)
+}
+
+func TestExpandBackupNameErrors(t *testing.T) {
+	vars := BackupNameVars{Name: ".env", Timestamp: "20240501-123000", Side: "local"}
+	_, err := ExpandBackupName("{{.Branch}}-{{.Timestamp}}", vars)
+	assert.ErrorContains(t, err, "Available variables: {{.Name}}, {{.Timestamp}}, {{.Side}}")
+	_, err = ExpandBackupName("{{.Side", vars)
+	assert.ErrorContains(t, err, "invalid backup_name template")
+	_, err = ExpandBackupName("{{.Side}}/{{.Timestamp}}", vars)
+	assert.ErrorContains(t, err, "must expand to a file name")
+
+	assert.NoError(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", BackupName: "{{.Name}}-{{.Side}}-{{.Timestamp}}"}).Validate())
+	assert.ErrorContains(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", BackupName: "../{{.Name}}"}).Validate(), "must expand to a file name")
+}
+
+func TestBackupNameMustNotCollide(t *testing.T) {
+	// Local and remote backups of one conflict, or two backups of one side, would share a file
+	for name, variable := range map[string]string{
+		"{{.Name}}-{{.Timestamp}}.env": "{{.Side}}",
+		"{{.Name}}-{{.Side}}.env":      "{{.Timestamp}}",
+		"backup.env":                   "{{.Side}}",
+	} {
+		cfg := &Config{VaultURL: "a", SecretName: "b", KeySource: "file", BackupName: name}
+		assert.ErrorContains(t, cfg.Validate(), "must use "+variable, name)
+	}
+}
+
+func TestBackupDirValidation(t *testing.T) {
+	for _, dir := range []string{".", "./", "..", "/", "~/backups"} {
+		cfg := &Config{VaultURL: "a", SecretName: "b", KeySource: "file", BackupDir: dir}
+		assert.Error(t, cfg.Validate(), dir)
+	}
+	assert.NoError(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", BackupDir: ".cache/backups"}).Validate())
+}
+
+func TestBackupFiles(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &Config{BackupDir: dir, BackupName: "{{.Name}}.{{.Side}}-{{.Timestamp}}"}
+	at := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	var want []string
+	for _, side := range []string{"local", "remote"} {
+		path, err := cfg.BackupPath(".env", side, at)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(path, nil, 0600))
+		want = append(want, path)
+	}
+	for _, other := range []string{"notes.txt", ".env.test.local-20240501-123000"} {
+		assert.NoError(t, os.WriteFile(filepath.Join(dir, other), nil, 0600))
+	}
+
+	files, err := cfg.BackupFiles(".env")
+	assert.NoError(t, err)
+	assert.Equal(t, want, files)
+
+	files, err = (&Config{}).BackupFiles(".env")
+	assert.NoError(t, err)
+	assert.Nil(t, files)
+}
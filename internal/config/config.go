@@ -1,37 +1,177 @@
 package config
 
 import (
-	"encoding/base64"
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/lliamscholtz/env-sync/internal/auth"
 	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/deps"
+	"github.com/lliamscholtz/env-sync/internal/keychain"
+	"github.com/lliamscholtz/env-sync/internal/kms"
+	"github.com/lliamscholtz/env-sync/internal/notify"
 	"github.com/lliamscholtz/env-sync/internal/utils"
+	"github.com/lliamscholtz/env-sync/internal/vault"
 	"github.com/spf13/viper"
 	"golang.org/x/term"
-	"gopkg.in/yaml.v3"
 )
 
 // Config holds the application's configuration.
 type Config struct {
-	VaultURL         string        `yaml:"vault_url" mapstructure:"vault_url"`
-	SecretName       string        `yaml:"secret_name" mapstructure:"secret_name"`
-	EnvFile          string        `yaml:"env_file" mapstructure:"env_file"`
-	SyncInterval     time.Duration `yaml:"sync_interval" mapstructure:"sync_interval"`
-	KeySource        string        `yaml:"key_source" mapstructure:"key_source"` // "env", "file", "prompt"
-	KeyFile          string        `yaml:"key_file" mapstructure:"key_file"`   // Path to key file if key_source is "file"
-	ConflictStrategy string        `yaml:"conflict_strategy" mapstructure:"conflict_strategy"` // "manual", "local", "remote", "merge", "backup"
-	AutoBackup       bool          `yaml:"auto_backup" mapstructure:"auto_backup"` // Enable automatic backups on conflicts
+	VaultURL              string             `yaml:"vault_url" mapstructure:"vault_url"`
+	SecretName            string             `yaml:"secret_name" mapstructure:"secret_name"`
+	EnvFile               string             `yaml:"env_file" mapstructure:"env_file"`
+	SyncInterval          time.Duration      `yaml:"sync_interval" mapstructure:"sync_interval"`
+	KeySource             string             `yaml:"key_source" mapstructure:"key_source"`                                       // "env", "file", "prompt", "kms", "keychain", "command"
+	KeyFile               string             `yaml:"key_file" mapstructure:"key_file"`                                           // Path to key file if key_source is "file"
+	KeyEnvVar             string             `yaml:"key_env_var,omitempty" mapstructure:"key_env_var"`                           // Environment variable holding the key if key_source is "env"
+	KeychainAccount       string             `yaml:"keychain_account,omitempty" mapstructure:"keychain_account"`                 // OS keyring account holding the key if key_source is "keychain"
+	KeyCommand            string             `yaml:"key_command,omitempty" mapstructure:"key_command"`                           // Shell command printing the key if key_source is "command"
+	KeyFormat             string             `yaml:"key_format,omitempty" mapstructure:"key_format"`                             // "auto" (default), "base64" or "hex"
+	KMSKeyID              string             `yaml:"kms_key_id,omitempty" mapstructure:"kms_key_id"`                             // Key Vault key that wraps the data key if key_source is "kms"
+	KMSWrappedKeySecret   string             `yaml:"kms_wrapped_key_secret,omitempty" mapstructure:"kms_wrapped_key_secret"`     // Secret holding the wrapped data key (default: <secret_name>-dek)
+	ConflictStrategy      string             `yaml:"conflict_strategy" mapstructure:"conflict_strategy"`                         // "manual", "local", "remote", "merge", "backup"
+	AutoBackup            bool               `yaml:"auto_backup" mapstructure:"auto_backup"`                                     // Enable automatic backups on conflicts
+	PostPullQuiet         time.Duration      `yaml:"post_pull_quiet" mapstructure:"post_pull_quiet"`                             // Window after a pull during which file changes are not pushed
+	DebounceInterval      time.Duration      `yaml:"debounce_interval,omitempty" mapstructure:"debounce_interval"`               // Minimum time between pushes triggered by file changes
+	PostPullHook          string             `yaml:"post_pull_hook,omitempty" mapstructure:"post_pull_hook"`                     // Shell command run after a successful pull
+	PostPushHook          string             `yaml:"post_push_hook,omitempty" mapstructure:"post_push_hook"`                     // Shell command run after a successful push
+	Notify                NotifyConfig       `yaml:"notify,omitempty" mapstructure:"notify"`                                     // Webhook notifications for sync events
+	Files                 []FileMapping      `yaml:"files,omitempty" mapstructure:"files"`                                       // Additional env files synced alongside env_file
+	MaxConcurrency        int                `yaml:"max_concurrency,omitempty" mapstructure:"max_concurrency"`                   // Maximum number of files synced in parallel
+	LocalOverlay          string             `yaml:"local_overlay,omitempty" mapstructure:"local_overlay"`                       // Local overrides file (e.g. .env.local) that is never pushed or pulled
+	Dependencies          []DependencyConfig `yaml:"dependencies,omitempty" mapstructure:"dependencies"`                         // Extra tools checked by doctor and install-deps
+	AuditLog              string             `yaml:"audit_log,omitempty" mapstructure:"audit_log"`                               // File that each push, pull and rotation is appended to as a JSON line
+	Recipients            []string           `yaml:"recipients,omitempty" mapstructure:"recipients"`                             // Public keys each push is encrypted to; the loaded key is then your private key
+	SecretPrefix          string             `yaml:"secret_prefix,omitempty" mapstructure:"secret_prefix"`                       // Prepended to every secret name; secrets without it are refused
+	IgnoreCommentsForSync bool               `yaml:"ignore_comments_for_sync,omitempty" mapstructure:"ignore_comments_for_sync"` // Detect changes by key/value pairs only, so comment-only edits aren't pushed or conflicts
+	ReadOnly              bool               `yaml:"read_only,omitempty" mapstructure:"read_only"`                               // Refuse every vault write (push, rotate-key, watcher pushes); pulls still work
+	EnableManagedIdentity *bool              `yaml:"enable_managed_identity,omitempty" mapstructure:"enable_managed_identity"`   // Try Azure managed identity; unset tries it only when MSI_ENDPOINT or IDENTITY_ENDPOINT is set
+	Direnv                bool               `yaml:"direnv,omitempty" mapstructure:"direnv"`                                     // After a pull, make .envrc load the env files and run 'direnv allow'
+	StateFile             string             `yaml:"state_file,omitempty" mapstructure:"state_file"`                             // Sync state file shared by every mapping (default: .env-sync-state.json next to each env file)
+	FileMode              string             `yaml:"file_mode,omitempty" mapstructure:"file_mode"`                               // Octal mode pulled env files are written with (default: 0600)
+	KeyFileMode           string             `yaml:"key_file_mode,omitempty" mapstructure:"key_file_mode"`                       // Octal mode generated key files are written with (default: 0600)
+	StateFileMode         string             `yaml:"state_file_mode,omitempty" mapstructure:"state_file_mode"`                   // Octal mode sync state files are written with (default: 0600)
+	FallbackVaultURL      string             `yaml:"fallback_vault_url,omitempty" mapstructure:"fallback_vault_url"`             // Second vault pushes are copied to (best-effort) and pulls fall back to when vault_url is unreachable
+	PreviousKeys          []string           `yaml:"previous_keys,omitempty" mapstructure:"previous_keys"`                       // Files holding keys retired by rotate-key that content is still decrypted with
+	SecretExpiresIn       time.Duration      `yaml:"secret_expires_in,omitempty" mapstructure:"secret_expires_in"`               // Pushed secret versions expire this long after the push
+	SecretNotBefore       string             `yaml:"secret_not_before,omitempty" mapstructure:"secret_not_before"`               // RFC 3339 time before which pushed secret versions are not active
+	BackupDir             string             `yaml:"backup_dir,omitempty" mapstructure:"backup_dir"`                             // Directory conflict and pull backups are written to (default: .env-sync-backups next to each env file)
+	BackupName            string             `yaml:"backup_name,omitempty" mapstructure:"backup_name"`                           // Backup file name template with {{.Name}}, {{.Timestamp}} and {{.Side}} (default: {{.Side}}-{{.Timestamp}}.env)
+}
+
+// DefaultKeyEnvVar is the environment variable read by the env key source when key_env_var is unset.
+const DefaultKeyEnvVar = "ENVSYNC_ENCRYPTION_KEY"
+
+// DefaultKeychainAccount is the OS keyring account read by the keychain key source when keychain_account is unset.
+const DefaultKeychainAccount = "default"
+
+// KeyCommandTimeout bounds how long the command key source waits for key_command.
+const KeyCommandTimeout = 30 * time.Second
+
+// DefaultPostPullQuiet is the window after a pull during which the watcher ignores file changes when post_pull_quiet is unset.
+const DefaultPostPullQuiet = 3 * time.Second
+
+// DefaultDebounceInterval is the watcher's minimum time between change-triggered pushes when debounce_interval is unset.
+const DefaultDebounceInterval = 5 * time.Second
+
+// DefaultMaxConcurrency is the number of file mappings synced in parallel when max_concurrency is unset.
+const DefaultMaxConcurrency = 4
+
+// FileMapping maps a local env file to a secret in Azure Key Vault.
+type FileMapping struct {
+	EnvFile    string `yaml:"env_file" mapstructure:"env_file"`
+	SecretName string `yaml:"secret_name" mapstructure:"secret_name"`
+}
+
+// DependencyConfig declares an extra command-line tool that doctor and install-deps check.
+type DependencyConfig struct {
+	Name        string            `yaml:"name" mapstructure:"name"`
+	Command     string            `yaml:"command" mapstructure:"command"`
+	MinVersion  string            `yaml:"min_version,omitempty" mapstructure:"min_version"`
+	Required    bool              `yaml:"required,omitempty" mapstructure:"required"`
+	Install     map[string]string `yaml:"install,omitempty" mapstructure:"install"`           // Install command per platform key, e.g. "linux-apt"
+	DownloadURL map[string]string `yaml:"download_url,omitempty" mapstructure:"download_url"` // Manual install page per OS
+}
+
+// NotifyConfig configures webhook notifications.
+type NotifyConfig struct {
+	WebhookURL string   `yaml:"webhook_url,omitempty" mapstructure:"webhook_url"`
+	Events     []string `yaml:"events,omitempty" mapstructure:"events"` // "push", "pull", "conflict", "rotate"; empty means all
+}
+
+// EnvPrefix prefixes the environment variables that set configuration keys, e.g. ENVSYNC_SECRET_NAME.
+const EnvPrefix = "ENVSYNC"
+
+// bindEnv binds an environment variable for every configuration key in t. Nested keys such as
+// notify.webhook_url use an underscore (ENVSYNC_NOTIFY_WEBHOOK_URL); lists of mappings such as
+// files can only be set in the config file.
+func bindEnv(v *viper.Viper, t reflect.Type, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		switch {
+		case field.Type.Kind() == reflect.Struct:
+			bindEnv(v, field.Type, key+".")
+			continue
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.Struct:
+			continue
+		}
+		_ = v.BindEnv(key) // Only fails without a key
+	}
+}
+
+// Overrides replaces configured values for a single invocation, e.g. from command-line flags.
+// Empty fields leave the configured value unchanged.
+type Overrides struct {
+	VaultURL string
+}
+
+var overrides Overrides
+
+// SetOverrides sets the values LoadConfig applies on top of the config file, before validation.
+func SetOverrides(o Overrides) {
+	overrides = o
+}
+
+// ErrInvalidConfig is matched, with errors.Is, by every error LoadConfig and Validate return.
+var ErrInvalidConfig = errors.New("invalid configuration")
+
+// configError marks an error as a configuration error without changing its message
+type configError struct {
+	err error
+}
+
+func (e *configError) Error() string {
+	return e.err.Error()
+}
+
+func (e *configError) Unwrap() []error {
+	return []error{e.err, ErrInvalidConfig}
 }
 
 // LoadConfig loads the configuration from the given file path.
 // It uses a new viper instance to avoid global state issues.
 func LoadConfig(path string) (*Config, error) {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		return nil, &configError{err}
+	}
+	return cfg, nil
+}
+
+func loadConfig(path string) (*Config, error) {
 	v := viper.New()
 	if path != "" {
 		v.SetConfigFile(path)
-		v.SetConfigType("yaml") // Explicitly set the config type
+		v.SetConfigType(FileFormat(path)) // .env-sync and other names without an extension are YAML
 	} else {
 		// Default behavior if no path is provided
 		v.SetConfigName(".env-sync")
@@ -39,6 +179,11 @@ func LoadConfig(path string) (*Config, error) {
 		v.AddConfigPath(".")
 	}
 
+	// ENVSYNC_<KEY> environment variables take precedence over the file, e.g. ENVSYNC_VAULT_URL
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	bindEnv(v, reflect.TypeOf(Config{}), "")
+
 	if err := v.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
 			// Config file not found is okay, we'll use defaults or command-line flags.
@@ -54,47 +199,360 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
 
+	if overrides.VaultURL != "" {
+		cfg.VaultURL = overrides.VaultURL
+	}
+	if err := cfg.finish(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// finish expands secret name templates, applies the secret prefix and defaults, and validates
+// the result, turning the settings read from a config file into the configuration commands use
+func (c *Config) finish() error {
+	// Expand secret name templates such as myapp-{{.Env}}-dotenv
+	secretName, err := expandSecretName(c.SecretName, templateVars)
+	if err != nil {
+		return err
+	}
+	c.SecretName = secretName
+	for i := range c.Files {
+		secretName, err := expandSecretName(c.Files[i].SecretName, templateVars)
+		if err != nil {
+			return fmt.Errorf("files[%d]: %w", i, err)
+		}
+		c.Files[i].SecretName = secretName
+	}
+
+	// Namespace every secret so apps sharing a vault can't overwrite each other's
+	if c.SecretName != "" {
+		c.SecretName = c.PrefixedSecretName(c.SecretName)
+	}
+	for i := range c.Files {
+		if c.Files[i].SecretName != "" {
+			c.Files[i].SecretName = c.PrefixedSecretName(c.Files[i].SecretName)
+		}
+	}
+	if c.KMSWrappedKeySecret != "" {
+		c.KMSWrappedKeySecret = c.PrefixedSecretName(c.KMSWrappedKeySecret)
+	}
+
 	// Set defaults for any zero values
-	if cfg.SyncInterval == 0 {
-		cfg.SyncInterval = 15 * time.Minute
+	if c.SyncInterval == 0 {
+		c.SyncInterval = 15 * time.Minute
 	}
-	if cfg.EnvFile == "" {
-		cfg.EnvFile = ".env"
+	if c.EnvFile == "" {
+		c.EnvFile = ".env"
+	}
+	if c.ConflictStrategy == "" {
+		c.ConflictStrategy = "manual" // Safe default
+	}
+	if c.PostPullQuiet == 0 {
+		c.PostPullQuiet = DefaultPostPullQuiet
 	}
-	if cfg.ConflictStrategy == "" {
-		cfg.ConflictStrategy = "manual" // Safe default
+	if c.DebounceInterval == 0 {
+		c.DebounceInterval = DefaultDebounceInterval
+	}
+	if c.MaxConcurrency == 0 {
+		c.MaxConcurrency = DefaultMaxConcurrency
 	}
 
 	// Validate the final configuration
-	if err := cfg.Validate(); err != nil {
-		return nil, fmt.Errorf("invalid config: %w", err)
+	if err := c.Validate(); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
 	}
-
-	return &cfg, nil
+	return nil
 }
 
 // Validate checks if the configuration values are valid.
 func (c *Config) Validate() error {
+	if err := c.validate(); err != nil {
+		return &configError{err}
+	}
+	return nil
+}
+
+func (c *Config) validate() error {
 	if c.VaultURL == "" {
 		return fmt.Errorf("vault_url is required")
 	}
+	if c.FallbackVaultURL != "" {
+		if err := vault.ValidateVaultURL(c.FallbackVaultURL); err != nil {
+			return fmt.Errorf("invalid fallback_vault_url: %w", err)
+		}
+		if strings.TrimSuffix(c.FallbackVaultURL, "/") == strings.TrimSuffix(c.VaultURL, "/") {
+			return fmt.Errorf("fallback_vault_url must be a different vault than vault_url")
+		}
+	}
 	if c.SecretName == "" {
 		return fmt.Errorf("secret_name is required")
 	}
+	if err := vault.ValidateSecretName(c.SecretName); err != nil {
+		return fmt.Errorf("invalid secret_name: %w", err)
+	}
 	if c.EnvFile == "" {
 		c.EnvFile = ".env" // Default value
 	}
 	if c.KeySource == "" {
-		return fmt.Errorf("key_source is required (env, file, or prompt)")
+		return fmt.Errorf("key_source is required (env, file, prompt, kms, keychain, or command)")
+	}
+	if c.KeySource == "command" && strings.TrimSpace(c.KeyCommand) == "" {
+		return fmt.Errorf("key_command is required when key_source is 'command'")
+	}
+	if c.KeySource == "kms" && c.KMSKeyID == "" {
+		return fmt.Errorf("kms_key_id is required when key_source is 'kms'")
+	}
+	if c.KMSWrappedKeySecret != "" {
+		if err := vault.ValidateSecretName(c.KMSWrappedKeySecret); err != nil {
+			return fmt.Errorf("invalid kms_wrapped_key_secret: %w", err)
+		}
+	}
+	if c.LocalOverlay != "" {
+		for _, mapping := range c.Mappings() {
+			if filepath.Clean(mapping.EnvFile) == filepath.Clean(c.LocalOverlay) {
+				return fmt.Errorf("local_overlay '%s' must not be a synced env file", c.LocalOverlay)
+			}
+		}
+	}
+	if c.KeyEnvVar != "" && !isValidEnvVarName(c.KeyEnvVar) {
+		return fmt.Errorf("key_env_var '%s' is not a valid environment variable name", c.KeyEnvVar)
+	}
+	if c.KeyFormat != "" && !isValidKeyFormat(c.KeyFormat) {
+		return fmt.Errorf("invalid key_format '%s'. Must be one of: %s", c.KeyFormat, strings.Join(crypto.KeyFormats, ", "))
+	}
+	if c.MaxConcurrency < 0 {
+		return fmt.Errorf("max_concurrency must not be negative")
+	}
+	fileModes := []struct{ option, value string }{
+		{"file_mode", c.FileMode},
+		{"key_file_mode", c.KeyFileMode},
+		{"state_file_mode", c.StateFileMode},
+	}
+	for _, mode := range fileModes {
+		if mode.value == "" {
+			continue
+		}
+		if _, err := parseFileMode(mode.value); err != nil {
+			return fmt.Errorf("invalid %s: %w", mode.option, err)
+		}
+	}
+	if c.BackupDir != "" {
+		if err := validateBackupDir(c.BackupDir); err != nil {
+			return err
+		}
+	}
+	if c.BackupName != "" {
+		if err := validateBackupName(c.BackupName); err != nil {
+			return err
+		}
+	}
+	if c.SyncInterval < 0 || c.DebounceInterval < 0 || c.PostPullQuiet < 0 {
+		return fmt.Errorf("sync_interval, debounce_interval and post_pull_quiet must not be negative")
+	}
+	seen := map[string]bool{c.SecretName: true}
+	for i, mapping := range c.Files {
+		if mapping.EnvFile == "" || mapping.SecretName == "" {
+			return fmt.Errorf("files[%d]: env_file and secret_name are required", i)
+		}
+		if err := vault.ValidateSecretName(mapping.SecretName); err != nil {
+			return fmt.Errorf("files[%d]: invalid secret_name: %w", i, err)
+		}
+		if seen[mapping.SecretName] {
+			return fmt.Errorf("files[%d]: secret_name '%s' is mapped more than once", i, mapping.SecretName)
+		}
+		seen[mapping.SecretName] = true
+	}
+	for i, dep := range c.ExtraDependencies() {
+		if err := dep.Validate(); err != nil {
+			return fmt.Errorf("dependencies[%d]: %w", i, err)
+		}
+	}
+	for _, event := range c.Notify.Events {
+		if !isValidNotifyEvent(event) {
+			return fmt.Errorf("invalid notify event '%s'. Must be one of: %s", event, strings.Join(notify.ValidEvents, ", "))
+		}
+	}
+	if err := c.validateRecipients(); err != nil {
+		return err
+	}
+	if err := c.validatePreviousKeys(); err != nil {
+		return err
+	}
+	if err := c.validateSecretAttributes(); err != nil {
+		return err
+	}
+	if err := c.validateSecretPrefix(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// validateSecretPrefix checks that every secret env-sync touches carries secret_prefix
+func (c *Config) validateSecretPrefix() error {
+	if c.SecretPrefix == "" {
+		return nil
+	}
+	if err := vault.ValidateSecretName(c.SecretPrefix); err != nil {
+		return fmt.Errorf("invalid secret_prefix: %w", err)
+	}
+	for _, mapping := range c.Mappings() {
+		if err := c.CheckSecretPrefix(mapping.SecretName); err != nil {
+			return err
+		}
+	}
+	if c.KMSWrappedKeySecret != "" {
+		if err := c.CheckSecretPrefix(c.KMSWrappedKeySecret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrefixedSecretName returns name with secret_prefix prepended, unless it already starts with it.
+func (c *Config) PrefixedSecretName(name string) string {
+	if strings.HasPrefix(name, c.SecretPrefix) {
+		return name
+	}
+	return c.SecretPrefix + name
+}
+
+// CheckSecretPrefix returns an error if secret_prefix is set and name doesn't start with it.
+func (c *Config) CheckSecretPrefix(name string) error {
+	if !strings.HasPrefix(name, c.SecretPrefix) {
+		return fmt.Errorf("secret '%s' lacks the configured secret_prefix '%s'; refusing to touch a secret outside this app's namespace", name, c.SecretPrefix)
+	}
+	return nil
+}
+
+// ErrReadOnly is returned, wrapped, by CheckWritable when read_only is set.
+var ErrReadOnly = errors.New("read-only mode")
+
+// CheckWritable returns an error naming action if read_only is set, so callers can refuse a vault
+// write before making it.
+func (c *Config) CheckWritable(action string) error {
+	if c.ReadOnly {
+		return fmt.Errorf("%w: refusing to %s (read_only is set in the config or %s_READ_ONLY)", ErrReadOnly, action, EnvPrefix)
 	}
 	return nil
 }
 
-// WriteToFile saves the configuration to a YAML file.
+// Mappings returns every file mapping, starting with the primary env_file and secret_name.
+func (c *Config) Mappings() []FileMapping {
+	mappings := []FileMapping{{EnvFile: c.EnvFile, SecretName: c.SecretName}}
+	return append(mappings, c.Files...)
+}
+
+// ExtraDependencies converts the configured dependencies for the deps package.
+func (c *Config) ExtraDependencies() []deps.Dependency {
+	extra := make([]deps.Dependency, len(c.Dependencies))
+	for i, dep := range c.Dependencies {
+		extra[i] = deps.Dependency{
+			Name:        dep.Name,
+			Command:     dep.Command,
+			Version:     dep.MinVersion,
+			InstallCmd:  dep.Install,
+			DownloadURL: dep.DownloadURL,
+			Required:    dep.Required,
+		}
+	}
+	return extra
+}
+
+// Notifier returns a webhook notifier for the configured notify block.
+func (c *Config) Notifier() *notify.Notifier {
+	return notify.NewNotifier(c.Notify.WebhookURL, c.Notify.Events)
+}
+
+// KeyEnvVarName returns the environment variable read by the env key source.
+func (c *Config) KeyEnvVarName() string {
+	if c.KeyEnvVar != "" {
+		return c.KeyEnvVar
+	}
+	return DefaultKeyEnvVar
+}
+
+// KeychainAccountName returns the OS keyring account read by the keychain key source.
+func (c *Config) KeychainAccountName() string {
+	if c.KeychainAccount != "" {
+		return c.KeychainAccount
+	}
+	return DefaultKeychainAccount
+}
+
+// EnvFilePerm returns the mode env files are written with: file_mode, or utils.SecretFileMode.
+func (c *Config) EnvFilePerm() os.FileMode {
+	return filePerm(c.FileMode)
+}
+
+// KeyFilePerm returns the mode key files are written with: key_file_mode, or utils.SecretFileMode.
+func (c *Config) KeyFilePerm() os.FileMode {
+	return filePerm(c.KeyFileMode)
+}
+
+// StateFilePerm returns the mode sync state files are written with: state_file_mode, or utils.SecretFileMode.
+func (c *Config) StateFilePerm() os.FileMode {
+	return filePerm(c.StateFileMode)
+}
+
+// filePerm parses a validated octal mode, defaulting to utils.SecretFileMode
+func filePerm(mode string) os.FileMode {
+	perm, err := parseFileMode(mode)
+	if err != nil || mode == "" {
+		return utils.SecretFileMode
+	}
+	return perm
+}
+
+// parseFileMode parses an octal file mode such as 0640. The owner must be able to read and write
+// the file, since env-sync rewrites it.
+func parseFileMode(mode string) (os.FileMode, error) {
+	perm, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimPrefix(mode, "0o"), "0O"), 8, 32)
+	if err != nil || perm > 0777 {
+		return 0, fmt.Errorf("'%s' is not an octal file mode such as 0600", mode)
+	}
+	if perm&0600 != 0600 {
+		return 0, fmt.Errorf("mode %04o must let the owner read and write the file", perm)
+	}
+	return os.FileMode(perm), nil
+}
+
+// isValidEnvVarName reports whether name is a portable environment variable name
+func isValidEnvVarName(name string) bool {
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+func isValidKeyFormat(format string) bool {
+	for _, valid := range crypto.KeyFormats {
+		if format == valid {
+			return true
+		}
+	}
+	return false
+}
+
+func isValidNotifyEvent(event string) bool {
+	for _, valid := range notify.ValidEvents {
+		if event == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteToFile saves the configuration to a file in the format its extension names (see FileFormat).
 func (c *Config) WriteToFile(path string) error {
-	data, err := yaml.Marshal(c)
+	data, err := marshalConfig(c, FileFormat(path))
 	if err != nil {
-		return fmt.Errorf("failed to marshal config to YAML: %w", err)
+		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
 	err = os.WriteFile(path, data, 0644)
@@ -106,19 +564,21 @@ func (c *Config) WriteToFile(path string) error {
 }
 
 // GetEncryptionKey loads the encryption key based on the configured source.
-func (c *Config) GetEncryptionKey(cliKey string) ([]byte, error) {
+func (c *Config) GetEncryptionKey(ctx context.Context, cliKey string) ([]byte, error) {
 	// Priority order: CLI flag -> Env Var -> Key File -> Prompt
 	if cliKey != "" {
-		return base64.StdEncoding.DecodeString(cliKey)
+		return crypto.DecodeKeyFormat(strings.TrimSpace(cliKey), c.KeyFormat)
 	}
 
 	switch c.KeySource {
 	case "env":
-		key := os.Getenv("ENVSYNC_ENCRYPTION_KEY")
+		envVar := c.KeyEnvVarName()
+		// Values set with e.g. $(cat keyfile) or in .env-style files often carry stray whitespace
+		key := strings.TrimSpace(os.Getenv(envVar))
 		if key == "" {
-			return nil, fmt.Errorf("key_source is 'env', but ENVSYNC_ENCRYPTION_KEY environment variable is not set")
+			return nil, fmt.Errorf("key_source is 'env', but %s environment variable is not set", envVar)
 		}
-		return base64.StdEncoding.DecodeString(key)
+		return crypto.DecodeKeyFormat(key, c.KeyFormat)
 	case "file":
 		if c.KeyFile == "" {
 			return nil, fmt.Errorf("key_source is 'file', but key_file is not specified in config")
@@ -127,27 +587,80 @@ func (c *Config) GetEncryptionKey(cliKey string) ([]byte, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to read key file '%s': %w", c.KeyFile, err)
 		}
-		return base64.StdEncoding.DecodeString(string(keyData))
+		// 'echo "$KEY" > keyfile' adds a trailing newline
+		return crypto.DecodeKeyFormat(strings.TrimSpace(string(keyData)), c.KeyFormat)
 	case "prompt":
 		// Check if we're in a non-interactive environment (for tests)
 		if !term.IsTerminal(int(os.Stdin.Fd())) {
 			return nil, fmt.Errorf("cannot use prompt in non-interactive mode")
 		}
-		fmt.Print("Enter encryption key (base64): ")
+		fmt.Print("Enter encryption key (base64 or hex): ")
 		keyInput, err := term.ReadPassword(int(os.Stdin.Fd()))
 		fmt.Println()
 		if err != nil {
 			return nil, fmt.Errorf("failed to read key from prompt: %w", err)
 		}
-		return base64.StdEncoding.DecodeString(string(keyInput))
+		return crypto.DecodeKeyFormat(strings.TrimSpace(string(keyInput)), c.KeyFormat)
+	case "kms":
+		provider, err := c.KeyProvider()
+		if err != nil {
+			return nil, err
+		}
+		return provider.GetKey(ctx)
+	case "keychain":
+		account := c.KeychainAccountName()
+		key, err := keychain.Get(account)
+		if errors.Is(err, keychain.ErrNotFound) {
+			return nil, fmt.Errorf("key_source is 'keychain', but no key is stored for account '%s'; store one with 'env-sync generate-key --to-keychain': %w", account, err)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return crypto.DecodeKeyFormat(key, c.KeyFormat)
+	case "command":
+		key, err := runKeyCommand(ctx, c.KeyCommand)
+		if err != nil {
+			return nil, err
+		}
+		return crypto.DecodeKeyFormat(key, c.KeyFormat)
 	default:
-		return nil, fmt.Errorf("invalid key source: '%s'. Must be one of: env, file, prompt", c.KeySource)
+		return nil, fmt.Errorf("invalid key source: '%s'. Must be one of: env, file, prompt, kms, keychain, command", c.KeySource)
+	}
+}
+
+// WrappedKeySecretName returns the secret holding the wrapped data key for the kms key source.
+func (c *Config) WrappedKeySecretName() string {
+	if c.KMSWrappedKeySecret != "" {
+		return c.KMSWrappedKeySecret
+	}
+	return c.SecretName + "-dek"
+}
+
+// KeyProvider creates the KMS-backed key provider used by the kms key source.
+// The data key is stored wrapped in the configured vault and unwrapped with kms_key_id.
+func (c *Config) KeyProvider() (*kms.EnvelopeKeyProvider, error) {
+	if c.KMSKeyID == "" {
+		return nil, fmt.Errorf("key_source is 'kms', but kms_key_id is not specified in config")
+	}
+	cred, err := auth.CreateAzureCredential()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Azure credentials for KMS: %w", err)
+	}
+	wrapper, err := kms.NewAzureKeyWrapper(c.KMSKeyID, cred, nil)
+	if err != nil {
+		return nil, err
+	}
+	store, err := vault.NewClient(c.VaultURL, cred)
+	if err != nil {
+		return nil, err
 	}
+	return kms.NewEnvelopeKeyProvider(wrapper, store, c.WrappedKeySecretName()), nil
 }
 
 // LoadAndValidateKey is a helper to load the key and validate it.
-func (c *Config) LoadAndValidateKey(cliKey string) ([]byte, error) {
-	key, err := c.GetEncryptionKey(cliKey)
+// ctx bounds the Key Vault calls made by the kms key source.
+func (c *Config) LoadAndValidateKey(ctx context.Context, cliKey string) ([]byte, error) {
+	key, err := c.GetEncryptionKey(ctx, cliKey)
 	if err != nil {
 		return nil, err
 	}
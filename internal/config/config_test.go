@@ -1,9 +1,11 @@
 package config
 
 import (
+	"context"
 	"encoding/base64"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -21,6 +23,8 @@ env_file: ".env.test"
 sync_interval: "30m"
 key_source: "file"
 key_file: ".test-key"
+post_pull_quiet: "10s"
+debounce_interval: "2s"
 `
 	tmpDir := t.TempDir()
 	configPath := filepath.Join(tmpDir, ".env-sync.yaml")
@@ -37,6 +41,9 @@ key_file: ".test-key"
 	assert.Equal(t, 30*time.Minute, cfg.SyncInterval)
 	assert.Equal(t, "file", cfg.KeySource)
 	assert.Equal(t, ".test-key", cfg.KeyFile)
+	assert.Equal(t, 10*time.Second, cfg.PostPullQuiet)
+	assert.Equal(t, 2*time.Second, cfg.DebounceInterval)
+	assert.Equal(t, DefaultMaxConcurrency, cfg.MaxConcurrency)
 }
 
 func TestConfigValidation(t *testing.T) {
@@ -50,6 +57,27 @@ func TestConfigValidation(t *testing.T) {
 		{"missing secret name", &Config{VaultURL: "a", KeySource: "env"}, true},
 		{"missing key source", &Config{VaultURL: "a", SecretName: "b"}, true},
 		{"default env file", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", EnvFile: ""}, false},
+		{"valid notify events", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", Notify: NotifyConfig{Events: []string{"push", "conflict"}}}, false},
+		{"kms without key id", &Config{VaultURL: "a", SecretName: "b", KeySource: "kms"}, true},
+		{"kms with key id", &Config{VaultURL: "a", SecretName: "b", KeySource: "kms", KMSKeyID: "https://v.vault.azure.net/keys/kek"}, false},
+		{"invalid notify event", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", Notify: NotifyConfig{Events: []string{"deploy"}}}, true},
+		{"valid file mappings", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", Files: []FileMapping{{EnvFile: ".env.api", SecretName: "c"}}}, false},
+		{"file mapping missing secret", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", Files: []FileMapping{{EnvFile: ".env.api"}}}, true},
+		{"local overlay", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", EnvFile: ".env", LocalOverlay: ".env.local"}, false},
+		{"local overlay is env file", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", EnvFile: ".env", LocalOverlay: "./.env"}, true},
+		{"local overlay is mapped file", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", LocalOverlay: ".env.worker", Files: []FileMapping{{EnvFile: ".env.worker", SecretName: "c"}}}, true},
+		{"negative max concurrency", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", MaxConcurrency: -1}, true},
+		{"custom key env var", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", KeyEnvVar: "PROD_ENVSYNC_KEY"}, false},
+		{"invalid key env var", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", KeyEnvVar: "1-KEY"}, true},
+		{"hex key format", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", KeyFormat: "hex"}, false},
+		{"invalid key format", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", KeyFormat: "pem"}, true},
+		{"extra dependency", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", Dependencies: []DependencyConfig{{Name: "kubectl", Command: "kubectl", Install: map[string]string{"darwin-brew": "brew install kubectl"}}}}, false},
+		{"extra dependency with unknown platform", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", Dependencies: []DependencyConfig{{Name: "helm", Command: "helm", Install: map[string]string{"macos": "brew install helm"}}}}, true},
+		{"duplicate file mapping secret", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", Files: []FileMapping{{EnvFile: ".env.api", SecretName: "b"}}}, true},
+		{"secret name with underscore", &Config{VaultURL: "a", SecretName: "my_secret", KeySource: "env"}, true},
+		{"negative debounce interval", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", DebounceInterval: -time.Second}, true},
+		{"negative post pull quiet", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", PostPullQuiet: -time.Second}, true},
+		{"file mapping secret name with dot", &Config{VaultURL: "a", SecretName: "b", KeySource: "env", Files: []FileMapping{{EnvFile: ".env.api", SecretName: "app.api"}}}, true},
 	}
 
 	for _, tc := range testCases {
@@ -73,7 +101,15 @@ func TestGetEncryptionKey(t *testing.T) {
 
 	t.Run("from CLI flag", func(t *testing.T) {
 		cfg := &Config{KeySource: "env"} // Source doesn't matter when CLI key is present
-		retrievedKey, err := cfg.GetEncryptionKey(b64Key)
+		retrievedKey, err := cfg.GetEncryptionKey(context.Background(), b64Key)
+		assert.NoError(t, err)
+		assert.Equal(t, key, retrievedKey)
+	})
+
+	t.Run("URL-safe unpadded", func(t *testing.T) {
+		cfg := &Config{KeySource: "env"}
+		t.Setenv("ENVSYNC_ENCRYPTION_KEY", base64.RawURLEncoding.EncodeToString(key))
+		retrievedKey, err := cfg.GetEncryptionKey(context.Background(), "")
 		assert.NoError(t, err)
 		assert.Equal(t, key, retrievedKey)
 	})
@@ -81,9 +117,52 @@ func TestGetEncryptionKey(t *testing.T) {
 	t.Run("from env var", func(t *testing.T) {
 		cfg := &Config{KeySource: "env"}
 		t.Setenv("ENVSYNC_ENCRYPTION_KEY", b64Key)
-		retrievedKey, err := cfg.GetEncryptionKey("")
+		retrievedKey, err := cfg.GetEncryptionKey(context.Background(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, key, retrievedKey)
+	})
+
+	t.Run("from custom env var", func(t *testing.T) {
+		cfg := &Config{KeySource: "env", KeyEnvVar: "STAGING_ENVSYNC_KEY"}
+		t.Setenv("ENVSYNC_ENCRYPTION_KEY", "")
+		t.Setenv("STAGING_ENVSYNC_KEY", b64Key)
+		retrievedKey, err := cfg.GetEncryptionKey(context.Background(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, key, retrievedKey)
+	})
+
+	t.Run("custom env var not set", func(t *testing.T) {
+		cfg := &Config{KeySource: "env", KeyEnvVar: "STAGING_ENVSYNC_KEY"}
+		t.Setenv("ENVSYNC_ENCRYPTION_KEY", b64Key)
+		t.Setenv("STAGING_ENVSYNC_KEY", "")
+		_, err := cfg.GetEncryptionKey(context.Background(), "")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "STAGING_ENVSYNC_KEY")
+	})
+
+	t.Run("from command", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("key_command tests use /bin/sh")
+		}
+		cfg := &Config{KeySource: "command", KeyCommand: "printf '  %s\\n' " + b64Key}
+		retrievedKey, err := cfg.GetEncryptionKey(context.Background(), "")
 		assert.NoError(t, err)
 		assert.Equal(t, key, retrievedKey)
+
+		cfg.KeyCommand = "echo 'broker: not logged in' >&2; exit 3"
+		_, err = cfg.GetEncryptionKey(context.Background(), "")
+		assert.ErrorContains(t, err, "key_command failed: exit status 3: broker: not logged in")
+
+		cfg.KeyCommand = "true"
+		_, err = cfg.GetEncryptionKey(context.Background(), "")
+		assert.ErrorContains(t, err, "key_command printed no key")
+
+		defer func(timeout time.Duration) { keyCommandTimeout = timeout }(keyCommandTimeout)
+		keyCommandTimeout = 50 * time.Millisecond
+		cfg.KeyCommand = "sleep 5 # --token=hunter2"
+		_, err = cfg.GetEncryptionKey(context.Background(), "")
+		assert.ErrorContains(t, err, "key_command timed out")
+		assert.NotContains(t, err.Error(), "hunter2")
 	})
 
 	t.Run("from file", func(t *testing.T) {
@@ -102,14 +181,60 @@ func TestGetEncryptionKey(t *testing.T) {
 		assert.NoError(t, err)
 
 		cfg := &Config{KeySource: "file", KeyFile: keyPath}
-		key, err := cfg.GetEncryptionKey("")
+		key, err := cfg.GetEncryptionKey(context.Background(), "")
 		assert.NoError(t, err)
 		assert.Equal(t, rawKey, key)
 	})
 
+	t.Run("hex key from file", func(t *testing.T) {
+		hexKey, _ := crypto.KeyToString(key, crypto.KeyFormatHex)
+		keyPath := filepath.Join(t.TempDir(), "test.key")
+		assert.NoError(t, os.WriteFile(keyPath, []byte(hexKey), 0600))
+
+		for _, format := range []string{"", "auto", "hex"} {
+			cfg := &Config{KeySource: "file", KeyFile: keyPath, KeyFormat: format}
+			retrievedKey, err := cfg.GetEncryptionKey(context.Background(), "")
+			assert.NoError(t, err, "format %q", format)
+			assert.Equal(t, key, retrievedKey, "format %q", format)
+		}
+	})
+
+	t.Run("key file with trailing whitespace", func(t *testing.T) {
+		hexKey, _ := crypto.KeyToString(key, crypto.KeyFormatHex)
+		for name, content := range map[string]string{
+			"base64 with newline": b64Key + "\n",
+			"base64 with crlf":    b64Key + "\r\n",
+			"hex with spaces":     "  " + hexKey + " \n",
+		} {
+			keyPath := filepath.Join(t.TempDir(), "test.key")
+			assert.NoError(t, os.WriteFile(keyPath, []byte(content), 0600))
+
+			cfg := &Config{KeySource: "file", KeyFile: keyPath}
+			retrievedKey, err := cfg.GetEncryptionKey(context.Background(), "")
+			assert.NoError(t, err, name)
+			assert.Equal(t, key, retrievedKey, name)
+		}
+	})
+
+	t.Run("env var with trailing whitespace", func(t *testing.T) {
+		cfg := &Config{KeySource: "env"}
+		t.Setenv("ENVSYNC_ENCRYPTION_KEY", b64Key+" \n")
+		retrievedKey, err := cfg.GetEncryptionKey(context.Background(), "")
+		assert.NoError(t, err)
+		assert.Equal(t, key, retrievedKey)
+	})
+
+	t.Run("hex key from CLI flag", func(t *testing.T) {
+		hexKey, _ := crypto.KeyToString(key, crypto.KeyFormatHex)
+		cfg := &Config{KeySource: "env"}
+		retrievedKey, err := cfg.LoadAndValidateKey(context.Background(), hexKey)
+		assert.NoError(t, err)
+		assert.Equal(t, key, retrievedKey)
+	})
+
 	t.Run("file source but no file path", func(t *testing.T) {
 		cfg := &Config{KeySource: "file", KeyFile: ""}
-		_, err := cfg.GetEncryptionKey("")
+		_, err := cfg.GetEncryptionKey(context.Background(), "")
 		assert.Error(t, err)
 	})
 
@@ -117,7 +242,7 @@ func TestGetEncryptionKey(t *testing.T) {
 		cfg := &Config{KeySource: "env"}
 		// Ensure the env var is not set
 		t.Setenv("ENVSYNC_ENCRYPTION_KEY", "")
-		_, err := cfg.GetEncryptionKey("")
+		_, err := cfg.GetEncryptionKey(context.Background(), "")
 		assert.Error(t, err)
 	})
 
@@ -126,18 +251,284 @@ func TestGetEncryptionKey(t *testing.T) {
 		// Reset viper for a clean test run
 		viper.Reset()
 		cfg := &Config{KeySource: "prompt"}
-		_, err := cfg.GetEncryptionKey("")
+		_, err := cfg.GetEncryptionKey(context.Background(), "")
 		assert.Error(t, err, "expected error when prompting in non-interactive test")
 		assert.Contains(t, err.Error(), "cannot use prompt in non-interactive mode")
 	})
 
+	t.Run("kms source but no key id", func(t *testing.T) {
+		cfg := &Config{KeySource: "kms", VaultURL: "https://v.vault.azure.net", SecretName: "app"}
+		_, err := cfg.GetEncryptionKey(context.Background(), "")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "kms_key_id")
+	})
+
 	t.Run("invalid source", func(t *testing.T) {
 		// Reset viper for a clean test run
 		viper.Reset()
 		cfg := &Config{
 			KeySource: "invalid",
 		}
-		_, err := cfg.GetEncryptionKey("")
+		_, err := cfg.GetEncryptionKey(context.Background(), "")
 		assert.Error(t, err)
 	})
 }
+
+func TestWrappedKeySecretName(t *testing.T) {
+	cfg := &Config{SecretName: "app-env"}
+	assert.Equal(t, "app-env-dek", cfg.WrappedKeySecretName())
+
+	cfg.KMSWrappedKeySecret = "custom-dek"
+	assert.Equal(t, "custom-dek", cfg.WrappedKeySecretName())
+}
+
+func TestMappings(t *testing.T) {
+	cfg := &Config{EnvFile: ".env", SecretName: "app-env"}
+	assert.Equal(t, []FileMapping{{EnvFile: ".env", SecretName: "app-env"}}, cfg.Mappings())
+
+	cfg.Files = []FileMapping{{EnvFile: ".env.worker", SecretName: "worker-env"}}
+	assert.Equal(t, []FileMapping{
+		{EnvFile: ".env", SecretName: "app-env"},
+		{EnvFile: ".env.worker", SecretName: "worker-env"},
+	}, cfg.Mappings())
+}
+
+func TestDirMapping(t *testing.T) {
+	cfg := &Config{SecretName: "myapp"}
+	dir := filepath.Join("repo", "services")
+
+	mapping, err := cfg.DirMapping(dir, filepath.Join(dir, "api", ".env"))
+	assert.NoError(t, err)
+	assert.Equal(t, FileMapping{EnvFile: filepath.Join(dir, "api", ".env"), SecretName: "myapp-api-env"}, mapping)
+
+	mapping, err = cfg.DirMapping(dir, filepath.Join(dir, "billing_worker", ".env.prod"))
+	assert.NoError(t, err)
+	assert.Equal(t, "myapp-billing-worker-env-prod", mapping.SecretName)
+
+	_, err = cfg.DirMapping(dir, filepath.Join("repo", ".env"))
+	assert.Error(t, err, "files outside the directory have no name")
+
+	cfg.SecretPrefix = "team-"
+	_, err = cfg.DirMapping(dir, filepath.Join(dir, "api", ".env"))
+	assert.Error(t, err, "names must keep secret_prefix")
+}
+
+func TestLoadConfigDependencies(t *testing.T) {
+	content := `
+vault_url: "https://my-test-vault.vault.azure.net"
+secret_name: "my-test-secret"
+key_source: "env"
+dependencies:
+  - name: kubectl
+    command: kubectl
+    min_version: "1.28.0"
+    required: true
+    install:
+      darwin-brew: brew install kubectl
+      windows-winget: winget install -e --id Kubernetes.kubectl
+`
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+
+	extra := cfg.ExtraDependencies()
+	assert.Len(t, extra, 1)
+	assert.Equal(t, "kubectl", extra[0].Command)
+	assert.Equal(t, "1.28.0", extra[0].Version)
+	assert.True(t, extra[0].Required)
+	assert.Equal(t, "brew install kubectl", extra[0].InstallCmd["darwin-brew"])
+}
+
+func TestLoadConfigOverrides(t *testing.T) {
+	content := `
+secret_name: "my-test-secret"
+key_source: "env"
+`
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	// Without vault_url the config is invalid unless it is overridden
+	_, err := LoadConfig(configPath)
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+
+	defer SetOverrides(Overrides{})
+	SetOverrides(Overrides{VaultURL: "https://other-vault.vault.azure.net"})
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "https://other-vault.vault.azure.net", cfg.VaultURL)
+}
+
+func TestLoadConfigSecretPrefix(t *testing.T) {
+	content := `
+vault_url: "https://myvault.vault.azure.net"
+secret_name: "dotenv"
+secret_prefix: "billing-"
+key_source: "env"
+files:
+  - env_file: ".env.worker"
+    secret_name: "billing-worker"
+`
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "billing-dotenv", cfg.SecretName)
+	// Names that already carry the prefix aren't prefixed twice
+	assert.Equal(t, "billing-worker", cfg.Files[0].SecretName)
+	assert.Equal(t, "billing-dotenv-dek", cfg.WrappedKeySecretName())
+
+	cfg.SecretName = "payments-dotenv"
+	assert.ErrorContains(t, cfg.Validate(), "lacks the configured secret_prefix 'billing-'")
+	assert.NoError(t, (&Config{}).CheckSecretPrefix("anything"))
+
+	invalid := &Config{VaultURL: "a", SecretName: "app_x", SecretPrefix: "app_", KeySource: "env"}
+	assert.Error(t, invalid.Validate())
+}
+
+func TestReadOnly(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte("vault_url: \"https://myvault.vault.azure.net\"\nsecret_name: \"dotenv\"\nkey_source: \"env\"\n"), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.CheckWritable("push"))
+
+	t.Setenv("ENVSYNC_READ_ONLY", "true")
+	cfg, err = LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.True(t, cfg.ReadOnly)
+	err = cfg.CheckWritable("push")
+	assert.ErrorIs(t, err, ErrReadOnly)
+	assert.ErrorContains(t, err, "read-only mode: refusing to push")
+}
+
+func TestValidateFallbackVaultURL(t *testing.T) {
+	cfg := &Config{VaultURL: "https://myvault.vault.azure.net/", SecretName: "dotenv", KeySource: "env"}
+	cfg.FallbackVaultURL = "https://myvault-dr.vault.azure.net/"
+	assert.NoError(t, cfg.validate())
+
+	cfg.FallbackVaultURL = "https://myvault.vault.azure.net"
+	assert.ErrorContains(t, cfg.validate(), "must be a different vault")
+
+	cfg.FallbackVaultURL = "http://myvault-dr.vault.azure.net"
+	assert.ErrorContains(t, cfg.validate(), "invalid fallback_vault_url")
+}
+
+func TestFileModes(t *testing.T) {
+	cfg := &Config{VaultURL: "https://myvault.vault.azure.net/", SecretName: "dotenv", KeySource: "env"}
+	assert.NoError(t, cfg.validate())
+	assert.Equal(t, os.FileMode(0600), cfg.EnvFilePerm())
+	assert.Equal(t, os.FileMode(0600), cfg.KeyFilePerm())
+	assert.Equal(t, os.FileMode(0600), cfg.StateFilePerm())
+
+	cfg.FileMode, cfg.KeyFileMode, cfg.StateFileMode = "0640", "400", "0o660"
+	assert.ErrorContains(t, cfg.validate(), "invalid key_file_mode")
+	cfg.KeyFileMode = "600"
+	assert.NoError(t, cfg.validate())
+	assert.Equal(t, os.FileMode(0640), cfg.EnvFilePerm())
+	assert.Equal(t, os.FileMode(0600), cfg.KeyFilePerm())
+	assert.Equal(t, os.FileMode(0660), cfg.StateFilePerm())
+
+	for _, mode := range []string{"rw-r-----", "0648", "01777", "0044"} {
+		cfg.FileMode = mode
+		assert.ErrorContains(t, cfg.validate(), "invalid file_mode", mode)
+	}
+}
+
+func TestLoadConfigManagedIdentity(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	content := "vault_url: \"https://myvault.vault.azure.net\"\nsecret_name: \"dotenv\"\nkey_source: \"env\"\n"
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Nil(t, cfg.EnableManagedIdentity, "unset leaves detection to the auth package")
+
+	assert.NoError(t, os.WriteFile(configPath, []byte(content+"enable_managed_identity: false\n"), 0644))
+	cfg, err = LoadConfig(configPath)
+	assert.NoError(t, err)
+	if assert.NotNil(t, cfg.EnableManagedIdentity) {
+		assert.False(t, *cfg.EnableManagedIdentity)
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	content := `
+vault_url: "https://file-vault.vault.azure.net"
+secret_name: "file-secret"
+`
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	t.Setenv("ENVSYNC_SECRET_NAME", "env-secret")
+	t.Setenv("ENVSYNC_KEY_SOURCE", "file")
+	t.Setenv("ENVSYNC_KEY_FILE", "/run/secrets/env-sync-key")
+	t.Setenv("ENVSYNC_SYNC_INTERVAL", "5m")
+	t.Setenv("ENVSYNC_NOTIFY_WEBHOOK_URL", "https://hooks.example.com/env-sync")
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	// Keys only in the file keep their value, the environment wins for the rest
+	assert.Equal(t, "https://file-vault.vault.azure.net", cfg.VaultURL)
+	assert.Equal(t, "env-secret", cfg.SecretName)
+	assert.Equal(t, "file", cfg.KeySource)
+	assert.Equal(t, "/run/secrets/env-sync-key", cfg.KeyFile)
+	assert.Equal(t, 5*time.Minute, cfg.SyncInterval)
+	assert.Equal(t, "https://hooks.example.com/env-sync", cfg.Notify.WebhookURL)
+
+	t.Run("without a config file", func(t *testing.T) {
+		wd, err := os.Getwd()
+		assert.NoError(t, err)
+		assert.NoError(t, os.Chdir(t.TempDir()))
+		defer os.Chdir(wd)
+		t.Setenv("ENVSYNC_VAULT_URL", "https://env-vault.vault.azure.net")
+
+		cfg, err := LoadConfig("")
+		assert.NoError(t, err)
+		assert.Equal(t, "https://env-vault.vault.azure.net", cfg.VaultURL)
+		assert.Equal(t, "env-secret", cfg.SecretName)
+	})
+}
+
+func TestConfigFileFormats(t *testing.T) {
+	enabled := true
+	cfg := &Config{
+		VaultURL:              "https://myvault.vault.azure.net/",
+		SecretName:            "app-env",
+		EnvFile:               ".env",
+		SyncInterval:          10 * time.Minute,
+		KeySource:             "file",
+		KeyFile:               ".env-sync-key",
+		ConflictStrategy:      "merge",
+		PostPullQuiet:         2 * time.Second,
+		DebounceInterval:      DefaultDebounceInterval,
+		MaxConcurrency:        DefaultMaxConcurrency,
+		Notify:                NotifyConfig{WebhookURL: "https://hooks.example.com/env-sync", Events: []string{"push"}},
+		Files:                 []FileMapping{{EnvFile: "api/.env", SecretName: "api-env"}},
+		EnableManagedIdentity: &enabled,
+		FileMode:              "0640",
+	}
+
+	for _, name := range []string{".env-sync.toml", ".env-sync.json", ".env-sync.yml", ".env-sync"} {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), name)
+			assert.NoError(t, cfg.WriteToFile(configPath))
+			loaded, err := LoadConfig(configPath)
+			assert.NoError(t, err)
+			assert.Equal(t, cfg, loaded)
+		})
+	}
+
+	data, err := marshalConfig(cfg, FormatTOML)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "vault_url = 'https://myvault.vault.azure.net/'")
+	assert.Contains(t, string(data), "[[files]]")
+
+	assert.Equal(t, FormatTOML, FileFormat("config/.env-sync.TOML"))
+	assert.Equal(t, FormatJSON, FileFormat(".env-sync.json"))
+	assert.Equal(t, FormatYAML, FileFormat(".env-sync.prod"))
+}
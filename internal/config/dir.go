@@ -0,0 +1,35 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lliamscholtz/env-sync/internal/vault"
+)
+
+// nonSecretNameChars matches runs of characters Key Vault doesn't allow in secret names
+var nonSecretNameChars = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// DirMapping maps an env file found under dir to a secret named from its path relative to dir,
+// appended to secret_name: with secret_name myapp, services/api/.env under services syncs with
+// myapp-api-env.
+func (c *Config) DirMapping(dir, path string) (FileMapping, error) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return FileMapping{}, fmt.Errorf("'%s' is not inside '%s'", path, dir)
+	}
+	slug := strings.Trim(nonSecretNameChars.ReplaceAllString(filepath.ToSlash(rel), "-"), "-")
+	if slug == "" {
+		return FileMapping{}, fmt.Errorf("cannot name a secret after '%s'", rel)
+	}
+	mapping := FileMapping{EnvFile: path, SecretName: c.SecretName + "-" + slug}
+	if err := vault.ValidateSecretName(mapping.SecretName); err != nil {
+		return FileMapping{}, fmt.Errorf("cannot name a secret after '%s': %w", rel, err)
+	}
+	if err := c.CheckSecretPrefix(mapping.SecretName); err != nil {
+		return FileMapping{}, err
+	}
+	return mapping, nil
+}
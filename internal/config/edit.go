@@ -0,0 +1,158 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ReadConfigFile reads the config file at path as it is written: without ENVSYNC_* environment
+// variables, expanded secret name templates or defaults. Edit the result and save it with
+// WriteToFile; commands use LoadConfig.
+func ReadConfigFile(path string) (*Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType(FileFormat(path))
+	if err := v.ReadInConfig(); err != nil {
+		return nil, &configError{fmt.Errorf("failed to read config file: %w", err)}
+	}
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, &configError{fmt.Errorf("failed to unmarshal config: %w", err)}
+	}
+	return &cfg, nil
+}
+
+// ValidateFile checks that c, as read by ReadConfigFile, loads as a valid configuration once its
+// secret name templates are expanded and defaults applied. Environment variables are ignored, so
+// the file is valid on its own.
+func (c *Config) ValidateFile() error {
+	check := *c
+	check.Files = slices.Clone(c.Files)
+	if err := check.finish(); err != nil {
+		return &configError{err}
+	}
+	return nil
+}
+
+// Marshal serializes c as a config file in format (see FileFormat).
+func (c *Config) Marshal(format string) ([]byte, error) {
+	return marshalConfig(c, format)
+}
+
+// SettableKeys lists the config keys SetValue accepts, with nested keys such as
+// notify.webhook_url joined by dots.
+func SettableKeys() []string {
+	return settableKeys(reflect.TypeOf(Config{}), "")
+}
+
+func settableKeys(t reflect.Type, prefix string) []string {
+	var keys []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := prefix + field.Tag.Get("mapstructure")
+		if field.Type.Kind() == reflect.Struct {
+			keys = append(keys, settableKeys(field.Type, key+".")...)
+		} else if settable(field.Type) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// SetValue sets a config key, such as sync_interval or notify.webhook_url, from a value written
+// as on the command line: durations such as 15m, true or false, integers, and comma-separated
+// lists. An empty value unsets the key. Lists of mappings, such as files, can't be set this way.
+func (c *Config) SetValue(key, value string) error {
+	field, err := lookupField(reflect.ValueOf(c).Elem(), key)
+	if err != nil {
+		return err
+	}
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': expected a duration such as 30s or 15m", key, value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': expected true or false", key, value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Pointer && field.Type().Elem().Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': expected true or false", key, value)
+		}
+		field.Set(reflect.ValueOf(&b))
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid %s '%s': expected a whole number", key, value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		field.Set(reflect.ValueOf(list))
+	}
+	return nil
+}
+
+// lookupField finds the settable field a dotted config key names
+func lookupField(v reflect.Value, key string) (reflect.Value, error) {
+	name, rest, nested := strings.Cut(key, ".")
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Tag.Get("mapstructure") != name {
+			continue
+		}
+		switch {
+		case nested && field.Type.Kind() == reflect.Struct:
+			return lookupField(v.Field(i), rest)
+		case nested || field.Type.Kind() == reflect.Struct:
+			break
+		case !settable(field.Type):
+			return reflect.Value{}, fmt.Errorf("%s can't be set with 'config set'; edit the config file instead", key)
+		default:
+			return v.Field(i), nil
+		}
+	}
+	return reflect.Value{}, fmt.Errorf("unknown config key '%s'", key)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// settable reports whether SetValue can parse a value for a field of type t
+func settable(t reflect.Type) bool {
+	if t == durationType {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.String, reflect.Bool, reflect.Int:
+		return true
+	case reflect.Pointer:
+		return t.Elem().Kind() == reflect.Bool
+	case reflect.Slice:
+		return t.Elem().Kind() == reflect.String
+	}
+	return false
+}
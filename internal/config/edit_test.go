@@ -0,0 +1,69 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetValue(t *testing.T) {
+	cfg := &Config{}
+	assert.NoError(t, cfg.SetValue("sync_interval", "30m"))
+	assert.Equal(t, 30*time.Minute, cfg.SyncInterval)
+	assert.NoError(t, cfg.SetValue("auto_backup", "true"))
+	assert.True(t, cfg.AutoBackup)
+	assert.NoError(t, cfg.SetValue("max_concurrency", "4"))
+	assert.Equal(t, 4, cfg.MaxConcurrency)
+	assert.NoError(t, cfg.SetValue("notify.webhook_url", "https://hooks.example.com/x"))
+	assert.Equal(t, "https://hooks.example.com/x", cfg.Notify.WebhookURL)
+	assert.NoError(t, cfg.SetValue("recipients", "envsync1a, envsync1b,"))
+	assert.Equal(t, []string{"envsync1a", "envsync1b"}, cfg.Recipients)
+
+	assert.NoError(t, cfg.SetValue("recipients", ""))
+	assert.Nil(t, cfg.Recipients)
+
+	assert.ErrorContains(t, cfg.SetValue("sync_interval", "often"), "expected a duration")
+	assert.ErrorContains(t, cfg.SetValue("auto_backup", "maybe"), "expected true or false")
+	assert.ErrorContains(t, cfg.SetValue("max_concurrency", "four"), "expected a whole number")
+	assert.ErrorContains(t, cfg.SetValue("no_such_key", "x"), "unknown config key")
+	assert.ErrorContains(t, cfg.SetValue("notify", "x"), "unknown config key")
+	assert.ErrorContains(t, cfg.SetValue("vault_url.host", "x"), "unknown config key")
+	assert.ErrorContains(t, cfg.SetValue("files", ".env"), "edit the config file instead")
+}
+
+func TestSettableKeys(t *testing.T) {
+	keys := SettableKeys()
+	assert.Contains(t, keys, "sync_interval")
+	assert.Contains(t, keys, "notify.webhook_url")
+	assert.NotContains(t, keys, "notify")
+	assert.NotContains(t, keys, "files")
+	cfg := &Config{}
+	for _, key := range keys {
+		assert.NoError(t, cfg.SetValue(key, ""), key)
+	}
+}
+
+func TestReadConfigFileIgnoresEnvironment(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("vault_url: https://myvault.vault.azure.net/\nsecret_name: app-{{.Branch}}\nkey_source: env\n"), 0644))
+	t.Setenv("ENVSYNC_SECRET_NAME", "from-env")
+
+	cfg, err := ReadConfigFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "app-{{.Branch}}", cfg.SecretName)
+	assert.Zero(t, cfg.SyncInterval)
+
+	// Validating must not expand the template or apply defaults in place
+	assert.NoError(t, cfg.ValidateFile())
+	assert.Equal(t, "app-{{.Branch}}", cfg.SecretName)
+	assert.Zero(t, cfg.SyncInterval)
+
+	cfg.VaultURL = ""
+	assert.ErrorIs(t, cfg.ValidateFile(), ErrInvalidConfig)
+
+	_, err = ReadConfigFile(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorIs(t, err, ErrInvalidConfig)
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/vault"
+)
+
+// validateSecretAttributes checks secret_expires_in and secret_not_before
+func (c *Config) validateSecretAttributes() error {
+	if c.SecretExpiresIn < 0 {
+		return fmt.Errorf("secret_expires_in must not be negative")
+	}
+	if c.SecretNotBefore != "" {
+		if _, err := time.Parse(time.RFC3339, c.SecretNotBefore); err != nil {
+			return fmt.Errorf("invalid secret_not_before '%s': expected an RFC 3339 time such as 2025-01-31T09:00:00Z", c.SecretNotBefore)
+		}
+	}
+	return nil
+}
+
+// SecretAttributes returns the activation and expiry dates of a secret version pushed at now:
+// secret_not_before, and now plus secret_expires_in. It fails if the version would expire before
+// it becomes active.
+func (c *Config) SecretAttributes(now time.Time) (vault.SecretAttributes, error) {
+	var attrs vault.SecretAttributes
+	if c.SecretNotBefore != "" {
+		notBefore, err := time.Parse(time.RFC3339, c.SecretNotBefore)
+		if err != nil {
+			return attrs, fmt.Errorf("invalid secret_not_before '%s': %w", c.SecretNotBefore, err)
+		}
+		attrs.NotBefore = notBefore
+	}
+	if c.SecretExpiresIn > 0 {
+		attrs.Expires = now.Add(c.SecretExpiresIn)
+	}
+	if !attrs.NotBefore.IsZero() && !attrs.Expires.IsZero() && !attrs.Expires.After(attrs.NotBefore) {
+		return attrs, fmt.Errorf("a secret pushed now would expire on %s, before secret_not_before %s; raise secret_expires_in", attrs.Expires.Format(time.RFC3339), c.SecretNotBefore)
+	}
+	return attrs, nil
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecretAttributesValidation(t *testing.T) {
+	valid := &Config{VaultURL: "a", SecretName: "b", KeySource: "file", SecretExpiresIn: 90 * 24 * time.Hour, SecretNotBefore: "2025-01-31T09:00:00Z"}
+	assert.NoError(t, valid.Validate())
+
+	assert.Error(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", SecretExpiresIn: -time.Hour}).Validate())
+	assert.Error(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", SecretNotBefore: "tomorrow"}).Validate())
+}
+
+func TestSecretAttributes(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	attrs, err := (&Config{}).SecretAttributes(now)
+	assert.NoError(t, err)
+	assert.True(t, attrs.NotBefore.IsZero())
+	assert.True(t, attrs.Expires.IsZero())
+
+	cfg := &Config{SecretExpiresIn: 24 * time.Hour, SecretNotBefore: "2025-06-01T18:00:00Z"}
+	attrs, err = cfg.SecretAttributes(now)
+	assert.NoError(t, err)
+	assert.Equal(t, now.Add(6*time.Hour), attrs.NotBefore.UTC())
+	assert.Equal(t, now.Add(24*time.Hour), attrs.Expires)
+
+	// A version that would expire before it becomes active is refused
+	cfg.SecretNotBefore = "2025-06-03T00:00:00Z"
+	_, err = cfg.SecretAttributes(now)
+	assert.ErrorContains(t, err, "secret_expires_in")
+}
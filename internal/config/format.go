@@ -0,0 +1,85 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Config file formats, as named by viper
+const (
+	FormatYAML = "yaml"
+	FormatTOML = "toml"
+	FormatJSON = "json"
+)
+
+// FileFormat returns the format of the config file at path from its extension: TOML for .toml,
+// JSON for .json, and YAML for .yaml, .yml or any other extension.
+func FileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return FormatTOML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatYAML
+	}
+}
+
+// unmarshalSettings parses a config file in format into a map of its top-level keys
+func unmarshalSettings(data []byte, format string) (map[string]interface{}, error) {
+	settings := make(map[string]interface{})
+	var err error
+	switch format {
+	case FormatTOML:
+		err = toml.Unmarshal(data, &settings)
+	case FormatJSON:
+		if len(strings.TrimSpace(string(data))) > 0 {
+			err = json.Unmarshal(data, &settings)
+		}
+	default:
+		err = yaml.Unmarshal(data, &settings)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// marshalSettings serializes config settings in format
+func marshalSettings(settings map[string]interface{}, format string) ([]byte, error) {
+	switch format {
+	case FormatTOML:
+		return toml.Marshal(settings)
+	case FormatJSON:
+		data, err := json.MarshalIndent(settings, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	default:
+		return yaml.Marshal(settings)
+	}
+}
+
+// marshalConfig serializes c in format. The YAML field names are the config keys in every
+// format, so the config is converted through YAML rather than tagging each field three times.
+func marshalConfig(c *Config, format string) ([]byte, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil || format == FormatYAML {
+		return data, err
+	}
+	settings, err := unmarshalSettings(data, FormatYAML)
+	if err != nil {
+		return nil, err
+	}
+	data, err = marshalSettings(settings, format)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert config to %s: %w", strings.ToUpper(format), err)
+	}
+	return data, nil
+}
@@ -0,0 +1,50 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/hooks"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+)
+
+// keyCommandTimeout is KeyCommandTimeout, shortened by tests
+var keyCommandTimeout = KeyCommandTimeout
+
+// runKeyCommand runs key_command through the system shell and returns its trimmed stdout. The
+// command itself is never printed or included in errors, since brokers are often called with
+// tokens or account names on the command line.
+func runKeyCommand(ctx context.Context, command string) (string, error) {
+	if strings.TrimSpace(command) == "" {
+		return "", fmt.Errorf("key_source is 'command', but key_command is not specified in config")
+	}
+	ctx, cancel := context.WithTimeout(ctx, keyCommandTimeout)
+	defer cancel()
+
+	utils.PrintDebug("🔑 Running key_command\n")
+	cmd := hooks.ShellCommand(ctx, command)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Don't wait on pipes held open by children of a killed command
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return "", fmt.Errorf("key_command timed out after %s", keyCommandTimeout)
+		}
+		if errOut := strings.TrimSpace(stderr.String()); errOut != "" {
+			return "", fmt.Errorf("key_command failed: %w: %s", err, errOut)
+		}
+		return "", fmt.Errorf("key_command failed: %w", err)
+	}
+	key := strings.TrimSpace(stdout.String())
+	if key == "" {
+		return "", fmt.Errorf("key_command printed no key")
+	}
+	return key, nil
+}
@@ -0,0 +1,79 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+)
+
+// validatePreviousKeys checks that previous_keys lists key files, each once
+func (c *Config) validatePreviousKeys() error {
+	if len(c.PreviousKeys) == 0 {
+		return nil
+	}
+	if len(c.Recipients) > 0 {
+		return fmt.Errorf("previous_keys can't be combined with recipients, which have no shared key to retire")
+	}
+	seen := make(map[string]bool, len(c.PreviousKeys))
+	for i, path := range c.PreviousKeys {
+		if strings.TrimSpace(path) == "" {
+			return fmt.Errorf("previous_keys[%d] must name a key file", i)
+		}
+		if seen[path] {
+			return fmt.Errorf("previous_keys[%d]: '%s' is listed more than once", i, path)
+		}
+		seen[path] = true
+	}
+	return nil
+}
+
+// loadPreviousKeys reads the keys in the previous_keys files
+func (c *Config) loadPreviousKeys() ([][]byte, error) {
+	keys := make([][]byte, 0, len(c.PreviousKeys))
+	for _, path := range c.PreviousKeys {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read previous key file '%s': %w", path, err)
+		}
+		key, err := crypto.DecodeKeyFormat(strings.TrimSpace(string(data)), c.KeyFormat)
+		if err == nil {
+			err = crypto.ValidateKeySize(key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("previous key file '%s': %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// DecryptContent decrypts stored content with key, falling back to the keys in previous_keys so
+// content pushed with a key retired by rotate-key stays readable during the grace period.
+// Content that only a previous key decrypts is reported, since pushing it again moves it to key.
+func (c *Config) DecryptContent(encrypted string, key []byte) ([]byte, error) {
+	plaintext, err := crypto.DecryptEnvContent(encrypted, key)
+	if err == nil || len(c.PreviousKeys) == 0 || !errors.Is(err, crypto.ErrDecryption) {
+		return plaintext, err
+	}
+	previous, loadErr := c.loadPreviousKeys()
+	if loadErr != nil {
+		utils.PrintWarning("⚠️ %v\n", loadErr)
+		return nil, err
+	}
+	plaintext, previousErr := crypto.DecryptEnvContent(encrypted, key, previous...)
+	if previousErr != nil {
+		return nil, err
+	}
+	utils.PrintWarning("⚠️ Content was decrypted with a key from previous_keys; push it again to move it to the current key.\n")
+	return plaintext, nil
+}
+
+// WritePreviousKeys replaces the previous_keys list in the config file at path, as WriteRecipients
+// does for recipients.
+func WritePreviousKeys(path string, previousKeys []string) error {
+	return writeList(path, "previous_keys", previousKeys)
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreviousKeysValidation(t *testing.T) {
+	valid := &Config{VaultURL: "a", SecretName: "b", KeySource: "file", PreviousKeys: []string{".env-sync-previous-key"}}
+	assert.NoError(t, valid.Validate())
+
+	assert.Error(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", PreviousKeys: []string{" "}}).Validate())
+	assert.Error(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", PreviousKeys: []string{"k", "k"}}).Validate())
+	_, alice := testRecipient(t)
+	assert.Error(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", Recipients: []string{alice}, PreviousKeys: []string{"k"}}).Validate())
+}
+
+func TestDecryptContentWithPreviousKeys(t *testing.T) {
+	current, err := crypto.GenerateEncryptionKey()
+	assert.NoError(t, err)
+	previous, err := crypto.GenerateEncryptionKey()
+	assert.NoError(t, err)
+	encrypted, err := crypto.EncryptEnvContent([]byte("KEY=old"), previous)
+	assert.NoError(t, err)
+
+	cfg := &Config{}
+	_, err = cfg.DecryptContent(encrypted, current)
+	assert.ErrorIs(t, err, crypto.ErrDecryption)
+
+	keyFile := filepath.Join(t.TempDir(), ".env-sync-previous-key")
+	assert.NoError(t, os.WriteFile(keyFile, []byte(base64.StdEncoding.EncodeToString(previous)+"\n"), 0600))
+	cfg.PreviousKeys = []string{keyFile}
+	decrypted, err := cfg.DecryptContent(encrypted, current)
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY=old", string(decrypted))
+
+	// A missing key file leaves the current key's error
+	cfg.PreviousKeys = []string{filepath.Join(t.TempDir(), "missing")}
+	_, err = cfg.DecryptContent(encrypted, current)
+	assert.ErrorIs(t, err, crypto.ErrDecryption)
+}
+
+func TestWritePreviousKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("# team config\nsecret_name: app\n"), 0644))
+
+	assert.NoError(t, WritePreviousKeys(path, []string{".env-sync-previous-key-1"}))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# team config\nsecret_name: app\nprevious_keys:\n  - .env-sync-previous-key-1\n", string(data))
+
+	assert.NoError(t, WritePreviousKeys(path, nil))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# team config\nsecret_name: app\n", string(data))
+}
@@ -0,0 +1,167 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"gopkg.in/yaml.v3"
+)
+
+// validateRecipients checks that every recipient is a valid public key listed once
+func (c *Config) validateRecipients() error {
+	if len(c.Recipients) == 0 {
+		return nil
+	}
+	if c.KeySource == "kms" {
+		return fmt.Errorf("recipients can't be combined with key_source 'kms'; each member loads their own private key instead")
+	}
+	if len(c.Recipients) > crypto.MaxRecipients {
+		return fmt.Errorf("at most %d recipients are supported, got %d", crypto.MaxRecipients, len(c.Recipients))
+	}
+	seen := make(map[string]bool, len(c.Recipients))
+	for i, recipient := range c.Recipients {
+		recipient = strings.TrimSpace(recipient)
+		if _, err := crypto.ParseRecipient(recipient); err != nil {
+			return fmt.Errorf("recipients[%d]: %w", i, err)
+		}
+		if seen[recipient] {
+			return fmt.Errorf("recipients[%d]: '%s' is listed more than once", i, recipient)
+		}
+		seen[recipient] = true
+		c.Recipients[i] = recipient
+	}
+	return nil
+}
+
+// HasRecipient reports whether a public key is in the recipient list.
+func (c *Config) HasRecipient(publicKey string) bool {
+	publicKey = strings.TrimSpace(publicKey)
+	for _, recipient := range c.Recipients {
+		if recipient == publicKey {
+			return true
+		}
+	}
+	return false
+}
+
+// EncryptContent encrypts content for storage: to every recipient when recipients are configured,
+// with key as the pusher's private key, and otherwise with key as the shared encryption key.
+func (c *Config) EncryptContent(content, key []byte) (string, error) {
+	if len(c.Recipients) == 0 {
+		return crypto.EncryptEnvContent(content, key)
+	}
+	publicKey, err := crypto.RecipientPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+	// Pushing content you can't pull back is never what was meant
+	if !c.HasRecipient(publicKey) {
+		return "", fmt.Errorf("your public key %s is not in recipients; add it with 'env-sync recipients add %s'", publicKey, publicKey)
+	}
+	return crypto.EncryptForRecipients(content, c.Recipients)
+}
+
+// RecipientsMatch reports whether encrypted content was encrypted to exactly the configured
+// recipients, so identical content still needs pushing after the recipient list changes.
+func (c *Config) RecipientsMatch(encrypted string) bool {
+	current := crypto.BlobRecipients(encrypted)
+	if len(current) != len(c.Recipients) {
+		return false
+	}
+	for _, recipient := range current {
+		if !c.HasRecipient(recipient) {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteRecipients replaces the recipients list in the config file at path, leaving the rest of
+// the file as it is. An empty list removes the recipients key. TOML and JSON files are rewritten
+// with their keys sorted, which drops TOML comments.
+func WriteRecipients(path string, recipients []string) error {
+	return writeList(path, "recipients", recipients)
+}
+
+// writeList replaces the list under name in the config file at path, as WriteRecipients does
+func writeList(path, name string, values []string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if format := FileFormat(path); format != FormatYAML {
+		return writeSettingsList(path, data, format, name, values, info.Mode().Perm())
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("config file '%s' is not a YAML mapping", path)
+	}
+
+	list := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	for _, value := range values {
+		list.Content = append(list.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value})
+	}
+
+	found := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != name {
+			continue
+		}
+		found = true
+		if len(values) == 0 {
+			root.Content = append(root.Content[:i], root.Content[i+2:]...)
+		} else {
+			root.Content[i+1] = list
+		}
+		break
+	}
+	if !found && len(values) > 0 {
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, list)
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return fmt.Errorf("failed to marshal config to YAML: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
+
+// writeSettingsList is writeList for config files in formats other than YAML
+func writeSettingsList(path string, data []byte, format, name string, values []string, perm os.FileMode) error {
+	settings, err := unmarshalSettings(data, format)
+	if err != nil {
+		return fmt.Errorf("failed to parse config file '%s': %w", path, err)
+	}
+	if len(values) == 0 {
+		delete(settings, name)
+	} else {
+		settings[name] = values
+	}
+	if data, err = marshalSettings(settings, format); err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	return nil
+}
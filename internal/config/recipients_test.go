@@ -0,0 +1,115 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRecipient returns a private key and its encoded public key
+func testRecipient(t *testing.T) ([]byte, string) {
+	t.Helper()
+	key, err := crypto.GenerateEncryptionKey()
+	assert.NoError(t, err)
+	publicKey, err := crypto.RecipientPublicKey(key)
+	assert.NoError(t, err)
+	return key, publicKey
+}
+
+func TestRecipientsValidation(t *testing.T) {
+	_, alice := testRecipient(t)
+	_, bob := testRecipient(t)
+
+	valid := &Config{VaultURL: "a", SecretName: "b", KeySource: "file", Recipients: []string{alice, " " + bob}}
+	assert.NoError(t, valid.Validate())
+	assert.Equal(t, bob, valid.Recipients[1], "recipients are trimmed")
+
+	assert.Error(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", Recipients: []string{alice, alice}}).Validate())
+	assert.ErrorIs(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "file", Recipients: []string{"not-a-key"}}).Validate(), crypto.ErrInvalidRecipient)
+	assert.Error(t, (&Config{VaultURL: "a", SecretName: "b", KeySource: "kms", KMSKeyID: "https://v.vault.azure.net/keys/kek", Recipients: []string{alice}}).Validate())
+}
+
+func TestEncryptContent(t *testing.T) {
+	aliceKey, alice := testRecipient(t)
+	bobKey, bob := testRecipient(t)
+	content := []byte("KEY=value\n")
+
+	cfg := &Config{Recipients: []string{alice, bob}}
+	encrypted, err := cfg.EncryptContent(content, aliceKey)
+	assert.NoError(t, err)
+	decrypted, err := crypto.DecryptEnvContent(encrypted, bobKey)
+	assert.NoError(t, err)
+	assert.Equal(t, content, decrypted)
+	assert.True(t, cfg.RecipientsMatch(encrypted))
+	assert.False(t, (&Config{Recipients: []string{alice}}).RecipientsMatch(encrypted))
+	assert.False(t, (&Config{}).RecipientsMatch(encrypted))
+
+	// Pushing content the pusher can't decrypt is refused
+	_, err = (&Config{Recipients: []string{bob}}).EncryptContent(content, aliceKey)
+	assert.ErrorContains(t, err, alice)
+
+	// Without recipients the key is the shared key
+	encrypted, err = (&Config{}).EncryptContent(content, aliceKey)
+	assert.NoError(t, err)
+	assert.Nil(t, crypto.BlobRecipients(encrypted))
+	assert.True(t, (&Config{}).RecipientsMatch(encrypted))
+}
+
+func TestWriteRecipients(t *testing.T) {
+	_, alice := testRecipient(t)
+	_, bob := testRecipient(t)
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	content := `# Team secrets
+vault_url: "https://myvault.vault.azure.net/"
+secret_name: "myapp-{{.Env}}-dotenv"
+key_source: "file"
+key_file: ".env-sync-key"
+`
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0600))
+
+	assert.NoError(t, WriteRecipients(configPath, []string{alice, bob}))
+	data, err := os.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), "# Team secrets")
+	assert.Contains(t, string(data), "myapp-{{.Env}}-dotenv", "templates are kept unexpanded")
+	info, err := os.Stat(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	SetTemplateVars(TemplateVars{Env: "dev"})
+	defer SetTemplateVars(TemplateVars{})
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{alice, bob}, cfg.Recipients)
+
+	assert.NoError(t, WriteRecipients(configPath, []string{bob}))
+	cfg, err = LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{bob}, cfg.Recipients)
+
+	assert.NoError(t, WriteRecipients(configPath, nil))
+	data, err = os.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "recipients")
+}
+
+func TestWriteRecipientsTOML(t *testing.T) {
+	_, alice := testRecipient(t)
+	configPath := filepath.Join(t.TempDir(), ".env-sync.toml")
+	content := "vault_url = \"https://myvault.vault.azure.net/\"\nsecret_name = \"app-env\"\nkey_source = \"env\"\n"
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0600))
+
+	assert.NoError(t, WriteRecipients(configPath, []string{alice}))
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{alice}, cfg.Recipients)
+	assert.Equal(t, "app-env", cfg.SecretName)
+
+	assert.NoError(t, WriteRecipients(configPath, nil))
+	data, err := os.ReadFile(configPath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "recipients")
+}
@@ -0,0 +1,106 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"text/template"
+)
+
+// TemplateVars holds the values available to secret_name templates.
+type TemplateVars struct {
+	Env    string // Set with --env; referenced as {{.Env}}
+	Branch string // Set with --branch, or the current git branch; referenced as {{.Branch}}
+}
+
+// TemplateVariables lists the variables available to secret_name templates.
+var TemplateVariables = []string{"Env", "Branch"}
+
+var templateVars TemplateVars
+
+// SetTemplateVars sets the values LoadConfig uses to expand secret_name templates.
+func SetTemplateVars(vars TemplateVars) {
+	templateVars = vars
+}
+
+// templateVarError reports a template variable that is used but has no value
+type templateVarError struct {
+	msg string
+}
+
+func (e *templateVarError) Error() string {
+	return e.msg
+}
+
+// templateData resolves template variables lazily, so the git branch is only looked up when used
+type templateData struct {
+	vars TemplateVars
+}
+
+func (d templateData) Env() (string, error) {
+	if d.vars.Env == "" {
+		return "", &templateVarError{"{{.Env}} is used but no environment was given (use --env)"}
+	}
+	return sanitizeSecretNamePart(d.vars.Env), nil
+}
+
+func (d templateData) Branch() (string, error) {
+	if d.vars.Branch != "" {
+		return sanitizeSecretNamePart(d.vars.Branch), nil
+	}
+	branch, err := currentGitBranch()
+	if err != nil {
+		return "", &templateVarError{fmt.Sprintf("{{.Branch}} is used but the git branch could not be determined (use --branch): %v", err)}
+	}
+	return sanitizeSecretNamePart(branch), nil
+}
+
+// expandSecretName expands template variables in a secret name.
+// Names without template actions are returned unchanged.
+func expandSecretName(name string, vars TemplateVars) (string, error) {
+	if !strings.Contains(name, "{{") {
+		return name, nil
+	}
+
+	tmpl, err := template.New("secret_name").Option("missingkey=error").Parse(name)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret_name template '%s': %w", name, err)
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, templateData{vars: vars}); err != nil {
+		if strings.Contains(err.Error(), "can't evaluate field") {
+			return "", fmt.Errorf("unknown variable in secret_name template '%s'. Available variables: {{.%s}}", name, strings.Join(TemplateVariables, "}}, {{."))
+		}
+		var varErr *templateVarError
+		if errors.As(err, &varErr) {
+			return "", fmt.Errorf("secret_name template '%s': %w", name, varErr)
+		}
+		return "", fmt.Errorf("failed to expand secret_name template '%s': %w", name, err)
+	}
+	return b.String(), nil
+}
+
+// sanitizeSecretNamePart replaces characters Key Vault does not allow in secret names with dashes
+func sanitizeSecretNamePart(value string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' {
+			return r
+		}
+		return '-'
+	}, value)
+}
+
+// currentGitBranch returns the checked out git branch
+func currentGitBranch() (string, error) {
+	output, err := exec.Command("git", "rev-parse", "--abbrev-ref", "HEAD").Output()
+	if err != nil {
+		return "", err
+	}
+	branch := strings.TrimSpace(string(output))
+	if branch == "" || branch == "HEAD" {
+		return "", fmt.Errorf("not on a branch (detached HEAD)")
+	}
+	return branch, nil
+}
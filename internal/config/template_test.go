@@ -0,0 +1,66 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandSecretName(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		vars      TemplateVars
+		expected  string
+		expectErr string
+	}{
+		{name: "plain name", template: "myapp-dev-env", expected: "myapp-dev-env"},
+		{name: "env variable", template: "myapp-{{.Env}}-dotenv", vars: TemplateVars{Env: "qa"}, expected: "myapp-qa-dotenv"},
+		{name: "branch is sanitized", template: "myapp-{{.Branch}}", vars: TemplateVars{Branch: "feature/login_page"}, expected: "myapp-feature-login-page"},
+		{name: "both variables", template: "{{.Env}}-{{.Branch}}", vars: TemplateVars{Env: "dev", Branch: "main"}, expected: "dev-main"},
+		{name: "missing env", template: "myapp-{{.Env}}", expectErr: "use --env"},
+		{name: "unknown variable", template: "myapp-{{.Region}}", vars: TemplateVars{Env: "qa"}, expectErr: "unknown variable"},
+		{name: "malformed template", template: "myapp-{{.Env", expectErr: "invalid secret_name template"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := expandSecretName(tt.template, tt.vars)
+			if tt.expectErr != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestLoadConfigExpandsSecretNameTemplates(t *testing.T) {
+	content := `
+vault_url: "https://my-test-vault.vault.azure.net"
+secret_name: "myapp-{{.Env}}-dotenv"
+key_source: "env"
+files:
+  - env_file: .env.worker
+    secret_name: "myapp-{{.Env}}-worker"
+`
+	configPath := filepath.Join(t.TempDir(), ".env-sync.yaml")
+	assert.NoError(t, os.WriteFile(configPath, []byte(content), 0644))
+
+	defer SetTemplateVars(TemplateVars{})
+	SetTemplateVars(TemplateVars{Env: "staging"})
+
+	cfg, err := LoadConfig(configPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "myapp-staging-dotenv", cfg.SecretName)
+	assert.Equal(t, "myapp-staging-worker", cfg.Files[0].SecretName)
+
+	SetTemplateVars(TemplateVars{})
+	_, err = LoadConfig(configPath)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--env")
+}
@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ContentTypePrefix starts the Key Vault content type of every secret env-sync encrypts.
+const ContentTypePrefix = "application/x-envsync-"
+
+// ErrUnknownContentType is returned for secrets whose content type says they hold something
+// other than env-sync content.
+var ErrUnknownContentType = errors.New("secret was not written by env-sync")
+
+// ContentType returns the Key Vault content type of an encrypted blob, naming its algorithm and
+// format version, e.g. application/x-envsync-aesgcm-v3. Values that aren't versioned blobs,
+// including FormatLegacy blobs, which have no header, get an empty content type.
+func ContentType(encodedData string) string {
+	// The first 8 characters decode to the magic and version
+	if len(encodedData) < 8 {
+		return ""
+	}
+	prefix, err := base64.StdEncoding.DecodeString(encodedData[:8])
+	if err != nil || !bytes.HasPrefix(prefix, formatMagic) {
+		return ""
+	}
+	switch version := prefix[len(formatMagic)]; version {
+	case FormatEnvelope, FormatEnvelopeKeyID:
+		return fmt.Sprintf("%saesgcm-v%d", ContentTypePrefix, version)
+	case FormatRecipients:
+		return fmt.Sprintf("%sx25519-aesgcm-v%d", ContentTypePrefix, version)
+	default:
+		return ""
+	}
+}
+
+// CheckContentType returns an error wrapping ErrUnknownContentType unless contentType is one
+// env-sync writes. An empty content type is accepted, since secrets stored before env-sync set
+// one have none.
+func CheckContentType(contentType string) error {
+	if contentType == "" || strings.HasPrefix(contentType, ContentTypePrefix) {
+		return nil
+	}
+	return fmt.Errorf("%w: its content type is '%s', not %s*", ErrUnknownContentType, contentType, ContentTypePrefix)
+}
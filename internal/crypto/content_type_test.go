@@ -0,0 +1,41 @@
+package crypto
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	key, _ := GenerateEncryptionKey()
+	if got := ContentType(mustEncrypt(t, []byte("KEY=value"), key)); got != "application/x-envsync-aesgcm-v3" {
+		t.Errorf("unexpected content type for an envelope blob: %q", got)
+	}
+
+	_, publicKey := newRecipient(t)
+	encrypted, err := EncryptForRecipients([]byte("KEY=value"), []string{publicKey})
+	if err != nil {
+		t.Fatalf("EncryptForRecipients failed: %v", err)
+	}
+	if got := ContentType(encrypted); got != "application/x-envsync-x25519-aesgcm-v4" {
+		t.Errorf("unexpected content type for a recipients blob: %q", got)
+	}
+
+	legacy, _ := sealGCM(key, []byte("KEY=value"), nil)
+	for _, value := range []string{base64.StdEncoding.EncodeToString(legacy), `{"kid": "x"}`, "", "RU5WUw"} {
+		if got := ContentType(value); got != "" {
+			t.Errorf("expected no content type for %q, got %q", value, got)
+		}
+	}
+}
+
+func TestCheckContentType(t *testing.T) {
+	for _, contentType := range []string{"", "application/x-envsync-aesgcm-v3", "application/x-envsync-aesgcm-v9"} {
+		if err := CheckContentType(contentType); err != nil {
+			t.Errorf("expected %q to be accepted, got %v", contentType, err)
+		}
+	}
+	if err := CheckContentType("application/x-pkcs12"); !errors.Is(err, ErrUnknownContentType) {
+		t.Errorf("expected ErrUnknownContentType, got %v", err)
+	}
+}
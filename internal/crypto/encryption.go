@@ -1,13 +1,17 @@
 package crypto
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 )
 
 const (
@@ -15,8 +19,99 @@ const (
 	KeySize = 32
 	// NonceSize is the size of the nonce (12 bytes for GCM).
 	NonceSize = 12
+	// TagSize is the size of the GCM authentication tag.
+	TagSize = 16
 )
 
+// Encrypted blob format versions.
+const (
+	// FormatLegacy is the original format: nonce + ciphertext, encrypted directly with the master key.
+	FormatLegacy byte = 1
+	// FormatEnvelope encrypts content with a per-push data key wrapped by the master key:
+	// magic + version + wrappedDataKey + nonce + ciphertext.
+	FormatEnvelope byte = 2
+	// FormatEnvelopeKeyID extends FormatEnvelope with the master key fingerprint:
+	// magic + version + keyFingerprint + wrappedDataKey + nonce + ciphertext.
+	FormatEnvelopeKeyID byte = 3
+)
+
+// Key string formats accepted by DecodeKeyFormat and KeyToString.
+const (
+	// KeyFormatAuto detects hex keys by their length and alphabet and treats everything else as base64.
+	KeyFormatAuto = "auto"
+	// KeyFormatBase64 is standard padded base64, the default output of generate-key.
+	KeyFormatBase64 = "base64"
+	// KeyFormatHex is lowercase or uppercase hexadecimal.
+	KeyFormatHex = "hex"
+)
+
+// KeyFormats lists the accepted key format names.
+var KeyFormats = []string{KeyFormatAuto, KeyFormatBase64, KeyFormatHex}
+
+// minUniqueKeyBytes is the fewest distinct byte values a key may contain.
+// A random 32-byte key has about 30 on average; fewer than 16 is vanishingly unlikely.
+const minUniqueKeyBytes = 16
+
+// Key validation errors, distinguishable with errors.Is.
+var (
+	// ErrKeyEncoding means the key string could not be decoded at all.
+	ErrKeyEncoding = errors.New("key could not be decoded")
+	// ErrKeySize means the key decoded to the wrong number of bytes.
+	ErrKeySize = errors.New("invalid key size")
+	// ErrWeakKey means the key has the right size but too little entropy.
+	ErrWeakKey = errors.New("key is too weak")
+)
+
+// ErrDecryption is matched, with errors.Is, by DecryptEnvContent errors caused by the content
+// rather than the key's format: a wrong key, a key mismatch or corrupted data.
+var ErrDecryption = errors.New("decryption failed")
+
+// decryptionError marks an error as a decryption failure without changing its message
+type decryptionError struct {
+	err error
+}
+
+func (e *decryptionError) Error() string {
+	return e.err.Error()
+}
+
+func (e *decryptionError) Unwrap() []error {
+	return []error{e.err, ErrDecryption}
+}
+
+// formatMagic prefixes versioned blobs so they can be told apart from legacy ones.
+var formatMagic = []byte("ENVS")
+
+// prefixSize is the size of the magic + version prefix of versioned blobs.
+var prefixSize = len(formatMagic) + 1
+
+// wrappedKeySize is the size of a data key wrapped with AES-GCM (nonce + key + tag).
+const wrappedKeySize = NonceSize + KeySize + TagSize
+
+// fingerprintSize is the number of key fingerprint bytes embedded in FormatEnvelopeKeyID blobs.
+const fingerprintSize = 8
+
+// KeyMismatchError is returned when content was encrypted with a different key than the one loaded.
+type KeyMismatchError struct {
+	ContentKey string // Fingerprint of the key the content was encrypted with
+	LoadedKey  string // Fingerprint of the key used for decryption
+}
+
+func (e *KeyMismatchError) Error() string {
+	return fmt.Sprintf("this content was encrypted with key %s, but you loaded key %s", e.ContentKey, e.LoadedKey)
+}
+
+// KeyFingerprint returns a short, non-secret identifier for a key:
+// the hex encoded first 8 bytes of its SHA-256 hash.
+func KeyFingerprint(key []byte) string {
+	return hex.EncodeToString(keyFingerprintBytes(key))
+}
+
+func keyFingerprintBytes(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:fingerprintSize]
+}
+
 // GenerateEncryptionKey creates a new 256-bit (32-byte) encryption key.
 func GenerateEncryptionKey() ([]byte, error) {
 	return GenerateRandomBytes(KeySize)
@@ -36,101 +131,347 @@ func DisplayKeyForSharing(key []byte) string {
 	return base64.StdEncoding.EncodeToString(key)
 }
 
-// ValidateEncryptionKey checks if the key has the correct size.
+// DecodeKey decodes a base64 or hex encoded key, detecting the format automatically.
+// It does not validate the key.
+func DecodeKey(encoded string) ([]byte, error) {
+	return DecodeKeyFormat(encoded, KeyFormatAuto)
+}
+
+// DecodeKeyFormat decodes a key in the given format (auto, base64 or hex; empty means auto).
+// It does not validate the key.
+func DecodeKeyFormat(encoded, format string) ([]byte, error) {
+	if format == "" || format == KeyFormatAuto {
+		format = KeyFormatBase64
+		// A hex key is exactly twice KeySize hex digits; base64 keys are 43 or 44 characters
+		if len(encoded) == hex.EncodedLen(KeySize) && isHex(encoded) {
+			format = KeyFormatHex
+		}
+	}
+
+	var key []byte
+	var err error
+	switch format {
+	case KeyFormatBase64:
+		key, err = decodeBase64Key(encoded)
+	case KeyFormatHex:
+		key, err = hex.DecodeString(encoded)
+	default:
+		return nil, fmt.Errorf("unsupported key format: %s", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: not valid %s: %v", ErrKeyEncoding, format, err)
+	}
+	return key, nil
+}
+
+// base64Encodings are the base64 variants keys are accepted in, in the order they're tried
+var base64Encodings = []*base64.Encoding{
+	base64.StdEncoding,
+	base64.URLEncoding,
+	base64.RawStdEncoding,
+	base64.RawURLEncoding,
+}
+
+// decodeBase64Key decodes a key in standard or URL-safe base64, with or without padding, since
+// keys copied out of other tools often use the URL-safe alphabet or drop the padding
+func decodeBase64Key(encoded string) ([]byte, error) {
+	for _, encoding := range base64Encodings {
+		if key, err := encoding.DecodeString(encoded); err == nil {
+			return key, nil
+		}
+	}
+
+	// Report the error of the variant the key looks like it was meant to be in
+	encoding := base64.StdEncoding
+	if strings.ContainsAny(encoded, "-_") {
+		encoding = base64.URLEncoding
+	}
+	if !strings.HasSuffix(encoded, "=") {
+		encoding = encoding.WithPadding(base64.NoPadding)
+	}
+	_, err := encoding.DecodeString(encoded)
+	return nil, fmt.Errorf("%v (tried the standard and URL-safe alphabets, padded and unpadded)", err)
+}
+
+// isHex reports whether s consists only of hexadecimal digits
+func isHex(s string) bool {
+	for _, r := range s {
+		if !('0' <= r && r <= '9' || 'a' <= r && r <= 'f' || 'A' <= r && r <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+// ValidateEncryptionKey checks that the key has the correct size and is not obviously low-entropy.
 func ValidateEncryptionKey(key []byte) error {
+	if err := ValidateKeySize(key); err != nil {
+		return err
+	}
+
+	unique := make(map[byte]bool, len(key))
+	for _, b := range key {
+		unique[b] = true
+	}
+	if len(unique) == 1 {
+		return fmt.Errorf("%w: all %d bytes are identical", ErrWeakKey, len(key))
+	}
+	if len(unique) < minUniqueKeyBytes {
+		return fmt.Errorf("%w: only %d distinct byte values (expected at least %d)", ErrWeakKey, len(unique), minUniqueKeyBytes)
+	}
+	return nil
+}
+
+// ValidateKeySize checks only that the key has the correct size.
+// Decryption uses it so content under an existing weak key can still be read and rotated.
+func ValidateKeySize(key []byte) error {
 	if len(key) != KeySize {
-		return fmt.Errorf("invalid key size: must be %d bytes", KeySize)
+		return fmt.Errorf("%w: must be %d bytes, got %d", ErrKeySize, KeySize, len(key))
 	}
 	return nil
 }
 
-// EncryptEnvContent encrypts content using AES-256-GCM.
-// The output is a base64 encoded string: nonce + ciphertext + tag
+// EncryptEnvContent encrypts content using envelope encryption with AES-256-GCM.
+// A fresh random data key encrypts the content and is itself wrapped with the
+// master key. The output is a base64 encoded string:
+// magic + version + keyFingerprint + wrappedDataKey + nonce + ciphertext + tag
 func EncryptEnvContent(content []byte, key []byte) (string, error) {
 	if err := ValidateEncryptionKey(key); err != nil {
 		return "", err
 	}
 
-	block, err := aes.NewCipher(key)
+	dataKey, err := GenerateEncryptionKey()
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher block: %w", err)
+		return "", fmt.Errorf("failed to generate data key: %w", err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	header := envelopeHeader(FormatEnvelopeKeyID, key)
+
+	// The wrapped key is bound to the full header, the content only to the prefix,
+	// so rotation can rewrap the data key without touching the content ciphertext
+	wrappedKey, err := sealGCM(key, dataKey, header)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
 	}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	ciphertext, err := sealGCM(dataKey, content, header[:prefixSize])
+	if err != nil {
+		return "", err
 	}
 
-	ciphertext := gcm.Seal(nil, nonce, content, nil)
-
-	// Prepend nonce to the ciphertext
-	encryptedData := append(nonce, ciphertext...)
+	encryptedData := append(header, wrappedKey...)
+	encryptedData = append(encryptedData, ciphertext...)
 
 	return base64.StdEncoding.EncodeToString(encryptedData), nil
 }
 
 // DecryptEnvContent decrypts a base64 encoded string using AES-256-GCM.
-func DecryptEnvContent(encodedData string, key []byte) ([]byte, error) {
-	if err := ValidateEncryptionKey(key); err != nil {
+// Both envelope and legacy single-key blobs are supported. If the blob records
+// the fingerprint of a different key, a *KeyMismatchError is returned.
+// FormatRecipients blobs are decrypted with key as the recipient's private key;
+// a *NotRecipientError is returned if it isn't one of them.
+//
+// When key fails, each of previousKeys is tried in turn, so content pushed with a key
+// retired by a rotation stays readable; the error is still the one key failed with.
+func DecryptEnvContent(encodedData string, key []byte, previousKeys ...[]byte) ([]byte, error) {
+	if err := ValidateKeySize(key); err != nil {
 		return nil, err
 	}
 
+	plaintext, err := decryptEnvContent(encodedData, key)
+	if err == nil {
+		return plaintext, nil
+	}
+	for _, previous := range previousKeys {
+		if ValidateKeySize(previous) != nil {
+			continue
+		}
+		if plaintext, previousErr := decryptEnvContent(encodedData, previous); previousErr == nil {
+			return plaintext, nil
+		}
+	}
+	return nil, &decryptionError{err}
+}
+
+func decryptEnvContent(encodedData string, key []byte) ([]byte, error) {
 	encryptedData, err := base64.StdEncoding.DecodeString(encodedData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode base64 data: %w", err)
 	}
 
-	block, err := aes.NewCipher(key)
+	switch blobVersion(encryptedData) {
+	case FormatEnvelope, FormatEnvelopeKeyID:
+		header, wrappedKey, ciphertext := splitEnvelope(encryptedData)
+		if wrappedKey == nil {
+			return nil, fmt.Errorf("ciphertext too short")
+		}
+		dataKey, err := unwrapDataKey(key, header, wrappedKey)
+		if err != nil {
+			return nil, err
+		}
+		plaintext, err := openGCM(dataKey, ciphertext, header[:prefixSize])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		}
+		return plaintext, nil
+	case FormatRecipients:
+		return decryptForRecipient(encryptedData, key)
+	default:
+		plaintext, err := openGCM(key, encryptedData, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		}
+		return plaintext, nil
+	}
+}
+
+// RotateKey re-protects encrypted content under a new master key.
+// For fingerprinted envelope blobs only the data key is rewrapped, leaving the
+// content ciphertext untouched. Older blobs are re-encrypted into the current format.
+func RotateKey(oldKey, newKey []byte, encryptedContent string) (string, error) {
+	if err := ValidateEncryptionKey(newKey); err != nil {
+		return "", fmt.Errorf("failed to re-encrypt with new key during rotation: %w", err)
+	}
+
+	encryptedData, err := base64.StdEncoding.DecodeString(encryptedContent)
+	if err == nil && blobVersion(encryptedData) == FormatEnvelopeKeyID {
+		header, wrappedKey, ciphertext := splitEnvelope(encryptedData)
+		if wrappedKey == nil {
+			return "", fmt.Errorf("failed to decrypt with old key during rotation: ciphertext too short")
+		}
+		dataKey, err := unwrapDataKey(oldKey, header, wrappedKey)
+		if err != nil {
+			return "", fmt.Errorf("failed to decrypt with old key during rotation: %w", err)
+		}
+
+		newHeader := envelopeHeader(FormatEnvelopeKeyID, newKey)
+		rewrapped, err := sealGCM(newKey, dataKey, newHeader)
+		if err != nil {
+			return "", fmt.Errorf("failed to re-encrypt with new key during rotation: %w", err)
+		}
+
+		rotated := append(newHeader, rewrapped...)
+		rotated = append(rotated, ciphertext...)
+		return base64.StdEncoding.EncodeToString(rotated), nil
+	}
+
+	decryptedContent, err := DecryptEnvContent(encryptedContent, oldKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create cipher block: %w", err)
+		return "", fmt.Errorf("failed to decrypt with old key during rotation: %w", err)
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	newEncryptedContent, err := EncryptEnvContent(decryptedContent, newKey)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create GCM: %w", err)
+		return "", fmt.Errorf("failed to re-encrypt with new key during rotation: %w", err)
 	}
 
-	nonceSize := gcm.NonceSize()
-	if len(encryptedData) < nonceSize {
-		return nil, fmt.Errorf("ciphertext too short")
+	return newEncryptedContent, nil
+}
+
+// envelopeHeader builds the header for a versioned blob, including the key
+// fingerprint for FormatEnvelopeKeyID
+func envelopeHeader(version byte, key []byte) []byte {
+	header := make([]byte, 0, prefixSize+fingerprintSize)
+	header = append(header, formatMagic...)
+	header = append(header, version)
+	if version == FormatEnvelopeKeyID {
+		header = append(header, keyFingerprintBytes(key)...)
 	}
+	return header
+}
 
-	nonce, ciphertext := encryptedData[:nonceSize], encryptedData[nonceSize:]
+// blobVersion reports the format version of decoded encrypted data
+func blobVersion(data []byte) byte {
+	if len(data) > len(formatMagic) && bytes.HasPrefix(data, formatMagic) {
+		return data[len(formatMagic)]
+	}
+	return FormatLegacy
+}
 
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+// splitEnvelope splits an envelope blob into header, wrapped data key, and ciphertext.
+// The wrapped key is nil if the blob is too short.
+func splitEnvelope(data []byte) (header, wrappedKey, ciphertext []byte) {
+	headerSize := prefixSize
+	if blobVersion(data) == FormatEnvelopeKeyID {
+		headerSize += fingerprintSize
+	}
+	if len(data) < headerSize+wrappedKeySize+NonceSize+TagSize {
+		return nil, nil, nil
+	}
+	return data[:headerSize], data[headerSize : headerSize+wrappedKeySize], data[headerSize+wrappedKeySize:]
+}
+
+// unwrapDataKey unwraps an envelope data key, reporting a key mismatch when
+// the header records a different key fingerprint
+func unwrapDataKey(key, header, wrappedKey []byte) ([]byte, error) {
+	if len(header) == prefixSize+fingerprintSize {
+		contentFingerprint := header[prefixSize:]
+		if !bytes.Equal(contentFingerprint, keyFingerprintBytes(key)) {
+			return nil, &KeyMismatchError{
+				ContentKey: hex.EncodeToString(contentFingerprint),
+				LoadedKey:  KeyFingerprint(key),
+			}
+		}
+	}
+
+	dataKey, err := openGCM(key, wrappedKey, header)
 	if err != nil {
-		return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
 	}
+	return dataKey, nil
+}
 
-	return plaintext, nil
+// sealGCM encrypts plaintext with AES-256-GCM, returning nonce + ciphertext + tag
+func sealGCM(key, plaintext, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, additionalData), nil
 }
 
-// RotateKey decrypts content with an old key and re-encrypts it with a new key.
-func RotateKey(oldKey, newKey []byte, encryptedContent string) (string, error) {
-	decryptedContent, err := DecryptEnvContent(encryptedContent, oldKey)
+// openGCM decrypts nonce + ciphertext + tag produced by sealGCM
+func openGCM(key, data, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt with old key during rotation: %w", err)
+		return nil, err
 	}
 
-	newEncryptedContent, err := EncryptEnvContent(decryptedContent, newKey)
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	return gcm.Open(nil, nonce, ciphertext, additionalData)
+}
+
+// newGCM creates an AES-GCM cipher for the given key
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to re-encrypt with new key during rotation: %w", err)
+		return nil, fmt.Errorf("failed to create cipher block: %w", err)
 	}
 
-	return newEncryptedContent, nil
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return gcm, nil
 }
 
 // KeyToString formats the key as either base64 or hex.
 func KeyToString(key []byte, format string) (string, error) {
 	switch format {
-	case "base64":
+	case KeyFormatBase64:
 		return base64.StdEncoding.EncodeToString(key), nil
-	case "hex":
+	case KeyFormatHex:
 		return hex.EncodeToString(key), nil
 	default:
 		return "", fmt.Errorf("unsupported key format: %s", format)
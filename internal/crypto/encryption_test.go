@@ -2,6 +2,9 @@ package crypto
 
 import (
 	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -28,8 +31,105 @@ func TestValidateEncryptionKey(t *testing.T) {
 		key := []byte("shortkey")
 		if err := ValidateEncryptionKey(key); err == nil {
 			t.Error("validation succeeded for an invalid key")
+		} else if !errors.Is(err, ErrKeySize) {
+			t.Errorf("expected ErrKeySize, got %v", err)
 		}
 	})
+
+	t.Run("all zero key", func(t *testing.T) {
+		key := make([]byte, KeySize)
+		if err := ValidateEncryptionKey(key); !errors.Is(err, ErrWeakKey) {
+			t.Errorf("expected ErrWeakKey, got %v", err)
+		}
+	})
+
+	t.Run("low entropy key", func(t *testing.T) {
+		key := []byte("12345678901234567890123456789012")
+		if err := ValidateEncryptionKey(key); !errors.Is(err, ErrWeakKey) {
+			t.Errorf("expected ErrWeakKey, got %v", err)
+		}
+		// Weak keys are still accepted for decryption so they can be rotated out
+		if err := ValidateKeySize(key); err != nil {
+			t.Errorf("size validation failed for a correctly sized key: %v", err)
+		}
+	})
+}
+
+func TestDecodeKey(t *testing.T) {
+	key, _ := GenerateEncryptionKey()
+
+	decoded, err := DecodeKey(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatalf("failed to decode valid key: %v", err)
+	}
+	if !bytes.Equal(key, decoded) {
+		t.Error("decoded key does not match original")
+	}
+
+	if _, err := DecodeKey("not base64!"); !errors.Is(err, ErrKeyEncoding) {
+		t.Errorf("expected ErrKeyEncoding, got %v", err)
+	}
+
+	hexKey, _ := KeyToString(key, KeyFormatHex)
+	decoded, err = DecodeKey(hexKey)
+	if err != nil {
+		t.Fatalf("failed to auto-detect hex key: %v", err)
+	}
+	if !bytes.Equal(key, decoded) {
+		t.Error("decoded hex key does not match original")
+	}
+
+	// Hex digits are valid base64, but decode to the wrong size
+	asBase64, err := DecodeKeyFormat(hexKey, KeyFormatBase64)
+	if err != nil {
+		t.Fatalf("unexpected decode error: %v", err)
+	}
+	if err := ValidateEncryptionKey(asBase64); !errors.Is(err, ErrKeySize) {
+		t.Errorf("expected ErrKeySize for hex key decoded as base64, got %v", err)
+	}
+	if _, err := DecodeKeyFormat("zz", KeyFormatHex); !errors.Is(err, ErrKeyEncoding) {
+		t.Errorf("expected ErrKeyEncoding for invalid hex, got %v", err)
+	}
+
+	short, err := DecodeKey(base64.StdEncoding.EncodeToString(key[:16]))
+	if err != nil {
+		t.Fatalf("failed to decode short key: %v", err)
+	}
+	if err := ValidateEncryptionKey(short); !errors.Is(err, ErrKeySize) {
+		t.Errorf("expected ErrKeySize for short key, got %v", err)
+	}
+}
+
+func TestDecodeKeyBase64Variants(t *testing.T) {
+	// Bytes chosen so the encodings use both characters that differ between the alphabets
+	key := bytes.Repeat([]byte{0xfb, 0xff, 0xbf, 0x01}, KeySize/4)
+	encodings := map[string]*base64.Encoding{
+		"standard":          base64.StdEncoding,
+		"URL-safe":          base64.URLEncoding,
+		"unpadded":          base64.RawStdEncoding,
+		"URL-safe unpadded": base64.RawURLEncoding,
+	}
+	for name, encoding := range encodings {
+		encoded := encoding.EncodeToString(key)
+		for _, format := range []string{KeyFormatAuto, KeyFormatBase64} {
+			decoded, err := DecodeKeyFormat(encoded, format)
+			if err != nil {
+				t.Errorf("%s key %q (format %s): %v", name, encoded, format, err)
+				continue
+			}
+			if !bytes.Equal(key, decoded) {
+				t.Errorf("%s key %q (format %s) decoded to %x", name, encoded, format, decoded)
+			}
+		}
+	}
+
+	_, err := DecodeKey("+/-_" + base64.RawStdEncoding.EncodeToString(key))
+	if !errors.Is(err, ErrKeyEncoding) {
+		t.Fatalf("expected ErrKeyEncoding for mixed alphabets, got %v", err)
+	}
+	if want := "illegal base64 data at input byte 0"; !strings.Contains(err.Error(), want) {
+		t.Errorf("expected the error to point at the offending character, got %v", err)
+	}
 }
 
 func TestEncryptDecrypt(t *testing.T) {
@@ -72,6 +172,28 @@ func TestDecryptWithWrongKey(t *testing.T) {
 	}
 }
 
+func TestDecryptWithPreviousKeys(t *testing.T) {
+	current, _ := GenerateEncryptionKey()
+	previous, _ := GenerateEncryptionKey()
+	other, _ := GenerateEncryptionKey()
+
+	encrypted, _ := EncryptEnvContent([]byte("KEY=old"), previous)
+	decrypted, err := DecryptEnvContent(encrypted, current, other, previous)
+	if err != nil {
+		t.Fatalf("expected a previous key to decrypt the content, got %v", err)
+	}
+	if string(decrypted) != "KEY=old" {
+		t.Errorf("unexpected content %q", decrypted)
+	}
+
+	// When every key fails, the error is the current key's
+	_, err = DecryptEnvContent(encrypted, current, other)
+	var mismatch *KeyMismatchError
+	if !errors.As(err, &mismatch) || mismatch.LoadedKey != KeyFingerprint(current) {
+		t.Errorf("expected a KeyMismatchError for the current key, got %v", err)
+	}
+}
+
 func TestRotateKey(t *testing.T) {
 	oldKey, _ := GenerateEncryptionKey()
 	newKey, _ := GenerateEncryptionKey()
@@ -99,3 +221,142 @@ func TestRotateKey(t *testing.T) {
 		t.Error("decryption succeeded with old key after rotation")
 	}
 }
+
+func TestEncryptUsesEnvelopeFormat(t *testing.T) {
+	key, _ := GenerateEncryptionKey()
+
+	encrypted, err := EncryptEnvContent([]byte("KEY=value"), key)
+	if err != nil {
+		t.Fatalf("encryption failed: %v", err)
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(encrypted)
+	if version := blobVersion(data); version != FormatEnvelopeKeyID {
+		t.Errorf("expected envelope format version %d, got %d", FormatEnvelopeKeyID, version)
+	}
+
+	// Each push uses a fresh data key, so identical content encrypts differently
+	again, _ := EncryptEnvContent([]byte("KEY=value"), key)
+	if encrypted == again {
+		t.Error("expected distinct ciphertexts for repeated encryption")
+	}
+}
+
+func TestDecryptLegacyFormat(t *testing.T) {
+	key, _ := GenerateEncryptionKey()
+	originalContent := []byte("LEGACY=content")
+
+	// Build a legacy blob: nonce + ciphertext encrypted directly with the master key
+	legacy, err := sealGCM(key, originalContent, nil)
+	if err != nil {
+		t.Fatalf("legacy encryption failed: %v", err)
+	}
+
+	decrypted, err := DecryptEnvContent(base64.StdEncoding.EncodeToString(legacy), key)
+	if err != nil {
+		t.Fatalf("decryption of legacy blob failed: %v", err)
+	}
+	if !bytes.Equal(originalContent, decrypted) {
+		t.Errorf("legacy content mismatch. got: %s, want: %s", decrypted, originalContent)
+	}
+}
+
+func TestRotateKeyRewrapsDataKey(t *testing.T) {
+	oldKey, _ := GenerateEncryptionKey()
+	newKey, _ := GenerateEncryptionKey()
+
+	encrypted, _ := EncryptEnvContent([]byte("content to be rewrapped"), oldKey)
+	rotated, err := RotateKey(oldKey, newKey, encrypted)
+	if err != nil {
+		t.Fatalf("key rotation failed: %v", err)
+	}
+
+	before, _ := base64.StdEncoding.DecodeString(encrypted)
+	after, _ := base64.StdEncoding.DecodeString(rotated)
+	_, _, beforeCiphertext := splitEnvelope(before)
+	_, _, afterCiphertext := splitEnvelope(after)
+	if !bytes.Equal(beforeCiphertext, afterCiphertext) {
+		t.Error("expected content ciphertext to be unchanged when only the data key is rewrapped")
+	}
+
+	if _, err := DecryptEnvContent(rotated, newKey); err != nil {
+		t.Errorf("decryption failed with new key after rewrap: %v", err)
+	}
+}
+
+func TestRotateKeyLegacyFormat(t *testing.T) {
+	oldKey, _ := GenerateEncryptionKey()
+	newKey, _ := GenerateEncryptionKey()
+	originalContent := []byte("legacy content")
+
+	legacy, _ := sealGCM(oldKey, originalContent, nil)
+	rotated, err := RotateKey(oldKey, newKey, base64.StdEncoding.EncodeToString(legacy))
+	if err != nil {
+		t.Fatalf("key rotation of legacy blob failed: %v", err)
+	}
+
+	data, _ := base64.StdEncoding.DecodeString(rotated)
+	if blobVersion(data) != FormatEnvelopeKeyID {
+		t.Error("expected rotated legacy blob to be upgraded to the envelope format")
+	}
+
+	decrypted, err := DecryptEnvContent(rotated, newKey)
+	if err != nil {
+		t.Fatalf("decryption failed with new key: %v", err)
+	}
+	if !bytes.Equal(originalContent, decrypted) {
+		t.Error("rotated content does not match original")
+	}
+}
+
+func TestKeyFingerprint(t *testing.T) {
+	key1, _ := GenerateEncryptionKey()
+	key2, _ := GenerateEncryptionKey()
+
+	fp := KeyFingerprint(key1)
+	if len(fp) != fingerprintSize*2 {
+		t.Errorf("expected fingerprint of %d hex characters, got %q", fingerprintSize*2, fp)
+	}
+	if fp != KeyFingerprint(key1) {
+		t.Error("fingerprint should be stable for the same key")
+	}
+	if fp == KeyFingerprint(key2) {
+		t.Error("different keys should have different fingerprints")
+	}
+}
+
+func TestDecryptReportsKeyMismatch(t *testing.T) {
+	key1, _ := GenerateEncryptionKey()
+	key2, _ := GenerateEncryptionKey()
+
+	encrypted, _ := EncryptEnvContent([]byte("KEY=value"), key1)
+	_, err := DecryptEnvContent(encrypted, key2)
+
+	var mismatch *KeyMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("expected a KeyMismatchError, got %v", err)
+	}
+	if mismatch.ContentKey != KeyFingerprint(key1) || mismatch.LoadedKey != KeyFingerprint(key2) {
+		t.Errorf("unexpected fingerprints in error: %v", err)
+	}
+}
+
+func TestDecryptEnvelopeWithoutFingerprint(t *testing.T) {
+	key, _ := GenerateEncryptionKey()
+	dataKey, _ := GenerateEncryptionKey()
+	originalContent := []byte("ENVELOPE=v2")
+
+	// Build a FormatEnvelope blob, which has no key fingerprint in its header
+	header := envelopeHeader(FormatEnvelope, key)
+	wrappedKey, _ := sealGCM(key, dataKey, header)
+	ciphertext, _ := sealGCM(dataKey, originalContent, header)
+	blob := append(append(header, wrappedKey...), ciphertext...)
+
+	decrypted, err := DecryptEnvContent(base64.StdEncoding.EncodeToString(blob), key)
+	if err != nil {
+		t.Fatalf("decryption of envelope blob without fingerprint failed: %v", err)
+	}
+	if !bytes.Equal(originalContent, decrypted) {
+		t.Errorf("content mismatch. got: %s, want: %s", decrypted, originalContent)
+	}
+}
@@ -0,0 +1,10 @@
+package crypto
+
+import "context"
+
+// KeyProvider supplies the data encryption key from an external key
+// management system, keeping the plaintext key off the local disk.
+type KeyProvider interface {
+	// GetKey returns the plaintext data encryption key.
+	GetKey(ctx context.Context) ([]byte, error)
+}
@@ -0,0 +1,237 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// FormatRecipients wraps the per-push data key to each recipient's X25519 public key:
+// magic + version + count + count * (recipientKey + ephemeralKey + wrappedDataKey) + nonce + ciphertext.
+// It is decrypted with a recipient's private key rather than a shared master key.
+const FormatRecipients byte = 4
+
+// RecipientPrefix starts every encoded recipient public key.
+const RecipientPrefix = "envsync1"
+
+// MaxRecipients is the most recipients a single blob can be encrypted to.
+const MaxRecipients = 255
+
+// ErrInvalidRecipient is matched, with errors.Is, by errors for malformed recipient public keys.
+var ErrInvalidRecipient = errors.New("invalid recipient")
+
+// recipientKeySize is the size of an X25519 public key
+const recipientKeySize = 32
+
+// stanzaSize is the size of one recipient's entry in a FormatRecipients header
+const stanzaSize = recipientKeySize + recipientKeySize + wrappedKeySize
+
+// recipientWrapInfo separates the wrapping keys derived here from any other use of the shared secret
+var recipientWrapInfo = []byte("env-sync recipient wrap v1")
+
+// NotRecipientError is returned when content was not encrypted to the loaded private key.
+type NotRecipientError struct {
+	PublicKey string // Recipient public key of the loaded private key
+}
+
+func (e *NotRecipientError) Error() string {
+	return fmt.Sprintf("this content was not encrypted to your public key %s; ask a team member to add you with 'env-sync recipients add' and push again", e.PublicKey)
+}
+
+// RecipientPublicKey returns the encoded public key for a recipient's 32-byte private key.
+func RecipientPublicKey(privateKey []byte) (string, error) {
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrKeySize, err)
+	}
+	return encodeRecipient(priv.PublicKey().Bytes()), nil
+}
+
+// ParseRecipient decodes and validates an encoded recipient public key, returning the raw X25519 key.
+func ParseRecipient(recipient string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(strings.TrimSpace(recipient), RecipientPrefix)
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s' does not start with '%s'", ErrInvalidRecipient, recipient, RecipientPrefix)
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%w: '%s' could not be decoded: %v", ErrInvalidRecipient, recipient, err)
+	}
+	if _, err := ecdh.X25519().NewPublicKey(raw); err != nil {
+		return nil, fmt.Errorf("%w: '%s': %v", ErrInvalidRecipient, recipient, err)
+	}
+	return raw, nil
+}
+
+// EncryptForRecipients encrypts content with a fresh data key and wraps that key to each
+// recipient public key, so any one of their private keys can decrypt it with DecryptEnvContent.
+func EncryptForRecipients(content []byte, recipients []string) (string, error) {
+	if len(recipients) == 0 {
+		return "", fmt.Errorf("%w: no recipients to encrypt to", ErrInvalidRecipient)
+	}
+	if len(recipients) > MaxRecipients {
+		return "", fmt.Errorf("%w: at most %d recipients are supported, got %d", ErrInvalidRecipient, MaxRecipients, len(recipients))
+	}
+
+	dataKey, err := GenerateEncryptionKey()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	prefix := envelopeHeader(FormatRecipients, nil)
+	header := append(append([]byte{}, prefix...), byte(len(recipients)))
+	for _, recipient := range recipients {
+		recipientKey, err := ParseRecipient(recipient)
+		if err != nil {
+			return "", err
+		}
+		stanza, err := wrapToRecipient(dataKey, recipientKey, prefix)
+		if err != nil {
+			return "", fmt.Errorf("failed to wrap data key for %s: %w", recipient, err)
+		}
+		header = append(header, stanza...)
+	}
+
+	// The content is bound to the whole header, so the recipient list can't be altered unnoticed
+	ciphertext, err := sealGCM(dataKey, content, header)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(append(header, ciphertext...)), nil
+}
+
+// BlobRecipients returns the recipient public keys a blob was encrypted to, or nil if it
+// isn't a FormatRecipients blob.
+func BlobRecipients(encodedData string) []string {
+	data, err := base64.StdEncoding.DecodeString(encodedData)
+	if err != nil || blobVersion(data) != FormatRecipients {
+		return nil
+	}
+	stanzas, _, ok := splitRecipients(data)
+	if !ok {
+		return nil
+	}
+	recipients := make([]string, len(stanzas))
+	for i, stanza := range stanzas {
+		recipients[i] = encodeRecipient(stanza[:recipientKeySize])
+	}
+	return recipients
+}
+
+// decryptForRecipient opens a FormatRecipients blob with the private key of one of its recipients
+func decryptForRecipient(data, privateKey []byte) ([]byte, error) {
+	stanzas, ciphertext, ok := splitRecipients(data)
+	if !ok {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	publicKey := priv.PublicKey().Bytes()
+
+	prefix := data[:prefixSize]
+	for _, stanza := range stanzas {
+		if !bytes.Equal(stanza[:recipientKeySize], publicKey) {
+			continue
+		}
+		dataKey, err := unwrapFromRecipient(priv, stanza, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+		}
+		header := data[:len(data)-len(ciphertext)]
+		plaintext, err := openGCM(dataKey, ciphertext, header)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt data: %w", err)
+		}
+		return plaintext, nil
+	}
+	return nil, &NotRecipientError{PublicKey: encodeRecipient(publicKey)}
+}
+
+// wrapToRecipient wraps the data key with a key agreed between a fresh ephemeral key and the
+// recipient, returning recipientKey + ephemeralKey + wrappedDataKey
+func wrapToRecipient(dataKey, recipientKey, prefix []byte) ([]byte, error) {
+	recipient, err := ecdh.X25519().NewPublicKey(recipientKey)
+	if err != nil {
+		return nil, err
+	}
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	wrapKey, err := recipientWrapKey(ephemeral, recipient, ephemeral.PublicKey().Bytes(), recipientKey)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := sealGCM(wrapKey, dataKey, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	stanza := make([]byte, 0, stanzaSize)
+	stanza = append(stanza, recipientKey...)
+	stanza = append(stanza, ephemeral.PublicKey().Bytes()...)
+	return append(stanza, wrapped...), nil
+}
+
+// unwrapFromRecipient reverses wrapToRecipient with the recipient's private key
+func unwrapFromRecipient(priv *ecdh.PrivateKey, stanza, prefix []byte) ([]byte, error) {
+	recipientKey := stanza[:recipientKeySize]
+	ephemeralKey := stanza[recipientKeySize : 2*recipientKeySize]
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralKey)
+	if err != nil {
+		return nil, err
+	}
+	wrapKey, err := recipientWrapKey(priv, ephemeral, ephemeralKey, recipientKey)
+	if err != nil {
+		return nil, err
+	}
+	return openGCM(wrapKey, stanza[2*recipientKeySize:], prefix)
+}
+
+// recipientWrapKey derives the key wrapping key from the X25519 shared secret, salted with
+// both public keys so it is unique to this stanza
+func recipientWrapKey(priv *ecdh.PrivateKey, peer *ecdh.PublicKey, ephemeralKey, recipientKey []byte) ([]byte, error) {
+	shared, err := priv.ECDH(peer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to agree on a wrapping key: %w", err)
+	}
+	salt := append(append([]byte{}, ephemeralKey...), recipientKey...)
+	wrapKey := make([]byte, KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared, salt, recipientWrapInfo), wrapKey); err != nil {
+		return nil, fmt.Errorf("failed to derive wrapping key: %w", err)
+	}
+	return wrapKey, nil
+}
+
+// splitRecipients splits a FormatRecipients blob into its recipient stanzas and content ciphertext
+func splitRecipients(data []byte) (stanzas [][]byte, ciphertext []byte, ok bool) {
+	if len(data) < prefixSize+1 {
+		return nil, nil, false
+	}
+	count := int(data[prefixSize])
+	headerSize := prefixSize + 1 + count*stanzaSize
+	if count == 0 || len(data) < headerSize+NonceSize+TagSize {
+		return nil, nil, false
+	}
+	for i := 0; i < count; i++ {
+		start := prefixSize + 1 + i*stanzaSize
+		stanzas = append(stanzas, data[start:start+stanzaSize])
+	}
+	return stanzas, data[headerSize:], true
+}
+
+func encodeRecipient(publicKey []byte) string {
+	return RecipientPrefix + base64.RawURLEncoding.EncodeToString(publicKey)
+}
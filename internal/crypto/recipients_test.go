@@ -0,0 +1,102 @@
+package crypto
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+// newRecipient returns a private key and its encoded public key
+func newRecipient(t *testing.T) ([]byte, string) {
+	t.Helper()
+	key, err := GenerateEncryptionKey()
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	publicKey, err := RecipientPublicKey(key)
+	if err != nil {
+		t.Fatalf("failed to derive public key: %v", err)
+	}
+	return key, publicKey
+}
+
+func TestEncryptForRecipients(t *testing.T) {
+	alice, alicePub := newRecipient(t)
+	bob, bobPub := newRecipient(t)
+	mallory, _ := newRecipient(t)
+	content := []byte("DATABASE_URL=postgres://localhost/db\n")
+
+	encrypted, err := EncryptForRecipients(content, []string{alicePub, bobPub})
+	if err != nil {
+		t.Fatalf("EncryptForRecipients failed: %v", err)
+	}
+
+	for name, key := range map[string][]byte{"alice": alice, "bob": bob} {
+		decrypted, err := DecryptEnvContent(encrypted, key)
+		if err != nil {
+			t.Fatalf("%s could not decrypt: %v", name, err)
+		}
+		if !bytes.Equal(content, decrypted) {
+			t.Errorf("%s decrypted %q, expected %q", name, decrypted, content)
+		}
+	}
+
+	_, err = DecryptEnvContent(encrypted, mallory)
+	var notRecipient *NotRecipientError
+	if !errors.As(err, &notRecipient) || !errors.Is(err, ErrDecryption) {
+		t.Fatalf("expected a NotRecipientError matching ErrDecryption, got %v", err)
+	}
+
+	recipients := BlobRecipients(encrypted)
+	if len(recipients) != 2 || recipients[0] != alicePub || recipients[1] != bobPub {
+		t.Errorf("expected recipients [%s %s], got %v", alicePub, bobPub, recipients)
+	}
+	if BlobRecipients(mustEncrypt(t, content, alice)) != nil {
+		t.Error("expected no recipients for a shared key blob")
+	}
+}
+
+func TestEncryptForRecipientsDetectsTampering(t *testing.T) {
+	alice, alicePub := newRecipient(t)
+	_, bobPub := newRecipient(t)
+
+	encrypted, err := EncryptForRecipients([]byte("KEY=value"), []string{alicePub, bobPub})
+	if err != nil {
+		t.Fatalf("EncryptForRecipients failed: %v", err)
+	}
+	data, _ := base64.StdEncoding.DecodeString(encrypted)
+
+	// Dropping bob's stanza changes the header the content is bound to
+	data[prefixSize] = 1
+	trimmed := append(append([]byte{}, data[:prefixSize+1+stanzaSize]...), data[prefixSize+1+2*stanzaSize:]...)
+	if _, err := DecryptEnvContent(base64.StdEncoding.EncodeToString(trimmed), alice); err == nil {
+		t.Error("expected decryption to fail after removing a recipient")
+	}
+}
+
+func TestParseRecipient(t *testing.T) {
+	_, publicKey := newRecipient(t)
+	if _, err := ParseRecipient(" " + publicKey + "\n"); err != nil {
+		t.Errorf("expected a valid recipient, got %v", err)
+	}
+
+	for _, invalid := range []string{"", "age1abc", RecipientPrefix + "!!!", RecipientPrefix + "c2hvcnQ"} {
+		if _, err := ParseRecipient(invalid); !errors.Is(err, ErrInvalidRecipient) {
+			t.Errorf("ParseRecipient(%q): expected ErrInvalidRecipient, got %v", invalid, err)
+		}
+	}
+
+	if _, err := EncryptForRecipients([]byte("KEY=value"), nil); !errors.Is(err, ErrInvalidRecipient) {
+		t.Errorf("expected ErrInvalidRecipient without recipients, got %v", err)
+	}
+}
+
+func mustEncrypt(t *testing.T, content, key []byte) string {
+	t.Helper()
+	encrypted, err := EncryptEnvContent(content, key)
+	if err != nil {
+		t.Fatalf("EncryptEnvContent failed: %v", err)
+	}
+	return encrypted
+}
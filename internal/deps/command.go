@@ -0,0 +1,113 @@
+package deps
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// shellMetacharacters are the characters that only a shell can interpret
+// (pipes, command lists, redirection, expansion, globbing and subshells).
+const shellMetacharacters = "|&;<>()$`*?[]{}~\n"
+
+// splitCommand splits a command line into argv, honoring single quotes, double quotes and
+// backslash escapes the way a POSIX shell would. needsShell reports unquoted shell metacharacters,
+// in which case the command must be run through a shell rather than executed directly.
+func splitCommand(command string) (argv []string, needsShell bool, err error) {
+	var current strings.Builder
+	inWord := false
+	var quote rune
+
+	runes := []rune(command)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			switch {
+			case r == '"':
+				quote = 0
+			case r == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]):
+				i++
+				current.WriteRune(runes[i])
+			case r == '$' || r == '`':
+				// Expansion inside double quotes still needs a shell
+				needsShell = true
+				current.WriteRune(r)
+			default:
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				current.WriteRune(runes[i])
+				inWord = true
+			}
+		case r == ' ' || r == '\t':
+			if inWord {
+				argv = append(argv, current.String())
+				current.Reset()
+				inWord = false
+			}
+		default:
+			if strings.ContainsRune(shellMetacharacters, r) {
+				needsShell = true
+			}
+			current.WriteRune(r)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, false, fmt.Errorf("unterminated %c quote in command: %s", quote, command)
+	}
+	if inWord {
+		argv = append(argv, current.String())
+	}
+	if len(argv) == 0 {
+		return nil, false, fmt.Errorf("empty command")
+	}
+	return argv, needsShell, nil
+}
+
+// buildInstallCommand creates the process for an install command on the given OS.
+// Simple commands are executed directly from their argv so quoted arguments survive intact;
+// only commands that need shell features are handed to a shell, as a single unsplit argument.
+func buildInstallCommand(goos, command string) (*exec.Cmd, error) {
+	argv, needsShell, err := splitCommand(command)
+	if err != nil {
+		return nil, err
+	}
+	if needsShell {
+		if goos == "windows" {
+			return exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", command), nil
+		}
+		return exec.Command("/bin/sh", "-c", command), nil
+	}
+	return exec.Command(argv[0], argv[1:]...), nil
+}
+
+// quoteArg quotes an argument for display so argv-based commands read back unambiguously
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\"'\\"+shellMetacharacters) {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// formatArgv renders argv as a shell-quoted command line
+func formatArgv(argv []string) string {
+	quoted := make([]string, len(argv))
+	for i, arg := range argv {
+		quoted[i] = quoteArg(arg)
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,106 @@
+package deps
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		command    string
+		argv       []string
+		needsShell bool
+		expectErr  bool
+	}{
+		{
+			name:    "simple command",
+			command: "brew install azure-cli",
+			argv:    []string{"brew", "install", "azure-cli"},
+		},
+		{
+			name:    "double quoted argument with spaces",
+			command: `choco install "My Tool" -y`,
+			argv:    []string{"choco", "install", "My Tool", "-y"},
+		},
+		{
+			name:    "single quoted argument with spaces",
+			command: `winget install --name 'Azure CLI' -e`,
+			argv:    []string{"winget", "install", "--name", "Azure CLI", "-e"},
+		},
+		{
+			name:    "escaped space",
+			command: `/opt/My\ Tools/install --yes`,
+			argv:    []string{"/opt/My Tools/install", "--yes"},
+		},
+		{
+			name:    "quoted metacharacters stay literal",
+			command: `echo "a | b && c"`,
+			argv:    []string{"echo", "a | b && c"},
+		},
+		{
+			name:       "pipeline needs a shell",
+			command:    "curl -fsSL https://example.com/install.sh | bash",
+			argv:       []string{"curl", "-fsSL", "https://example.com/install.sh", "|", "bash"},
+			needsShell: true,
+		},
+		{
+			name:       "expansion in double quotes needs a shell",
+			command:    `echo "$HOME"`,
+			argv:       []string{"echo", "$HOME"},
+			needsShell: true,
+		},
+		{
+			name:      "unterminated quote",
+			command:   `brew install "azure-cli`,
+			expectErr: true,
+		},
+		{
+			name:      "empty command",
+			command:   "   ",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			argv, needsShell, err := splitCommand(tt.command)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.argv, argv)
+			assert.Equal(t, tt.needsShell, needsShell)
+		})
+	}
+}
+
+func TestBuildInstallCommand(t *testing.T) {
+	t.Run("argument with spaces is passed intact", func(t *testing.T) {
+		cmd, err := buildInstallCommand("linux", `sudo apt-get install -y "my package"`)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"sudo", "apt-get", "install", "-y", "my package"}, cmd.Args)
+	})
+
+	t.Run("shell command is not split", func(t *testing.T) {
+		command := "curl -sL https://aka.ms/InstallAzureCLIDeb | sudo bash"
+		cmd, err := buildInstallCommand("linux", command)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"/bin/sh", "-c", command}, cmd.Args)
+	})
+
+	t.Run("windows shell command uses powershell", func(t *testing.T) {
+		command := "iwr https://example.com/install.ps1 | iex"
+		cmd, err := buildInstallCommand("windows", command)
+		assert.NoError(t, err)
+		assert.Equal(t, command, cmd.Args[len(cmd.Args)-1])
+		assert.Contains(t, cmd.Args[0], "powershell")
+	})
+}
+
+func TestFormatArgv(t *testing.T) {
+	assert.Equal(t, "brew install azure-cli", formatArgv([]string{"brew", "install", "azure-cli"}))
+	assert.Equal(t, `choco install 'My Tool' ''`, formatArgv([]string{"choco", "install", "My Tool", ""}))
+}
@@ -16,7 +16,8 @@ type Dependency struct {
 	Name        string
 	Command     string
 	Version     string
-	InstallCmd  map[string]string
+	InstallCmd  map[string]string   // Install command line per platform key, run through a shell only if it needs one
+	InstallArgs map[string][]string // Install argv per platform key, always run without a shell
 	DownloadURL map[string]string
 	Required    bool
 }
@@ -41,6 +42,17 @@ func NewDependencyManager() (*DependencyManager, error) {
 	}, nil
 }
 
+// PlatformKeys lists the InstallCmd keys that InstallDependency can select:
+// "<os>-<package manager>", plus "<os>-curl" for universal install scripts.
+var PlatformKeys = []string{
+	"linux-apt", "linux-yum", "linux-dnf", "linux-curl",
+	"darwin-brew", "darwin-curl",
+	"windows-winget", "windows-choco",
+}
+
+// azureCLIRPMRepo registers the Microsoft package repository used by yum and dnf to install the Azure CLI
+const azureCLIRPMRepo = "sudo rpm --import https://packages.microsoft.com/keys/microsoft.asc && echo -e '[azure-cli]\nname=Azure CLI\nbaseurl=https://packages.microsoft.com/yumrepos/azure-cli\nenabled=1\ngpgcheck=1\ngpgkey=https://packages.microsoft.com/keys/microsoft.asc' | sudo tee /etc/yum.repos.d/azure-cli.repo"
+
 var dependencies = []Dependency{
 	{
 		Name:     "Azure CLI",
@@ -48,11 +60,14 @@ var dependencies = []Dependency{
 		Version:  "2.50.0",
 		Required: true,
 		InstallCmd: map[string]string{
-			"linux-apt":      "curl -sL https://aka.ms/InstallAzureCLIDeb | sudo bash",
-			"linux-yum":      "sudo rpm --import https://packages.microsoft.com/keys/microsoft.asc && echo -e '[azure-cli]\nname=Azure CLI\nbaseurl=https://packages.microsoft.com/yumrepos/azure-cli\nenabled=1\ngpgcheck=1\ngpgkey=https://packages.microsoft.com/keys/microsoft.asc' | sudo tee /etc/yum.repos.d/azure-cli.repo && sudo yum install -y azure-cli",
-			"darwin-brew":    "brew install azure-cli",
-			"windows-winget": "winget install --id Microsoft.AzureCLI -e",
-			"windows-choco":  "choco install azure-cli -y",
+			"linux-apt": "curl -sL https://aka.ms/InstallAzureCLIDeb | sudo bash",
+			"linux-yum": azureCLIRPMRepo + " && sudo yum install -y azure-cli",
+			"linux-dnf": azureCLIRPMRepo + " && sudo dnf install -y azure-cli",
+		},
+		InstallArgs: map[string][]string{
+			"darwin-brew":    {"brew", "install", "azure-cli"},
+			"windows-winget": {"winget", "install", "--id", "Microsoft.AzureCLI", "-e"},
+			"windows-choco":  {"choco", "install", "azure-cli", "-y"},
 		},
 		DownloadURL: map[string]string{
 			"linux":   "https://docs.microsoft.com/en-us/cli/azure/install-azure-cli-linux",
@@ -66,10 +81,12 @@ var dependencies = []Dependency{
 		Version:  "0.30.0",
 		Required: false,
 		InstallCmd: map[string]string{
-			"linux-curl":     "curl -fsSL https://raw.githubusercontent.com/tilt-dev/tilt/master/scripts/install.sh | bash",
-			"darwin-brew":    "brew install tilt",
-			"windows-choco":  "choco install tilt -y",
-			"windows-winget": "winget install --id Tilt.Tilt -e",
+			"linux-curl": "curl -fsSL https://raw.githubusercontent.com/tilt-dev/tilt/master/scripts/install.sh | bash",
+		},
+		InstallArgs: map[string][]string{
+			"darwin-brew":    {"brew", "install", "tilt"},
+			"windows-choco":  {"choco", "install", "tilt", "-y"},
+			"windows-winget": {"winget", "install", "--id", "Tilt.Tilt", "-e"},
 		},
 		DownloadURL: map[string]string{
 			"linux":   "https://docs.tilt.dev/install.html#linux",
@@ -79,10 +96,90 @@ var dependencies = []Dependency{
 	},
 }
 
+// extraDependencies are declared in the config file and checked alongside the built-ins.
+var extraDependencies []Dependency
+
+// SetExtraDependencies replaces the user-declared dependencies checked alongside the built-ins.
+// An extra dependency with the same command as a built-in one replaces it.
+func SetExtraDependencies(extra []Dependency) error {
+	for _, dep := range extra {
+		if err := dep.Validate(); err != nil {
+			return err
+		}
+	}
+	extraDependencies = extra
+	return nil
+}
+
+// Dependencies returns the built-in dependencies merged with any extra ones.
+func Dependencies() []Dependency {
+	merged := make([]Dependency, 0, len(dependencies)+len(extraDependencies))
+	overridden := make(map[string]bool, len(extraDependencies))
+	for _, dep := range extraDependencies {
+		overridden[dep.Command] = true
+	}
+	for _, dep := range dependencies {
+		if !overridden[dep.Command] {
+			merged = append(merged, dep)
+		}
+	}
+	return append(merged, extraDependencies...)
+}
+
+// Validate checks that a dependency has a name and command and only uses known platform keys.
+func (d Dependency) Validate() error {
+	if d.Name == "" || d.Command == "" {
+		return fmt.Errorf("dependency requires both a name and a command")
+	}
+	for key, cmd := range d.InstallCmd {
+		if !isPlatformKey(key) {
+			return fmt.Errorf("dependency %s: unknown platform '%s' in install commands. Must be one of: %s", d.Name, key, strings.Join(PlatformKeys, ", "))
+		}
+		if _, _, err := splitCommand(cmd); err != nil {
+			return fmt.Errorf("dependency %s: invalid install command for '%s': %w", d.Name, key, err)
+		}
+	}
+	for key, argv := range d.InstallArgs {
+		if !isPlatformKey(key) {
+			return fmt.Errorf("dependency %s: unknown platform '%s' in install commands. Must be one of: %s", d.Name, key, strings.Join(PlatformKeys, ", "))
+		}
+		if len(argv) == 0 || argv[0] == "" {
+			return fmt.Errorf("dependency %s: install command for '%s' is empty", d.Name, key)
+		}
+	}
+	return nil
+}
+
+// hasInstallCommand reports whether the dependency can be installed for a platform key
+func (d Dependency) hasInstallCommand(key string) bool {
+	_, hasArgs := d.InstallArgs[key]
+	_, hasCmd := d.InstallCmd[key]
+	return hasArgs || hasCmd
+}
+
+// installCommand builds the install process for a platform key and a printable form of it
+func (d Dependency) installCommand(goos, key string) (*exec.Cmd, string, error) {
+	if argv, ok := d.InstallArgs[key]; ok {
+		return exec.Command(argv[0], argv[1:]...), formatArgv(argv), nil
+	}
+	cmdStr := d.InstallCmd[key]
+	cmd, err := buildInstallCommand(goos, cmdStr)
+	return cmd, cmdStr, err
+}
+
+func isPlatformKey(key string) bool {
+	for _, valid := range PlatformKeys {
+		if key == valid {
+			return true
+		}
+	}
+	return false
+}
+
 // CheckDependencies verifies if all dependencies are installed.
 func (dm *DependencyManager) CheckDependencies() (missing []Dependency, installed []Dependency) {
 	utils.PrintInfo("🔍 Checking dependencies...\n")
-	for _, dep := range dependencies {
+	for _, dep := range Dependencies() {
 		_, err := exec.LookPath(dep.Command)
 		if err != nil {
 			utils.PrintWarning("❌ Missing dependency: %s\n", dep.Name)
@@ -95,14 +192,23 @@ func (dm *DependencyManager) CheckDependencies() (missing []Dependency, installe
 	return
 }
 
-// InstallDependency attempts to install a single dependency.
-func (dm *DependencyManager) InstallDependency(dep Dependency) error {
+// installKey selects the platform key used to install a dependency on this system
+func (dm *DependencyManager) installKey(dep Dependency) (string, bool) {
 	key := dm.OS + "-" + dm.PackageManager
 	if dep.Name == "Tilt" && (dm.OS == "linux" || (dm.OS == "darwin" && dm.PackageManager != "brew")) {
 		key = dm.OS + "-curl" // Tilt has a universal curl installer for Linux/macOS
 	}
 
-	cmdStr, supported := dep.InstallCmd[key]
+	if !dep.hasInstallCommand(key) && dm.OS != "windows" {
+		// Fall back to a universal install script when there is no package manager command
+		key = dm.OS + "-curl"
+	}
+	return key, dep.hasInstallCommand(key)
+}
+
+// InstallDependency attempts to install a single dependency.
+func (dm *DependencyManager) InstallDependency(dep Dependency) error {
+	key, supported := dm.installKey(dep)
 	if !supported {
 		url, hasURL := dep.DownloadURL[dm.OS]
 		if !hasURL {
@@ -111,29 +217,18 @@ func (dm *DependencyManager) InstallDependency(dep Dependency) error {
 		return fmt.Errorf("package manager '%s' not supported for installing %s on %s. Please install manually from: %s", dm.PackageManager, dep.Name, dm.OS, url)
 	}
 
-	utils.PrintInfo("🚀 Attempting to install %s with command: %s\n", dep.Name, cmdStr)
-
-	parts := strings.Fields(cmdStr)
-	cmd := exec.Command(parts[0], parts[1:]...)
-	if strings.Contains(cmdStr, "|") || strings.Contains(cmdStr, "&&") {
-		// For complex shell commands, use a shell to execute
-		shell := "/bin/sh"
-		if dm.OS == "windows" {
-			shell = "powershell"
-			cmd = exec.Command(shell, "-Command", cmdStr)
-		} else {
-			cmd = exec.Command(shell, "-c", cmdStr)
-		}
-	} else {
-		cmd = exec.Command(parts[0], parts[1:]...)
+	cmd, display, err := dep.installCommand(dm.OS, key)
+	if err != nil {
+		return fmt.Errorf("invalid install command for %s: %w", dep.Name, err)
 	}
 
+	utils.PrintInfo("🚀 Attempting to install %s with command: %s\n", dep.Name, display)
+
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin // For prompts like sudo password
 
-	err := cmd.Run()
-	if err != nil {
+	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("installation failed: %w", err)
 	}
 
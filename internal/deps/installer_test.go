@@ -43,3 +43,63 @@ func TestGetPackageManager(t *testing.T) {
 		t.Skipf("Skipping package manager test on unsupported OS: %s", runtime.GOOS)
 	}
 }
+
+func TestDependencyValidate(t *testing.T) {
+	valid := Dependency{
+		Name:       "kubectl",
+		Command:    "kubectl",
+		InstallCmd: map[string]string{"darwin-brew": "brew install kubectl", "linux-curl": "curl -LO https://dl.k8s.io/kubectl"},
+	}
+	assert.NoError(t, valid.Validate())
+
+	unknownPlatform := Dependency{Name: "helm", Command: "helm", InstallCmd: map[string]string{"linux-pacman": "pacman -S helm"}}
+	err := unknownPlatform.Validate()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "linux-pacman")
+
+	assert.Error(t, Dependency{Name: "helm"}.Validate(), "command is required")
+	assert.Error(t, Dependency{Name: "helm", Command: "helm", InstallCmd: map[string]string{"darwin-brew": " "}}.Validate())
+}
+
+func TestSetExtraDependencies(t *testing.T) {
+	defer SetExtraDependencies(nil)
+
+	extra := []Dependency{
+		{Name: "kubectl", Command: "kubectl", Required: true},
+		{Name: "Tilt", Command: "tilt", Required: true},
+	}
+	assert.NoError(t, SetExtraDependencies(extra))
+
+	merged := Dependencies()
+	assert.Len(t, merged, 3, "Azure CLI plus the two extras, with tilt overridden")
+	byCommand := make(map[string]Dependency)
+	for _, dep := range merged {
+		byCommand[dep.Command] = dep
+	}
+	assert.Contains(t, byCommand, "az")
+	assert.Contains(t, byCommand, "kubectl")
+	assert.True(t, byCommand["tilt"].Required, "configured tilt should replace the built-in one")
+
+	assert.Error(t, SetExtraDependencies([]Dependency{{Name: "bad", Command: "bad", InstallCmd: map[string]string{"plan9-apt": "x"}}}))
+	assert.Len(t, Dependencies(), 3, "a rejected set should leave the previous extras in place")
+}
+
+func TestAzureCLIInstallKeyForDnf(t *testing.T) {
+	var azureCLI Dependency
+	for _, dep := range dependencies {
+		if dep.Command == "az" {
+			azureCLI = dep
+		}
+	}
+
+	dm := &DependencyManager{OS: "linux", PackageManager: "dnf"}
+	key, supported := dm.installKey(azureCLI)
+	assert.True(t, supported, "dnf should be able to install the Azure CLI")
+	assert.Equal(t, "linux-dnf", key)
+
+	cmd, display, err := azureCLI.installCommand(dm.OS, key)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, display)
+	assert.Contains(t, display, "dnf install -y azure-cli")
+	assert.Equal(t, "/bin/sh", cmd.Args[0], "the repo setup pipeline needs a shell")
+}
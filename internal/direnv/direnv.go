@@ -0,0 +1,101 @@
+package direnv
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Envrc is the file direnv loads in each directory.
+const Envrc = ".envrc"
+
+// Installed reports whether direnv is in PATH.
+func Installed() bool {
+	_, err := exec.LookPath("direnv")
+	return err == nil
+}
+
+// DotenvLine returns the .envrc line that loads envFile, given relative to the .envrc's directory.
+func DotenvLine(envFile string) string {
+	return "dotenv " + quote(filepath.ToSlash(envFile))
+}
+
+// RelativeEnvFile returns envFile relative to dir, as DotenvLine expects it.
+func RelativeEnvFile(dir, envFile string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return envFile
+	}
+	absEnvFile, err := filepath.Abs(envFile)
+	if err != nil {
+		return envFile
+	}
+	rel, err := filepath.Rel(absDir, absEnvFile)
+	if err != nil {
+		return envFile
+	}
+	return rel
+}
+
+// EnsureDotenv makes the .envrc in dir load envFile, creating the file or appending a dotenv line
+// unless one (or a dotenv_if_exists line) already loads it. It reports whether the file changed.
+func EnsureDotenv(dir, envFile string) (bool, error) {
+	rel := filepath.ToSlash(RelativeEnvFile(dir, envFile))
+	path := filepath.Join(dir, Envrc)
+
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if loads(string(existing), rel) {
+		return false, nil
+	}
+
+	content := string(existing)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += DotenvLine(rel) + "\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return false, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return true, nil
+}
+
+// Allow runs 'direnv allow' for dir, which direnv requires after its .envrc changes.
+func Allow(dir string) error {
+	output, err := exec.Command("direnv", "allow", dir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("'direnv allow' failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// loads reports whether an .envrc already has a dotenv line for envFile
+func loads(envrc, envFile string) bool {
+	for _, line := range strings.Split(envrc, "\n") {
+		directive, arg, found := strings.Cut(strings.TrimSpace(line), " ")
+		if !found || (directive != "dotenv" && directive != "dotenv_if_exists") {
+			continue
+		}
+		arg = strings.Trim(strings.TrimSpace(arg), `"'`)
+		if filepath.Clean(arg) == filepath.Clean(envFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// plainWord matches paths the shell reads literally
+var plainWord = regexp.MustCompile(`^[A-Za-z0-9._/+-]+$`)
+
+// quote single-quotes a path for the shell unless it needs no quoting
+func quote(path string) string {
+	if plainWord.MatchString(path) {
+		return path
+	}
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
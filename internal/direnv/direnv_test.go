@@ -0,0 +1,42 @@
+package direnv
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEnsureDotenv(t *testing.T) {
+	dir := t.TempDir()
+	envrc := filepath.Join(dir, Envrc)
+
+	changed, err := EnsureDotenv(dir, filepath.Join(dir, ".env"))
+	require.NoError(t, err)
+	assert.True(t, changed)
+	content, _ := os.ReadFile(envrc)
+	assert.Equal(t, "dotenv .env\n", string(content))
+
+	// Running it again leaves the file alone
+	changed, err = EnsureDotenv(dir, filepath.Join(dir, ".env"))
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// Existing content is kept and lines already loading the file are recognized
+	require.NoError(t, os.WriteFile(envrc, []byte("export FOO=bar\ndotenv_if_exists \"config/.env.worker\""), 0644))
+	changed, err = EnsureDotenv(dir, filepath.Join(dir, "config", ".env.worker"))
+	require.NoError(t, err)
+	assert.False(t, changed)
+	changed, err = EnsureDotenv(dir, filepath.Join(dir, ".env"))
+	require.NoError(t, err)
+	assert.True(t, changed)
+	content, _ = os.ReadFile(envrc)
+	assert.Equal(t, "export FOO=bar\ndotenv_if_exists \"config/.env.worker\"\ndotenv .env\n", string(content))
+}
+
+func TestDotenvLine(t *testing.T) {
+	assert.Equal(t, "dotenv config/.env.local", DotenvLine("config/.env.local"))
+	assert.Equal(t, `dotenv 'my env/it'\''s.env'`, DotenvLine("my env/it's.env"))
+}
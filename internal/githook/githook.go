@@ -0,0 +1,201 @@
+package githook
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// beginMarker and endMarker delimit the env-sync block inside the pre-commit hook.
+	beginMarker = "# >>> env-sync pre-commit hook >>>"
+	endMarker   = "# <<< env-sync pre-commit hook <<<"
+
+	shebang = "#!/bin/sh"
+)
+
+// Install writes (or updates) the env-sync block in the repository's pre-commit hook.
+// The block refuses commits that stage any of the protected paths.
+// Existing hook content is preserved. It reports whether a block was already installed.
+func Install(repoDir string, protected []string) (alreadyInstalled bool, err error) {
+	hookPath, err := preCommitPath(repoDir)
+	if err != nil {
+		return false, err
+	}
+
+	existing, err := os.ReadFile(hookPath)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read pre-commit hook: %w", err)
+	}
+
+	content, alreadyInstalled := removeBlock(string(existing))
+	content = insertBlock(content, hookBlock(protected))
+
+	if err := os.MkdirAll(filepath.Dir(hookPath), 0755); err != nil {
+		return false, fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+	if err := os.WriteFile(hookPath, []byte(content), 0755); err != nil {
+		return false, fmt.Errorf("failed to write pre-commit hook: %w", err)
+	}
+	return alreadyInstalled, nil
+}
+
+// Uninstall removes the env-sync block from the pre-commit hook, deleting the hook
+// if nothing else remains. It reports whether a block was found.
+func Uninstall(repoDir string) (bool, error) {
+	hookPath, err := preCommitPath(repoDir)
+	if err != nil {
+		return false, err
+	}
+
+	existing, err := os.ReadFile(hookPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read pre-commit hook: %w", err)
+	}
+
+	content, found := removeBlock(string(existing))
+	if !found {
+		return false, nil
+	}
+
+	if strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(content), shebang)) == "" {
+		if err := os.Remove(hookPath); err != nil {
+			return true, fmt.Errorf("failed to remove pre-commit hook: %w", err)
+		}
+		return true, nil
+	}
+	if err := os.WriteFile(hookPath, []byte(content), 0755); err != nil {
+		return true, fmt.Errorf("failed to write pre-commit hook: %w", err)
+	}
+	return true, nil
+}
+
+// IsInstalled reports whether the env-sync block is present in the pre-commit hook.
+func IsInstalled(repoDir string) (bool, error) {
+	hookPath, err := preCommitPath(repoDir)
+	if err != nil {
+		return false, err
+	}
+	existing, err := os.ReadFile(hookPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read pre-commit hook: %w", err)
+	}
+	return strings.Contains(string(existing), beginMarker), nil
+}
+
+// RepoRelativePaths converts paths to be relative to the repository root, as git reports staged files.
+// Paths outside the repository are dropped.
+func RepoRelativePaths(repoDir string, paths []string) ([]string, error) {
+	root, err := git(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+
+	var relative []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		if !seen[rel] {
+			seen[rel] = true
+			relative = append(relative, rel)
+		}
+	}
+	return relative, nil
+}
+
+// preCommitPath resolves the pre-commit hook path, honoring core.hooksPath and worktrees
+func preCommitPath(repoDir string) (string, error) {
+	path, err := git(repoDir, "rev-parse", "--git-path", "hooks/pre-commit")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(repoDir, path)
+	}
+	return path, nil
+}
+
+// git runs a git command in dir and returns its trimmed output
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed (is this a git repository?): %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// hookBlock builds the shell snippet that rejects staged protected paths
+func hookBlock(protected []string) string {
+	quoted := make([]string, len(protected))
+	for i, path := range protected {
+		quoted[i] = shellQuote(path)
+	}
+
+	var b strings.Builder
+	b.WriteString(beginMarker + "\n")
+	b.WriteString("# Refuses commits that add plaintext env or key files. Remove with: env-sync install-hook --uninstall\n")
+	b.WriteString("for envsync_file in " + strings.Join(quoted, " ") + "; do\n")
+	b.WriteString("  if git diff --cached --name-only --diff-filter=ACMR -- \"$envsync_file\" | grep -q .; then\n")
+	b.WriteString("    echo \"env-sync: refusing to commit plaintext secret file '$envsync_file'.\" >&2\n")
+	b.WriteString("    echo \"Unstage it with: git rm --cached -- '$envsync_file'\" >&2\n")
+	b.WriteString("    exit 1\n")
+	b.WriteString("  fi\n")
+	b.WriteString("done\n")
+	b.WriteString(endMarker + "\n")
+	return b.String()
+}
+
+// insertBlock places the block right after the shebang so earlier exits in the hook can't skip it
+func insertBlock(content, block string) string {
+	if strings.TrimSpace(content) == "" {
+		return shebang + "\n" + block
+	}
+	if strings.HasPrefix(content, "#!") {
+		firstLine, rest, _ := strings.Cut(content, "\n")
+		return firstLine + "\n" + block + rest
+	}
+	return shebang + "\n" + block + content
+}
+
+// removeBlock strips the env-sync block from hook content, reporting whether it was present
+func removeBlock(content string) (string, bool) {
+	start := strings.Index(content, beginMarker)
+	if start == -1 {
+		return content, false
+	}
+	end := strings.Index(content[start:], endMarker)
+	if end == -1 {
+		return content, false
+	}
+	end += start + len(endMarker)
+	if end < len(content) && content[end] == '\n' {
+		end++
+	}
+	return content[:start] + content[end:], true
+}
+
+// shellQuote wraps a value in single quotes for POSIX shells
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
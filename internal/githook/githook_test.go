@@ -0,0 +1,111 @@
+package githook
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// initRepo creates an empty git repository for testing
+func initRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+	dir := t.TempDir()
+	cmd := exec.Command("git", "init", "-q")
+	cmd.Dir = dir
+	require.NoError(t, cmd.Run())
+	return dir
+}
+
+func TestInstallAndUninstall(t *testing.T) {
+	dir := initRepo(t)
+	hookPath := filepath.Join(dir, ".git", "hooks", "pre-commit")
+
+	alreadyInstalled, err := Install(dir, []string{".env", ".env-sync-key"})
+	require.NoError(t, err)
+	assert.False(t, alreadyInstalled)
+
+	content, err := os.ReadFile(hookPath)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(content), shebang))
+	assert.Contains(t, string(content), "'.env' '.env-sync-key'")
+
+	installed, err := IsInstalled(dir)
+	require.NoError(t, err)
+	assert.True(t, installed)
+
+	// Installing again replaces the block rather than duplicating it
+	alreadyInstalled, err = Install(dir, []string{".env"})
+	require.NoError(t, err)
+	assert.True(t, alreadyInstalled)
+	content, _ = os.ReadFile(hookPath)
+	assert.Equal(t, 1, strings.Count(string(content), beginMarker))
+
+	found, err := Uninstall(dir)
+	require.NoError(t, err)
+	assert.True(t, found)
+	_, err = os.Stat(hookPath)
+	assert.True(t, os.IsNotExist(err), "hook with only env-sync content should be removed")
+}
+
+func TestInstallPreservesExistingHook(t *testing.T) {
+	dir := initRepo(t)
+	hookPath := filepath.Join(dir, ".git", "hooks", "pre-commit")
+	existing := "#!/bin/bash\necho running lint\nexit 0\n"
+	require.NoError(t, os.WriteFile(hookPath, []byte(existing), 0755))
+
+	_, err := Install(dir, []string{".env"})
+	require.NoError(t, err)
+
+	content, _ := os.ReadFile(hookPath)
+	assert.True(t, strings.HasPrefix(string(content), "#!/bin/bash\n"+beginMarker))
+	assert.Contains(t, string(content), "echo running lint")
+
+	found, err := Uninstall(dir)
+	require.NoError(t, err)
+	assert.True(t, found)
+	content, _ = os.ReadFile(hookPath)
+	assert.Equal(t, existing, string(content))
+}
+
+func TestHookRejectsStagedEnvFile(t *testing.T) {
+	dir := initRepo(t)
+	_, err := Install(dir, []string{".env"})
+	require.NoError(t, err)
+
+	run := func(args ...string) error {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		return cmd.Run()
+	}
+
+	hook := filepath.Join(dir, ".git", "hooks", "pre-commit")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("docs"), 0644))
+	require.NoError(t, run("git", "add", "README.md"))
+	assert.NoError(t, run(hook), "unrelated files should be allowed")
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".env"), []byte("SECRET=1"), 0600))
+	require.NoError(t, run("git", "add", ".env"))
+	assert.Error(t, run(hook), "staged .env should be rejected")
+}
+
+func TestRepoRelativePaths(t *testing.T) {
+	dir := initRepo(t)
+	paths, err := RepoRelativePaths(dir, []string{
+		filepath.Join(dir, ".env"),
+		filepath.Join(dir, "config", ".env.worker"),
+		filepath.Join(dir, ".env"),
+		"",
+		filepath.Join(filepath.Dir(dir), "outside.env"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{".env", "config/.env.worker"}, paths)
+}
@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/lliamscholtz/env-sync/internal/utils"
+)
+
+const (
+	// EventPostPull identifies the hook run after a successful pull.
+	EventPostPull = "post-pull"
+	// EventPostPush identifies the hook run after a successful push.
+	EventPostPush = "post-push"
+
+	// EnvFileVar is the environment variable holding the synced file path.
+	EnvFileVar = "ENVSYNC_ENV_FILE"
+	// EventVar is the environment variable holding the hook event name.
+	EventVar = "ENVSYNC_HOOK_EVENT"
+)
+
+// Run executes a hook command through the system shell after a sync operation.
+// The synced file path is exposed to the command via ENVSYNC_ENV_FILE.
+// Hook output is surfaced to the user; a non-nil error means the hook failed.
+func Run(event, command, envFile string) error {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return nil
+	}
+
+	if absPath, err := filepath.Abs(envFile); err == nil {
+		envFile = absPath
+	}
+
+	utils.PrintInfo("🪝 Running %s hook: %s\n", event, command)
+
+	cmd := ShellCommand(context.Background(), command)
+	cmd.Env = append(os.Environ(),
+		EnvFileVar+"="+envFile,
+		EventVar+"="+event,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	if out := strings.TrimSpace(stdout.String()); out != "" {
+		utils.PrintInfo("%s\n", out)
+	}
+	if errOut := strings.TrimSpace(stderr.String()); errOut != "" {
+		utils.PrintWarning("%s\n", errOut)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%s hook failed: %w", event, err)
+	}
+
+	utils.PrintSuccess("✅ %s hook completed\n", event)
+	return nil
+}
+
+// ShellCommand builds the command used to run a user-configured shell command, such as a hook,
+// on the current platform. ctx kills the command when it ends.
+func ShellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "powershell", "-Command", command)
+	}
+	return exec.CommandContext(ctx, "/bin/sh", "-c", command)
+}
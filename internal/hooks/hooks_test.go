@@ -0,0 +1,40 @@
+package hooks
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook tests use POSIX shell syntax")
+	}
+
+	t.Run("empty command is a no-op", func(t *testing.T) {
+		assert.NoError(t, Run(EventPostPull, "  ", ".env"))
+	})
+
+	t.Run("exposes synced file path", func(t *testing.T) {
+		tmpDir := t.TempDir()
+		envFile := filepath.Join(tmpDir, ".env")
+		outFile := filepath.Join(tmpDir, "hook.out")
+
+		err := Run(EventPostPull, `echo "$ENVSYNC_ENV_FILE $ENVSYNC_HOOK_EVENT" > `+outFile, envFile)
+		assert.NoError(t, err)
+
+		data, err := os.ReadFile(outFile)
+		assert.NoError(t, err)
+		assert.Equal(t, envFile+" "+EventPostPull, strings.TrimSpace(string(data)))
+	})
+
+	t.Run("non-zero exit returns error", func(t *testing.T) {
+		err := Run(EventPostPush, "echo failing >&2; exit 3", ".env")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "post-push hook failed")
+	})
+}
@@ -0,0 +1,136 @@
+package keychain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// Service is the service name keys are stored under in the OS keyring.
+const Service = "env-sync"
+
+var (
+	// ErrNotFound is returned when the keyring holds no key for an account.
+	ErrNotFound = errors.New("no key stored in the OS keyring")
+	// ErrUnsupported is returned on platforms without a usable keyring.
+	ErrUnsupported = errors.New("no OS keyring available")
+)
+
+// runCommand runs a keyring tool with stdin and returns its stdout. Tests replace it.
+var runCommand = func(stdin, name string, args ...string) ([]byte, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return nil, fmt.Errorf("%w: '%s' not found in PATH", ErrUnsupported, name)
+	}
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil && stderr.Len() > 0 {
+		return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return out, err
+}
+
+// goos is the platform whose keyring is used. Tests replace it.
+var goos = runtime.GOOS
+
+// credRead and credWrite access generic credentials in the Windows Credential Manager. Tests
+// replace them.
+var (
+	credRead  = readCredential
+	credWrite = writeCredential
+)
+
+// Get returns the key stored for account: from the login keychain on macOS, from the Credential
+// Manager on Windows and from the Secret Service (GNOME Keyring, KWallet) through secret-tool
+// elsewhere.
+func Get(account string) (string, error) {
+	switch goos {
+	case "darwin":
+		out, err := runCommand("", "security", "find-generic-password", "-s", Service, "-a", account, "-w")
+		// security exits with 44 when the item doesn't exist
+		if exitCode(err) == 44 {
+			return "", fmt.Errorf("%w for account '%s'", ErrNotFound, account)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read from the macOS keychain: %w", err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	case "windows":
+		key, err := credRead(credentialTarget(account))
+		if errors.Is(err, ErrNotFound) {
+			return "", fmt.Errorf("%w for account '%s'", ErrNotFound, account)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read from the Windows Credential Manager: %w", err)
+		}
+		return key, nil
+	default:
+		out, err := runCommand("", "secret-tool", "lookup", "service", Service, "account", account)
+		// secret-tool exits with 1 and prints nothing when there is no match
+		if exitCode(err) == 1 && len(bytes.TrimSpace(out)) == 0 {
+			return "", fmt.Errorf("%w for account '%s'", ErrNotFound, account)
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read from the Secret Service keyring: %w", describeSecretTool(err))
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+}
+
+// Set stores key for account, replacing any key already stored for it. The key is passed on
+// stdin, never as an argument, so it doesn't show up in process lists.
+func Set(account, key string) error {
+	switch goos {
+	case "darwin":
+		// In interactive mode security reads the command, password included, from stdin
+		command := fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", quote(Service), quote(account), quote(key))
+		if _, err := runCommand(command, "security", "-i"); err != nil {
+			return fmt.Errorf("failed to write to the macOS keychain: %w", err)
+		}
+		return nil
+	case "windows":
+		label := fmt.Sprintf("%s encryption key (%s)", Service, account)
+		if err := credWrite(credentialTarget(account), account, label, key); err != nil {
+			return fmt.Errorf("failed to write to the Windows Credential Manager: %w", err)
+		}
+		return nil
+	default:
+		label := fmt.Sprintf("%s encryption key (%s)", Service, account)
+		if _, err := runCommand(key, "secret-tool", "store", "--label", label, "service", Service, "account", account); err != nil {
+			return fmt.Errorf("failed to write to the Secret Service keyring: %w", describeSecretTool(err))
+		}
+		return nil
+	}
+}
+
+// credentialTarget is the Credential Manager target name the key for account is stored under
+func credentialTarget(account string) string {
+	return Service + ":" + account
+}
+
+// describeSecretTool adds an install hint when secret-tool is missing
+func describeSecretTool(err error) error {
+	if errors.Is(err, ErrUnsupported) {
+		return fmt.Errorf("%w (install libsecret-tools, or the libsecret package of your distribution, and make sure a keyring daemon is running)", err)
+	}
+	return err
+}
+
+// exitCode returns the exit code of a command that ran and failed, or -1
+func exitCode(err error) int {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	return -1
+}
+
+// quote single-quotes a word for the command line security reads in interactive mode
+func quote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", `'\''`) + "'"
+}
@@ -0,0 +1,131 @@
+package keychain
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// fakeCommand records keyring tool invocations and answers them from a map of account to key
+type fakeCommand struct {
+	keys  map[string]string
+	calls []string
+	stdin []string
+}
+
+// exitWith returns the error of a command that exited with code
+func exitWith(t *testing.T, code string) error {
+	t.Helper()
+	err := exec.Command("sh", "-c", "exit "+code).Run()
+	if err == nil {
+		t.Fatal("expected the command to fail")
+	}
+	return err
+}
+
+func useFake(t *testing.T, platform string) *fakeCommand {
+	t.Helper()
+	fake := &fakeCommand{keys: map[string]string{}}
+	oldRun, oldGOOS := runCommand, goos
+	t.Cleanup(func() { runCommand, goos = oldRun, oldGOOS })
+	goos = platform
+
+	runCommand = func(stdin, name string, args ...string) ([]byte, error) {
+		fake.calls = append(fake.calls, name+" "+strings.Join(args, " "))
+		fake.stdin = append(fake.stdin, stdin)
+		account := args[len(args)-1]
+		switch {
+		case name == "security" && args[0] == "find-generic-password":
+			account = args[4]
+			if key, ok := fake.keys[account]; ok {
+				return []byte(key + "\n"), nil
+			}
+			return nil, exitWith(t, "44")
+		case name == "secret-tool" && args[0] == "lookup":
+			if key, ok := fake.keys[account]; ok {
+				return []byte(key), nil
+			}
+			return nil, exitWith(t, "1")
+		case name == "secret-tool" && args[0] == "store":
+			fake.keys[account] = stdin
+		}
+		return nil, nil
+	}
+	return fake
+}
+
+func TestSecretService(t *testing.T) {
+	fake := useFake(t, "linux")
+
+	if _, err := Get("default"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := Set("default", "c2VjcmV0"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	key, err := Get("default")
+	if err != nil || key != "c2VjcmV0" {
+		t.Fatalf("expected the stored key, got %q, %v", key, err)
+	}
+
+	for _, call := range fake.calls {
+		if strings.Contains(call, "c2VjcmV0") {
+			t.Errorf("the key must not be passed as an argument: %s", call)
+		}
+	}
+}
+
+func TestMacOSKeychain(t *testing.T) {
+	fake := useFake(t, "darwin")
+	fake.keys["qa"] = "a2V5"
+
+	key, err := Get("qa")
+	if err != nil || key != "a2V5" {
+		t.Fatalf("expected the stored key, got %q, %v", key, err)
+	}
+	if _, err := Get("prod"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := Set("it's", "a2V5"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	expected := `add-generic-password -U -s 'env-sync' -a 'it'\''s' -w 'a2V5'` + "\n"
+	if last := fake.stdin[len(fake.stdin)-1]; last != expected {
+		t.Errorf("expected security to read %q, got %q", expected, last)
+	}
+	if last := fake.calls[len(fake.calls)-1]; last != "security -i" {
+		t.Errorf("expected the key to be passed on stdin, got %q", last)
+	}
+}
+
+func TestWindowsCredentialManager(t *testing.T) {
+	fake := useFake(t, "windows")
+	oldRead, oldWrite := credRead, credWrite
+	t.Cleanup(func() { credRead, credWrite = oldRead, oldWrite })
+	credRead = func(target string) (string, error) {
+		if key, ok := fake.keys[target]; ok {
+			return key, nil
+		}
+		return "", ErrNotFound
+	}
+	credWrite = func(target, user, comment, secret string) error {
+		fake.calls = append(fake.calls, target+" "+user+" "+comment)
+		fake.keys[target] = secret
+		return nil
+	}
+
+	if _, err := Get("default"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := Set("default", "a2V5"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if key, err := Get("default"); err != nil || key != "a2V5" {
+		t.Fatalf("expected the stored key, got %q, %v", key, err)
+	}
+	if expected := "env-sync:default default env-sync encryption key (default)"; fake.calls[0] != expected {
+		t.Errorf("expected the key under %q, got %q", expected, fake.calls[0])
+	}
+}
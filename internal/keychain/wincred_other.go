@@ -0,0 +1,15 @@
+//go:build !windows
+
+package keychain
+
+import "fmt"
+
+// readCredential reads from the Windows Credential Manager, which only exists on Windows
+func readCredential(target string) (string, error) {
+	return "", fmt.Errorf("%w: the Windows Credential Manager is only available on Windows", ErrUnsupported)
+}
+
+// writeCredential writes to the Windows Credential Manager, which only exists on Windows
+func writeCredential(target, user, comment, secret string) error {
+	return fmt.Errorf("%w: the Windows Credential Manager is only available on Windows", ErrUnsupported)
+}
@@ -0,0 +1,247 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+)
+
+const (
+	// WrapAlgorithm is the Key Vault key algorithm used to wrap data keys.
+	WrapAlgorithm = "RSA-OAEP-256"
+
+	apiVersion = "7.4"
+	vaultScope = "https://vault.azure.net/.default"
+)
+
+// ErrNoWrappedKey is returned when no wrapped data key has been stored yet.
+var ErrNoWrappedKey = errors.New("no wrapped data key found")
+
+// SecretStore is the subset of the vault client used to persist the wrapped data key.
+type SecretStore interface {
+	GetSecret(ctx context.Context, secretName string) (string, error)
+	StoreSecret(ctx context.Context, secretName, value string, tags map[string]string, attrs vault.SecretAttributes) error
+	SecretExists(ctx context.Context, secretName string) (bool, error)
+}
+
+// KeyWrapper wraps and unwraps data keys with a master key held in a KMS.
+type KeyWrapper interface {
+	WrapKey(ctx context.Context, key []byte) (keyID string, wrapped []byte, err error)
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// wrappedKey is the envelope stored alongside the env secret.
+type wrappedKey struct {
+	KeyID      string `json:"kid"`
+	Algorithm  string `json:"alg"`
+	WrappedKey string `json:"wrapped_key"`
+}
+
+// EnvelopeKeyProvider implements crypto.KeyProvider using envelope encryption:
+// the data key is stored wrapped in a secret and unwrapped by the KMS on demand.
+type EnvelopeKeyProvider struct {
+	WrappedKeySecret string
+	wrapper          KeyWrapper
+	store            SecretStore
+}
+
+var _ crypto.KeyProvider = (*EnvelopeKeyProvider)(nil)
+
+// NewEnvelopeKeyProvider creates a provider storing the wrapped data key in wrappedKeySecret.
+func NewEnvelopeKeyProvider(wrapper KeyWrapper, store SecretStore, wrappedKeySecret string) *EnvelopeKeyProvider {
+	return &EnvelopeKeyProvider{
+		WrappedKeySecret: wrappedKeySecret,
+		wrapper:          wrapper,
+		store:            store,
+	}
+}
+
+// GetKey fetches the wrapped data key and unwraps it with the KMS.
+func (p *EnvelopeKeyProvider) GetKey(ctx context.Context) ([]byte, error) {
+	exists, err := p.store.SecretExists(ctx, p.WrappedKeySecret)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, fmt.Errorf("%w in secret '%s'", ErrNoWrappedKey, p.WrappedKeySecret)
+	}
+
+	stored, err := p.store.GetSecret(ctx, p.WrappedKeySecret)
+	if err != nil {
+		return nil, err
+	}
+	return p.UnwrapDataKey(ctx, stored)
+}
+
+// UnwrapDataKey unwraps an envelope returned by WrapDataKey with the KMS, e.g. one kept
+// from before a key rotation.
+func (p *EnvelopeKeyProvider) UnwrapDataKey(ctx context.Context, stored string) ([]byte, error) {
+	var envelope wrappedKey
+	if err := json.Unmarshal([]byte(stored), &envelope); err != nil {
+		return nil, fmt.Errorf("failed to parse wrapped data key: %w", err)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(envelope.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode wrapped data key: %w", err)
+	}
+
+	key, err := p.wrapper.UnwrapKey(ctx, envelope.KeyID, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key with '%s': %w", envelope.KeyID, err)
+	}
+	if err := crypto.ValidateEncryptionKey(key); err != nil {
+		return nil, fmt.Errorf("unwrapped data key is invalid: %w", err)
+	}
+	return key, nil
+}
+
+// CreateKey generates a new data key, wraps it with the KMS, and stores the
+// wrapped key. The plaintext key is returned for immediate use.
+func (p *EnvelopeKeyProvider) CreateKey(ctx context.Context) ([]byte, error) {
+	key, err := crypto.GenerateEncryptionKey()
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := p.WrapDataKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.StoreWrappedDataKey(ctx, envelope); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WrapDataKey wraps key with the KMS and returns the envelope to store with StoreWrappedDataKey.
+// Nothing is stored, so a key rotation can wrap the new key before changing any secret.
+func (p *EnvelopeKeyProvider) WrapDataKey(ctx context.Context, key []byte) (string, error) {
+	keyID, wrapped, err := p.wrapper.WrapKey(ctx, key)
+	if err != nil {
+		return "", fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	data, err := json.Marshal(wrappedKey{
+		KeyID:      keyID,
+		Algorithm:  WrapAlgorithm,
+		WrappedKey: base64.StdEncoding.EncodeToString(wrapped),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal wrapped data key: %w", err)
+	}
+	return string(data), nil
+}
+
+// StoreWrappedDataKey stores an envelope returned by WrapDataKey, replacing the current data key.
+func (p *EnvelopeKeyProvider) StoreWrappedDataKey(ctx context.Context, envelope string) error {
+	// The data key must outlive any expiry set on the env secrets it decrypts
+	return p.store.StoreSecret(ctx, p.WrappedKeySecret, envelope, nil, vault.SecretAttributes{})
+}
+
+// AzureKeyWrapper wraps data keys using an Azure Key Vault key.
+type AzureKeyWrapper struct {
+	KeyID    string // e.g. https://myvault.vault.azure.net/keys/envsync-kek[/version]
+	pipeline runtime.Pipeline
+}
+
+// NewAzureKeyWrapper creates a wrapper for the given Key Vault key identifier.
+func NewAzureKeyWrapper(keyID string, cred azcore.TokenCredential, options *policy.ClientOptions) (*AzureKeyWrapper, error) {
+	if !strings.HasPrefix(keyID, "https://") || !strings.Contains(keyID, "/keys/") {
+		return nil, fmt.Errorf("invalid Key Vault key ID '%s': expected https://<vault>.vault.azure.net/keys/<name>[/<version>]", keyID)
+	}
+
+	pipeline := runtime.NewPipeline("env-sync", "v1", runtime.PipelineOptions{
+		PerRetry: []policy.Policy{runtime.NewBearerTokenPolicy(cred, []string{vaultScope}, nil)},
+	}, options)
+
+	return &AzureKeyWrapper{
+		KeyID:    strings.TrimSuffix(keyID, "/"),
+		pipeline: pipeline,
+	}, nil
+}
+
+type keyOperationRequest struct {
+	Algorithm string `json:"alg"`
+	Value     string `json:"value"`
+}
+
+type keyOperationResult struct {
+	KeyID string `json:"kid"`
+	Value string `json:"value"`
+}
+
+// WrapKey wraps the key and returns the versioned key ID that performed the wrap.
+func (w *AzureKeyWrapper) WrapKey(ctx context.Context, key []byte) (string, []byte, error) {
+	result, err := w.keyOperation(ctx, w.KeyID, "wrapkey", key)
+	if err != nil {
+		return "", nil, err
+	}
+	keyID := result.KeyID
+	if keyID == "" {
+		keyID = w.KeyID
+	}
+	wrapped, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(result.Value, "="))
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode wrapped key: %w", err)
+	}
+	return keyID, wrapped, nil
+}
+
+// UnwrapKey unwraps the key using the key version that wrapped it.
+func (w *AzureKeyWrapper) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if keyID == "" {
+		keyID = w.KeyID
+	}
+	result, err := w.keyOperation(ctx, keyID, "unwrapkey", wrapped)
+	if err != nil {
+		return nil, err
+	}
+	key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(result.Value, "="))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode unwrapped key: %w", err)
+	}
+	return key, nil
+}
+
+// keyOperation calls a Key Vault key operation endpoint
+func (w *AzureKeyWrapper) keyOperation(ctx context.Context, keyID, operation string, value []byte) (*keyOperationResult, error) {
+	req, err := runtime.NewRequest(ctx, http.MethodPost, keyID+"/"+operation)
+	if err != nil {
+		return nil, err
+	}
+	query := req.Raw().URL.Query()
+	query.Set("api-version", apiVersion)
+	req.Raw().URL.RawQuery = query.Encode()
+	req.Raw().Header.Set("Accept", "application/json")
+
+	if err := runtime.MarshalAsJSON(req, keyOperationRequest{
+		Algorithm: WrapAlgorithm,
+		Value:     base64.RawURLEncoding.EncodeToString(value),
+	}); err != nil {
+		return nil, err
+	}
+
+	resp, err := w.pipeline.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("key %s request failed: %w", operation, err)
+	}
+	if !runtime.HasStatusCode(resp, http.StatusOK) {
+		return nil, runtime.NewResponseError(resp)
+	}
+
+	var result keyOperationResult
+	if err := runtime.UnmarshalAsJSON(resp, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse key %s response: %w", operation, err)
+	}
+	return &result, nil
+}
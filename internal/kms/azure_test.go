@@ -0,0 +1,143 @@
+package kms
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore is an in-memory SecretStore for tests
+type memoryStore map[string]string
+
+func (m memoryStore) GetSecret(ctx context.Context, name string) (string, error) {
+	v, ok := m[name]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return v, nil
+}
+
+func (m memoryStore) StoreSecret(ctx context.Context, name, value string, tags map[string]string, attrs vault.SecretAttributes) error {
+	m[name] = value
+	return nil
+}
+
+func (m memoryStore) SecretExists(ctx context.Context, name string) (bool, error) {
+	_, ok := m[name]
+	return ok, nil
+}
+
+// xorWrapper is a reversible KeyWrapper for tests
+type xorWrapper struct{}
+
+func (xorWrapper) WrapKey(ctx context.Context, key []byte) (string, []byte, error) {
+	return "test-kek/v1", xor(key), nil
+}
+
+func (xorWrapper) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	if keyID != "test-kek/v1" {
+		return nil, errors.New("unknown key")
+	}
+	return xor(wrapped), nil
+}
+
+func xor(b []byte) []byte {
+	out := make([]byte, len(b))
+	for i := range b {
+		out[i] = b[i] ^ 0x5a
+	}
+	return out
+}
+
+func TestEnvelopeKeyProvider(t *testing.T) {
+	store := memoryStore{}
+	provider := NewEnvelopeKeyProvider(xorWrapper{}, store, "app-env-dek")
+	ctx := context.Background()
+
+	t.Run("missing wrapped key", func(t *testing.T) {
+		_, err := provider.GetKey(ctx)
+		assert.ErrorIs(t, err, ErrNoWrappedKey)
+	})
+
+	t.Run("create and unwrap", func(t *testing.T) {
+		created, err := provider.CreateKey(ctx)
+		require.NoError(t, err)
+		assert.Len(t, created, 32)
+		assert.NotContains(t, store["app-env-dek"], base64.StdEncoding.EncodeToString(created))
+
+		key, err := provider.GetKey(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, created, key)
+	})
+
+	t.Run("wrap then store replaces the data key", func(t *testing.T) {
+		previous := store["app-env-dek"]
+		newKey := make([]byte, 32)
+		for i := range newKey {
+			newKey[i] = byte(i + 1)
+		}
+
+		envelope, err := provider.WrapDataKey(ctx, newKey)
+		require.NoError(t, err)
+		assert.Equal(t, previous, store["app-env-dek"], "wrapping must not store anything")
+
+		require.NoError(t, provider.StoreWrappedDataKey(ctx, envelope))
+		key, err := provider.GetKey(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, newKey, key)
+	})
+}
+
+type staticCredential struct{}
+
+func (staticCredential) GetToken(ctx context.Context, opts policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	return azcore.AccessToken{Token: "test-token", ExpiresOn: time.Now().Add(time.Hour)}, nil
+}
+
+func TestAzureKeyWrapper(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer test-token", r.Header.Get("Authorization"))
+		assert.Equal(t, apiVersion, r.URL.Query().Get("api-version"))
+
+		var body keyOperationRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, WrapAlgorithm, body.Algorithm)
+
+		raw, _ := base64.RawURLEncoding.DecodeString(body.Value)
+		json.NewEncoder(w).Encode(keyOperationResult{
+			KeyID: "https://" + r.Host + "/keys/kek/v2",
+			Value: base64.RawURLEncoding.EncodeToString(xor(raw)),
+		})
+	}))
+	defer server.Close()
+
+	wrapper, err := NewAzureKeyWrapper(server.URL+"/keys/kek", staticCredential{}, &policy.ClientOptions{Transport: server.Client()})
+	require.NoError(t, err)
+
+	key := []byte(strings.Repeat("k", 32))
+	keyID, wrapped, err := wrapper.WrapKey(context.Background(), key)
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(keyID, "/keys/kek/v2"))
+	assert.NotEqual(t, key, wrapped)
+
+	unwrapped, err := wrapper.UnwrapKey(context.Background(), keyID, wrapped)
+	require.NoError(t, err)
+	assert.Equal(t, key, unwrapped)
+}
+
+func TestNewAzureKeyWrapperInvalidID(t *testing.T) {
+	_, err := NewAzureKeyWrapper("http://example.com/secrets/foo", staticCredential{}, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,146 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// Event types that can be delivered to a webhook.
+const (
+	EventPush     = "push"
+	EventPull     = "pull"
+	EventConflict = "conflict"
+	EventRotate   = "rotate"
+)
+
+// ValidEvents lists the event types accepted in the notify event filter.
+var ValidEvents = []string{EventPush, EventPull, EventConflict, EventRotate}
+
+// Event describes a sync action to notify the team about.
+// It must never carry secret values.
+type Event struct {
+	Type            string    `json:"event"`
+	SecretName      string    `json:"secret_name"`
+	VaultURL        string    `json:"vault_url,omitempty"`
+	Message         string    `json:"message,omitempty"`
+	ConflictingKeys []string  `json:"conflicting_keys,omitempty"`
+	User            string    `json:"user,omitempty"`
+	Host            string    `json:"host,omitempty"`
+	Timestamp       time.Time `json:"timestamp"`
+}
+
+// payload is the JSON body posted to the webhook. The text field makes it
+// directly consumable by Slack-compatible incoming webhooks.
+type payload struct {
+	Text string `json:"text"`
+	Event
+}
+
+// Notifier posts events to a generic webhook.
+type Notifier struct {
+	WebhookURL string
+	Events     []string // Event types to send; empty means all
+	client     *http.Client
+}
+
+// NewNotifier creates a notifier for the given webhook and event filter.
+func NewNotifier(webhookURL string, events []string) *Notifier {
+	return &Notifier{
+		WebhookURL: webhookURL,
+		Events:     events,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Enabled reports whether the notifier should deliver events of the given type.
+func (n *Notifier) Enabled(eventType string) bool {
+	if n == nil || n.WebhookURL == "" {
+		return false
+	}
+	if len(n.Events) == 0 {
+		return true
+	}
+	for _, e := range n.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Send posts the event to the webhook as JSON. It is a no-op when the
+// notifier is nil, unconfigured, or the event type is filtered out.
+func (n *Notifier) Send(event Event) error {
+	if !n.Enabled(event.Type) {
+		return nil
+	}
+
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+	if event.User == "" {
+		event.User = currentUser()
+	}
+	if event.Host == "" {
+		event.Host, _ = os.Hostname()
+	}
+
+	body, err := json.Marshal(payload{Text: summary(event), Event: event})
+	if err != nil {
+		return fmt.Errorf("failed to marshal notification: %w", err)
+	}
+
+	resp, err := n.client.Post(n.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notification webhook returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// summary builds the human-readable message for an event
+func summary(event Event) string {
+	who := event.User
+	if who == "" {
+		who = "someone"
+	}
+
+	var text string
+	switch event.Type {
+	case EventPush:
+		text = fmt.Sprintf("🔒 %s pushed a new version of '%s'", who, event.SecretName)
+	case EventPull:
+		text = fmt.Sprintf("⬇️ %s pulled '%s'", who, event.SecretName)
+	case EventConflict:
+		text = fmt.Sprintf("⚠️ Conflict detected on '%s' for %s", event.SecretName, who)
+		if len(event.ConflictingKeys) > 0 {
+			text += fmt.Sprintf(" (keys: %s)", strings.Join(event.ConflictingKeys, ", "))
+		}
+	case EventRotate:
+		text = fmt.Sprintf("🔑 %s rotated the encryption key for '%s'", who, event.SecretName)
+	default:
+		text = fmt.Sprintf("env-sync %s on '%s'", event.Type, event.SecretName)
+	}
+
+	if event.Message != "" {
+		text += ": " + event.Message
+	}
+	return text
+}
+
+// currentUser returns the local user name from the environment
+func currentUser() string {
+	if user := os.Getenv("USER"); user != "" {
+		return user
+	}
+	return os.Getenv("USERNAME")
+}
@@ -0,0 +1,55 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSend(t *testing.T) {
+	var received map[string]interface{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	t.Run("posts payload for enabled event", func(t *testing.T) {
+		n := NewNotifier(server.URL, []string{EventConflict})
+		err := n.Send(Event{Type: EventConflict, SecretName: "app-env", ConflictingKeys: []string{"API_KEY"}})
+		assert.NoError(t, err)
+		assert.Equal(t, 1, requests)
+		assert.Equal(t, "conflict", received["event"])
+		assert.Equal(t, "app-env", received["secret_name"])
+		assert.Contains(t, received["text"], "API_KEY")
+	})
+
+	t.Run("filtered event is not sent", func(t *testing.T) {
+		n := NewNotifier(server.URL, []string{EventConflict})
+		assert.NoError(t, n.Send(Event{Type: EventPush, SecretName: "app-env"}))
+		assert.Equal(t, 1, requests)
+	})
+
+	t.Run("nil notifier is a no-op", func(t *testing.T) {
+		var n *Notifier
+		assert.NoError(t, n.Send(Event{Type: EventPush}))
+	})
+}
+
+func TestSendErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	n := NewNotifier(server.URL, nil)
+	err := n.Send(Event{Type: EventRotate, SecretName: "app-env"})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "500")
+}
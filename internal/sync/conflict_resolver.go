@@ -6,10 +6,13 @@ import (
 	"crypto/sha256"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/lliamscholtz/env-sync/internal/config"
+	"github.com/lliamscholtz/env-sync/internal/notify"
 	"github.com/lliamscholtz/env-sync/internal/utils"
 )
 
@@ -24,6 +27,25 @@ const (
 	ConflictStrategyBackup    ConflictStrategy = "backup"    // Create backup and merge
 )
 
+// ValidStrategies lists every supported conflict strategy
+var ValidStrategies = []ConflictStrategy{
+	ConflictStrategyManual,
+	ConflictStrategyLocal,
+	ConflictStrategyRemote,
+	ConflictStrategyMerge,
+	ConflictStrategyBackup,
+}
+
+// IsValidStrategy reports whether name is a supported conflict strategy
+func IsValidStrategy(name string) bool {
+	for _, strategy := range ValidStrategies {
+		if string(strategy) == name {
+			return true
+		}
+	}
+	return false
+}
+
 // ConflictInfo contains details about a detected conflict
 type ConflictInfo struct {
 	LocalHash     string
@@ -36,9 +58,14 @@ type ConflictInfo struct {
 
 // ConflictResolver handles environment file conflicts
 type ConflictResolver struct {
-	Strategy      ConflictStrategy
-	BackupDir     string
+	Strategy        ConflictStrategy
+	BackupDir       string // Directory backups are written to; empty uses config.DefaultBackupDir in the working directory
+	BackupName      string // backup_name template for backup file names; empty uses config.DefaultBackupName
 	InteractiveMode bool
+	Notifier        *notify.Notifier // Optional webhook notified when conflicts are resolved
+	SecretName      string           // Secret name reported in notifications
+	ShowValues      bool             // Print conflicting values in full instead of redacted
+	IgnoreComments  bool             // Hash only the key/value pairs, so comment-only edits aren't changes
 }
 
 // NewConflictResolver creates a new conflict resolver
@@ -52,8 +79,8 @@ func NewConflictResolver(strategy ConflictStrategy, backupDir string, interactiv
 
 // DetectConflict checks if local and remote content conflict
 func (cr *ConflictResolver) DetectConflict(localContent, remoteContent, lastKnownHash string) (*ConflictInfo, error) {
-	localHash := calculateHash(localContent)
-	remoteHash := calculateHash(remoteContent)
+	localHash := calculateHash(NormalizeContent(localContent, cr.IgnoreComments))
+	remoteHash := calculateHash(NormalizeContent(remoteContent, cr.IgnoreComments))
 	
 	// No conflict if content is identical
 	if localHash == remoteHash {
@@ -98,6 +125,15 @@ func (cr *ConflictResolver) ResolveConflict(ctx context.Context, conflict *Confl
 	utils.PrintWarning("⚠️  Conflict detected! Both local and remote .env files have changes.\n")
 	utils.PrintInfo("📊 Conflicting keys: %v\n", conflict.Conflicts)
 	
+	if err := cr.Notifier.Send(notify.Event{
+		Type:            notify.EventConflict,
+		SecretName:      cr.SecretName,
+		ConflictingKeys: conflict.Conflicts,
+		Message:         fmt.Sprintf("resolving with '%s' strategy", cr.Strategy),
+	}); err != nil {
+		utils.PrintWarning("⚠️  Failed to send conflict notification: %v\n", err)
+	}
+	
 	// Create backup regardless of strategy
 	if err := cr.createBackup(localFile, conflict); err != nil {
 		utils.PrintWarning("⚠️  Failed to create backup: %v\n", err)
@@ -124,7 +160,7 @@ func (cr *ConflictResolver) ResolveConflict(ctx context.Context, conflict *Confl
 // resolveManually prompts user to resolve conflicts
 func (cr *ConflictResolver) resolveManually(conflict *ConflictInfo) (string, error) {
 	if !cr.InteractiveMode {
-		return "", fmt.Errorf("conflict requires manual resolution but not in interactive mode")
+		return "", fmt.Errorf("%w requires manual resolution but not in interactive mode", ErrConflict)
 	}
 	
 	merged := make(map[string]string)
@@ -147,8 +183,8 @@ func (cr *ConflictResolver) resolveManually(conflict *ConflictInfo) (string, err
 		remoteVal := conflict.RemoteChanges[key]
 		
 		utils.PrintInfo("\n🔧 Conflict for key: %s\n", key)
-		utils.PrintInfo("  Local:  %s\n", localVal)
-		utils.PrintInfo("  Remote: %s\n", remoteVal)
+		utils.PrintInfo("  Local:  %s\n", cr.displayValue(localVal))
+		utils.PrintInfo("  Remote: %s\n", cr.displayValue(remoteVal))
 		
 		choice, err := cr.promptUserChoice(key)
 		if err != nil {
@@ -230,26 +266,31 @@ func (cr *ConflictResolver) resolveWithBackupMerge(conflict *ConflictInfo) (stri
 
 // createBackup creates backup files for conflict resolution
 func (cr *ConflictResolver) createBackup(localFile string, conflict *ConflictInfo) error {
-	if cr.BackupDir == "" {
-		cr.BackupDir = ".env-sync-backups"
+	backupDir := cr.BackupDir
+	if backupDir == "" {
+		backupDir = config.DefaultBackupDir
+	}
+	localBackup, err := config.BackupPath(backupDir, cr.BackupName, localFile, "local", conflict.ConflictTime)
+	if err != nil {
+		return err
+	}
+	remoteBackup, err := config.BackupPath(backupDir, cr.BackupName, localFile, "remote", conflict.ConflictTime)
+	if err != nil {
+		return err
 	}
 	
 	// Create backup directory
-	if err := os.MkdirAll(cr.BackupDir, 0755); err != nil {
+	if err := os.MkdirAll(filepath.Dir(localBackup), 0755); err != nil {
 		return fmt.Errorf("failed to create backup directory: %w", err)
 	}
 	
-	timestamp := conflict.ConflictTime.Format("20060102-150405")
-	
 	// Backup local version
-	localBackup := fmt.Sprintf("%s/local-%s.env", cr.BackupDir, timestamp)
 	localContent := generateEnvContent(conflict.LocalChanges)
 	if err := os.WriteFile(localBackup, []byte(localContent), 0600); err != nil {
 		return fmt.Errorf("failed to create local backup: %w", err)
 	}
 	
 	// Backup remote version
-	remoteBackup := fmt.Sprintf("%s/remote-%s.env", cr.BackupDir, timestamp)
 	remoteContent := generateEnvContent(conflict.RemoteChanges)
 	if err := os.WriteFile(remoteBackup, []byte(remoteContent), 0600); err != nil {
 		return fmt.Errorf("failed to create remote backup: %w", err)
@@ -262,6 +303,22 @@ func (cr *ConflictResolver) createBackup(localFile string, conflict *ConflictInf
 	return nil
 }
 
+// BackupLocalFile copies content, the env file's current content, to cfg's backup directory
+// before it is overwritten, returning the backup's path.
+func BackupLocalFile(cfg *config.Config, envFile string, content []byte, at time.Time) (string, error) {
+	backup, err := cfg.BackupPath(envFile, "local", at)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	if err := os.WriteFile(backup, content, 0600); err != nil {
+		return "", fmt.Errorf("failed to back up '%s': %w", envFile, err)
+	}
+	return backup, nil
+}
+
 // promptUserChoice prompts user to choose resolution for a conflict
 func (cr *ConflictResolver) promptUserChoice(key string) (string, error) {
 	fmt.Printf("Choose resolution for %s:\n", key)
@@ -293,8 +350,8 @@ func (cr *ConflictResolver) promptUserChoice(key string) (string, error) {
 // promptUserEdit prompts user to enter a new value
 func (cr *ConflictResolver) promptUserEdit(key, localVal, remoteVal string) (string, error) {
 	fmt.Printf("Enter new value for %s:\n", key)
-	fmt.Printf("  Current local:  %s\n", localVal)
-	fmt.Printf("  Current remote: %s\n", remoteVal)
+	fmt.Printf("  Current local:  %s\n", cr.displayValue(localVal))
+	fmt.Printf("  Current remote: %s\n", cr.displayValue(remoteVal))
 	fmt.Printf("New value: ")
 	
 	reader := bufio.NewReader(os.Stdin)
@@ -306,6 +363,14 @@ func (cr *ConflictResolver) promptUserEdit(key, localVal, remoteVal string) (str
 	return strings.TrimSpace(input), nil
 }
 
+// displayValue returns a value as it should be shown in conflict prompts
+func (cr *ConflictResolver) displayValue(value string) string {
+	if cr.ShowValues {
+		return value
+	}
+	return utils.Redact(value)
+}
+
 // Helper functions
 
 func calculateHash(content string) string {
@@ -313,6 +378,26 @@ func calculateHash(content string) string {
 	return fmt.Sprintf("%x", hash)
 }
 
+// NormalizeContent returns the form of .env content that change detection compares and hashes.
+// With ignoreComments that is its sorted key/value pairs, so editing comments or blank lines or
+// reordering keys isn't a change; otherwise, or if the content doesn't parse, it is the content as-is.
+func NormalizeContent(content string, ignoreComments bool) string {
+	if !ignoreComments {
+		return content
+	}
+	env, err := parseEnvContent(content)
+	if err != nil {
+		return content
+	}
+	return generateEnvContent(env)
+}
+
+// ParseEnvContent parses .env content into key-value pairs, stripping surrounding quotes.
+// It returns an error naming the first line that is not a KEY=value pair.
+func ParseEnvContent(content string) (map[string]string, error) {
+	return parseEnvContent(content)
+}
+
 func parseEnvContent(content string) (map[string]string, error) {
 	env := make(map[string]string)
 	lines := strings.Split(content, "\n")
@@ -328,7 +413,7 @@ func parseEnvContent(content string) (map[string]string, error) {
 		// Find the first = sign
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid env line %d: %s", i+1, line)
+			return nil, fmt.Errorf("invalid env line %d: %s", i+1, utils.Redact(line))
 		}
 		
 		key := strings.TrimSpace(parts[0])
@@ -359,7 +444,7 @@ func generateEnvContent(env map[string]string) string {
 	for _, key := range keys {
 		value := env[key]
 		// Quote values that contain spaces or special characters
-		if strings.ContainsAny(value, " \t\n\r") || strings.Contains(value, "=") {
+		if needsQuotes(value) {
 			value = fmt.Sprintf(`"%s"`, value)
 		}
 		lines = append(lines, fmt.Sprintf("%s=%s", key, value))
@@ -368,6 +453,15 @@ func generateEnvContent(env map[string]string) string {
 	return strings.Join(lines, "\n") + "\n"
 }
 
+// needsQuotes reports whether a value must be quoted to parse back unchanged: parsing trims
+// whitespace and strips one pair of surrounding quotes
+func needsQuotes(value string) bool {
+	if strings.ContainsAny(value, " \t\n\r#=") {
+		return true
+	}
+	return strings.HasPrefix(value, `"`) || strings.HasPrefix(value, "'") || strings.HasSuffix(value, `"`) || strings.HasSuffix(value, "'")
+}
+
 func findConflictingKeys(local, remote map[string]string) []string {
 	var conflicts []string
 	
@@ -91,6 +91,44 @@ func TestDetectConflict(t *testing.T) {
 	}
 }
 
+func TestDetectConflictIgnoringComments(t *testing.T) {
+	synced := "# Database\nDB_HOST=localhost\nDB_PORT=5432\n"
+	local := "# Database settings, see the wiki\nDB_HOST=localhost\n\nDB_PORT=5432\n"
+	remote := "DB_PORT=5432\n# Host of the primary\nDB_HOST=localhost\n"
+
+	resolver := NewConflictResolver(ConflictStrategyManual, "", false)
+	resolver.IgnoreComments = true
+	conflict, err := resolver.DetectConflict(local, remote, calculateHash(NormalizeContent(synced, true)))
+	if err != nil || conflict != nil {
+		t.Fatalf("Expected comment-only edits on both sides not to conflict, got %v, %v", conflict, err)
+	}
+
+	// A value change on one side is still seen as a change of that side only
+	conflict, err = resolver.DetectConflict(local+"DB_USER=app\n", remote, calculateHash(NormalizeContent(synced, true)))
+	if err != nil || conflict != nil {
+		t.Fatalf("Expected a one-sided change not to conflict, got %v, %v", conflict, err)
+	}
+
+	resolver.IgnoreComments = false
+	conflict, err = resolver.DetectConflict(local, remote, calculateHash(synced))
+	if err != nil || conflict == nil {
+		t.Fatalf("Expected raw hashes to see both sides as changed, got %v, %v", conflict, err)
+	}
+}
+
+func TestNormalizeContent(t *testing.T) {
+	content := "# comment\nB=2\n\nA=\"1\"\n"
+	if got := NormalizeContent(content, false); got != content {
+		t.Errorf("Expected content unchanged without ignoreComments, got %q", got)
+	}
+	if NormalizeContent(content, true) != NormalizeContent("A=1\nB=2\n", true) {
+		t.Errorf("Expected comments, blank lines, quoting and order to be ignored, got %q", NormalizeContent(content, true))
+	}
+	if NormalizeContent("A=1\n", true) == NormalizeContent("A=2\n", true) {
+		t.Error("Expected value changes to be kept")
+	}
+}
+
 func TestResolveConflictStrategies(t *testing.T) {
 	tempDir := t.TempDir()
 	localFile := filepath.Join(tempDir, ".env")
@@ -331,4 +369,27 @@ func TestCreateBackup(t *testing.T) {
 	if !remoteBackupFound {
 		t.Error("Remote backup file not found")
 	}
-}
\ No newline at end of file
+}
+func TestCreateBackupNameTemplate(t *testing.T) {
+	tempDir := t.TempDir()
+	backupDir := filepath.Join(tempDir, "backups")
+	conflict := &ConflictInfo{
+		ConflictTime:  time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		LocalChanges:  map[string]string{"KEY1": "local_value"},
+		RemoteChanges: map[string]string{"KEY1": "remote_value"},
+	}
+
+	// Env files sharing a backup directory get backups of their own
+	for _, name := range []string{".env", ".env.test"} {
+		resolver := NewConflictResolver(ConflictStrategyBackup, backupDir, false)
+		resolver.BackupName = "{{.Name}}.{{.Side}}-{{.Timestamp}}"
+		if err := resolver.createBackup(filepath.Join(tempDir, name), conflict); err != nil {
+			t.Fatalf("createBackup failed: %v", err)
+		}
+	}
+	for _, name := range []string{".env.local-20240501-123000", ".env.remote-20240501-123000", ".env.test.local-20240501-123000", ".env.test.remote-20240501-123000"} {
+		if _, err := os.Stat(filepath.Join(backupDir, name)); err != nil {
+			t.Errorf("Expected backup %s: %v", name, err)
+		}
+	}
+}
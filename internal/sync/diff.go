@@ -0,0 +1,38 @@
+package sync
+
+import "sort"
+
+// EnvDiff lists the keys that differ between two versions of .env content, each sorted.
+type EnvDiff struct {
+	Added   []string // Keys only in the newer content
+	Removed []string // Keys only in the older content
+	Changed []string // Keys whose value differs
+}
+
+// Empty reports whether the two versions have the same keys and values.
+func (d *EnvDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// DiffEnv compares parsed .env content from an older and a newer version.
+func DiffEnv(older, newer map[string]string) *EnvDiff {
+	diff := &EnvDiff{}
+	for key, newValue := range newer {
+		oldValue, exists := older[key]
+		switch {
+		case !exists:
+			diff.Added = append(diff.Added, key)
+		case oldValue != newValue:
+			diff.Changed = append(diff.Changed, key)
+		}
+	}
+	for key := range older {
+		if _, exists := newer[key]; !exists {
+			diff.Removed = append(diff.Removed, key)
+		}
+	}
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return diff
+}
@@ -0,0 +1,28 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffEnv(t *testing.T) {
+	older := map[string]string{"KEEP": "1", "CHANGED": "old", "REMOVED": "x", "EMPTIED": "y"}
+	newer := map[string]string{"KEEP": "1", "CHANGED": "new", "ADDED": "z", "EMPTIED": ""}
+
+	diff := DiffEnv(older, newer)
+	if !reflect.DeepEqual(diff.Added, []string{"ADDED"}) {
+		t.Errorf("Expected ADDED to be added, got %v", diff.Added)
+	}
+	if !reflect.DeepEqual(diff.Removed, []string{"REMOVED"}) {
+		t.Errorf("Expected REMOVED to be removed, got %v", diff.Removed)
+	}
+	if !reflect.DeepEqual(diff.Changed, []string{"CHANGED", "EMPTIED"}) {
+		t.Errorf("Expected CHANGED and EMPTIED to be changed, got %v", diff.Changed)
+	}
+	if diff.Empty() {
+		t.Error("Expected a non-empty diff")
+	}
+	if !DiffEnv(older, older).Empty() {
+		t.Error("Expected identical content to have an empty diff")
+	}
+}
@@ -0,0 +1,94 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// EditEnvContent sets and removes keys in .env content, leaving every other line, including
+// comments and the order of keys, as it was. Keys in set replace the value of an existing
+// line, or are appended in sorted order when absent; keys in remove have their lines dropped.
+func EditEnvContent(content string, set map[string]string, remove []string) (string, error) {
+	for key, value := range set {
+		if err := checkEnvKey(key); err != nil {
+			return "", err
+		}
+		if strings.ContainsAny(value, "\n\r") {
+			return "", fmt.Errorf("the value of %s spans several lines, which .env files can't hold", key)
+		}
+	}
+	removed := make(map[string]bool, len(remove))
+	for _, key := range remove {
+		if _, ok := set[key]; ok {
+			return "", fmt.Errorf("%s is both set and removed", key)
+		}
+		removed[key] = true
+	}
+
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+	written := make(map[string]bool, len(set))
+	edited := make([]string, 0, len(lines)+len(set))
+	for _, line := range lines {
+		key, ok := lineKey(line)
+		if ok && removed[key] {
+			continue
+		}
+		if value, replace := set[key]; ok && replace {
+			if written[key] {
+				continue // Keep a single definition so the new value can't be shadowed
+			}
+			written[key] = true
+			line = formatEnvLine(key, value)
+		}
+		edited = append(edited, line)
+	}
+
+	added := make([]string, 0, len(set))
+	for key := range set {
+		if !written[key] {
+			added = append(added, key)
+		}
+	}
+	sort.Strings(added)
+	for _, key := range added {
+		edited = append(edited, formatEnvLine(key, set[key]))
+	}
+
+	if len(edited) == 0 {
+		return "", nil
+	}
+	return strings.Join(edited, "\n") + "\n", nil
+}
+
+// lineKey returns the key a .env line assigns, parsed the way parseEnvContent does
+func lineKey(line string) (string, bool) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return "", false
+	}
+	key, _, ok := strings.Cut(line, "=")
+	if !ok {
+		return "", false
+	}
+	return strings.TrimSpace(key), true
+}
+
+// formatEnvLine formats a key and value as a .env line that parses back unchanged
+func formatEnvLine(key, value string) string {
+	if needsQuotes(value) {
+		value = fmt.Sprintf(`"%s"`, value)
+	}
+	return fmt.Sprintf("%s=%s", key, value)
+}
+
+// checkEnvKey rejects keys that wouldn't parse back as the same key
+func checkEnvKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "#") || strings.ContainsAny(key, "= \t\n\r") {
+		return fmt.Errorf("invalid key '%s'", key)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEditEnvContent(t *testing.T) {
+	content := "# Database\nDB_HOST=localhost\nDB_PASS='old'\n\nAPI_KEY=abc\nDB_HOST=shadowed\n"
+
+	edited, err := EditEnvContent(content, map[string]string{"DB_PASS": "new pass", "ZED": "1", "ALPHA": "2"}, []string{"API_KEY"})
+	if err != nil {
+		t.Fatalf("EditEnvContent failed: %v", err)
+	}
+	expected := "# Database\nDB_HOST=localhost\nDB_PASS=\"new pass\"\n\nDB_HOST=shadowed\nALPHA=2\nZED=1\n"
+	if edited != expected {
+		t.Errorf("Expected %q, got %q", expected, edited)
+	}
+
+	// Duplicate definitions collapse into the replaced one
+	edited, _ = EditEnvContent(content, map[string]string{"DB_HOST": "db"}, nil)
+	env, _ := ParseEnvContent(edited)
+	if env["DB_HOST"] != "db" {
+		t.Errorf("Expected DB_HOST to be db, got %q in %q", env["DB_HOST"], edited)
+	}
+
+	edited, _ = EditEnvContent("", map[string]string{"NEW": "x"}, nil)
+	if edited != "NEW=x\n" {
+		t.Errorf("Expected a new file with NEW, got %q", edited)
+	}
+
+	for _, tt := range []struct {
+		set    map[string]string
+		remove []string
+	}{
+		{map[string]string{"BAD KEY": "x"}, nil},
+		{map[string]string{"KEY": "two\nlines"}, nil},
+		{map[string]string{"KEY": "x"}, []string{"KEY"}},
+	} {
+		if _, err := EditEnvContent(content, tt.set, tt.remove); err == nil {
+			t.Errorf("Expected an error setting %v and removing %v", tt.set, tt.remove)
+		}
+	}
+
+	// Values round-trip through the parser
+	values := map[string]string{"A": `say "hi"`, "B": "x=y", "C": " padded ", "D": ""}
+	edited, _ = EditEnvContent("", values, nil)
+	if env, _ := ParseEnvContent(edited); !reflect.DeepEqual(env, values) {
+		t.Errorf("Expected %v to parse back, got %v from %q", values, env, edited)
+	}
+}
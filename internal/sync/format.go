@@ -0,0 +1,152 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats accepted by FormatEnvContent and ConvertToEnvContent.
+const (
+	// FormatDotenv is the KEY=value syntax of .env files, written unchanged.
+	FormatDotenv = "dotenv"
+	// FormatJSON is a JSON object of string values.
+	FormatJSON = "json"
+	// FormatYAML is a YAML mapping of string values.
+	FormatYAML = "yaml"
+)
+
+// Formats lists the accepted format names.
+var Formats = []string{FormatDotenv, FormatJSON, FormatYAML}
+
+// FormatEnvContent converts .env content to format. Dotenv content is returned as-is; for JSON
+// and YAML it is parsed with ParseEnvContent and emitted as an object with sorted keys.
+func FormatEnvContent(content []byte, format string) ([]byte, error) {
+	switch format {
+	case "", FormatDotenv:
+		return content, nil
+	case FormatJSON, FormatYAML:
+	default:
+		return nil, fmt.Errorf("invalid format '%s'. Must be one of: %s", format, strings.Join(Formats, ", "))
+	}
+
+	env, err := parseEnvContent(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse .env content: %w", err)
+	}
+
+	var buf bytes.Buffer
+	if format == FormatJSON {
+		encoder := json.NewEncoder(&buf)
+		// Values such as URLs with & must stay readable for the tools consuming them
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(env); err != nil {
+			return nil, fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(env); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode YAML: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// ConvertToEnvContent converts a JSON or YAML object to .env content with sorted keys. Nested
+// objects are flattened by joining keys with an underscore, so {"db": {"host": "x"}} becomes
+// db_host=x. Numbers and booleans keep their literal text and null becomes an empty value.
+// Lists are rejected unless stringify is set, in which case they are stored as compact JSON.
+func ConvertToEnvContent(data []byte, format string, stringify bool) ([]byte, error) {
+	switch format {
+	case "", FormatDotenv:
+		return data, nil
+	case FormatJSON:
+		if !json.Valid(data) {
+			var v interface{}
+			return nil, fmt.Errorf("invalid JSON: %w", json.Unmarshal(data, &v))
+		}
+	case FormatYAML:
+	default:
+		return nil, fmt.Errorf("invalid format '%s'. Must be one of: %s", format, strings.Join(Formats, ", "))
+	}
+
+	// JSON is parsed as YAML too, which keeps the literal text of every scalar
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", strings.ToUpper(format), err)
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("%s content must be an object of keys and values", strings.ToUpper(format))
+	}
+
+	env := make(map[string]string)
+	if err := flattenNode(doc.Content[0], "", env, stringify); err != nil {
+		return nil, err
+	}
+	return []byte(generateEnvContent(env)), nil
+}
+
+// flattenNode adds the scalar leaves of node to env, prefixing nested keys with their parents'
+func flattenNode(node *yaml.Node, name string, env map[string]string, stringify bool) error {
+	if node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			if name != "" {
+				key = name + "_" + key
+			}
+			if key == "" || strings.ContainsAny(key, "=# \t\r\n") {
+				return fmt.Errorf("key '%s' can't be used in a .env file", key)
+			}
+			if err := flattenNode(node.Content[i+1], key, env, stringify); err != nil {
+				return err
+			}
+		}
+		return nil
+	case yaml.SequenceNode:
+		if !stringify {
+			return fmt.Errorf("'%s' is a list; values must be strings, numbers or booleans (use --stringify to store lists as JSON)", name)
+		}
+		var value interface{}
+		if err := node.Decode(&value); err != nil {
+			return fmt.Errorf("failed to decode '%s': %w", name, err)
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("'%s' can't be stored as JSON: %w", name, err)
+		}
+		return setFlattened(env, name, string(encoded))
+	case yaml.ScalarNode:
+		if node.Tag == "!!null" {
+			return setFlattened(env, name, "")
+		}
+		return setFlattened(env, name, node.Value)
+	default:
+		return fmt.Errorf("'%s' has an unsupported value", name)
+	}
+}
+
+// setFlattened sets a flattened key, rejecting duplicates and values a .env file can't hold
+func setFlattened(env map[string]string, key, value string) error {
+	if _, exists := env[key]; exists {
+		return fmt.Errorf("key '%s' is defined more than once after flattening nested objects", key)
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("'%s' spans several lines, which a .env file can't hold", key)
+	}
+	env[key] = value
+	return nil
+}
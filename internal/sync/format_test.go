@@ -0,0 +1,157 @@
+package sync
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestFormatEnvContent(t *testing.T) {
+	content := []byte(`# comment
+DATABASE_URL="postgres://user:p@ss@localhost/db?sslmode=require&x=<1>"
+QUOTE='say "hi"'
+ENABLED=true
+PORT=8080
+COLON=a: b
+HASH=#notacomment
+EMPTY=
+`)
+	expected := map[string]string{
+		"DATABASE_URL": "postgres://user:p@ss@localhost/db?sslmode=require&x=<1>",
+		"QUOTE":        `say "hi"`,
+		"ENABLED":      "true",
+		"PORT":         "8080",
+		"COLON":        "a: b",
+		"HASH":         "#notacomment",
+		"EMPTY":        "",
+	}
+
+	dotenv, err := FormatEnvContent(content, FormatDotenv)
+	if err != nil || string(dotenv) != string(content) {
+		t.Errorf("Expected dotenv content unchanged, got %q, %v", dotenv, err)
+	}
+
+	out, err := FormatEnvContent(content, FormatJSON)
+	if err != nil {
+		t.Fatalf("JSON formatting failed: %v", err)
+	}
+	var fromJSON map[string]string
+	if err := json.Unmarshal(out, &fromJSON); err != nil {
+		t.Fatalf("Output is not valid JSON: %v\n%s", err, out)
+	}
+	assertEnvEqual(t, expected, fromJSON)
+
+	out, err = FormatEnvContent(content, FormatYAML)
+	if err != nil {
+		t.Fatalf("YAML formatting failed: %v", err)
+	}
+	// Decoding into interface values catches strings like true and 8080 that lost their quotes
+	var fromYAML map[string]interface{}
+	if err := yaml.Unmarshal(out, &fromYAML); err != nil {
+		t.Fatalf("Output is not valid YAML: %v\n%s", err, out)
+	}
+	for key, value := range fromYAML {
+		if _, ok := value.(string); !ok {
+			t.Errorf("Expected %s to decode as a string, got %T", key, value)
+		}
+	}
+	var yamlStrings map[string]string
+	_ = yaml.Unmarshal(out, &yamlStrings)
+	assertEnvEqual(t, expected, yamlStrings)
+
+	if _, err := FormatEnvContent(content, "toml"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if _, err := FormatEnvContent([]byte("NOT_AN_ENV_LINE\n"), FormatJSON); err == nil {
+		t.Error("Expected an error for content that doesn't parse")
+	}
+}
+
+func assertEnvEqual(t *testing.T, expected, actual map[string]string) {
+	t.Helper()
+	if len(expected) != len(actual) {
+		t.Errorf("Expected %d keys, got %d: %v", len(expected), len(actual), actual)
+	}
+	for key, value := range expected {
+		if actual[key] != value {
+			t.Errorf("Expected %s=%q, got %q", key, value, actual[key])
+		}
+	}
+}
+
+func TestConvertToEnvContent(t *testing.T) {
+	jsonSource := []byte(`{
+  "DATABASE_URL": "postgres://user:p@ss@localhost/db?a=1&b=2",
+  "port": 8080,
+  "ratio": 1.50,
+  "debug": false,
+  "token": null,
+  "greeting": "say \"hi\" # not a comment",
+  "db": {"host": "localhost", "replica": {"port": "5433"}}
+}`)
+	expected := map[string]string{
+		"DATABASE_URL":    "postgres://user:p@ss@localhost/db?a=1&b=2",
+		"port":            "8080",
+		"ratio":           "1.50",
+		"debug":           "false",
+		"token":           "",
+		"greeting":        `say "hi" # not a comment`,
+		"db_host":         "localhost",
+		"db_replica_port": "5433",
+	}
+
+	content, err := ConvertToEnvContent(jsonSource, FormatJSON, false)
+	if err != nil {
+		t.Fatalf("JSON conversion failed: %v", err)
+	}
+	env, err := ParseEnvContent(string(content))
+	if err != nil {
+		t.Fatalf("Converted content doesn't parse: %v\n%s", err, content)
+	}
+	assertEnvEqual(t, expected, env)
+
+	yamlSource := []byte("DATABASE_URL: 'postgres://user:p@ss@localhost/db?a=1&b=2'\nport: 8080\nratio: 1.50\ndebug: false\ntoken: ~\ngreeting: 'say \"hi\" # not a comment'\ndb:\n  host: localhost\n  replica:\n    port: \"5433\"\n")
+	content, err = ConvertToEnvContent(yamlSource, FormatYAML, false)
+	if err != nil {
+		t.Fatalf("YAML conversion failed: %v", err)
+	}
+	env, _ = ParseEnvContent(string(content))
+	assertEnvEqual(t, expected, env)
+
+	// Pulling as JSON and pushing that back is lossless
+	formatted, err := FormatEnvContent(content, FormatJSON)
+	if err != nil {
+		t.Fatalf("JSON formatting failed: %v", err)
+	}
+	roundTrip, err := ConvertToEnvContent(formatted, FormatJSON, false)
+	if err != nil || string(roundTrip) != string(content) {
+		t.Errorf("Expected a lossless round trip, got %q, %v", roundTrip, err)
+	}
+
+	lists := []byte(`{"hosts": ["a", "b"]}`)
+	if _, err := ConvertToEnvContent(lists, FormatJSON, false); err == nil || !strings.Contains(err.Error(), "--stringify") {
+		t.Errorf("Expected lists to be rejected with a hint, got %v", err)
+	}
+	content, err = ConvertToEnvContent(lists, FormatJSON, true)
+	if err != nil {
+		t.Fatalf("Stringified conversion failed: %v", err)
+	}
+	env, _ = ParseEnvContent(string(content))
+	if env["hosts"] != `["a","b"]` {
+		t.Errorf("Expected hosts stored as JSON, got %q", env["hosts"])
+	}
+
+	for name, source := range map[string]string{
+		"not an object":       `["a"]`,
+		"invalid json":        `{"a": }`,
+		"flattened duplicate": `{"a_b": "1", "a": {"b": "2"}}`,
+		"multi-line value":    `{"cert": "line1\nline2"}`,
+		"key with space":      `{"my key": "x"}`,
+	} {
+		if _, err := ConvertToEnvContent([]byte(source), FormatJSON, false); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// StaleLockAge is how old a lock file may get before it is assumed abandoned.
+const StaleLockAge = 10 * time.Minute
+
+// LockInfo is written to the lock file to identify its holder.
+type LockInfo struct {
+	PID        int       `json:"pid"`
+	Hostname   string    `json:"hostname"`
+	AcquiredAt time.Time `json:"acquired_at"`
+}
+
+// LockHeldError is returned when another process holds the sync lock.
+type LockHeldError struct {
+	Path   string
+	Holder LockInfo
+}
+
+func (e *LockHeldError) Error() string {
+	return fmt.Sprintf("another env-sync process (PID %d on %s) has held the sync lock '%s' since %s",
+		e.Holder.PID, e.Holder.Hostname, e.Path, e.Holder.AcquiredAt.Format(time.RFC3339))
+}
+
+// Lock is an advisory lock file that prevents concurrent pushes of the same env file.
+type Lock struct {
+	path string
+}
+
+// LockPath returns the lock file used for an env file.
+func LockPath(envFile string) string {
+	return envFile + ".env-sync.lock"
+}
+
+// AcquireLock creates the lock file at path, recording the current PID, host and time.
+// Locks left behind by a process that has exited, or older than StaleLockAge, are taken over.
+// If another live process holds the lock, a *LockHeldError is returned.
+func AcquireLock(path string) (*Lock, error) {
+	hostname, _ := os.Hostname()
+	info := LockInfo{PID: os.Getpid(), Hostname: hostname, AcquiredAt: time.Now()}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+
+	// Two attempts: the second follows removing a stale lock
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err == nil {
+			_, writeErr := file.Write(data)
+			closeErr := file.Close()
+			if err := errors.Join(writeErr, closeErr); err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write sync lock '%s': %w", path, err)
+			}
+			return &Lock{path: path}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, fmt.Errorf("failed to create sync lock '%s': %w", path, err)
+		}
+
+		holder, readErr := readLockInfo(path)
+		if readErr == nil && !isStaleLock(holder, hostname) {
+			return nil, &LockHeldError{Path: path, Holder: holder}
+		}
+		// Unreadable or stale: the holder is gone, so take the lock over
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to remove stale sync lock '%s': %w", path, err)
+		}
+	}
+	return nil, fmt.Errorf("failed to acquire sync lock '%s'", path)
+}
+
+// Release removes the lock file.
+func (l *Lock) Release() error {
+	if err := os.Remove(l.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to release sync lock '%s': %w", l.path, err)
+	}
+	return nil
+}
+
+// readLockInfo reads the holder recorded in a lock file
+func readLockInfo(path string) (LockInfo, error) {
+	var info LockInfo
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(data, &info)
+	return info, err
+}
+
+// isStaleLock reports whether a lock's holder has exited or held it for too long
+func isStaleLock(holder LockInfo, hostname string) bool {
+	if time.Since(holder.AcquiredAt) > StaleLockAge {
+		return true
+	}
+	// Processes on other hosts (e.g. a shared drive) can't be checked, so only the age applies
+	return holder.Hostname == hostname && !processAlive(holder.PID)
+}
+
+// processAlive reports whether a process with the given PID exists on this host
+func processAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// On Windows FindProcess opens a handle, which already fails for exited processes
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	// Signal 0 checks for existence without affecting the process
+	err = process.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, os.ErrPermission)
+}
@@ -0,0 +1,108 @@
+package sync
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeLockFile(t *testing.T, path string, info LockInfo) {
+	t.Helper()
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Failed to marshal lock info: %v", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("Failed to write lock file: %v", err)
+	}
+}
+
+func TestAcquireLock(t *testing.T) {
+	path := LockPath(filepath.Join(t.TempDir(), ".env"))
+
+	lock, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("Expected to acquire lock, got %v", err)
+	}
+
+	holder, err := readLockInfo(path)
+	if err != nil {
+		t.Fatalf("Failed to read lock file: %v", err)
+	}
+	if holder.PID != os.Getpid() {
+		t.Errorf("Expected lock PID %d, got %d", os.Getpid(), holder.PID)
+	}
+
+	if err := lock.Release(); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected lock file to be removed, got %v", err)
+	}
+}
+
+func TestAcquireLockHeld(t *testing.T) {
+	path := LockPath(filepath.Join(t.TempDir(), ".env"))
+
+	lock, err := AcquireLock(path)
+	if err != nil {
+		t.Fatalf("Expected to acquire lock, got %v", err)
+	}
+	defer lock.Release()
+
+	_, err = AcquireLock(path)
+	var held *LockHeldError
+	if !errors.As(err, &held) {
+		t.Fatalf("Expected LockHeldError, got %v", err)
+	}
+	if held.Holder.PID != os.Getpid() {
+		t.Errorf("Expected holder PID %d, got %d", os.Getpid(), held.Holder.PID)
+	}
+}
+
+func TestAcquireLockStale(t *testing.T) {
+	hostname, _ := os.Hostname()
+
+	tests := []struct {
+		name   string
+		holder LockInfo
+	}{
+		{
+			name:   "expired lock",
+			holder: LockInfo{PID: os.Getpid(), Hostname: hostname, AcquiredAt: time.Now().Add(-2 * StaleLockAge)},
+		},
+		{
+			name:   "holder has exited",
+			holder: LockInfo{PID: -1, Hostname: hostname, AcquiredAt: time.Now()},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := LockPath(filepath.Join(t.TempDir(), ".env"))
+			writeLockFile(t, path, tt.holder)
+
+			lock, err := AcquireLock(path)
+			if err != nil {
+				t.Fatalf("Expected stale lock to be taken over, got %v", err)
+			}
+			lock.Release()
+		})
+	}
+
+	t.Run("corrupt lock file", func(t *testing.T) {
+		path := LockPath(filepath.Join(t.TempDir(), ".env"))
+		if err := os.WriteFile(path, []byte("not json"), 0600); err != nil {
+			t.Fatalf("Failed to write lock file: %v", err)
+		}
+
+		lock, err := AcquireLock(path)
+		if err != nil {
+			t.Fatalf("Expected corrupt lock to be taken over, got %v", err)
+		}
+		lock.Release()
+	})
+}
@@ -2,40 +2,40 @@ package sync
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
-	"path/filepath"
 	"time"
 
+	"github.com/lliamscholtz/env-sync/internal/auth"
 	"github.com/lliamscholtz/env-sync/internal/config"
 	"github.com/lliamscholtz/env-sync/internal/crypto"
 	"github.com/lliamscholtz/env-sync/internal/utils"
 	"github.com/lliamscholtz/env-sync/internal/vault"
 )
 
+// ErrConflict is returned when local and remote changes conflict and can't be resolved automatically
+var ErrConflict = errors.New("conflict")
+
+// ErrRemoteChanged is returned by Push when the remote changed since the last sync but the local file did not
+var ErrRemoteChanged = errors.New("remote has newer changes, pull first")
+
 // SyncManager handles conflict-aware synchronization
 type SyncManager struct {
 	config      *config.Config
-	vaultClient *vault.Client
+	vaultClient vault.SecretStore
 	resolver    *ConflictResolver
 	stateFile   string // Stores last known state for conflict detection
 }
 
-// SyncState tracks the last known state for conflict detection
-type SyncState struct {
-	LastSyncTime   time.Time `json:"last_sync_time"`
-	LastKnownHash  string    `json:"last_known_hash"`
-	LastSyncBy     string    `json:"last_sync_by"`
-	ConflictCount  int       `json:"conflict_count"`
-}
-
 // NewSyncManager creates a new sync manager with conflict resolution
-func NewSyncManager(cfg *config.Config, vaultClient *vault.Client, strategy ConflictStrategy, interactive bool) *SyncManager {
-	stateFile := filepath.Join(filepath.Dir(cfg.EnvFile), ".env-sync-state.json")
-	backupDir := filepath.Join(filepath.Dir(cfg.EnvFile), ".env-sync-backups")
-	
-	resolver := NewConflictResolver(strategy, backupDir, interactive)
+func NewSyncManager(cfg *config.Config, vaultClient vault.SecretStore, strategy ConflictStrategy, interactive bool) *SyncManager {
+	stateFile := ConfiguredStatePath(cfg, cfg.EnvFile)
+	resolver := NewConflictResolver(strategy, cfg.BackupDirFor(cfg.EnvFile), interactive)
+	resolver.BackupName = cfg.BackupName
+	resolver.Notifier = cfg.Notifier()
+	resolver.SecretName = cfg.SecretName
+	resolver.IgnoreComments = cfg.IgnoreCommentsForSync
 	
 	return &SyncManager{
 		config:      cfg,
@@ -47,6 +47,9 @@ func NewSyncManager(cfg *config.Config, vaultClient *vault.Client, strategy Conf
 
 // Push uploads local content with conflict detection
 func (sm *SyncManager) Push(ctx context.Context, encryptionKey []byte) error {
+	if err := sm.config.CheckWritable("push"); err != nil {
+		return err
+	}
 	utils.PrintInfo("📤 Starting conflict-aware push...\n")
 	
 	// Read local file
@@ -55,71 +58,95 @@ func (sm *SyncManager) Push(ctx context.Context, encryptionKey []byte) error {
 		return fmt.Errorf("failed to read local file: %w", err)
 	}
 	
-	// Get current remote content for conflict detection
-	remoteEncrypted, err := sm.vaultClient.GetSecret(ctx, sm.config.SecretName)
+	// Prevent concurrent pushes of the same file from this machine
+	lock, err := AcquireLock(LockPath(sm.config.EnvFile))
 	if err != nil {
+		return err
+	}
+	defer lock.Release()
+	
+	// Get current remote content for conflict detection
+	remote, err := sm.vaultClient.GetSecretWithProperties(ctx, sm.config.SecretName)
+	if errors.Is(err, vault.ErrSecretNotFound) {
 		// If secret doesn't exist, this is the first push
 		utils.PrintInfo("📝 First push - no conflict detection needed\n")
-		return sm.performPush(ctx, string(localContent), encryptionKey)
+		return sm.performPush(ctx, string(localContent), encryptionKey, "")
 	}
-	
+	if err != nil {
+		return fmt.Errorf("failed to get remote secret: %w", err)
+	}
+	if err := crypto.CheckContentType(remote.ContentType); err != nil {
+		return fmt.Errorf("'%s': %w", sm.config.SecretName, err)
+	}
+
 	// Decrypt remote content
-	remoteContent, err := crypto.DecryptEnvContent(remoteEncrypted, encryptionKey)
+	remoteContent, err := sm.config.DecryptContent(remote.Value, encryptionKey)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt remote content: %w", err)
 	}
-	
+
+	// Identical content would only add a version to the secret's history
+	if sm.normalize(string(localContent)) == sm.normalize(string(remoteContent)) && sm.config.RecipientsMatch(remote.Value) {
+		utils.PrintSuccess("✅ Already up to date, nothing to push\n")
+		return nil
+	}
+
 	// Load last known state
 	state, err := sm.loadState()
 	if err != nil {
 		utils.PrintWarning("⚠️  Could not load sync state, assuming first sync: %v\n", err)
 		state = &SyncState{}
 	}
-	
+
+	// Refuse to overwrite remote changes we haven't pulled yet
+	if remoteChangedOnly(sm.normalize(string(localContent)), sm.normalize(string(remoteContent)), state.LastKnownHash) {
+		return fmt.Errorf("'%s': %w", sm.config.SecretName, ErrRemoteChanged)
+	}
+
 	// Detect conflicts
 	conflict, err := sm.resolver.DetectConflict(string(localContent), string(remoteContent), state.LastKnownHash)
 	if err != nil {
 		return fmt.Errorf("failed to detect conflicts: %w", err)
 	}
-	
+
 	var finalContent string
 	if conflict != nil {
 		utils.PrintWarning("⚠️  Conflict detected during push!\n")
-		
+
 		// Resolve the conflict
 		resolvedContent, err := sm.resolver.ResolveConflict(ctx, conflict, sm.config.EnvFile)
 		if err != nil {
 			return fmt.Errorf("failed to resolve conflict: %w", err)
 		}
-		
+
 		finalContent = resolvedContent
 		state.ConflictCount++
-		
+
 		// Write resolved content back to local file
-		if err := os.WriteFile(sm.config.EnvFile, []byte(finalContent), 0600); err != nil {
+		if err := utils.WriteFileMode(sm.config.EnvFile, []byte(finalContent), sm.config.EnvFilePerm()); err != nil {
 			return fmt.Errorf("failed to write resolved content to local file: %w", err)
 		}
-		
+
 		utils.PrintSuccess("✅ Conflict resolved and local file updated\n")
 	} else {
 		finalContent = string(localContent)
 		utils.PrintInfo("✅ No conflicts detected\n")
 	}
-	
+
 	// Perform the push
-	if err := sm.performPush(ctx, finalContent, encryptionKey); err != nil {
+	if err := sm.performPush(ctx, finalContent, encryptionKey, remote.Version); err != nil {
 		return err
 	}
-	
+
 	// Update state
 	state.LastSyncTime = time.Now()
-	state.LastKnownHash = calculateHash(finalContent)
+	state.LastKnownHash = calculateHash(sm.normalize(finalContent))
 	state.LastSyncBy = "push"
-	
+
 	if err := sm.saveState(state); err != nil {
 		utils.PrintWarning("⚠️  Failed to save sync state: %v\n", err)
 	}
-	
+
 	return nil
 }
 
@@ -128,17 +155,27 @@ func (sm *SyncManager) Pull(ctx context.Context, encryptionKey []byte) error {
 	utils.PrintInfo("📥 Starting conflict-aware pull...\n")
 	
 	// Get remote content
-	remoteEncrypted, err := sm.vaultClient.GetSecret(ctx, sm.config.SecretName)
+	remote, err := sm.vaultClient.GetSecretWithProperties(ctx, sm.config.SecretName)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		utils.PrintWarning("⚠️  No remote secret '%s' yet — run 'env-sync push' first.\n", sm.config.SecretName)
+		return nil
+	}
 	if err != nil {
 		return fmt.Errorf("failed to get remote secret: %w", err)
 	}
-	
+	if err := remote.Attributes.Check(time.Now()); err != nil {
+		return fmt.Errorf("'%s': %w", sm.config.SecretName, err)
+	}
+	if err := crypto.CheckContentType(remote.ContentType); err != nil {
+		return fmt.Errorf("'%s': %w", sm.config.SecretName, err)
+	}
+
 	// Decrypt remote content
-	remoteContent, err := crypto.DecryptEnvContent(remoteEncrypted, encryptionKey)
+	remoteContent, err := sm.config.DecryptContent(remote.Value, encryptionKey)
 	if err != nil {
 		return fmt.Errorf("failed to decrypt remote content: %w", err)
 	}
-	
+
 	// Check if local file exists
 	var localContent []byte
 	if _, err := os.Stat(sm.config.EnvFile); err == nil {
@@ -187,13 +224,13 @@ func (sm *SyncManager) Pull(ctx context.Context, encryptionKey []byte) error {
 	}
 	
 	// Write final content to local file
-	if err := os.WriteFile(sm.config.EnvFile, []byte(finalContent), 0600); err != nil {
+	if err := utils.WriteFileMode(sm.config.EnvFile, []byte(finalContent), sm.config.EnvFilePerm()); err != nil {
 		return fmt.Errorf("failed to write to local file: %w", err)
 	}
 	
 	// Update state
 	state.LastSyncTime = time.Now()
-	state.LastKnownHash = calculateHash(finalContent)
+	state.LastKnownHash = calculateHash(sm.normalize(finalContent))
 	state.LastSyncBy = "pull"
 	
 	if err := sm.saveState(state); err != nil {
@@ -209,16 +246,25 @@ func (sm *SyncManager) GetConflictStats() (*SyncState, error) {
 	return sm.loadState()
 }
 
-// performPush handles the actual push operation
-func (sm *SyncManager) performPush(ctx context.Context, content string, encryptionKey []byte) error {
+// performPush handles the actual push operation.
+// The store is rejected if the remote secret is no longer at baseVersion ("" for a first push).
+func (sm *SyncManager) performPush(ctx context.Context, content string, encryptionKey []byte, baseVersion string) error {
 	// Encrypt content
-	encryptedContent, err := crypto.EncryptEnvContent([]byte(content), encryptionKey)
+	encryptedContent, err := sm.config.EncryptContent([]byte(content), encryptionKey)
 	if err != nil {
 		return fmt.Errorf("failed to encrypt content: %w", err)
 	}
 	
+	attrs, err := sm.config.SecretAttributes(time.Now())
+	if err != nil {
+		return err
+	}
+
 	// Store in vault
-	if err := sm.vaultClient.StoreSecret(ctx, sm.config.SecretName, encryptedContent); err != nil {
+	if err := sm.vaultClient.StoreSecretIfVersionBestEffort(ctx, sm.config.SecretName, encryptedContent, PushTags([]byte(content)), attrs, baseVersion); err != nil {
+		if errors.Is(err, vault.ErrConcurrentModification) {
+			return fmt.Errorf("someone else pushed while you were working; pull and try again: %w", err)
+		}
 		return fmt.Errorf("failed to store secret: %w", err)
 	}
 	
@@ -226,36 +272,33 @@ func (sm *SyncManager) performPush(ctx context.Context, content string, encrypti
 	return nil
 }
 
+// PushTags builds the audit tags stored alongside a pushed secret: who pushed it, from which
+// host, and a hash of the plaintext content.
+func PushTags(content []byte) map[string]string {
+	hostname, _ := os.Hostname()
+	return map[string]string{
+		vault.TagPushedBy:    auth.CurrentUser(),
+		vault.TagHostname:    hostname,
+		vault.TagContentHash: ContentHash(content),
+	}
+}
+
+// ContentHash returns the hex encoded SHA-256 hash of plaintext env content.
+func ContentHash(content []byte) string {
+	return calculateHash(string(content))
+}
+
+// normalize returns content as change detection sees it, honoring ignore_comments_for_sync
+func (sm *SyncManager) normalize(content string) string {
+	return NormalizeContent(content, sm.config.IgnoreCommentsForSync)
+}
+
 // loadState loads the sync state from disk
 func (sm *SyncManager) loadState() (*SyncState, error) {
-	data, err := os.ReadFile(sm.stateFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return &SyncState{}, nil // Return empty state for first time
-		}
-		return nil, err
-	}
-	
-	var state SyncState
-	if err := json.Unmarshal(data, &state); err != nil {
-		return nil, err
-	}
-	
-	return &state, nil
+	return LoadState(sm.stateFile)
 }
 
 // saveState saves the sync state to disk
 func (sm *SyncManager) saveState(state *SyncState) error {
-	data, err := json.MarshalIndent(state, "", "  ")
-	if err != nil {
-		return err
-	}
-	
-	// Ensure directory exists
-	dir := filepath.Dir(sm.stateFile)
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return err
-	}
-	
-	return os.WriteFile(sm.stateFile, data, 0600)
+	return SaveState(sm.stateFile, state, sm.config.StateFilePerm())
 }
\ No newline at end of file
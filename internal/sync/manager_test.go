@@ -0,0 +1,136 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lliamscholtz/env-sync/internal/config"
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+)
+
+func newTestSyncManager(t *testing.T, key []byte, local, remote, lastKnown string) (*SyncManager, *vault.FakeStore) {
+	t.Helper()
+	dir := t.TempDir()
+	cfg := &config.Config{EnvFile: filepath.Join(dir, ".env"), SecretName: "test-secret"}
+	if err := os.WriteFile(cfg.EnvFile, []byte(local), 0600); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	store := vault.NewFakeStore()
+	encrypted, err := crypto.EncryptEnvContent([]byte(remote), key)
+	if err != nil {
+		t.Fatalf("Failed to encrypt remote content: %v", err)
+	}
+	if err := store.StoreSecret(context.Background(), cfg.SecretName, encrypted, nil, vault.SecretAttributes{}); err != nil {
+		t.Fatalf("Failed to store remote content: %v", err)
+	}
+
+	sm := NewSyncManager(cfg, store, ConflictStrategyMerge, false)
+	if err := sm.saveState(&SyncState{LastKnownHash: lastKnown}); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+	return sm, store
+}
+
+func TestPushRemoteChangedOnly(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	synced := "KEY1=value1\nKEY2=value2\n"
+
+	t.Run("remote moved and local did not", func(t *testing.T) {
+		sm, store := newTestSyncManager(t, key, synced, "KEY1=value1\nKEY2=updated\n", calculateHash(synced))
+
+		err := sm.Push(context.Background(), key)
+		if !errors.Is(err, ErrRemoteChanged) {
+			t.Fatalf("Expected ErrRemoteChanged, got %v", err)
+		}
+		if store.Versions("test-secret") != 1 {
+			t.Errorf("Expected remote not to be overwritten, got %d versions", store.Versions("test-secret"))
+		}
+	})
+
+	t.Run("only local changed", func(t *testing.T) {
+		local := "KEY1=value1\nKEY2=local\n"
+		sm, store := newTestSyncManager(t, key, local, synced, calculateHash(synced))
+
+		if err := sm.Push(context.Background(), key); err != nil {
+			t.Fatalf("Expected push to succeed, got %v", err)
+		}
+		if store.Versions("test-secret") != 2 {
+			t.Fatalf("Expected one store, got %d versions", store.Versions("test-secret"))
+		}
+		secret, err := store.GetSecretWithProperties(context.Background(), "test-secret")
+		if err != nil {
+			t.Fatalf("Failed to get pushed secret: %v", err)
+		}
+		pushed, err := crypto.DecryptEnvContent(secret.Value, key)
+		if err != nil {
+			t.Fatalf("Failed to decrypt pushed content: %v", err)
+		}
+		if string(pushed) != local {
+			t.Errorf("Expected pushed content %q, got %q", local, pushed)
+		}
+		if got := secret.Tags[vault.TagContentHash]; got != ContentHash([]byte(local)) {
+			t.Errorf("Expected content hash tag %q, got %q", ContentHash([]byte(local)), got)
+		}
+		for _, tag := range []string{vault.TagPushedBy, vault.TagHostname} {
+			if _, ok := secret.Tags[tag]; !ok {
+				t.Errorf("Expected a %s tag, got %v", tag, secret.Tags)
+			}
+		}
+	})
+
+	t.Run("identical content is not pushed", func(t *testing.T) {
+		sm, store := newTestSyncManager(t, key, synced, synced, "")
+
+		if err := sm.Push(context.Background(), key); err != nil {
+			t.Fatalf("Expected push to succeed, got %v", err)
+		}
+		if store.Versions("test-secret") != 1 {
+			t.Errorf("Expected no store for unchanged content, got %d versions", store.Versions("test-secret"))
+		}
+	})
+
+	t.Run("no recorded state", func(t *testing.T) {
+		sm, store := newTestSyncManager(t, key, synced, "KEY1=value1\nKEY2=updated\n", "")
+
+		if err := sm.Push(context.Background(), key); err != nil {
+			t.Fatalf("Expected push to succeed without sync state, got %v", err)
+		}
+		if store.Versions("test-secret") != 2 {
+			t.Errorf("Expected one store, got %d versions", store.Versions("test-secret"))
+		}
+	})
+}
+
+func TestPushRemoteReadError(t *testing.T) {
+	key := make([]byte, 32)
+	for i := range key {
+		key[i] = byte(i + 1)
+	}
+	sm, store := newTestSyncManager(t, key, "KEY1=value1\n", "KEY1=value1\n", "")
+	sm.vaultClient = &failingStore{FakeStore: store, err: errors.New("403 Forbidden")}
+
+	if err := sm.Push(context.Background(), key); err == nil {
+		t.Fatal("Expected push to fail when the remote can't be read")
+	}
+	if store.Versions("test-secret") != 1 {
+		t.Errorf("Expected no store after a failed read, got %d versions", store.Versions("test-secret"))
+	}
+}
+
+// failingStore fails every read with err
+type failingStore struct {
+	*vault.FakeStore
+	err error
+}
+
+func (f *failingStore) GetSecretWithProperties(ctx context.Context, secretName string) (*vault.Secret, error) {
+	return nil, f.err
+}
@@ -0,0 +1,73 @@
+package sync
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// conflictMarkerPrefixes are the line prefixes left behind by the merge strategy
+var conflictMarkerPrefixes = []string{"<<<<<<<", "=======", ">>>>>>>"}
+
+// mergeConflictValue is the value the merge strategy writes for a conflicting key, e.g. KEY=<<<<<<< LOCAL
+const mergeConflictValue = "<<<<<<< LOCAL"
+
+// privateKeyMarker appears in the header of PEM encoded private keys
+const privateKeyMarker = "PRIVATE KEY-----"
+
+// UnsafeContentError reports .env content that should not be pushed as-is.
+type UnsafeContentError struct {
+	Problems []string
+}
+
+func (e *UnsafeContentError) Error() string {
+	return fmt.Sprintf("refusing to push: %s", strings.Join(e.Problems, "; "))
+}
+
+// CheckPushContent scans .env content for signs that it is broken or leaks key material:
+// leftover conflict markers, bare PEM private key blocks, and the encryption key itself.
+// It returns an *UnsafeContentError describing every problem found, or nil.
+func CheckPushContent(content string, key []byte) error {
+	var problems []string
+
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// Markers start a line of their own, except the opening one, which the merge strategy
+		// writes as the value. Other values that merely begin with '=' or '<' are legitimate.
+		for _, prefix := range conflictMarkerPrefixes {
+			if strings.HasPrefix(trimmed, prefix) {
+				problems = append(problems, fmt.Sprintf("line %d contains an unresolved conflict marker '%s'", i+1, prefix))
+				break
+			}
+		}
+		if _, after, found := strings.Cut(trimmed, "="); found && !strings.HasPrefix(trimmed, "=") {
+			if strings.Trim(strings.TrimSpace(after), `"'`) == mergeConflictValue {
+				problems = append(problems, fmt.Sprintf("line %d contains an unresolved conflict marker '%s'", i+1, conflictMarkerPrefixes[0]))
+			}
+		}
+
+		// A key block on its own line means a multi-line value was pasted without quoting
+		if strings.HasPrefix(trimmed, "-----BEGIN") && strings.Contains(trimmed, privateKeyMarker) {
+			problems = append(problems, fmt.Sprintf("line %d contains an unquoted private key block", i+1))
+		}
+	}
+
+	if len(key) > 0 {
+		for _, encoded := range []string{base64.StdEncoding.EncodeToString(key), hex.EncodeToString(key)} {
+			if strings.Contains(content, encoded) {
+				problems = append(problems, "content contains the env-sync encryption key in plaintext")
+				break
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &UnsafeContentError{Problems: problems}
+	}
+	return nil
+}
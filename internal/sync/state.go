@@ -0,0 +1,159 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/config"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+)
+
+// SyncState tracks the last known state for conflict detection
+type SyncState struct {
+	LastSyncTime  time.Time         `json:"last_sync_time"`
+	LastKnownHash string            `json:"last_known_hash"`
+	LastSyncBy    string            `json:"last_sync_by"`
+	ConflictCount int               `json:"conflict_count"`
+	KnownHashes   map[string]string `json:"known_hashes,omitempty"` // Content hash per secret at its last push or pull
+}
+
+// StateFileName is the name of the sync state file kept alongside env files.
+const StateFileName = ".env-sync-state.json"
+
+// StatePath returns the sync state file kept alongside an env file. When the env file's directory
+// isn't writable and holds no state yet, the state is kept under $XDG_STATE_HOME/env-sync instead.
+func StatePath(envFile string) string {
+	dir := filepath.Dir(envFile)
+	path := filepath.Join(dir, StateFileName)
+	if _, err := os.Stat(path); err == nil || dirWritable(dir) {
+		return path
+	}
+	if fallback, err := xdgStatePath(dir); err == nil {
+		return fallback
+	}
+	return path
+}
+
+// ConfiguredStatePath returns cfg's state_file if set, and otherwise StatePath(envFile). One state
+// file can serve every mapping, since it records a hash per secret.
+func ConfiguredStatePath(cfg *config.Config, envFile string) string {
+	if cfg.StateFile != "" {
+		return cfg.StateFile
+	}
+	return StatePath(envFile)
+}
+
+// xdgStatePath returns a state file under $XDG_STATE_HOME (default ~/.local/state) that is unique
+// to dir, since every directory whose env files can't have state next to them shares the base
+func xdgStatePath(dir string) (string, error) {
+	base := os.Getenv("XDG_STATE_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		base = filepath.Join(home, ".local", "state")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(absDir))
+	return filepath.Join(base, "env-sync", hex.EncodeToString(sum[:8])+"-state.json"), nil
+}
+
+// dirWritable reports whether a file can be created in dir
+func dirWritable(dir string) bool {
+	probe, err := os.CreateTemp(dir, ".env-sync-probe-*")
+	if err != nil {
+		return false
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return true
+}
+
+// LoadState reads the sync state at path. A missing file yields an empty state.
+func LoadState(path string) (*SyncState, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &SyncState{}, nil // Return empty state for first time
+		}
+		return nil, err
+	}
+
+	var state SyncState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// SaveState writes the sync state to path with mode, creating its directory if needed.
+func SaveState(path string, state *SyncState, mode os.FileMode) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// Ensure directory exists
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return utils.WriteFileMode(path, data, mode)
+}
+
+// KnownHash returns the content hash recorded for secretName at its last push or pull, or "".
+func (s *SyncState) KnownHash(secretName string) string {
+	return s.KnownHashes[secretName]
+}
+
+// RecordSync notes that content was pushed to or pulled from secretName.
+func (s *SyncState) RecordSync(secretName, content, by string) {
+	if s.KnownHashes == nil {
+		s.KnownHashes = make(map[string]string)
+	}
+	s.KnownHashes[secretName] = calculateHash(content)
+	s.LastSyncTime = time.Now()
+	s.LastSyncBy = by
+}
+
+// RecordSyncState updates the state file at path, written with mode, after a push or pull of secretName.
+func RecordSyncState(path string, mode os.FileMode, secretName, content, by string) error {
+	state, err := LoadState(path)
+	if err != nil {
+		return fmt.Errorf("failed to load sync state '%s': %w", path, err)
+	}
+	state.RecordSync(secretName, content, by)
+	if err := SaveState(path, state, mode); err != nil {
+		return fmt.Errorf("failed to save sync state '%s': %w", path, err)
+	}
+	return nil
+}
+
+// CheckRemoteChanged returns ErrRemoteChanged when the remote moved away from
+// the content last synced (lastKnownHash) while the local content did not, so pushing would
+// silently discard someone else's changes.
+func CheckRemoteChanged(localContent, remoteContent, lastKnownHash string) error {
+	if remoteChangedOnly(localContent, remoteContent, lastKnownHash) {
+		return ErrRemoteChanged
+	}
+	return nil
+}
+
+// remoteChangedOnly reports whether the remote moved away from the last synced content while the local file did not.
+// Without a recorded hash there is nothing to compare against, so it returns false.
+func remoteChangedOnly(localContent, remoteContent, lastKnownHash string) bool {
+	if lastKnownHash == "" {
+		return false
+	}
+	return calculateHash(localContent) == lastKnownHash && calculateHash(remoteContent) != lastKnownHash
+}
@@ -0,0 +1,74 @@
+package sync
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lliamscholtz/env-sync/internal/config"
+)
+
+func TestStatePath(t *testing.T) {
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, ".env")
+	if got := StatePath(envFile); got != filepath.Join(dir, StateFileName) {
+		t.Errorf("Expected the state next to the env file, got %s", got)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected the writability probe to be removed, found %v", entries)
+	}
+
+	stateFile := filepath.Join(t.TempDir(), "state", "env-sync.json")
+	cfg := &config.Config{StateFile: stateFile}
+	if got := ConfiguredStatePath(cfg, envFile); got != stateFile {
+		t.Errorf("Expected state_file to be used, got %s", got)
+	}
+	if got := ConfiguredStatePath(&config.Config{}, envFile); got != StatePath(envFile) {
+		t.Errorf("Expected the default without state_file, got %s", got)
+	}
+
+	// Parent directories of state_file are created on first save
+	if err := RecordSyncState(stateFile, 0600, "app-env", "KEY=value\n", "pull"); err != nil {
+		t.Fatalf("Failed to record state: %v", err)
+	}
+	state, err := LoadState(stateFile)
+	if err != nil || state.KnownHash("app-env") == "" {
+		t.Errorf("Expected the recorded hash in state_file, got %v, %v", state, err)
+	}
+}
+
+func TestStatePathFallsBackToXDG(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("directory permissions aren't enforced here")
+	}
+	stateHome := t.TempDir()
+	t.Setenv("XDG_STATE_HOME", stateHome)
+
+	dir := t.TempDir()
+	if err := os.Chmod(dir, 0500); err != nil {
+		t.Fatalf("Failed to make directory read-only: %v", err)
+	}
+	t.Cleanup(func() { os.Chmod(dir, 0700) })
+
+	path := StatePath(filepath.Join(dir, ".env"))
+	if !strings.HasPrefix(path, filepath.Join(stateHome, "env-sync")+string(filepath.Separator)) {
+		t.Errorf("Expected a state file under XDG_STATE_HOME, got %s", path)
+	}
+	if other := StatePath(filepath.Join(t.TempDir(), "ro", ".env")); other == path {
+		t.Errorf("Expected directories to get separate state files")
+	}
+}
+
+func TestXDGStatePath(t *testing.T) {
+	t.Setenv("XDG_STATE_HOME", "/state")
+	first, err := xdgStatePath("/srv/app")
+	if err != nil {
+		t.Fatalf("xdgStatePath failed: %v", err)
+	}
+	second, _ := xdgStatePath("/srv/other")
+	if filepath.Dir(first) != filepath.Join("/state", "env-sync") || first == second {
+		t.Errorf("Expected distinct files under /state/env-sync, got %s and %s", first, second)
+	}
+}
@@ -2,22 +2,101 @@ package utils
 
 import (
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
 	
 	"github.com/fatih/color"
 )
 
-// PrintSuccess prints a success message.
-func PrintSuccess(format string, a ...interface{}) {
+// outputMu keeps messages from concurrent operations from interleaving mid-line.
+var outputMu sync.Mutex
+
+// lockOutput takes the output lock and clears any active progress line.
+// The returned function redraws the progress line and releases the lock.
+func lockOutput() func() {
+	outputMu.Lock()
+	if activeProgress != nil {
+		activeProgress.clear()
+	}
+	return func() {
+		if activeProgress != nil {
+			activeProgress.render()
+		}
+		outputMu.Unlock()
+	}
+}
+
+// messagesToStderr routes success, info and warning messages to stderr.
+var messagesToStderr bool
+
+// SetMessagesToStderr routes success, info and warning messages to stderr instead of stdout,
+// keeping stdout clean for piped output such as 'pull --stdout'.
+func SetMessagesToStderr(enabled bool) {
+	messagesToStderr = enabled
+}
+
+// messageColors maps the level of a success, info or warning message to its color
+var messageColors = map[slog.Level]color.Attribute{
+	levelSuccess:   color.FgGreen,
+	slog.LevelInfo: color.FgBlue,
+	slog.LevelWarn: color.FgYellow,
+}
+
+// printMessage prints a success, info or warning message to the message output, or the logger.
+// Like color.Green and friends, a newline is appended to colored messages that lack one.
+func printMessage(level slog.Level, fields Fields, format string, a ...interface{}) {
+	defer lockOutput()()
+	if logger != nil {
+		logMessage(level, fields, formatMessage(format, a))
+		return
+	}
 	if os.Getenv("TESTING") == "1" {
-		fmt.Fprintf(os.Stdout, format, a...)
+		out := os.Stdout
+		if messagesToStderr {
+			out = os.Stderr
+		}
+		fmt.Fprintf(out, format, a...)
+		return
+	}
+
+	var out io.Writer = color.Output
+	if messagesToStderr {
+		out = color.Error
+	}
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+	c := color.New(messageColors[level])
+	if len(a) == 0 {
+		c.Fprint(out, format)
 	} else {
-		color.Green(format, a...)
+		c.Fprintf(out, format, a...)
+	}
+}
+
+// PrintSuccess prints a success message.
+func PrintSuccess(format string, a ...interface{}) {
+	if IsQuiet() {
+		return
 	}
+	printMessage(levelSuccess, nil, format, a...)
 }
 
 // PrintError prints an error message and exits.
 func PrintError(format string, a ...interface{}) {
+	printError(nil, format, a...)
+}
+
+// printError prints an error message to stderr, or the logger
+func printError(fields Fields, format string, a ...interface{}) {
+	defer lockOutput()()
+	if logger != nil {
+		logMessage(slog.LevelError, fields, formatMessage(format, a))
+		return
+	}
 	if os.Getenv("TESTING") == "1" {
 		fmt.Fprintf(os.Stderr, format, a...)
 	} else {
@@ -27,18 +106,13 @@ func PrintError(format string, a ...interface{}) {
 
 // PrintInfo prints an informational message.
 func PrintInfo(format string, a ...interface{}) {
-	if os.Getenv("TESTING") == "1" {
-		fmt.Fprintf(os.Stdout, format, a...)
-	} else {
-		color.Blue(format, a...)
+	if IsQuiet() {
+		return
 	}
+	printMessage(slog.LevelInfo, nil, format, a...)
 }
 
 // PrintWarning prints a warning message.
 func PrintWarning(format string, a ...interface{}) {
-	if os.Getenv("TESTING") == "1" {
-		fmt.Fprintf(os.Stdout, format, a...)
-	} else {
-		color.Yellow(format, a...)
-	}
+	printMessage(slog.LevelWarn, nil, format, a...)
 }
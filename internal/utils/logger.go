@@ -0,0 +1,120 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"unicode"
+)
+
+// Logger receives every message the Print functions emit, once the log level has let it through.
+// fields are alternating keys and values, as for slog.Logger.Log.
+type Logger interface {
+	Log(level slog.Level, message string, fields ...any)
+}
+
+// logger replaces the colored output when set
+var logger Logger
+
+// SetLogger routes the Print functions through l. A nil Logger restores the colored output.
+func SetLogger(l Logger) {
+	logger = l
+}
+
+// LogFormats lists the formats accepted by SetLogFormat.
+var LogFormats = []string{"text", "json"}
+
+// SetLogFormat selects how the Print functions emit messages: "text" for the colored output, or
+// "json" for one JSON record per message, with its level and fields, written to w.
+func SetLogFormat(format string, w io.Writer) error {
+	switch format {
+	case "", "text":
+		SetLogger(nil)
+	case "json":
+		SetLogger(NewSlogLogger(slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	default:
+		return fmt.Errorf("unknown log format '%s': expected one of %s", format, strings.Join(LogFormats, ", "))
+	}
+	return nil
+}
+
+// slogLogger is a Logger writing records to a slog.Handler
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger writing records to handler. The Print functions already filter
+// by log level, so handler should accept slog.LevelDebug.
+func NewSlogLogger(handler slog.Handler) Logger {
+	return slogLogger{logger: slog.New(handler)}
+}
+
+func (l slogLogger) Log(level slog.Level, message string, fields ...any) {
+	l.logger.Log(context.Background(), level, message, fields...)
+}
+
+// Fields attaches structured fields, such as the secret name or env file a message is about, to
+// the messages printed through it. The colored output ignores them.
+type Fields []any
+
+// With returns fields to print messages with, as alternating keys and values:
+//
+//	utils.With("secret", mapping.SecretName, "file", mapping.EnvFile).PrintSuccess("✅ Pushed\n")
+func With(fields ...any) Fields {
+	return Fields(fields)
+}
+
+// PrintSuccess prints a success message with the fields.
+func (f Fields) PrintSuccess(format string, a ...interface{}) {
+	if IsQuiet() {
+		return
+	}
+	printMessage(levelSuccess, f, format, a...)
+}
+
+// PrintInfo prints an informational message with the fields.
+func (f Fields) PrintInfo(format string, a ...interface{}) {
+	if IsQuiet() {
+		return
+	}
+	printMessage(slog.LevelInfo, f, format, a...)
+}
+
+// PrintWarning prints a warning message with the fields.
+func (f Fields) PrintWarning(format string, a ...interface{}) {
+	printMessage(slog.LevelWarn, f, format, a...)
+}
+
+// PrintError prints an error message with the fields.
+func (f Fields) PrintError(format string, a ...interface{}) {
+	printError(f, format, a...)
+}
+
+// levelSuccess is the level of success messages. slog has no success level, so they are logged
+// as info and marked with a field instead.
+const levelSuccess = slog.LevelInfo + 1
+
+// logMessage sends a formatted message to the logger, without the leading emoji and trailing
+// newline that only make sense in the colored output
+func logMessage(level slog.Level, fields Fields, message string) {
+	message = strings.TrimLeftFunc(message, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.Is(unicode.So, r) || unicode.IsMark(r) || r == '‍'
+	})
+	message = strings.TrimRightFunc(message, unicode.IsSpace)
+	if level == levelSuccess {
+		level = slog.LevelInfo
+		fields = append(fields[:len(fields):len(fields)], "success", true)
+	}
+	logger.Log(level, message, fields...)
+}
+
+// formatMessage formats a message like the colored output does: a format without arguments
+// is printed verbatim
+func formatMessage(format string, a []interface{}) string {
+	if len(a) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, a...)
+}
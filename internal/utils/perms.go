@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"os"
+	"runtime"
+)
+
+// SecretFileMode is the mode secret files are restricted to: readable and writable by the owner only.
+const SecretFileMode os.FileMode = 0600
+
+// CheckSecretFilePermissions warns when a file holding secrets can be read or written by other
+// users, and restricts it to SecretFileMode instead when fix is set. It reports whether the file
+// was left with insecure permissions. Missing files are ignored, and on Windows, where Unix modes
+// don't reflect ACLs, nothing is checked.
+func CheckSecretFilePermissions(path string, fix bool) bool {
+	return CheckFilePermissions(path, SecretFileMode, fix)
+}
+
+// CheckFilePermissions is CheckSecretFilePermissions for files allowed a configured mode: it
+// warns about permissions beyond allowed, and restricts the file to allowed when fix is set.
+func CheckFilePermissions(path string, allowed os.FileMode, fix bool) bool {
+	if runtime.GOOS == "windows" {
+		PrintDebug("🐛 Skipping the permission check of '%s' on Windows\n", path)
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	mode := info.Mode().Perm()
+	if mode&^allowed == 0 {
+		return false
+	}
+
+	if !fix {
+		PrintWarning("⚠️ '%s' is accessible by other users (mode %04o); run with --fix-perms to restrict it to %04o.\n", path, mode, allowed)
+		return true
+	}
+	if err := os.Chmod(path, allowed); err != nil {
+		PrintWarning("⚠️ Failed to restrict the permissions of '%s' (mode %04o): %v\n", path, mode, err)
+		return true
+	}
+	PrintSuccess("🔐 Restricted the permissions of '%s' from %04o to %04o.\n", path, mode, allowed)
+	return false
+}
+
+// WriteFileMode writes data to path and gives it mode, including when the file already existed,
+// which os.WriteFile would leave with its old permissions.
+func WriteFileMode(path string, data []byte, mode os.FileMode) error {
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return err
+	}
+	return os.Chmod(path, mode)
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSecretFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix file modes aren't checked on Windows")
+	}
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, os.WriteFile(path, []byte("KEY=value\n"), 0600))
+	assert.False(t, CheckSecretFilePermissions(path, false))
+
+	for _, mode := range []os.FileMode{0644, 0640, 0660, 0606} {
+		assert.NoError(t, os.Chmod(path, mode))
+		assert.True(t, CheckSecretFilePermissions(path, false), "mode %04o", mode)
+		info, _ := os.Stat(path)
+		assert.Equal(t, mode, info.Mode().Perm(), "the mode is left alone without fix")
+	}
+
+	assert.False(t, CheckSecretFilePermissions(path, true))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, SecretFileMode, info.Mode().Perm())
+
+	assert.False(t, CheckSecretFilePermissions(filepath.Join(t.TempDir(), "missing"), false))
+}
+
+func TestCheckFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix file modes aren't checked on Windows")
+	}
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, WriteFileMode(path, []byte("KEY=value\n"), 0640))
+	assert.False(t, CheckFilePermissions(path, 0640, false))
+	assert.False(t, CheckFilePermissions(path, 0660, false), "a more restrictive mode is fine")
+	assert.True(t, CheckFilePermissions(path, 0600, false))
+
+	assert.NoError(t, os.Chmod(path, 0644))
+	assert.False(t, CheckFilePermissions(path, 0640, true))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func TestWriteFileMode(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix file modes don't apply on Windows")
+	}
+	path := filepath.Join(t.TempDir(), ".env")
+	assert.NoError(t, os.WriteFile(path, []byte("OLD=value\n"), 0644))
+
+	// Existing files get the mode too, unlike with os.WriteFile
+	assert.NoError(t, WriteFileMode(path, []byte("KEY=value\n"), 0600))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, SecretFileMode, info.Mode().Perm())
+	data, _ := os.ReadFile(path)
+	assert.Equal(t, "KEY=value\n", string(data))
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// activeProgress is the interactive progress line currently drawn, if any.
+// It is guarded by outputMu.
+var activeProgress *Progress
+
+// progressBarWidth is the number of cells in an interactive progress bar.
+const progressBarWidth = 20
+
+// Progress reports completion of a fixed number of steps.
+// On a terminal it draws a single updating bar; otherwise it prints "N/M done" lines.
+// It is silent when TESTING=1 or in quiet mode, and safe for concurrent use.
+type Progress struct {
+	label       string
+	total       int
+	done        int
+	out         io.Writer
+	interactive bool
+	disabled    bool
+}
+
+// NewProgress starts a progress indicator for total steps.
+func NewProgress(label string, total int) *Progress {
+	p := &Progress{
+		label:       label,
+		total:       total,
+		out:         os.Stderr,
+		interactive: term.IsTerminal(int(os.Stderr.Fd())),
+		disabled:    os.Getenv("TESTING") == "1" || IsQuiet() || total <= 0,
+	}
+
+	if p.disabled || !p.interactive {
+		return p
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	activeProgress = p
+	p.render()
+	return p
+}
+
+// Increment marks one more step as done.
+func (p *Progress) Increment() {
+	if p.disabled {
+		return
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if p.done < p.total {
+		p.done++
+	}
+	if p.interactive {
+		p.render()
+	} else {
+		fmt.Fprintf(p.out, "%s: %d/%d done\n", p.label, p.done, p.total)
+	}
+}
+
+// Finish ends the progress indicator, leaving the final state on screen.
+func (p *Progress) Finish() {
+	if p.disabled || !p.interactive {
+		return
+	}
+
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if activeProgress == p {
+		p.render()
+		fmt.Fprintln(p.out)
+		activeProgress = nil
+	}
+}
+
+// render draws the progress line. Callers must hold outputMu.
+func (p *Progress) render() {
+	filled := progressBarWidth * p.done / p.total
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", progressBarWidth-filled)
+	fmt.Fprintf(p.out, "\r\033[K⏳ %s [%s] %d/%d", p.label, bar, p.done, p.total)
+}
+
+// clear erases the progress line. Callers must hold outputMu.
+func (p *Progress) clear() {
+	fmt.Fprint(p.out, "\r\033[K")
+}
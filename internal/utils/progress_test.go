@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgressNonInteractive(t *testing.T) {
+	var buf bytes.Buffer
+	p := &Progress{label: "Pushing", total: 3, out: &buf}
+
+	p.Increment()
+	p.Increment()
+	p.Increment()
+	p.Increment() // Extra increments are capped at the total
+	p.Finish()
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Equal(t, []string{
+		"Pushing: 1/3 done",
+		"Pushing: 2/3 done",
+		"Pushing: 3/3 done",
+		"Pushing: 3/3 done",
+	}, lines)
+}
+
+func TestProgressInteractive(t *testing.T) {
+	var buf bytes.Buffer
+	p := &Progress{label: "Pulling", total: 2, out: &buf, interactive: true}
+	activeProgress = p
+	defer func() { activeProgress = nil }()
+
+	p.Increment()
+	assert.Contains(t, buf.String(), "Pulling")
+	assert.Contains(t, buf.String(), "1/2")
+
+	p.Finish()
+	assert.True(t, strings.HasSuffix(buf.String(), "\n"))
+	assert.Nil(t, activeProgress)
+}
+
+func TestProgressDisabledInTests(t *testing.T) {
+	t.Setenv("TESTING", "1")
+
+	p := NewProgress("Rotating", 5)
+	p.Increment()
+	p.Finish()
+
+	assert.True(t, p.disabled)
+	assert.Nil(t, activeProgress)
+}
@@ -0,0 +1,80 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// minRevealLength is the shortest value whose first and last characters Redact will show
+const minRevealLength = 8
+
+// Redact returns a representation of a secret value that is safe to print:
+// only its length and, for longer values, its first and last characters.
+func Redact(value string) string {
+	runes := []rune(value)
+	switch {
+	case len(runes) == 0:
+		return "<empty>"
+	case len(runes) < minRevealLength:
+		return fmt.Sprintf("*** (%d chars)", len(runes))
+	default:
+		return fmt.Sprintf("%c***%c (%d chars)", runes[0], runes[len(runes)-1], len(runes))
+	}
+}
+
+// minBlobClassChanges is the share of adjacent characters in a run matched by blobPattern that
+// must change between upper case, lower case, digits and symbols for RedactSecrets to mask it.
+// Encoded random bytes change class about two thirds of the time; identifiers such as
+// TestPushMappingContent2022741822 and path segments far less often.
+const minBlobClassChanges = 0.45
+
+var (
+	// blobPattern matches runs of base64, base64url or hex characters long enough to hold a key
+	blobPattern = regexp.MustCompile(`[A-Za-z0-9+/_-]{32,}={0,2}`)
+	// secretAssignmentPattern matches NAME=value and name: value where the name ends in key,
+	// secret, token, password or passwd, such as ENVSYNC_ENCRYPTION_KEY=... or client_secret: ...
+	secretAssignmentPattern = regexp.MustCompile(`(?i)\b(\w*(?:key|secret|token|password|passwd))(\s*[=:]\s*)("[^"]*"|'[^']*'|[^\s,;]+)`)
+)
+
+// RedactSecrets masks what looks like key material in a message: the values of key, secret,
+// token and password assignments, and long base64 or hex strings such as encrypted blobs and
+// encoded keys. It is a safety net for debug output and can mask harmless values or miss short
+// secrets; pass values known to be sensitive through Redact instead.
+func RedactSecrets(message string) string {
+	message = secretAssignmentPattern.ReplaceAllStringFunc(message, func(match string) string {
+		parts := secretAssignmentPattern.FindStringSubmatch(match)
+		return parts[1] + parts[2] + Redact(parts[3])
+	})
+	return blobPattern.ReplaceAllStringFunc(message, func(match string) string {
+		if classChanges(match) < minBlobClassChanges {
+			return match
+		}
+		return fmt.Sprintf("<redacted %d chars>", len(match))
+	})
+}
+
+// classChanges returns the share of adjacent characters in s that differ in character class
+func classChanges(s string) float64 {
+	if len(s) < 2 {
+		return 0
+	}
+	class := func(c byte) int {
+		switch {
+		case c >= 'A' && c <= 'Z':
+			return 0
+		case c >= 'a' && c <= 'z':
+			return 1
+		case c >= '0' && c <= '9':
+			return 2
+		default:
+			return 3
+		}
+	}
+	changes := 0
+	for i := 1; i < len(s); i++ {
+		if class(s[i]) != class(s[i-1]) {
+			changes++
+		}
+	}
+	return float64(changes) / float64(len(s)-1)
+}
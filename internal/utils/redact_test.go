@@ -0,0 +1,41 @@
+package utils
+
+import "testing"
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"", "<empty>"},
+		{"abc", "*** (3 chars)"},
+		{"supersecret", "s***t (11 chars)"},
+		{"pässwörter", "p***r (10 chars)"},
+	}
+
+	for _, tt := range tests {
+		if got := Redact(tt.value); got != tt.expected {
+			t.Errorf("Redact(%q) = %q, expected %q", tt.value, got, tt.expected)
+		}
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	tests := []struct {
+		message  string
+		expected string
+	}{
+		{"Watching /tmp/TestPushMappingSkipsIdenticalContent2022741822/001/.env\n", "Watching /tmp/TestPushMappingSkipsIdenticalContent2022741822/001/.env\n"},
+		{"blob: 7lrfmyi8MqdLt9WGjw7PrHmCLnx3SBP/ah3c5UFG6S4= stored", "blob: <redacted 44 chars> stored"},
+		{"hex 9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08", "hex <redacted 64 chars>"},
+		{"ENVSYNC_ENCRYPTION_KEY=supersecret", "ENVSYNC_ENCRYPTION_KEY=s***t (11 chars)"},
+		{`client_secret: "abc", secret_name: app-env`, `client_secret: *** (5 chars), secret_name: app-env`},
+		{"Token expires at 2030-01-01T00:00:00Z", "Token expires at 2030-01-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		if got := RedactSecrets(tt.message); got != tt.expected {
+			t.Errorf("RedactSecrets(%q) = %q, expected %q", tt.message, got, tt.expected)
+		}
+	}
+}
@@ -2,30 +2,102 @@ package utils
 
 import (
 	"fmt"
+	"log/slog"
 	"os"
 
 	"github.com/fatih/color"
+	"golang.org/x/term"
 )
 
-var debugMode bool
+// LogLevel controls which messages the Print functions emit.
+type LogLevel int
+
+const (
+	// LogLevelQuiet emits only warnings and errors.
+	LogLevelQuiet LogLevel = iota
+	// LogLevelNormal also emits info and success messages.
+	LogLevelNormal
+	// LogLevelDebug also emits debug messages.
+	LogLevelDebug
+)
+
+var logLevel = LogLevelNormal
+
+// SetLogLevel sets the shared log level used by the Print functions.
+func SetLogLevel(level LogLevel) {
+	logLevel = level
+}
+
+// GetLogLevel returns the shared log level.
+func GetLogLevel() LogLevel {
+	return logLevel
+}
+
+// IsQuiet returns true if info and success messages are suppressed.
+func IsQuiet() bool {
+	return logLevel < LogLevelNormal
+}
 
 // IsDebug returns true if the ENVSYNC_DEBUG environment variable is set or debug mode is enabled.
 func IsDebug() bool {
-	return debugMode || os.Getenv("ENVSYNC_DEBUG") != ""
+	return logLevel >= LogLevelDebug || os.Getenv("ENVSYNC_DEBUG") != ""
 }
 
 // SetDebugMode enables or disables debug mode programmatically.
 func SetDebugMode(enabled bool) {
-	debugMode = enabled
+	if enabled {
+		logLevel = LogLevelDebug
+	} else if logLevel == LogLevelDebug {
+		logLevel = LogLevelNormal
+	}
+}
+
+// ConfigureColor disables colored output globally when disabled is true,
+// the NO_COLOR environment variable is set, or stdout is not a terminal.
+func ConfigureColor(disabled bool) {
+	color.NoColor = disabled ||
+		os.Getenv("NO_COLOR") != "" ||
+		os.Getenv("TERM") == "dumb" ||
+		!term.IsTerminal(int(os.Stdout.Fd()))
 }
 
-// PrintDebug prints a debug message if debugging is enabled.
+// ColorEnabled returns true if the Print functions emit colored output.
+func ColorEnabled() bool {
+	return !color.NoColor
+}
+
+// PrintDebug prints a debug message if debugging is enabled. Long base64 or hex strings and
+// the values of key, secret, token and password assignments are masked with RedactSecrets, since
+// debug output is often shared when reporting issues.
 func PrintDebug(format string, a ...interface{}) {
 	if IsDebug() {
-		if os.Getenv("TESTING") == "1" {
-			fmt.Fprintf(os.Stderr, "DEBUG: "+format, a...)
-		} else {
-			color.Yellow("DEBUG: "+format, a...)
+		printDebug(RedactSecrets(fmt.Sprintf(format, a...)))
+	}
+}
+
+// DebugRedacted prints a debug message like PrintDebug, with every argument replaced by what
+// Redact shows of it. Use it, with %s verbs, for values known to be sensitive that the automatic
+// masking could miss, such as short passwords.
+func DebugRedacted(format string, a ...interface{}) {
+	if IsDebug() {
+		redacted := make([]interface{}, len(a))
+		for i, arg := range a {
+			redacted[i] = Redact(fmt.Sprint(arg))
 		}
+		printDebug(RedactSecrets(fmt.Sprintf(format, redacted...)))
 	}
-} 
\ No newline at end of file
+}
+
+// printDebug prints an already formatted debug message
+func printDebug(message string) {
+	defer lockOutput()()
+	if logger != nil {
+		logMessage(slog.LevelDebug, nil, message)
+		return
+	}
+	if os.Getenv("TESTING") == "1" {
+		fmt.Fprint(os.Stderr, "DEBUG: "+message)
+	} else {
+		color.Yellow("DEBUG: " + message) // Printed verbatim: color only formats when given arguments
+	}
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"strings"
 	"testing"
@@ -117,6 +118,27 @@ func TestPrintDebug(t *testing.T) {
 		assert.Contains(t, output, "Debug message: test")
 	})
 
+	t.Run("redacts secrets", func(t *testing.T) {
+		t.Setenv("ENVSYNC_DEBUG", "1")
+
+		// Capture stderr
+		oldStderr := os.Stderr
+		r, w, _ := os.Pipe()
+		os.Stderr = w
+
+		PrintDebug("Loaded key %s\n", "7lrfmyi8MqdLt9WGjw7PrHmCLnx3SBP/ah3c5UFG6S4=")
+		DebugRedacted("Password %s for %s\n", "hunter2", "admin")
+
+		w.Close()
+		os.Stderr = oldStderr
+
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		output := buf.String()
+
+		assert.Equal(t, "DEBUG: Loaded key <redacted 44 chars>\nDEBUG: Password *** (7 chars) for *** (5 chars)\n", output)
+	})
+
 	t.Run("debug disabled", func(t *testing.T) {
 		// Disable debug
 		oldDebugEnv := os.Getenv("ENVSYNC_DEBUG")
@@ -140,4 +162,134 @@ func TestPrintDebug(t *testing.T) {
 		// Should be empty when debug is disabled
 		assert.Empty(t, strings.TrimSpace(output))
 	})
-} 
\ No newline at end of file
+}
+func TestLogLevel(t *testing.T) {
+	oldTestingEnv := os.Getenv("TESTING")
+	os.Setenv("TESTING", "1")
+	defer os.Setenv("TESTING", oldTestingEnv)
+	defer SetLogLevel(LogLevelNormal)
+
+	capture := func(fn func()) string {
+		oldStdout, oldStderr := os.Stdout, os.Stderr
+		r, w, _ := os.Pipe()
+		os.Stdout, os.Stderr = w, w
+		fn()
+		w.Close()
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		var buf bytes.Buffer
+		buf.ReadFrom(r)
+		return buf.String()
+	}
+
+	t.Run("quiet suppresses info and success", func(t *testing.T) {
+		SetLogLevel(LogLevelQuiet)
+		output := capture(func() {
+			PrintInfo("info message")
+			PrintSuccess("success message")
+			PrintWarning("warning message")
+			PrintError("error message")
+		})
+		assert.NotContains(t, output, "info message")
+		assert.NotContains(t, output, "success message")
+		assert.Contains(t, output, "warning message")
+		assert.Contains(t, output, "error message")
+	})
+
+	t.Run("debug enables debug output", func(t *testing.T) {
+		t.Setenv("ENVSYNC_DEBUG", "")
+		SetLogLevel(LogLevelDebug)
+		assert.True(t, IsDebug())
+		output := capture(func() { PrintDebug("debug message") })
+		assert.Contains(t, output, "DEBUG: debug message")
+
+		SetLogLevel(LogLevelNormal)
+		assert.False(t, IsDebug())
+	})
+}
+
+func TestConfigureColor(t *testing.T) {
+	defer ConfigureColor(false)
+
+	t.Run("flag disables color", func(t *testing.T) {
+		ConfigureColor(true)
+		assert.False(t, ColorEnabled())
+	})
+
+	t.Run("NO_COLOR disables color", func(t *testing.T) {
+		t.Setenv("NO_COLOR", "1")
+		ConfigureColor(false)
+		assert.False(t, ColorEnabled())
+	})
+}
+
+func TestSetMessagesToStderr(t *testing.T) {
+	oldTestingEnv := os.Getenv("TESTING")
+	os.Setenv("TESTING", "1")
+	defer os.Setenv("TESTING", oldTestingEnv)
+
+	SetMessagesToStderr(true)
+	defer SetMessagesToStderr(false)
+
+	// Capture stdout and stderr
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	rOut, wOut, _ := os.Pipe()
+	rErr, wErr, _ := os.Pipe()
+	os.Stdout, os.Stderr = wOut, wErr
+
+	PrintSuccess("Test success\n")
+	PrintInfo("Test info\n")
+	PrintWarning("Test warning\n")
+
+	wOut.Close()
+	wErr.Close()
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+
+	var stdout, stderr bytes.Buffer
+	stdout.ReadFrom(rOut)
+	stderr.ReadFrom(rErr)
+
+	assert.Empty(t, stdout.String())
+	assert.Contains(t, stderr.String(), "Test success")
+	assert.Contains(t, stderr.String(), "Test info")
+	assert.Contains(t, stderr.String(), "Test warning")
+}
+
+func TestJSONLogFormat(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, SetLogFormat("json", &buf))
+	defer SetLogger(nil)
+	defer SetLogLevel(LogLevelNormal)
+
+	With("secret", "myapp-env", "file", ".env").PrintSuccess("✅ Pulled '%s'\n", ".env")
+	PrintWarning("⚠️ Careful\n")
+	PrintError("❌ Failed: %v\n", "boom")
+	PrintDebug("🐛 Hidden at the normal level\n")
+	SetLogLevel(LogLevelDebug)
+	PrintDebug("🐛 Shown at the debug level\n")
+	SetLogLevel(LogLevelQuiet)
+	PrintInfo("ℹ️ Hidden when quiet\n")
+
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		assert.NoError(t, json.Unmarshal([]byte(line), &record), line)
+		records = append(records, record)
+	}
+	if assert.Len(t, records, 4) {
+		assert.Equal(t, "INFO", records[0]["level"])
+		assert.Equal(t, "Pulled '.env'", records[0]["msg"])
+		assert.Equal(t, "myapp-env", records[0]["secret"])
+		assert.Equal(t, ".env", records[0]["file"])
+		assert.Equal(t, true, records[0]["success"])
+		assert.Equal(t, "WARN", records[1]["level"])
+		assert.Equal(t, "Careful", records[1]["msg"])
+		assert.Equal(t, "ERROR", records[2]["level"])
+		assert.Equal(t, "Failed: boom", records[2]["msg"])
+		assert.Equal(t, "DEBUG", records[3]["level"])
+		assert.Equal(t, "Shown at the debug level", records[3]["msg"])
+	}
+
+	assert.Error(t, SetLogFormat("xml", &buf))
+	assert.NoError(t, SetLogFormat("text", &buf))
+	assert.Nil(t, logger)
+}
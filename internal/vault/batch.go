@@ -0,0 +1,55 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// DefaultMaxConcurrency is the number of secrets GetSecrets fetches in parallel when no limit is set.
+const DefaultMaxConcurrency = 4
+
+// GetSecrets retrieves the latest value of every named secret, with at most c.MaxConcurrency
+// requests in flight. Key Vault has no batch API, so each secret is a separate request.
+func (c *Client) GetSecrets(ctx context.Context, names []string) (map[string]string, error) {
+	return getSecrets(ctx, names, c.MaxConcurrency, c.GetSecret)
+}
+
+// getSecrets fetches names concurrently with get, at most limit at a time. Every secret is
+// attempted: the values that were fetched are returned along with the failures joined into one
+// error, each naming its secret. Duplicate names are fetched once.
+func getSecrets(ctx context.Context, names []string, limit int, get func(context.Context, string) (string, error)) (map[string]string, error) {
+	if limit <= 0 {
+		limit = DefaultMaxConcurrency
+	}
+
+	var g errgroup.Group
+	g.SetLimit(limit)
+
+	var mu sync.Mutex
+	values := make(map[string]string, len(names))
+	errs := make([]error, len(names))
+	seen := make(map[string]bool, len(names))
+	for i, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		g.Go(func() error {
+			value, err := get(ctx, name)
+			if err != nil {
+				errs[i] = err
+				return nil
+			}
+			mu.Lock()
+			values[name] = value
+			mu.Unlock()
+			return nil
+		})
+	}
+	g.Wait()
+
+	return values, errors.Join(errs...)
+}
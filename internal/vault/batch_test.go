@@ -0,0 +1,49 @@
+package vault
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetSecrets(t *testing.T) {
+	ctx := context.Background()
+	store := NewFakeStore()
+	assert.NoError(t, store.StoreSecret(ctx, "app-env", "one", nil, SecretAttributes{}))
+	assert.NoError(t, store.StoreSecret(ctx, "worker-env", "two", nil, SecretAttributes{}))
+
+	values, err := store.GetSecrets(ctx, []string{"app-env", "worker-env", "app-env"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"app-env": "one", "worker-env": "two"}, values)
+
+	// Failures don't hide the secrets that could be fetched
+	values, err = store.GetSecrets(ctx, []string{"app-env", "missing-env"})
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+	assert.ErrorContains(t, err, "missing-env")
+	assert.Equal(t, map[string]string{"app-env": "one"}, values)
+}
+
+func TestGetSecretsBoundsConcurrency(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	get := func(ctx context.Context, name string) (string, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		return name, nil
+	}
+
+	names := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+	values, err := getSecrets(context.Background(), names, 2, get)
+	assert.NoError(t, err)
+	assert.Len(t, values, len(names))
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+}
@@ -4,15 +4,187 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azsecrets"
+	"github.com/lliamscholtz/env-sync/internal/crypto"
 )
 
+// Tags set on secrets by push for auditing.
+const (
+	TagPushedBy    = "pushed_by"
+	TagHostname    = "hostname"
+	TagContentHash = "content_hash"
+	TagMessage     = "message"
+)
+
+// MaxTagValueLength is the longest tag value, in characters, Key Vault accepts.
+const MaxTagValueLength = 256
+
+// ErrSecretNotFound is returned when a secret does not exist in the vault.
+var ErrSecretNotFound = errors.New("secret not found")
+
+// ErrConcurrentModification is returned by StoreSecretIfVersionBestEffort when the secret changed
+// since it was read. The operation can be retried after fetching the new version.
+var ErrConcurrentModification = errors.New("secret was modified concurrently")
+
+// ErrSecretNotYetActive is returned when a secret's activation date is still in the future.
+var ErrSecretNotYetActive = errors.New("secret is not active yet")
+
+// ErrSecretExpired is returned when a secret's expiry date has passed.
+var ErrSecretExpired = errors.New("secret has expired")
+
+// MaxSecretNameLength is the longest secret name Key Vault accepts.
+const MaxSecretNameLength = 127
+
+// ValidateSecretName checks that name is a valid Key Vault secret name:
+// 1 to 127 characters, using only letters, digits and dashes.
+func ValidateSecretName(name string) error {
+	if name == "" {
+		return fmt.Errorf("secret name must not be empty")
+	}
+	if len(name) > MaxSecretNameLength {
+		return fmt.Errorf("secret name '%s' is %d characters long; Key Vault allows at most %d", name, len(name), MaxSecretNameLength)
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			return fmt.Errorf("secret name '%s' contains %q; Key Vault only allows letters, digits and dashes", name, r)
+		}
+	}
+	return nil
+}
+
+// vaultHostSuffixes are the Key Vault DNS suffixes of the public and sovereign Azure clouds
+var vaultHostSuffixes = []string{".vault.azure.net", ".vault.azure.cn", ".vault.usgovcloudapi.net", ".vault.microsoftazure.de"}
+
+// ValidateVaultURL checks that rawURL is a well-formed Key Vault URL such as https://myvault.vault.azure.net/.
+func ValidateVaultURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("vault URL '%s' is not a valid URL: %w", rawURL, err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("vault URL '%s' must use https", rawURL)
+	}
+	if u.Path != "" && u.Path != "/" {
+		return fmt.Errorf("vault URL '%s' must not include a path", rawURL)
+	}
+	host := u.Hostname()
+	for _, suffix := range vaultHostSuffixes {
+		if strings.HasSuffix(host, suffix) && len(host) > len(suffix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("vault URL '%s' is not a Key Vault URL (expected https://<vault-name>.vault.azure.net)", rawURL)
+}
+
+// Secret is a secret value together with its tags.
+type Secret struct {
+	Value       string
+	Tags        map[string]string
+	Version     string // Version identifier of the returned value
+	ContentType string // Content type set when the value was stored; empty if none was
+	Attributes  SecretAttributes
+}
+
+// SecretProperties holds a secret's metadata without its value.
+type SecretProperties struct {
+	CreatedOn  time.Time
+	UpdatedOn  time.Time
+	Tags       map[string]string
+	Version    string // Version identifier of the latest value
+	Attributes SecretAttributes
+}
+
+// SecretAttributes are the activation and expiry dates of a secret version. A zero time is unset:
+// the version is active from when it is stored, or never expires.
+type SecretAttributes struct {
+	NotBefore time.Time
+	Expires   time.Time
+}
+
+// Check returns an error wrapping ErrSecretNotYetActive or ErrSecretExpired if a version with
+// these attributes can't be used at now.
+func (a SecretAttributes) Check(now time.Time) error {
+	if !a.NotBefore.IsZero() && now.Before(a.NotBefore) {
+		return fmt.Errorf("%w: it becomes active on %s", ErrSecretNotYetActive, a.NotBefore.Local().Format(time.RFC1123))
+	}
+	if !a.Expires.IsZero() && !now.Before(a.Expires) {
+		return fmt.Errorf("%w: it expired on %s", ErrSecretExpired, a.Expires.Local().Format(time.RFC1123))
+	}
+	return nil
+}
+
+// sdkAttributes converts attributes for a set request, or returns nil if none are set
+func (a SecretAttributes) sdkAttributes() *azsecrets.SecretAttributes {
+	if a.NotBefore.IsZero() && a.Expires.IsZero() {
+		return nil
+	}
+	attrs := &azsecrets.SecretAttributes{}
+	if !a.NotBefore.IsZero() {
+		notBefore := a.NotBefore
+		attrs.NotBefore = &notBefore
+	}
+	if !a.Expires.IsZero() {
+		expires := a.Expires
+		attrs.Expires = &expires
+	}
+	return attrs
+}
+
+// secretAttributes converts the attributes of a get response
+func secretAttributes(attrs *azsecrets.SecretAttributes) SecretAttributes {
+	var result SecretAttributes
+	if attrs == nil {
+		return result
+	}
+	if attrs.NotBefore != nil {
+		result.NotBefore = *attrs.NotBefore
+	}
+	if attrs.Expires != nil {
+		result.Expires = *attrs.Expires
+	}
+	return result
+}
+
+// SecretVersion describes one stored version of a secret, without its value.
+type SecretVersion struct {
+	Version   string
+	CreatedOn time.Time
+	Enabled   bool
+	Tags      map[string]string
+}
+
+// SecretStore is the secret storage env-sync syncs against. *Client implements it against
+// Azure Key Vault, FakeStore in memory and MirrorStore across a primary and a fallback store.
+type SecretStore interface {
+	GetSecret(ctx context.Context, secretName string) (string, error)
+	GetSecretWithProperties(ctx context.Context, secretName string) (*Secret, error)
+	GetSecretProperties(ctx context.Context, secretName string) (*SecretProperties, error)
+	// StoreSecret and StoreSecretIfVersionBestEffort set the new version's activation and expiry
+	// dates from attrs; its zero value sets neither.
+	StoreSecret(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes) error
+	StoreSecretIfVersionBestEffort(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes, expectedVersion string) error
+	// GetSecrets retrieves several secrets concurrently. The values that could be fetched are
+	// returned even when others fail; the failures are joined into the error.
+	GetSecrets(ctx context.Context, names []string) (map[string]string, error)
+}
+
+var _ VersionStore = (*Client)(nil)
+
 // Client is a wrapper around the Azure Key Vault secrets client.
 type Client struct {
 	client   *azsecrets.Client
 	VaultURL string
+	// MaxConcurrency bounds the requests GetSecrets makes in parallel; zero uses DefaultMaxConcurrency.
+	MaxConcurrency int
+	// PageDelay pauses between the pages of ListSecrets and ListSecretVersions, to stay under Key
+	// Vault's request limits when listing large vaults; zero doesn't pause.
+	PageDelay time.Duration
 }
 
 // NewClient creates a new Key Vault client.
@@ -34,8 +206,25 @@ func NewClient(vaultURL string, cred azcore.TokenCredential) (*Client, error) {
 }
 
 // StoreSecret creates or updates a secret in the Key Vault.
-func (c *Client) StoreSecret(ctx context.Context, secretName, value string) error {
-	_, err := c.client.SetSecret(ctx, secretName, azsecrets.SetSecretParameters{Value: &value}, nil)
+// Tags are optional and may be nil. The new version gets the activation and expiry dates set in
+// attrs. The secret name is validated before any request is made.
+// Encrypted env content is labelled with its crypto.ContentType so it can be recognized in the portal.
+func (c *Client) StoreSecret(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes) error {
+	if err := ValidateSecretName(secretName); err != nil {
+		return err
+	}
+	params := azsecrets.SetSecretParameters{Value: &value, SecretAttributes: attrs.sdkAttributes()}
+	if contentType := crypto.ContentType(value); contentType != "" {
+		params.ContentType = &contentType
+	}
+	if len(tags) > 0 {
+		params.Tags = make(map[string]*string, len(tags))
+		for k, v := range tags {
+			v := v
+			params.Tags[k] = &v
+		}
+	}
+	_, err := c.client.SetSecret(ctx, secretName, params, nil)
 	if err != nil {
 		return fmt.Errorf("failed to store secret '%s': %w", secretName, err)
 	}
@@ -46,7 +235,7 @@ func (c *Client) StoreSecret(ctx context.Context, secretName, value string) erro
 func (c *Client) GetSecret(ctx context.Context, secretName string) (string, error) {
 	resp, err := c.client.GetSecret(ctx, secretName, "", nil)
 	if err != nil {
-		return "", fmt.Errorf("failed to get secret '%s': %w", secretName, err)
+		return "", wrapGetError(secretName, err)
 	}
 
 	if resp.Value == nil {
@@ -56,6 +245,175 @@ func (c *Client) GetSecret(ctx context.Context, secretName string) (string, erro
 	return *resp.Value, nil
 }
 
+// GetSecretWithProperties retrieves a secret's value together with its tags.
+func (c *Client) GetSecretWithProperties(ctx context.Context, secretName string) (*Secret, error) {
+	resp, err := c.client.GetSecret(ctx, secretName, "", nil)
+	if err != nil {
+		return nil, wrapGetError(secretName, err)
+	}
+
+	if resp.Value == nil {
+		return nil, fmt.Errorf("retrieved secret '%s' has a nil value", secretName)
+	}
+	return newSecret(resp), nil
+}
+
+// GetSecretVersionWithProperties retrieves the value of a specific version of a secret together
+// with its tags.
+func (c *Client) GetSecretVersionWithProperties(ctx context.Context, secretName, version string) (*Secret, error) {
+	resp, err := c.client.GetSecret(ctx, secretName, version, nil)
+	if isNotFound(err) {
+		return nil, fmt.Errorf("failed to get version '%s' of secret '%s': %w: %w", version, secretName, ErrSecretNotFound, err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version '%s' of secret '%s': %w", version, secretName, err)
+	}
+
+	if resp.Value == nil {
+		return nil, fmt.Errorf("retrieved secret '%s' version '%s' has a nil value", secretName, version)
+	}
+	return newSecret(resp), nil
+}
+
+// newSecret converts a get response with a value
+func newSecret(resp azsecrets.GetSecretResponse) *Secret {
+	secret := &Secret{Value: *resp.Value, Tags: derefTags(resp.Tags), Version: secretVersion(resp.ID), Attributes: secretAttributes(resp.Attributes)}
+	if resp.ContentType != nil {
+		secret.ContentType = *resp.ContentType
+	}
+	return secret
+}
+
+// UpdateSecretTags replaces the tags of a specific version of a secret, leaving its value and
+// other properties as they are.
+func (c *Client) UpdateSecretTags(ctx context.Context, secretName, version string, tags map[string]string) error {
+	params := azsecrets.UpdateSecretPropertiesParameters{Tags: make(map[string]*string, len(tags))}
+	for k, v := range tags {
+		v := v
+		params.Tags[k] = &v
+	}
+	_, err := c.client.UpdateSecretProperties(ctx, secretName, version, params, nil)
+	if isNotFound(err) {
+		return fmt.Errorf("failed to update tags of version '%s' of secret '%s': %w: %w", version, secretName, ErrSecretNotFound, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update tags of version '%s' of secret '%s': %w", version, secretName, err)
+	}
+	return nil
+}
+
+// GetSecretVersion retrieves the value of a specific version of a secret.
+func (c *Client) GetSecretVersion(ctx context.Context, secretName, version string) (string, error) {
+	resp, err := c.client.GetSecret(ctx, secretName, version, nil)
+	if isNotFound(err) {
+		return "", fmt.Errorf("failed to get version '%s' of secret '%s': %w: %w", version, secretName, ErrSecretNotFound, err)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get version '%s' of secret '%s': %w", version, secretName, err)
+	}
+
+	if resp.Value == nil {
+		return "", fmt.Errorf("retrieved secret '%s' version '%s' has a nil value", secretName, version)
+	}
+
+	return *resp.Value, nil
+}
+
+// CurrentVersion returns the version identifier of a secret's latest value,
+// or an empty string if the secret does not exist.
+func (c *Client) CurrentVersion(ctx context.Context, secretName string) (string, error) {
+	resp, err := c.client.GetSecret(ctx, secretName, "", nil)
+	if isNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", wrapGetError(secretName, err)
+	}
+	return secretVersion(resp.ID), nil
+}
+
+// StoreSecretIfVersionBestEffort stores a secret if its latest version is still expectedVersion
+// (an empty expectedVersion means the secret must not exist yet). Otherwise it returns an
+// error wrapping ErrConcurrentModification.
+//
+// This is not an atomic conditional write: Key Vault has no If-Match support for setting
+// secrets, so the version is checked with a separate request immediately before the write.
+// A concurrent writer that lands between the two requests is overwritten without an error.
+// It catches the common case of pushing over changes made since the last read, nothing more.
+func (c *Client) StoreSecretIfVersionBestEffort(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes, expectedVersion string) error {
+	if err := ValidateSecretName(secretName); err != nil {
+		return err
+	}
+	current, err := c.CurrentVersion(ctx, secretName)
+	if err != nil {
+		return err
+	}
+	if current != expectedVersion {
+		return fmt.Errorf("%w: '%s' is now at version %s, expected %s", ErrConcurrentModification, secretName, describeVersion(current), describeVersion(expectedVersion))
+	}
+	return c.StoreSecret(ctx, secretName, value, tags, attrs)
+}
+
+// secretVersion extracts the version from a secret ID
+func secretVersion(id *azsecrets.ID) string {
+	if id == nil {
+		return ""
+	}
+	return id.Version()
+}
+
+// describeVersion formats a version for error messages
+func describeVersion(version string) string {
+	if version == "" {
+		return "(none)"
+	}
+	return version
+}
+
+// GetSecretProperties retrieves a secret's created/updated timestamps, tags and activation and expiry dates.
+func (c *Client) GetSecretProperties(ctx context.Context, secretName string) (*SecretProperties, error) {
+	resp, err := c.client.GetSecret(ctx, secretName, "", nil)
+	if err != nil {
+		return nil, wrapGetError(secretName, err)
+	}
+
+	props := &SecretProperties{Tags: derefTags(resp.Tags), Version: secretVersion(resp.ID), Attributes: secretAttributes(resp.Attributes)}
+	if resp.Attributes != nil {
+		if resp.Attributes.Created != nil {
+			props.CreatedOn = *resp.Attributes.Created
+		}
+		if resp.Attributes.Updated != nil {
+			props.UpdatedOn = *resp.Attributes.Updated
+		}
+	}
+	return props, nil
+}
+
+// wrapGetError annotates a get failure, marking 404 responses with ErrSecretNotFound
+func wrapGetError(secretName string, err error) error {
+	if isNotFound(err) {
+		return fmt.Errorf("failed to get secret '%s': %w: %w", secretName, ErrSecretNotFound, err)
+	}
+	return fmt.Errorf("failed to get secret '%s': %w", secretName, err)
+}
+
+// isNotFound reports whether err is a 404 response from Key Vault
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == 404
+}
+
+// derefTags converts SDK tags to a plain string map
+func derefTags(tags map[string]*string) map[string]string {
+	result := make(map[string]string, len(tags))
+	for k, v := range tags {
+		if v != nil {
+			result[k] = *v
+		}
+	}
+	return result
+}
+
 // DeleteSecret removes a secret from the Key Vault.
 func (c *Client) DeleteSecret(ctx context.Context, secretName string) error {
 	_, err := c.client.DeleteSecret(ctx, secretName, nil)
@@ -70,25 +428,58 @@ func (c *Client) ListSecrets(ctx context.Context) ([]string, error) {
 	var secretNames []string
 
 	pager := c.client.NewListSecretPropertiesPager(nil)
-	for pager.More() {
-		page, err := pager.NextPage(ctx)
-		if err != nil {
-			return nil, fmt.Errorf("failed to list secrets: %w", err)
-		}
+	err := eachPage(ctx, pager, c.PageDelay, func(page azsecrets.ListSecretPropertiesResponse) {
 		for _, secret := range page.Value {
 			secretNames = append(secretNames, secret.ID.Name())
 		}
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
 	}
 
 	return secretNames, nil
 }
 
+// ListSecretVersions returns the properties of every version of a secret, newest first.
+// It returns an error wrapping ErrSecretNotFound if the secret has no versions.
+func (c *Client) ListSecretVersions(ctx context.Context, secretName string) ([]SecretVersion, error) {
+	var versions []SecretVersion
+
+	pager := c.client.NewListSecretPropertiesVersionsPager(secretName, nil)
+	err := eachPage(ctx, pager, c.PageDelay, func(page azsecrets.ListSecretPropertiesVersionsResponse) {
+		for _, props := range page.Value {
+			version := SecretVersion{Version: secretVersion(props.ID), Tags: derefTags(props.Tags)}
+			if props.Attributes != nil {
+				if props.Attributes.Created != nil {
+					version.CreatedOn = *props.Attributes.Created
+				}
+				version.Enabled = props.Attributes.Enabled == nil || *props.Attributes.Enabled
+			}
+			versions = append(versions, version)
+		}
+	})
+	if err != nil {
+		if isNotFound(err) {
+			return nil, fmt.Errorf("failed to list versions of secret '%s': %w: %w", secretName, ErrSecretNotFound, err)
+		}
+		return nil, fmt.Errorf("failed to list versions of secret '%s': %w", secretName, err)
+	}
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("failed to list versions of secret '%s': %w", secretName, ErrSecretNotFound)
+	}
+
+	// Key Vault returns versions in no particular order
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].CreatedOn.After(versions[j].CreatedOn)
+	})
+	return versions, nil
+}
+
 // SecretExists checks if a secret with the given name exists in the vault.
 func (c *Client) SecretExists(ctx context.Context, secretName string) (bool, error) {
 	_, err := c.client.GetSecret(ctx, secretName, "", nil)
 	if err != nil {
-		var respErr *azcore.ResponseError
-		if ok := errors.As(err, &respErr); ok && respErr.StatusCode == 404 {
+		if isNotFound(err) {
 			return false, nil // Not found
 		}
 		return false, fmt.Errorf("failed to check for secret '%s': %w", secretName, err)
@@ -96,5 +487,38 @@ func (c *Client) SecretExists(ctx context.Context, secretName string) (bool, err
 	return true, nil
 }
 
+// ProbeResult is the outcome of a vault connectivity probe.
+type ProbeResult int
+
+const (
+	// ProbeOK means the vault answered and the caller may read secrets.
+	// Write (set) permission is not exercised by the probe.
+	ProbeOK ProbeResult = iota
+	// ProbeForbidden means the vault answered but denied access (401/403), e.g. missing RBAC roles.
+	ProbeForbidden
+	// ProbeUnreachable means the vault could not be reached or returned an unexpected error.
+	ProbeUnreachable
+)
+
+// Probe checks that the vault is reachable and that the caller may read secretName.
+// A secret that doesn't exist yet still counts as reachable with permission.
+// Only read access is checked; a caller without set permission still gets ProbeOK.
+func (c *Client) Probe(ctx context.Context, secretName string) (ProbeResult, error) {
+	_, err := c.SecretExists(ctx, secretName)
+	return classifyProbeError(err), err
+}
+
+// classifyProbeError maps a probe error to its result
+func classifyProbeError(err error) ProbeResult {
+	if err == nil {
+		return ProbeOK
+	}
+	var respErr *azcore.ResponseError
+	if errors.As(err, &respErr) && (respErr.StatusCode == 401 || respErr.StatusCode == 403) {
+		return ProbeForbidden
+	}
+	return ProbeUnreachable
+}
+
 // As is a helper function to check for a specific error type in an error chain.
 // This is no longer needed as we use errors.As directly.
@@ -0,0 +1,119 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapGetError(t *testing.T) {
+	t.Run("404 is marked as not found", func(t *testing.T) {
+		err := wrapGetError("app-env", &azcore.ResponseError{StatusCode: 404, ErrorCode: "SecretNotFound"})
+		assert.ErrorIs(t, err, ErrSecretNotFound)
+		assert.Contains(t, err.Error(), "app-env")
+	})
+
+	t.Run("other errors are not marked", func(t *testing.T) {
+		err := wrapGetError("app-env", &azcore.ResponseError{StatusCode: 403, ErrorCode: "Forbidden"})
+		assert.False(t, errors.Is(err, ErrSecretNotFound))
+
+		var respErr *azcore.ResponseError
+		assert.True(t, errors.As(err, &respErr))
+	})
+
+	t.Run("non-response errors are not marked", func(t *testing.T) {
+		err := wrapGetError("app-env", fmt.Errorf("connection refused"))
+		assert.False(t, errors.Is(err, ErrSecretNotFound))
+	})
+}
+
+func TestSecretAttributesCheck(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	assert.NoError(t, SecretAttributes{}.Check(now))
+	assert.NoError(t, SecretAttributes{NotBefore: now, Expires: now.Add(time.Hour)}.Check(now))
+	assert.ErrorIs(t, SecretAttributes{NotBefore: now.Add(time.Minute)}.Check(now), ErrSecretNotYetActive)
+	assert.ErrorIs(t, SecretAttributes{Expires: now}.Check(now), ErrSecretExpired)
+
+	assert.Nil(t, SecretAttributes{}.sdkAttributes())
+	sdk := SecretAttributes{Expires: now}.sdkAttributes()
+	if assert.NotNil(t, sdk) {
+		assert.Nil(t, sdk.NotBefore)
+		assert.Equal(t, now, *sdk.Expires)
+	}
+	assert.Equal(t, SecretAttributes{Expires: now}, secretAttributes(sdk))
+}
+
+func TestClassifyProbeError(t *testing.T) {
+	assert.Equal(t, ProbeOK, classifyProbeError(nil))
+	assert.Equal(t, ProbeForbidden, classifyProbeError(fmt.Errorf("check: %w", &azcore.ResponseError{StatusCode: 403, ErrorCode: "Forbidden"})))
+	assert.Equal(t, ProbeForbidden, classifyProbeError(&azcore.ResponseError{StatusCode: 401, ErrorCode: "Unauthorized"}))
+	assert.Equal(t, ProbeUnreachable, classifyProbeError(&azcore.ResponseError{StatusCode: 503, ErrorCode: "ServiceUnavailable"}))
+	assert.Equal(t, ProbeUnreachable, classifyProbeError(fmt.Errorf("dial tcp: lookup myvault.vault.azure.net: no such host")))
+}
+
+func TestValidateVaultURL(t *testing.T) {
+	tests := []struct {
+		url         string
+		expectError string
+	}{
+		{url: "https://myvault.vault.azure.net"},
+		{url: "https://myvault.vault.azure.net/"},
+		{url: "https://myvault.vault.usgovcloudapi.net/"},
+		{url: "http://myvault.vault.azure.net", expectError: "must use https"},
+		{url: "myvault.vault.azure.net", expectError: "must use https"},
+		{url: "https://myvault.vault.azure.net/secrets/app", expectError: "must not include a path"},
+		{url: "https://example.com", expectError: "not a Key Vault URL"},
+		{url: "https://.vault.azure.net", expectError: "not a Key Vault URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := ValidateVaultURL(tt.url)
+			if tt.expectError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestValidateSecretName(t *testing.T) {
+	tests := []struct {
+		name        string
+		secretName  string
+		expectError string
+	}{
+		{name: "letters digits and dashes", secretName: "myapp-prod-2"},
+		{name: "maximum length", secretName: strings.Repeat("a", MaxSecretNameLength)},
+		{name: "empty", secretName: "", expectError: "must not be empty"},
+		{name: "too long", secretName: strings.Repeat("a", MaxSecretNameLength+1), expectError: "at most 127"},
+		{name: "underscore", secretName: "myapp_prod", expectError: `contains '_'`},
+		{name: "dot", secretName: "myapp.prod", expectError: `contains '.'`},
+		{name: "space", secretName: "myapp prod", expectError: `contains ' '`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateSecretName(tt.secretName)
+			if tt.expectError == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.expectError)
+			}
+		})
+	}
+}
+
+func TestStoreSecretRejectsInvalidName(t *testing.T) {
+	// Validation happens before any request, so no vault is needed
+	client := &Client{}
+	err := client.StoreSecret(context.Background(), "my_secret", "value", nil, SecretAttributes{})
+	assert.ErrorContains(t, err, `contains '_'`)
+}
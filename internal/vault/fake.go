@@ -0,0 +1,238 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+)
+
+var _ VersionStore = (*FakeStore)(nil)
+
+// FakeStore is an in-memory SecretStore for tests. Like Key Vault it keeps every version of a
+// secret; versions are numbered "1", "2", ... per secret. It is safe for concurrent use.
+type FakeStore struct {
+	// Now stamps stored versions; time.Now is used when it is nil.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	secrets map[string][]fakeVersion
+}
+
+// fakeVersion is one stored version of a secret
+type fakeVersion struct {
+	value       string
+	tags        map[string]string
+	contentType string
+	createdOn   time.Time
+	attrs       SecretAttributes
+}
+
+// NewFakeStore returns an empty FakeStore.
+func NewFakeStore() *FakeStore {
+	return &FakeStore{secrets: make(map[string][]fakeVersion)}
+}
+
+// GetSecret returns the latest value of a secret.
+func (f *FakeStore) GetSecret(ctx context.Context, secretName string) (string, error) {
+	secret, err := f.GetSecretWithProperties(ctx, secretName)
+	if err != nil {
+		return "", err
+	}
+	return secret.Value, nil
+}
+
+// GetSecretWithProperties returns the latest value of a secret with its tags and version.
+func (f *FakeStore) GetSecretWithProperties(ctx context.Context, secretName string) (*Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	versions := f.secrets[secretName]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: '%s'", ErrSecretNotFound, secretName)
+	}
+	latest := versions[len(versions)-1]
+	return &Secret{Value: latest.value, Tags: copyTags(latest.tags), Version: strconv.Itoa(len(versions)), ContentType: latest.contentType, Attributes: latest.attrs}, nil
+}
+
+// GetSecrets returns the latest value of every named secret, fetched the way Client.GetSecrets does.
+func (f *FakeStore) GetSecrets(ctx context.Context, names []string) (map[string]string, error) {
+	return getSecrets(ctx, names, DefaultMaxConcurrency, f.GetSecret)
+}
+
+// GetSecretVersion returns the value of a specific version of a secret.
+func (f *FakeStore) GetSecretVersion(ctx context.Context, secretName, version string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.version(secretName, version)
+	if err != nil {
+		return "", fmt.Errorf("failed to get version '%s' of secret '%s': %w", version, secretName, err)
+	}
+	return stored.value, nil
+}
+
+// GetSecretVersionWithProperties returns a specific version of a secret with its tags.
+func (f *FakeStore) GetSecretVersionWithProperties(ctx context.Context, secretName, version string) (*Secret, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.version(secretName, version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version '%s' of secret '%s': %w", version, secretName, err)
+	}
+	return &Secret{Value: stored.value, Tags: copyTags(stored.tags), Version: version, ContentType: stored.contentType, Attributes: stored.attrs}, nil
+}
+
+// UpdateSecretTags replaces the tags of a specific version of a secret.
+func (f *FakeStore) UpdateSecretTags(ctx context.Context, secretName, version string, tags map[string]string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored, err := f.version(secretName, version)
+	if err != nil {
+		return fmt.Errorf("failed to update tags of version '%s' of secret '%s': %w", version, secretName, err)
+	}
+	stored.tags = copyTags(tags)
+	return nil
+}
+
+// version returns a stored version; the caller holds f.mu
+func (f *FakeStore) version(secretName, version string) (*fakeVersion, error) {
+	versions := f.secrets[secretName]
+	n, err := strconv.Atoi(version)
+	if err != nil || n < 1 || n > len(versions) {
+		return nil, ErrSecretNotFound
+	}
+	return &versions[n-1], nil
+}
+
+// GetSecretProperties returns a secret's creation and update times and its latest tags and version.
+func (f *FakeStore) GetSecretProperties(ctx context.Context, secretName string) (*SecretProperties, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	versions := f.secrets[secretName]
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("%w: '%s'", ErrSecretNotFound, secretName)
+	}
+	latest := versions[len(versions)-1]
+	return &SecretProperties{CreatedOn: versions[0].createdOn, UpdatedOn: latest.createdOn, Tags: copyTags(latest.tags), Version: strconv.Itoa(len(versions)), Attributes: latest.attrs}, nil
+}
+
+// StoreSecret adds a new version of a secret with the given activation and expiry dates. They
+// aren't enforced; reads return them for the caller to check.
+func (f *FakeStore) StoreSecret(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes) error {
+	if err := ValidateSecretName(secretName); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.store(secretName, value, tags, attrs)
+	return nil
+}
+
+// StoreSecretIfVersionBestEffort adds a new version of a secret if its latest version is still
+// expectedVersion, with the same semantics as Client.StoreSecretIfVersionBestEffort. Unlike the
+// Client, the check and the store are atomic.
+func (f *FakeStore) StoreSecretIfVersionBestEffort(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes, expectedVersion string) error {
+	if err := ValidateSecretName(secretName); err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var current string
+	if n := len(f.secrets[secretName]); n > 0 {
+		current = strconv.Itoa(n)
+	}
+	if current != expectedVersion {
+		return fmt.Errorf("%w: '%s' is now at version %s, expected %s", ErrConcurrentModification, secretName, describeVersion(current), describeVersion(expectedVersion))
+	}
+	f.store(secretName, value, tags, attrs)
+	return nil
+}
+
+// SecretExists reports whether a secret has any version.
+func (f *FakeStore) SecretExists(ctx context.Context, secretName string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.secrets[secretName]) > 0, nil
+}
+
+// DeleteSecret removes a secret and all its versions.
+func (f *FakeStore) DeleteSecret(ctx context.Context, secretName string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.secrets[secretName]) == 0 {
+		return fmt.Errorf("failed to delete secret '%s': %w", secretName, ErrSecretNotFound)
+	}
+	delete(f.secrets, secretName)
+	return nil
+}
+
+// ListSecrets returns the names of all secrets, sorted.
+func (f *FakeStore) ListSecrets(ctx context.Context) ([]string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	names := make([]string, 0, len(f.secrets))
+	for name := range f.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ListSecretVersions returns the properties of every version of a secret, newest first.
+func (f *FakeStore) ListSecretVersions(ctx context.Context, secretName string) ([]SecretVersion, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	stored := f.secrets[secretName]
+	if len(stored) == 0 {
+		return nil, fmt.Errorf("failed to list versions of secret '%s': %w", secretName, ErrSecretNotFound)
+	}
+	versions := make([]SecretVersion, 0, len(stored))
+	for i := len(stored) - 1; i >= 0; i-- {
+		versions = append(versions, SecretVersion{Version: strconv.Itoa(i + 1), CreatedOn: stored[i].createdOn, Enabled: true, Tags: copyTags(stored[i].tags)})
+	}
+	return versions, nil
+}
+
+// Versions returns the number of versions stored for a secret.
+func (f *FakeStore) Versions(secretName string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.secrets[secretName])
+}
+
+// store appends a version; the caller holds f.mu
+func (f *FakeStore) store(secretName, value string, tags map[string]string, attrs SecretAttributes) {
+	now := time.Now
+	if f.Now != nil {
+		now = f.Now
+	}
+	if f.secrets == nil {
+		f.secrets = make(map[string][]fakeVersion)
+	}
+	f.secrets[secretName] = append(f.secrets[secretName], fakeVersion{value: value, tags: copyTags(tags), contentType: crypto.ContentType(value), createdOn: now(), attrs: attrs})
+}
+
+// SetContentType changes the content type of a secret's latest version, as editing it in the
+// portal would.
+func (f *FakeStore) SetContentType(secretName, contentType string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if versions := f.secrets[secretName]; len(versions) > 0 {
+		versions[len(versions)-1].contentType = contentType
+	}
+}
+
+// copyTags returns a copy of tags, so callers can't change stored versions
+func copyTags(tags map[string]string) map[string]string {
+	if tags == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(tags))
+	for k, v := range tags {
+		copied[k] = v
+	}
+	return copied
+}
@@ -0,0 +1,75 @@
+package vault
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewFakeStore()
+	created := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	store.Now = func() time.Time { return created }
+
+	_, err := store.GetSecret(ctx, "app-env")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	// An empty expected version means the secret must not exist yet
+	assert.NoError(t, store.StoreSecretIfVersionBestEffort(ctx, "app-env", "first", map[string]string{TagPushedBy: "alice"}, SecretAttributes{}, ""))
+	secret, err := store.GetSecretWithProperties(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, "first", secret.Value)
+	assert.Equal(t, "1", secret.Version)
+	assert.Equal(t, "alice", secret.Tags[TagPushedBy])
+
+	// Tags returned to callers don't alias the stored version
+	secret.Tags[TagPushedBy] = "mallory"
+	props, err := store.GetSecretProperties(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, "alice", props.Tags[TagPushedBy])
+
+	err = store.StoreSecretIfVersionBestEffort(ctx, "app-env", "stale", nil, SecretAttributes{}, "")
+	assert.ErrorIs(t, err, ErrConcurrentModification)
+
+	store.Now = func() time.Time { return created.Add(time.Hour) }
+	assert.NoError(t, store.StoreSecretIfVersionBestEffort(ctx, "app-env", "second", nil, SecretAttributes{}, "1"))
+	assert.Equal(t, 2, store.Versions("app-env"))
+	props, err = store.GetSecretProperties(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, created, props.CreatedOn)
+	assert.Equal(t, created.Add(time.Hour), props.UpdatedOn)
+	assert.Equal(t, "2", props.Version)
+
+	versions, err := store.ListSecretVersions(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, []SecretVersion{
+		{Version: "2", CreatedOn: created.Add(time.Hour), Enabled: true},
+		{Version: "1", CreatedOn: created, Enabled: true, Tags: map[string]string{TagPushedBy: "alice"}},
+	}, versions)
+	_, err = store.ListSecretVersions(ctx, "missing")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	assert.Error(t, store.StoreSecret(ctx, "bad_name", "value", nil, SecretAttributes{}))
+
+	// Activation and expiry dates are returned with the version they were stored with
+	attrs := SecretAttributes{NotBefore: created, Expires: created.Add(24 * time.Hour)}
+	assert.NoError(t, store.StoreSecret(ctx, "app-env", "third", nil, attrs))
+	secret, err = store.GetSecretWithProperties(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, attrs, secret.Attributes)
+	props, err = store.GetSecretProperties(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, attrs, props.Attributes)
+
+	names, err := store.ListSecrets(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"app-env"}, names)
+
+	assert.NoError(t, store.DeleteSecret(ctx, "app-env"))
+	exists, err := store.SecretExists(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+}
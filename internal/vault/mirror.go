@@ -0,0 +1,141 @@
+package vault
+
+import (
+	"context"
+	"errors"
+)
+
+var _ VersionStore = (*MirrorStore)(nil)
+
+// MirrorStore replicates secrets to a second store for disaster recovery. The primary is
+// authoritative: every write must succeed there and every read is served from there. The
+// secondary is best-effort on write, where its failures are only logged, and a last resort on
+// read, used only when the primary can't be reached. A secret missing from the primary, or a
+// request the primary refused, is never looked up in the secondary.
+//
+// Versions returned by a read served from the secondary are the secondary's, so a conditional
+// store based on them fails on the primary with ErrConcurrentModification rather than
+// overwriting anything.
+//
+// Version tags are only moved on the primary, since version IDs differ between the stores. The
+// secondary keeps the tags its versions were copied with, so its newest version carrying a tag is
+// still the one last pushed with it.
+type MirrorStore struct {
+	Primary   VersionStore
+	Secondary VersionStore
+	// Logf reports failed secondary writes and reads served from the secondary; nil discards them.
+	Logf func(format string, args ...interface{})
+}
+
+// NewMirrorStore returns a MirrorStore writing to both stores and reading from secondary only
+// when primary is unavailable.
+func NewMirrorStore(primary, secondary VersionStore) *MirrorStore {
+	return &MirrorStore{Primary: primary, Secondary: secondary}
+}
+
+// GetSecret returns the latest value of a secret from the primary, or the secondary if the primary is unavailable.
+func (m *MirrorStore) GetSecret(ctx context.Context, secretName string) (string, error) {
+	value, err := m.Primary.GetSecret(ctx, secretName)
+	if !unavailable(err) {
+		return value, err
+	}
+	m.logFallback(secretName, err)
+	return m.Secondary.GetSecret(ctx, secretName)
+}
+
+// GetSecretWithProperties returns a secret with its tags from the primary, or the secondary if the primary is unavailable.
+func (m *MirrorStore) GetSecretWithProperties(ctx context.Context, secretName string) (*Secret, error) {
+	secret, err := m.Primary.GetSecretWithProperties(ctx, secretName)
+	if !unavailable(err) {
+		return secret, err
+	}
+	m.logFallback(secretName, err)
+	return m.Secondary.GetSecretWithProperties(ctx, secretName)
+}
+
+// GetSecretProperties returns a secret's metadata from the primary, or the secondary if the primary is unavailable.
+func (m *MirrorStore) GetSecretProperties(ctx context.Context, secretName string) (*SecretProperties, error) {
+	props, err := m.Primary.GetSecretProperties(ctx, secretName)
+	if !unavailable(err) {
+		return props, err
+	}
+	m.logFallback(secretName, err)
+	return m.Secondary.GetSecretProperties(ctx, secretName)
+}
+
+// ListSecretVersions lists a secret's versions from the primary, or the secondary if the primary is unavailable.
+func (m *MirrorStore) ListSecretVersions(ctx context.Context, secretName string) ([]SecretVersion, error) {
+	versions, err := m.Primary.ListSecretVersions(ctx, secretName)
+	if !unavailable(err) {
+		return versions, err
+	}
+	m.logFallback(secretName, err)
+	return m.Secondary.ListSecretVersions(ctx, secretName)
+}
+
+// GetSecretVersionWithProperties returns a version of a secret from the primary, or the secondary
+// if the primary is unavailable.
+func (m *MirrorStore) GetSecretVersionWithProperties(ctx context.Context, secretName, version string) (*Secret, error) {
+	secret, err := m.Primary.GetSecretVersionWithProperties(ctx, secretName, version)
+	if !unavailable(err) {
+		return secret, err
+	}
+	m.logFallback(secretName, err)
+	return m.Secondary.GetSecretVersionWithProperties(ctx, secretName, version)
+}
+
+// UpdateSecretTags replaces the tags of a version in the primary only.
+func (m *MirrorStore) UpdateSecretTags(ctx context.Context, secretName, version string, tags map[string]string) error {
+	return m.Primary.UpdateSecretTags(ctx, secretName, version, tags)
+}
+
+// GetSecrets retrieves several secrets concurrently, each falling back to the secondary on its own.
+func (m *MirrorStore) GetSecrets(ctx context.Context, names []string) (map[string]string, error) {
+	return getSecrets(ctx, names, DefaultMaxConcurrency, m.GetSecret)
+}
+
+// StoreSecret stores a secret in the primary and then copies it to the secondary.
+func (m *MirrorStore) StoreSecret(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes) error {
+	if err := m.Primary.StoreSecret(ctx, secretName, value, tags, attrs); err != nil {
+		return err
+	}
+	m.mirror(ctx, secretName, value, tags, attrs)
+	return nil
+}
+
+// StoreSecretIfVersionBestEffort stores a secret in the primary if its version still matches and
+// then copies it to the secondary. Versions are only checked on the primary.
+func (m *MirrorStore) StoreSecretIfVersionBestEffort(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes, expectedVersion string) error {
+	if err := m.Primary.StoreSecretIfVersionBestEffort(ctx, secretName, value, tags, attrs, expectedVersion); err != nil {
+		return err
+	}
+	m.mirror(ctx, secretName, value, tags, attrs)
+	return nil
+}
+
+// mirror copies a stored secret to the secondary, logging rather than returning a failure
+func (m *MirrorStore) mirror(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes) {
+	if err := m.Secondary.StoreSecret(ctx, secretName, value, tags, attrs); err != nil {
+		m.logf("⚠️ Stored '%s' in the primary vault, but copying it to the fallback vault failed: %v\n", secretName, err)
+	}
+}
+
+// logFallback reports a read served from the secondary
+func (m *MirrorStore) logFallback(secretName string, err error) {
+	m.logf("⚠️ Primary vault unavailable, reading '%s' from the fallback vault: %v\n", secretName, err)
+}
+
+func (m *MirrorStore) logf(format string, args ...interface{}) {
+	if m.Logf != nil {
+		m.Logf(format, args...)
+	}
+}
+
+// unavailable reports whether err means the store couldn't be reached, as opposed to answering
+// that the secret doesn't exist or that the caller may not read it
+func unavailable(err error) bool {
+	if err == nil || errors.Is(err, ErrSecretNotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+	return classifyProbeError(err) == ProbeUnreachable
+}
@@ -0,0 +1,171 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+)
+
+// failingStore is a FakeStore that returns err from every call while err is set
+type failingStore struct {
+	*FakeStore
+	err error
+}
+
+func (f *failingStore) GetSecret(ctx context.Context, secretName string) (string, error) {
+	if f.err != nil {
+		return "", f.err
+	}
+	return f.FakeStore.GetSecret(ctx, secretName)
+}
+
+func (f *failingStore) GetSecretWithProperties(ctx context.Context, secretName string) (*Secret, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.FakeStore.GetSecretWithProperties(ctx, secretName)
+}
+
+func (f *failingStore) GetSecretProperties(ctx context.Context, secretName string) (*SecretProperties, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.FakeStore.GetSecretProperties(ctx, secretName)
+}
+
+func (f *failingStore) StoreSecret(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.FakeStore.StoreSecret(ctx, secretName, value, tags, attrs)
+}
+
+func (f *failingStore) StoreSecretIfVersionBestEffort(ctx context.Context, secretName, value string, tags map[string]string, attrs SecretAttributes, expectedVersion string) error {
+	if f.err != nil {
+		return f.err
+	}
+	return f.FakeStore.StoreSecretIfVersionBestEffort(ctx, secretName, value, tags, attrs, expectedVersion)
+}
+
+func (f *failingStore) ListSecretVersions(ctx context.Context, secretName string) ([]SecretVersion, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.FakeStore.ListSecretVersions(ctx, secretName)
+}
+
+func (f *failingStore) GetSecretVersionWithProperties(ctx context.Context, secretName, version string) (*Secret, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.FakeStore.GetSecretVersionWithProperties(ctx, secretName, version)
+}
+
+func TestMirrorStoreWrites(t *testing.T) {
+	ctx := context.Background()
+	primary := &failingStore{FakeStore: NewFakeStore()}
+	secondary := &failingStore{FakeStore: NewFakeStore()}
+	var logged []string
+	mirror := NewMirrorStore(primary, secondary)
+	mirror.Logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+
+	assert.NoError(t, mirror.StoreSecret(ctx, "app-env", "one", map[string]string{"k": "v"}, SecretAttributes{}))
+	value, _ := secondary.GetSecret(ctx, "app-env")
+	assert.Equal(t, "one", value)
+
+	// Versions are only checked on the primary, so the secondary can't refuse the copy
+	current, err := primary.GetSecretWithProperties(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.NoError(t, secondary.StoreSecret(ctx, "app-env", "drifted", nil, SecretAttributes{}))
+	assert.NoError(t, mirror.StoreSecretIfVersionBestEffort(ctx, "app-env", "two", nil, SecretAttributes{}, current.Version))
+	value, _ = secondary.GetSecret(ctx, "app-env")
+	assert.Equal(t, "two", value)
+	assert.ErrorIs(t, mirror.StoreSecretIfVersionBestEffort(ctx, "app-env", "three", nil, SecretAttributes{}, current.Version), ErrConcurrentModification)
+	value, _ = secondary.GetSecret(ctx, "app-env")
+	assert.Equal(t, "two", value, "a refused write isn't copied")
+
+	// A failing secondary is logged, not returned
+	secondary.err = errors.New("dial tcp: no such host")
+	assert.NoError(t, mirror.StoreSecret(ctx, "app-env", "four", nil, SecretAttributes{}))
+	value, _ = primary.GetSecret(ctx, "app-env")
+	assert.Equal(t, "four", value)
+	if assert.Len(t, logged, 1) {
+		assert.Contains(t, logged[0], "copying it to the fallback vault failed")
+	}
+
+	// A failing primary fails the write and leaves the secondary alone
+	secondary.err = nil
+	primary.err = errors.New("dial tcp: no such host")
+	assert.Error(t, mirror.StoreSecret(ctx, "app-env", "five", nil, SecretAttributes{}))
+	value, _ = secondary.GetSecret(ctx, "app-env")
+	assert.Equal(t, "two", value)
+}
+
+func TestMirrorStoreReads(t *testing.T) {
+	ctx := context.Background()
+	primary := &failingStore{FakeStore: NewFakeStore()}
+	secondary := &failingStore{FakeStore: NewFakeStore()}
+	assert.NoError(t, primary.StoreSecret(ctx, "app-env", "primary", nil, SecretAttributes{}))
+	assert.NoError(t, secondary.StoreSecret(ctx, "app-env", "secondary", nil, SecretAttributes{}))
+	assert.NoError(t, secondary.StoreSecret(ctx, "stale-env", "secondary", nil, SecretAttributes{}))
+	var logged []string
+	mirror := NewMirrorStore(primary, secondary)
+	mirror.Logf = func(format string, args ...interface{}) { logged = append(logged, fmt.Sprintf(format, args...)) }
+
+	value, err := mirror.GetSecret(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, "primary", value)
+
+	// The primary is authoritative: a secret it doesn't have isn't read from the secondary
+	_, err = mirror.GetSecret(ctx, "stale-env")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	// Nor is one it refuses to hand out
+	primary.err = &azcore.ResponseError{StatusCode: 403, ErrorCode: "Forbidden"}
+	_, err = mirror.GetSecret(ctx, "app-env")
+	assert.Error(t, err)
+	assert.Empty(t, logged)
+
+	// An unreachable primary falls back to the secondary
+	primary.err = &azcore.ResponseError{StatusCode: 503, ErrorCode: "ServiceUnavailable"}
+	value, err = mirror.GetSecret(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, "secondary", value)
+	secret, err := mirror.GetSecretWithProperties(ctx, "app-env")
+	assert.NoError(t, err)
+	assert.Equal(t, "secondary", secret.Value)
+	values, err := mirror.GetSecrets(ctx, []string{"app-env", "stale-env"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"app-env": "secondary", "stale-env": "secondary"}, values)
+	assert.NotEmpty(t, logged)
+	assert.Contains(t, logged[0], "reading 'app-env' from the fallback vault")
+}
+
+func TestMirrorStoreVersionTags(t *testing.T) {
+	ctx := context.Background()
+	primary := &failingStore{FakeStore: NewFakeStore()}
+	secondary := &failingStore{FakeStore: NewFakeStore()}
+	mirror := NewMirrorStore(primary, secondary)
+
+	assert.NoError(t, mirror.StoreSecret(ctx, "app-env", "one", map[string]string{VersionTagKey("stable"): "true"}, SecretAttributes{}))
+	assert.NoError(t, mirror.StoreSecret(ctx, "app-env", "two", nil, SecretAttributes{}))
+
+	// Tags are moved on the primary only; the secondary keeps the tags versions were copied with
+	assert.NoError(t, MoveVersionTag(ctx, mirror, "app-env", "stable", "2"))
+	secret, err := GetTaggedSecret(ctx, primary, "app-env", "stable")
+	assert.NoError(t, err)
+	assert.Equal(t, "two", secret.Value)
+	secret, err = GetTaggedSecret(ctx, secondary, "app-env", "stable")
+	assert.NoError(t, err)
+	assert.Equal(t, "one", secret.Value)
+
+	// With the primary unreachable, the tagged version is read from the secondary
+	primary.err = errors.New("dial tcp: no such host")
+	secret, err = GetTaggedSecret(ctx, mirror, "app-env", "stable")
+	assert.NoError(t, err)
+	assert.Equal(t, "one", secret.Value)
+}
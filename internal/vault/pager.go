@@ -0,0 +1,93 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+)
+
+// maxThrottleRetries is how many times a throttled page is requested again before listing fails
+const maxThrottleRetries = 4
+
+// throttleBackoff is the wait before the first retry of a throttled page when Key Vault doesn't
+// send Retry-After; it doubles with each retry
+var throttleBackoff = 2 * time.Second
+
+// pageSource is the part of *runtime.Pager that eachPage uses
+type pageSource[T any] interface {
+	More() bool
+	NextPage(ctx context.Context) (T, error)
+}
+
+// eachPage calls visit with every page of pager, waiting delay between pages. The Azure SDK
+// retries throttled requests a few times on its own; a page that is still throttled after that
+// is requested again with backoff instead of aborting a long listing halfway.
+func eachPage[T any](ctx context.Context, pager pageSource[T], delay time.Duration, visit func(T)) error {
+	for first := true; pager.More(); first = false {
+		if !first {
+			if err := sleep(ctx, delay); err != nil {
+				return err
+			}
+		}
+		page, err := nextPage(ctx, pager)
+		if err != nil {
+			return err
+		}
+		visit(page)
+	}
+	return nil
+}
+
+// nextPage fetches the next page of pager, retrying while Key Vault throttles the request.
+// A failed request doesn't advance the pager, so the retry fetches the same page.
+func nextPage[T any](ctx context.Context, pager pageSource[T]) (T, error) {
+	backoff := throttleBackoff
+	for attempt := 0; ; attempt++ {
+		page, err := pager.NextPage(ctx)
+		wait, throttled := throttleDelay(err)
+		if !throttled || attempt == maxThrottleRetries {
+			return page, err
+		}
+		if wait == 0 {
+			wait = backoff
+			backoff *= 2
+		}
+		if err := sleep(ctx, wait); err != nil {
+			return page, err
+		}
+	}
+}
+
+// throttleDelay reports whether err is a throttled (429) response and how long Key Vault asked
+// to wait before retrying, or zero if it didn't say
+func throttleDelay(err error) (time.Duration, bool) {
+	var respErr *azcore.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusTooManyRequests {
+		return 0, false
+	}
+	if respErr.RawResponse != nil {
+		if seconds, err := strconv.Atoi(respErr.RawResponse.Header.Get("Retry-After")); err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	return 0, true
+}
+
+// sleep waits for d, returning early with the context's error if ctx ends first
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,88 @@
+package vault
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedPager returns pages in order, failing a page with the next queued error first
+type scriptedPager struct {
+	pages    []int
+	errs     []error
+	requests int
+}
+
+func (p *scriptedPager) More() bool { return len(p.pages) > 0 }
+
+func (p *scriptedPager) NextPage(ctx context.Context) (int, error) {
+	p.requests++
+	if len(p.errs) > 0 {
+		err := p.errs[0]
+		p.errs = p.errs[1:]
+		return 0, err
+	}
+	page := p.pages[0]
+	p.pages = p.pages[1:]
+	return page, nil
+}
+
+func throttled(retryAfter string) error {
+	resp := &http.Response{StatusCode: http.StatusTooManyRequests, Header: http.Header{}}
+	if retryAfter != "" {
+		resp.Header.Set("Retry-After", retryAfter)
+	}
+	return &azcore.ResponseError{StatusCode: http.StatusTooManyRequests, ErrorCode: "Throttled", RawResponse: resp}
+}
+
+func TestEachPageRetriesThrottledPages(t *testing.T) {
+	defer func(backoff time.Duration) { throttleBackoff = backoff }(throttleBackoff)
+	throttleBackoff = time.Millisecond
+
+	pager := &scriptedPager{pages: []int{1, 2, 3}, errs: []error{throttled(""), throttled("")}}
+	var got []int
+	err := eachPage[int](context.Background(), pager, time.Millisecond, func(page int) { got = append(got, page) })
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3}, got)
+	assert.Equal(t, 5, pager.requests)
+
+	// Persistent throttling gives up after maxThrottleRetries
+	pager = &scriptedPager{pages: []int{1}}
+	for i := 0; i <= maxThrottleRetries; i++ {
+		pager.errs = append(pager.errs, throttled(""))
+	}
+	err = eachPage[int](context.Background(), pager, 0, func(int) {})
+	assert.Error(t, err)
+	assert.Equal(t, maxThrottleRetries+1, pager.requests)
+
+	// Other errors aren't retried
+	pager = &scriptedPager{pages: []int{1}, errs: []error{&azcore.ResponseError{StatusCode: http.StatusForbidden}}}
+	err = eachPage[int](context.Background(), pager, 0, func(int) {})
+	assert.Error(t, err)
+	assert.Equal(t, 1, pager.requests)
+}
+
+func TestEachPageStopsWhenContextEnds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pager := &scriptedPager{pages: []int{1, 2}}
+	err := eachPage[int](ctx, pager, time.Hour, func(int) { cancel() })
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 1, pager.requests)
+}
+
+func TestThrottleDelay(t *testing.T) {
+	wait, ok := throttleDelay(throttled("7"))
+	assert.True(t, ok)
+	assert.Equal(t, 7*time.Second, wait)
+
+	wait, ok = throttleDelay(throttled(""))
+	assert.True(t, ok)
+	assert.Zero(t, wait)
+
+	_, ok = throttleDelay(&azcore.ResponseError{StatusCode: http.StatusServiceUnavailable})
+	assert.False(t, ok)
+}
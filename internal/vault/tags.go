@@ -0,0 +1,136 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// VersionTagPrefix starts the names of the Key Vault tags that hold version tags: a version tagged
+// stable carries the Key Vault tag version_tag_stable.
+const VersionTagPrefix = "version_tag_"
+
+// MaxVersionTagLength is the longest version tag accepted.
+const MaxVersionTagLength = 64
+
+// ErrVersionTagNotFound is returned when no version of a secret carries a version tag.
+var ErrVersionTagNotFound = errors.New("version tag not found")
+
+// VersionStore is a SecretStore that can also read and retag single versions of a secret, which
+// version tags need. *Client, FakeStore and MirrorStore implement it.
+type VersionStore interface {
+	SecretStore
+	// ListSecretVersions returns the properties of every version of a secret, newest first.
+	ListSecretVersions(ctx context.Context, secretName string) ([]SecretVersion, error)
+	GetSecretVersionWithProperties(ctx context.Context, secretName, version string) (*Secret, error)
+	// UpdateSecretTags replaces the tags of one version.
+	UpdateSecretTags(ctx context.Context, secretName, version string, tags map[string]string) error
+}
+
+// ValidateVersionTag checks that tag is a usable version tag, such as stable or qa-2024: 1 to 64
+// letters, digits, dashes, underscores and dots.
+func ValidateVersionTag(tag string) error {
+	if tag == "" {
+		return fmt.Errorf("version tag must not be empty")
+	}
+	if len(tag) > MaxVersionTagLength {
+		return fmt.Errorf("version tag '%s' is %d characters long; at most %d are allowed", tag, len(tag), MaxVersionTagLength)
+	}
+	for _, r := range tag {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.') {
+			return fmt.Errorf("version tag '%s' contains %q; only letters, digits, dashes, underscores and dots are allowed", tag, r)
+		}
+	}
+	return nil
+}
+
+// VersionTagKey returns the name of the Key Vault tag that marks a version with tag.
+func VersionTagKey(tag string) string {
+	return VersionTagPrefix + tag
+}
+
+// VersionTags returns the version tags among a version's Key Vault tags.
+func VersionTags(tags map[string]string) []string {
+	var result []string
+	for key := range tags {
+		if tag, ok := strings.CutPrefix(key, VersionTagPrefix); ok && tag != "" {
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// GetTaggedSecret returns the newest enabled version of a secret carrying tag, with its tags. It
+// returns an error wrapping ErrVersionTagNotFound if no version carries it.
+func GetTaggedSecret(ctx context.Context, store VersionStore, secretName, tag string) (*Secret, error) {
+	versions, err := store.ListSecretVersions(ctx, secretName)
+	if err != nil {
+		return nil, err
+	}
+	key := VersionTagKey(tag)
+	for _, version := range versions {
+		// Disabled versions can't be read
+		if _, ok := version.Tags[key]; ok && version.Enabled {
+			return store.GetSecretVersionWithProperties(ctx, secretName, version.Version)
+		}
+	}
+	return nil, fmt.Errorf("%w: no version of '%s' carries the tag '%s'", ErrVersionTagNotFound, secretName, tag)
+}
+
+// MoveVersionTag tags one version of a secret with tag and removes the tag from every other
+// version, so exactly one carries it. An empty version moves it to the newest version already
+// carrying it, as after storing a version with the tag set.
+//
+// The new version is tagged before the others are untagged, so a concurrent GetTaggedSecret
+// always finds one of them.
+func MoveVersionTag(ctx context.Context, store VersionStore, secretName, tag, version string) error {
+	versions, err := store.ListSecretVersions(ctx, secretName)
+	if err != nil {
+		return err
+	}
+	key := VersionTagKey(tag)
+	target := -1
+	for i, v := range versions {
+		_, tagged := v.Tags[key]
+		if v.Version == version || version == "" && tagged {
+			target = i
+			break
+		}
+	}
+	if target < 0 {
+		if version == "" {
+			return fmt.Errorf("%w: no version of '%s' carries the tag '%s'", ErrVersionTagNotFound, secretName, tag)
+		}
+		return fmt.Errorf("cannot tag version '%s' of secret '%s': %w", version, secretName, ErrSecretNotFound)
+	}
+
+	if _, tagged := versions[target].Tags[key]; !tagged {
+		if err := store.UpdateSecretTags(ctx, secretName, versions[target].Version, withTag(versions[target].Tags, key)); err != nil {
+			return err
+		}
+	}
+	for i, v := range versions {
+		if _, tagged := v.Tags[key]; i == target || !tagged {
+			continue
+		}
+		tags := copyTags(v.Tags)
+		delete(tags, key)
+		if err := store.UpdateSecretTags(ctx, secretName, v.Version, tags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withTag returns a copy of tags with key set
+func withTag(tags map[string]string, key string) map[string]string {
+	result := copyTags(tags)
+	if result == nil {
+		result = make(map[string]string, 1)
+	}
+	result[key] = "true"
+	return result
+}
@@ -0,0 +1,64 @@
+package vault
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateVersionTag(t *testing.T) {
+	for _, tag := range []string{"stable", "qa-2024", "release_1.2"} {
+		assert.NoError(t, ValidateVersionTag(tag), tag)
+	}
+	for _, tag := range []string{"", "has space", "a/b", strings.Repeat("a", MaxVersionTagLength+1)} {
+		assert.Error(t, ValidateVersionTag(tag), tag)
+	}
+}
+
+func TestMoveVersionTag(t *testing.T) {
+	ctx := context.Background()
+	store := NewFakeStore()
+	for _, value := range []string{"first", "second", "third"} {
+		assert.NoError(t, store.StoreSecret(ctx, "app-env", value, map[string]string{TagPushedBy: "alice"}, SecretAttributes{}))
+	}
+	_, err := GetTaggedSecret(ctx, store, "app-env", "stable")
+	assert.ErrorIs(t, err, ErrVersionTagNotFound)
+
+	assert.NoError(t, MoveVersionTag(ctx, store, "app-env", "stable", "1"))
+	secret, err := GetTaggedSecret(ctx, store, "app-env", "stable")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "first", secret.Value)
+		assert.Equal(t, "1", secret.Version)
+		assert.Equal(t, "alice", secret.Tags[TagPushedBy], "other tags are kept")
+	}
+
+	// Moving the tag takes it off the version that had it
+	assert.NoError(t, MoveVersionTag(ctx, store, "app-env", "stable", "2"))
+	versions, err := store.ListSecretVersions(ctx, "app-env")
+	assert.NoError(t, err)
+	var tagged []string
+	for _, version := range versions {
+		if len(VersionTags(version.Tags)) > 0 {
+			tagged = append(tagged, version.Version)
+		}
+	}
+	assert.Equal(t, []string{"2"}, tagged)
+	assert.Equal(t, []string{"stable"}, VersionTags(versions[1].Tags))
+
+	// A version stored with the tag keeps it, and the older ones lose it
+	assert.NoError(t, store.StoreSecret(ctx, "app-env", "fourth", map[string]string{VersionTagKey("stable"): "true"}, SecretAttributes{}))
+	assert.NoError(t, MoveVersionTag(ctx, store, "app-env", "stable", ""))
+	secret, err = GetTaggedSecret(ctx, store, "app-env", "stable")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "fourth", secret.Value)
+	}
+	second, err := store.GetSecretVersionWithProperties(ctx, "app-env", "2")
+	assert.NoError(t, err)
+	assert.Empty(t, VersionTags(second.Tags))
+
+	assert.ErrorIs(t, MoveVersionTag(ctx, store, "app-env", "stable", "9"), ErrSecretNotFound)
+	assert.ErrorIs(t, MoveVersionTag(ctx, store, "app-env", "qa", ""), ErrVersionTagNotFound)
+	assert.ErrorIs(t, MoveVersionTag(ctx, store, "missing", "stable", "1"), ErrSecretNotFound)
+}
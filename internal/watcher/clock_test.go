@@ -0,0 +1,106 @@
+package watcher
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when Advance is called
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1), deadline: c.now.Add(d), active: true}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, firing every timer that falls due
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if t.active && !t.deadline.After(c.now) {
+			t.active = false
+			select {
+			case t.c <- c.now:
+			default:
+			}
+		}
+	}
+}
+
+// fakeTimer is a Timer driven by a fakeClock
+type fakeTimer struct {
+	clock    *fakeClock
+	c        chan time.Time
+	deadline time.Time
+	active   bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.deadline, t.active = t.clock.now.Add(d), true
+	return wasActive
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := t.active
+	t.active = false
+	return wasActive
+}
+
+func TestFakeClockTimer(t *testing.T) {
+	clock := newFakeClock()
+	timer := clock.NewTimer(time.Minute)
+
+	clock.Advance(59 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("Timer fired before its deadline")
+	default:
+	}
+
+	clock.Advance(time.Second)
+	select {
+	case <-timer.C():
+	default:
+		t.Fatal("Timer did not fire at its deadline")
+	}
+
+	if timer.Reset(time.Minute) {
+		t.Error("Expected Reset of a fired timer to report it was inactive")
+	}
+	if !timer.Stop() {
+		t.Error("Expected Stop of a reset timer to report it was active")
+	}
+	clock.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal("Stopped timer fired")
+	default:
+	}
+}
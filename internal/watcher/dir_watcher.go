@@ -0,0 +1,140 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+)
+
+// DirWatcher finds the env files under a directory that match a glob pattern, such as */.env,
+// and reports each one once, including files created while it runs.
+type DirWatcher struct {
+	Dir       string
+	Pattern   string            // filepath.Match pattern relative to Dir
+	OnNewFile func(path string) // Called once per matching file, from the watching goroutine
+	watcher   *fsnotify.Watcher
+	known     map[string]bool // Files already passed to OnNewFile
+}
+
+// NewDirWatcher creates a watcher for files under dir matching pattern.
+func NewDirWatcher(dir, pattern string, onNewFile func(path string)) (*DirWatcher, error) {
+	if pattern == "" || filepath.IsAbs(pattern) || strings.HasPrefix(filepath.Clean(pattern), "..") {
+		return nil, fmt.Errorf("invalid pattern '%s': it must be relative to the watched directory", pattern)
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern '%s': %w", pattern, err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("cannot watch '%s': %w", dir, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("cannot watch '%s': not a directory", dir)
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &DirWatcher{
+		Dir:       dir,
+		Pattern:   filepath.Clean(pattern),
+		OnNewFile: onNewFile,
+		watcher:   watcher,
+		known:     make(map[string]bool),
+	}, nil
+}
+
+// Start reports the files that already match, then watches the directories the pattern can
+// match in for new ones until ctx is done.
+func (d *DirWatcher) Start(ctx context.Context) error {
+	defer d.watcher.Close()
+
+	if err := d.watchDirs(d.Dir, 0); err != nil {
+		return err
+	}
+	d.scan()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-d.watcher.Events:
+			if !ok {
+				return nil
+			}
+			if event.Op&(fsnotify.Create|fsnotify.Rename) == 0 {
+				continue
+			}
+			// A new directory may hold matches, or be where they will be created
+			if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+				if err := d.watchDirs(event.Name, d.depth(event.Name)); err != nil {
+					utils.PrintWarning("⚠️ %v\n", err)
+				}
+			}
+			d.scan()
+		case err, ok := <-d.watcher.Errors:
+			if !ok {
+				return nil
+			}
+			utils.PrintError("❌ Directory watcher error: %v\n", err)
+		}
+	}
+}
+
+// watchDirs watches dir and its subdirectories down to the depth the pattern's directory
+// components reach, since files can only match there
+func (d *DirWatcher) watchDirs(dir string, depth int) error {
+	if depth > strings.Count(d.Pattern, string(filepath.Separator)) || depth < 0 {
+		return nil
+	}
+	if err := d.watcher.Add(dir); err != nil {
+		return fmt.Errorf("cannot watch '%s': %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("cannot read '%s': %w", dir, err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			if err := d.watchDirs(filepath.Join(dir, entry.Name()), depth+1); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// depth returns how many directories path is below Dir, or -1 if it isn't inside Dir
+func (d *DirWatcher) depth(path string) int {
+	rel, err := filepath.Rel(d.Dir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return -1
+	}
+	if rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// scan passes every matching regular file not seen before to OnNewFile
+func (d *DirWatcher) scan() {
+	matches, err := filepath.Glob(filepath.Join(d.Dir, d.Pattern))
+	if err != nil {
+		return // The pattern was checked in NewDirWatcher
+	}
+	for _, path := range matches {
+		if d.known[path] {
+			continue
+		}
+		if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		d.known[path] = true
+		d.OnNewFile(path)
+	}
+}
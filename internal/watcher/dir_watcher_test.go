@@ -0,0 +1,84 @@
+package watcher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewDirWatcherValidation(t *testing.T) {
+	dir := t.TempDir()
+	for _, pattern := range []string{"", "[", "../*/.env", filepath.Join(dir, "*")} {
+		if _, err := NewDirWatcher(dir, pattern, func(string) {}); err == nil {
+			t.Errorf("Expected an error for pattern %q", pattern)
+		}
+	}
+	if _, err := NewDirWatcher(filepath.Join(dir, "missing"), "*/.env", func(string) {}); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
+
+func TestDirWatcherFindsFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{"api/.env", "web/.env", "web/.env.example", ".env"} {
+		writeFile(t, filepath.Join(dir, path))
+	}
+
+	found := make(chan string, 10)
+	w, err := NewDirWatcher(dir, "*/.env", func(path string) { found <- path })
+	if err != nil {
+		t.Fatalf("NewDirWatcher failed: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- w.Start(ctx) }()
+
+	got := []string{receive(t, found), receive(t, found)}
+	sort.Strings(got)
+	want := []string{filepath.Join(dir, "api", ".env"), filepath.Join(dir, "web", ".env")}
+	if got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Expected the existing matches %v, got %v", want, got)
+	}
+
+	// Files in new directories are found as they appear, and each file only once
+	writeFile(t, filepath.Join(dir, "worker", ".env"))
+	if path := receive(t, found); path != filepath.Join(dir, "worker", ".env") {
+		t.Errorf("Expected the new file to be found, got %s", path)
+	}
+	writeFile(t, filepath.Join(dir, "worker", ".env"))
+	select {
+	case path := <-found:
+		t.Errorf("Expected no more files, got %s", path)
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Expected a clean stop, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("KEY=value\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, found <-chan string) string {
+	t.Helper()
+	select {
+	case path := <-found:
+		return path
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for a file to be found")
+		return ""
+	}
+}
@@ -3,29 +3,75 @@ package watcher
 import (
 	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/lliamscholtz/env-sync/internal/config"
 	"github.com/lliamscholtz/env-sync/internal/utils"
 )
 
+// DefaultPostPullQuiet is the default window after a pull during which file
+// changes are not pushed.
+const DefaultPostPullQuiet = config.DefaultPostPullQuiet
+
+// DefaultMaxPullBackoff caps the interval between periodic pulls while they keep failing.
+const DefaultMaxPullBackoff = 1 * time.Hour
+
+// syncHistorySize is how many recent push and pull results the watcher keeps
+const syncHistorySize = 10
+
+// ErrSyncFailing is returned by Start when the watcher stops while its periodic pulls are failing,
+// so a process supervisor can tell a degraded watcher from a clean shutdown.
+var ErrSyncFailing = errors.New("periodic sync is failing")
+
+// promptLock serializes push prompts of watchers running in the same process, such as one per
+// file when watching a directory
+var promptLock sync.Mutex
+
+// Sync operations recorded in a SyncResult
+const (
+	OpPush = "push"
+	OpPull = "pull"
+)
+
+// SyncResult is the outcome of one push or periodic pull run by the watcher.
+type SyncResult struct {
+	Op   string // OpPush or OpPull
+	Time time.Time
+	Err  error
+}
+
 // FileWatcher monitors a file for changes and triggers a callback.
 type FileWatcher struct {
-	FilePath        string
-	SyncInterval    time.Duration
-	DebounceTime    time.Duration
-	OnChangeFunc    func() error // Called when file changes (push)
-	OnPeriodicFunc  func() error // Called on periodic intervals (pull)
-	EnablePush      bool         // Whether to push on file changes
-	ConfirmPush     bool         // Whether to prompt user before push
-	watcher         *fsnotify.Watcher
-	done            chan bool
-	lastPullTime    time.Time     // Timestamp of last pull operation
-	lastWatchCheck  time.Time     // Timestamp of last watcher health check
+	FilePath       string
+	SyncInterval   time.Duration
+	DebounceTime   time.Duration
+	PostPullQuiet  time.Duration // Window after a pull during which file changes are ignored
+	MaxPullBackoff time.Duration // Upper bound for the pull interval after consecutive failures
+	OnChangeFunc   func() error  // Called when file changes (push)
+	OnPeriodicFunc func() error  // Called on periodic intervals (pull)
+	EnablePush     bool          // Whether to push on file changes
+	ConfirmPush    bool          // Whether to prompt user before push
+	IgnorePaths    []string      // Files whose changes never trigger a push (e.g. a local overlay)
+	FailOnError    bool          // Stop at the first failed push or pull instead of retrying
+	Metrics        *Metrics      // Counts syncs for the health and metrics endpoints; nil disables them
+	Clock          Clock         // Source of time for debouncing, the quiet window and periodic pulls
+	watcher        *fsnotify.Watcher
+	done           chan bool
+	lastPullTime   time.Time    // Timestamp of last pull operation
+	lastChangeTime time.Time    // Timestamp of the last change handled, for debouncing
+	lastOwnHash    string       // Hash of the file as left by the last push or pull, including conflict-resolution writes
+	lastWatchCheck time.Time    // Timestamp of last watcher health check
+	pullFailures   int          // Consecutive periodic pull failures
+	history        []SyncResult // The last syncHistorySize push and pull results, oldest first
 }
 
 // NewFileWatcher creates a new file watcher instance.
@@ -38,10 +84,13 @@ func NewFileWatcher(filePath string, syncInterval, debounceTime time.Duration, o
 		FilePath:       filePath,
 		SyncInterval:   syncInterval,
 		DebounceTime:   debounceTime,
+		PostPullQuiet:  DefaultPostPullQuiet,
+		MaxPullBackoff: DefaultMaxPullBackoff,
 		OnChangeFunc:   onChange,
 		OnPeriodicFunc: onPeriodic,
 		EnablePush:     enablePush,
 		ConfirmPush:    confirmPush,
+		Clock:          realClock{},
 		watcher:        watcher,
 		done:           make(chan bool),
 		lastWatchCheck: time.Now(),
@@ -52,6 +101,8 @@ func NewFileWatcher(filePath string, syncInterval, debounceTime time.Duration, o
 func (w *FileWatcher) Start(ctx context.Context) error {
 	defer w.watcher.Close()
 	defer close(w.done)
+	w.Metrics.SetActive(true)
+	defer w.Metrics.SetActive(false)
 
 	// Watch both the file and its parent directory
 	// This handles atomic writes where editors create temp files and rename them
@@ -78,116 +129,275 @@ func (w *FileWatcher) Start(ctx context.Context) error {
 		utils.PrintInfo("🔍 Watching %s (file change push disabled, periodic pull only).\n", w.FilePath)
 	}
 
-	var lastChange time.Time
-	ticker := time.NewTicker(w.SyncInterval)
-	defer ticker.Stop()
+	pullTimer := w.Clock.NewTimer(w.SyncInterval)
+	defer pullTimer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			utils.PrintInfo("🛑 Stopping watcher...\n")
-			return nil
+			return w.shutdownError()
 		case event, ok := <-w.watcher.Events:
 			if !ok {
 				return nil
 			}
-			
-			// Debug: Always log all events to help diagnose issues
-			utils.PrintDebug("🔍 File event: %s -> %s (target: %s)\n", event.Name, event.Op.String(), w.FilePath)
-			
-			// Only process events related to our target file
-			isTargetFile := event.Name == w.FilePath || filepath.Base(event.Name) == filepath.Base(w.FilePath)
-			
-			// Handle file removal/recreation (atomic writes often do this) - do this first, outside other conditions
-			if event.Name == w.FilePath {
-				if event.Op&fsnotify.Remove == fsnotify.Remove {
-					utils.PrintDebug("📁 Target file removed, will re-watch when recreated\n")
-				}
-				
-				if event.Op&fsnotify.Create == fsnotify.Create {
-					utils.PrintDebug("📁 Target file recreated, ensuring it's being watched\n")
-					// Remove and re-add to ensure clean watching state
-					w.watcher.Remove(w.FilePath)
-					if err := w.watcher.Add(w.FilePath); err != nil {
-						utils.PrintError("❌ Could not re-watch file after recreation: %v\n", err)
-					} else {
-						utils.PrintDebug("✅ Successfully re-established watcher after file recreation\n")
-					}
-				}
-			}
-			
-			// Only process file changes if push is enabled
-			if w.EnablePush && isTargetFile {
-				// We care about writes, creates, and also renames (common with editors)
-				if event.Op&fsnotify.Write == fsnotify.Write || 
-				   event.Op&fsnotify.Create == fsnotify.Create ||
-				   event.Op&fsnotify.Rename == fsnotify.Rename {
-					
-					// Skip file changes that happen within 3 seconds of a pull operation
-					// This prevents the pull from triggering a push
-					if time.Since(w.lastPullTime) < 3*time.Second {
-						utils.PrintDebug("⏳ Skipping event (within 3s of pull): %s\n", event.Op.String())
-						continue
-					}
-					
-					// Check debounce timing
-					timeSinceLastChange := time.Since(lastChange)
-					utils.PrintDebug("⏱️ Time since last change: %.2fs (debounce: %.2fs)\n", timeSinceLastChange.Seconds(), w.DebounceTime.Seconds())
-					if timeSinceLastChange > w.DebounceTime {
-						utils.PrintInfo("📝 Change detected in %s (event: %s)\n", w.FilePath, event.Op.String())
-						
-						// Check if we should confirm before pushing
-						shouldPush := true
-						if w.ConfirmPush {
-							shouldPush = w.promptUserForPush()
-						}
-						
-						if shouldPush {
-							utils.PrintInfo("📤 Pushing changes to remote...\n")
-							if err := w.OnChangeFunc(); err != nil {
-								utils.PrintError("❌ Error during push: %v\n", err)
-							} else {
-								utils.PrintSuccess("✅ Successfully pushed encrypted .env file to Azure Key Vault.\n")
-							}
-						} else {
-							utils.PrintInfo("⏭️  Skipping push (user declined)\n")
-						}
-						
-						lastChange = time.Now()
-					} else {
-						utils.PrintDebug("⏳ Debouncing event (%.2fs since last): %s\n", timeSinceLastChange.Seconds(), event.Op.String())
-					}
-				} else {
-					utils.PrintDebug("🚫 Ignoring event type: %s\n", event.Op.String())
-				}
-			} else if !isTargetFile {
-				utils.PrintDebug("🔇 Ignoring non-target file event: %s\n", event.Name)
-			} else {
-				// File change detection disabled - only periodic pulls are active
-				utils.PrintDebug("📋 Push disabled, ignoring event: %s\n", event.Op.String())
+			w.handleEvent(event)
+			if err := w.failOnError(); err != nil {
+				return err
 			}
 		case err, ok := <-w.watcher.Errors:
 			if !ok {
 				return nil
 			}
 			utils.PrintError("❌ Watcher error: %v\n", err)
-		case <-ticker.C:
-			// Record pull time before and after pull operation
-			w.lastPullTime = time.Now()
-			if err := w.OnPeriodicFunc(); err != nil {
-				utils.PrintError("❌ Error during periodic pull: %v\n", err)
+		case <-pullTimer.C():
+			w.handlePullTick()
+			if err := w.failOnError(); err != nil {
+				return err
 			}
-			
-			// Periodically check if the watcher is still active (every 5 minutes)
-			if time.Since(w.lastWatchCheck) > 5*time.Minute {
-				utils.PrintDebug("🔍 Performing watcher health check...\n")
-				if err := w.ensureWatcherActive(); err != nil {
-					utils.PrintError("❌ Failed to ensure watcher is active: %v\n", err)
-				}
-				w.lastWatchCheck = time.Now()
+			pullTimer.Reset(w.nextPullInterval())
+		}
+	}
+}
+
+// handleEvent pushes on a change to the watched file, unless it falls in the quiet window after
+// a pull, was written by env-sync itself, or is debounced
+func (w *FileWatcher) handleEvent(event fsnotify.Event) {
+	// Debug: Always log all events to help diagnose issues
+	utils.PrintDebug("🔍 File event: %s -> %s (target: %s)\n", event.Name, event.Op.String(), w.FilePath)
+
+	// Changes to ignored files, such as a local overlay, never trigger a push
+	if w.isIgnored(event.Name) {
+		utils.PrintDebug("🔇 Ignoring event for ignored file: %s\n", event.Name)
+		return
+	}
+
+	// Only process events related to our target file
+	isTargetFile := event.Name == w.FilePath || filepath.Base(event.Name) == filepath.Base(w.FilePath)
+
+	// Handle file removal/recreation (atomic writes often do this) - do this first, outside other conditions
+	if event.Name == w.FilePath {
+		if event.Op&fsnotify.Remove == fsnotify.Remove {
+			utils.PrintDebug("📁 Target file removed, will re-watch when recreated\n")
+		}
+
+		if event.Op&fsnotify.Create == fsnotify.Create {
+			utils.PrintDebug("📁 Target file recreated, ensuring it's being watched\n")
+			// Remove and re-add to ensure clean watching state
+			w.watcher.Remove(w.FilePath)
+			if err := w.watcher.Add(w.FilePath); err != nil {
+				utils.PrintError("❌ Could not re-watch file after recreation: %v\n", err)
+			} else {
+				utils.PrintDebug("✅ Successfully re-established watcher after file recreation\n")
 			}
 		}
 	}
+
+	if !isTargetFile {
+		utils.PrintDebug("🔇 Ignoring non-target file event: %s\n", event.Name)
+		return
+	}
+	if !w.EnablePush {
+		// File change detection disabled - only periodic pulls are active
+		utils.PrintDebug("📋 Push disabled, ignoring event: %s\n", event.Op.String())
+		return
+	}
+	// We care about writes, creates, and also renames (common with editors)
+	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+		utils.PrintDebug("🚫 Ignoring event type: %s\n", event.Op.String())
+		return
+	}
+
+	now := w.Clock.Now()
+
+	// Skip file changes that happen within the quiet window after a pull operation
+	// This prevents the pull from triggering a push
+	if now.Sub(w.lastPullTime) < w.PostPullQuiet {
+		utils.PrintDebug("⏳ Skipping event (within %s of pull): %s\n", w.PostPullQuiet, event.Op.String())
+		return
+	}
+
+	// Skip writes made by env-sync itself, such as the merged content written
+	// back while resolving a conflict during a push
+	if w.isOwnWrite() {
+		utils.PrintDebug("🔇 Skipping event (content written by env-sync): %s\n", event.Op.String())
+		return
+	}
+
+	// Check debounce timing
+	timeSinceLastChange := now.Sub(w.lastChangeTime)
+	utils.PrintDebug("⏱️ Time since last change: %.2fs (debounce: %.2fs)\n", timeSinceLastChange.Seconds(), w.DebounceTime.Seconds())
+	if timeSinceLastChange <= w.DebounceTime {
+		utils.PrintDebug("⏳ Debouncing event (%.2fs since last): %s\n", timeSinceLastChange.Seconds(), event.Op.String())
+		return
+	}
+
+	log := utils.With("file", w.FilePath)
+	log.PrintInfo("📝 Change detected in %s (event: %s)\n", w.FilePath, event.Op.String())
+
+	// Check if we should confirm before pushing
+	shouldPush := true
+	if w.ConfirmPush {
+		shouldPush = w.promptUserForPush()
+	}
+
+	if shouldPush {
+		log.PrintInfo("📤 Pushing changes to remote...\n")
+		err := w.OnChangeFunc()
+		w.recordSync(OpPush, err)
+		if err != nil {
+			log.PrintError("❌ Error during push: %v\n", err)
+		} else {
+			log.PrintSuccess("✅ Successfully pushed encrypted .env file to Azure Key Vault.\n")
+			// A push may rewrite the file while resolving conflicts
+			w.recordOwnWrite()
+		}
+	} else {
+		log.PrintInfo("⏭️  Skipping push (user declined)\n")
+	}
+
+	w.lastChangeTime = w.Clock.Now()
+}
+
+// handlePullTick runs a periodic pull and, every few minutes, checks the watch is still in place
+func (w *FileWatcher) handlePullTick() {
+	// Record pull time before and after pull operation. Resetting it once the
+	// pull completes ensures slow pulls still get a full quiet window.
+	w.lastPullTime = w.Clock.Now()
+	pullErr := w.OnPeriodicFunc()
+	w.recordSync(OpPull, pullErr)
+	w.recordPullResult(pullErr)
+	w.lastPullTime = w.Clock.Now()
+	if pullErr == nil {
+		w.recordOwnWrite()
+	}
+
+	// Periodically check if the watcher is still active (every 5 minutes)
+	if w.Clock.Now().Sub(w.lastWatchCheck) > 5*time.Minute {
+		utils.PrintDebug("🔍 Performing watcher health check...\n")
+		if err := w.ensureWatcherActive(); err != nil {
+			utils.PrintError("❌ Failed to ensure watcher is active: %v\n", err)
+		}
+		w.lastWatchCheck = w.Clock.Now()
+	}
+}
+
+// recordOwnWrite remembers the file's current content as written by env-sync
+func (w *FileWatcher) recordOwnWrite() {
+	w.lastOwnHash = fileHash(w.FilePath)
+}
+
+// isOwnWrite reports whether the file still has the content env-sync last left in it
+func (w *FileWatcher) isOwnWrite() bool {
+	return w.lastOwnHash != "" && fileHash(w.FilePath) == w.lastOwnHash
+}
+
+// fileHash returns the SHA-256 of a file's content, or "" if it can't be read
+func fileHash(path string) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// isIgnored reports whether a file event path matches one of the ignored paths
+func (w *FileWatcher) isIgnored(name string) bool {
+	for _, ignored := range w.IgnorePaths {
+		if ignored != "" && samePath(name, ignored) {
+			return true
+		}
+	}
+	return false
+}
+
+// samePath compares two paths after resolving them to absolute, cleaned form
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA != nil || errB != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+	return absA == absB
+}
+
+// recordSync adds a push or pull result to the history, dropping the oldest beyond syncHistorySize
+func (w *FileWatcher) recordSync(op string, err error) {
+	w.history = append(w.history, SyncResult{Op: op, Time: w.Clock.Now(), Err: err})
+	w.Metrics.RecordSync(op, err, w.Clock.Now())
+	if len(w.history) > syncHistorySize {
+		w.history = w.history[len(w.history)-syncHistorySize:]
+	}
+}
+
+// failOnError returns the error of the latest sync if it failed and FailOnError is set
+func (w *FileWatcher) failOnError() error {
+	if !w.FailOnError || len(w.history) == 0 {
+		return nil
+	}
+	last := w.history[len(w.history)-1]
+	if last.Err == nil {
+		return nil
+	}
+	return fmt.Errorf("stopping the watcher after a failed %s: %w", last.Op, last.Err)
+}
+
+// shutdownError returns ErrSyncFailing, wrapping the pull's error, if the latest periodic pull failed
+func (w *FileWatcher) shutdownError() error {
+	for i := len(w.history) - 1; i >= 0; i-- {
+		if w.history[i].Op != OpPull {
+			continue
+		}
+		if w.history[i].Err == nil {
+			return nil
+		}
+		failed := 0
+		for _, result := range w.history {
+			if result.Err != nil {
+				failed++
+			}
+		}
+		return fmt.Errorf("%w: %d of the last %d syncs failed, the last pull with: %w", ErrSyncFailing, failed, len(w.history), w.history[i].Err)
+	}
+	return nil
+}
+
+// recordPullResult tracks consecutive pull failures, warning once per failure streak
+func (w *FileWatcher) recordPullResult(err error) {
+	log := utils.With("file", w.FilePath)
+	if err == nil {
+		if w.pullFailures > 0 {
+			log.PrintSuccess("✅ Periodic pull recovered after %d failed attempt(s)\n", w.pullFailures)
+		}
+		w.pullFailures = 0
+		return
+	}
+
+	w.pullFailures++
+	if w.pullFailures == 1 {
+		log.PrintWarning("⚠️ Error during periodic pull: %v\n", err)
+		log.PrintWarning("⏳ Backing off periodic pulls until the next success\n")
+	} else {
+		utils.PrintDebug("❌ Periodic pull failed again (%d consecutive): %v\n", w.pullFailures, err)
+	}
+}
+
+// nextPullInterval returns the delay before the next periodic pull, doubling
+// the sync interval for each consecutive failure up to MaxPullBackoff
+func (w *FileWatcher) nextPullInterval() time.Duration {
+	interval := w.SyncInterval
+	maxInterval := w.MaxPullBackoff
+	if maxInterval < interval {
+		maxInterval = interval
+	}
+	for i := 0; i < w.pullFailures && interval < maxInterval; i++ {
+		interval *= 2
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
 }
 
 // Stop gracefully shuts down the file watcher.
@@ -231,7 +441,9 @@ func (w *FileWatcher) ensureWatcherActive() error {
 
 // promptUserForPush prompts the user to confirm whether they want to push changes
 func (w *FileWatcher) promptUserForPush() bool {
-	fmt.Printf("\n🚀 Push changes to remote? [y/N]: ")
+	promptLock.Lock()
+	defer promptLock.Unlock()
+	fmt.Printf("\n🚀 Push changes in %s to remote? [y/N]: ", w.FilePath)
 	
 	reader := bufio.NewReader(os.Stdin)
 	response, err := reader.ReadString('\n')
@@ -2,11 +2,15 @@ package watcher
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/fsnotify/fsnotify"
 )
 
 func TestNewFileWatcher(t *testing.T) {
@@ -185,7 +189,7 @@ func TestFileWatcherAtomicWrites(t *testing.T) {
 	watcher, err := NewFileWatcher(
 		testFile,
 		10*time.Second, // Long interval to avoid periodic calls during test
-		50*time.Millisecond,  // Short debounce
+		0,              // No debounce, so the test doesn't depend on timing
 		onChange,
 		onPeriodic,
 		true,  // Enable push
@@ -227,9 +231,6 @@ func TestFileWatcherAtomicWrites(t *testing.T) {
 		case <-time.After(2 * time.Second):
 			t.Errorf("❌ Atomic write change %d was not detected within timeout", i)
 		}
-		
-		// Wait a bit between changes to avoid debouncing
-		time.Sleep(100 * time.Millisecond)
 	}
 	
 	cancel()
@@ -240,4 +241,283 @@ func TestFileWatcherAtomicWrites(t *testing.T) {
 	case <-time.After(2 * time.Second):
 		t.Error("Watcher did not stop within timeout")
 	}
-}
\ No newline at end of file
+}
+
+// newClockedWatcher returns a watcher on a fresh env file that auto-pushes, driven by a fake clock
+func newClockedWatcher(t *testing.T, debounce time.Duration) (*FileWatcher, *fakeClock, *int) {
+	t.Helper()
+	testFile := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(testFile, []byte("TEST=value"), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	pushes := 0
+	clock := newFakeClock()
+	w := &FileWatcher{
+		FilePath:       testFile,
+		SyncInterval:   time.Minute,
+		DebounceTime:   debounce,
+		PostPullQuiet:  DefaultPostPullQuiet,
+		OnChangeFunc:   func() error { pushes++; return nil },
+		OnPeriodicFunc: func() error { return nil },
+		EnablePush:     true,
+		Clock:          clock,
+		lastWatchCheck: clock.Now(),
+	}
+	return w, clock, &pushes
+}
+
+// edit changes the watched file and delivers the write event to the watcher
+func edit(t *testing.T, w *FileWatcher, content string) {
+	t.Helper()
+	if err := os.WriteFile(w.FilePath, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+	w.handleEvent(fsnotify.Event{Name: w.FilePath, Op: fsnotify.Write})
+}
+
+func TestFileWatcherDebounce(t *testing.T) {
+	w, clock, pushes := newClockedWatcher(t, 5*time.Second)
+
+	edit(t, w, "TEST=one")
+	if *pushes != 1 {
+		t.Fatalf("Expected the first change to push, got %d pushes", *pushes)
+	}
+
+	clock.Advance(4 * time.Second)
+	edit(t, w, "TEST=two")
+	if *pushes != 1 {
+		t.Errorf("Expected a change within the debounce interval to be skipped, got %d pushes", *pushes)
+	}
+
+	clock.Advance(2 * time.Second)
+	edit(t, w, "TEST=three")
+	if *pushes != 2 {
+		t.Errorf("Expected a change after the debounce interval to push, got %d pushes", *pushes)
+	}
+}
+
+func TestFileWatcherPostPullQuiet(t *testing.T) {
+	w, clock, pushes := newClockedWatcher(t, 0)
+	w.PostPullQuiet = 3 * time.Second
+
+	// A slow pull that writes the file and then takes longer than the quiet window
+	w.OnPeriodicFunc = func() error {
+		if err := os.WriteFile(w.FilePath, []byte("TEST=pulled"), 0600); err != nil {
+			return err
+		}
+		clock.Advance(10 * time.Second)
+		return nil
+	}
+	w.handlePullTick()
+
+	clock.Advance(2 * time.Second)
+	edit(t, w, "TEST=edited-during-quiet-window")
+	if *pushes != 0 {
+		t.Errorf("Expected changes within the quiet window after a pull to be skipped, got %d pushes", *pushes)
+	}
+
+	clock.Advance(2 * time.Second)
+	edit(t, w, "TEST=edited-later")
+	if *pushes != 1 {
+		t.Errorf("Expected a change after the quiet window to push, got %d pushes", *pushes)
+	}
+}
+
+func TestFileWatcherDefaultPostPullQuiet(t *testing.T) {
+	watcher, err := NewFileWatcher(filepath.Join(t.TempDir(), ".env"), time.Minute, time.Second, nil, nil, true, false)
+	if err != nil {
+		t.Fatalf("NewFileWatcher failed: %v", err)
+	}
+	if watcher.PostPullQuiet != DefaultPostPullQuiet {
+		t.Errorf("Expected default PostPullQuiet=%v, got %v", DefaultPostPullQuiet, watcher.PostPullQuiet)
+	}
+}
+
+func TestNextPullInterval(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		maxBackoff time.Duration
+		expected   time.Duration
+	}{
+		{"no failures", 0, time.Hour, 1 * time.Minute},
+		{"one failure doubles", 1, time.Hour, 2 * time.Minute},
+		{"three failures", 3, time.Hour, 8 * time.Minute},
+		{"capped at max backoff", 10, 10 * time.Minute, 10 * time.Minute},
+		{"cap below interval uses interval", 5, 30 * time.Second, 1 * time.Minute},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &FileWatcher{
+				SyncInterval:   1 * time.Minute,
+				MaxPullBackoff: tt.maxBackoff,
+				pullFailures:   tt.failures,
+			}
+			if got := w.nextPullInterval(); got != tt.expected {
+				t.Errorf("Expected interval %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestFileWatcherPullBackoff(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, ".env")
+
+	// Create test file
+	if err := os.WriteFile(testFile, []byte("TEST=value"), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	pullAttempts := 0
+	onChange := func() error { return nil }
+	onPeriodic := func() error {
+		pullAttempts++
+		return fmt.Errorf("vault unreachable")
+	}
+	
+	watcher, err := NewFileWatcher(
+		testFile,
+		50*time.Millisecond,
+		10*time.Millisecond,
+		onChange,
+		onPeriodic,
+		false,
+		false,
+	)
+	if err != nil {
+		t.Fatalf("NewFileWatcher failed: %v", err)
+	}
+	
+	// Without backoff this would attempt ~16 pulls; with doubling it is 50+100+200+400ms
+	ctx, cancel := context.WithTimeout(context.Background(), 800*time.Millisecond)
+	defer cancel()
+	
+	// Stopping while the pulls fail reports the watcher as degraded
+	if err := watcher.Start(ctx); !errors.Is(err, ErrSyncFailing) {
+		t.Fatalf("Expected ErrSyncFailing from Start, got %v", err)
+	}
+	
+	if pullAttempts == 0 || pullAttempts > 5 {
+		t.Errorf("Expected between 1 and 5 pull attempts with backoff, got %d", pullAttempts)
+	}
+}
+
+func TestFileWatcherIgnorePaths(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, ".env")
+	overlayFile := filepath.Join(tempDir, ".env.local")
+	
+	w := &FileWatcher{FilePath: testFile, IgnorePaths: []string{overlayFile}}
+	
+	if !w.isIgnored(overlayFile) {
+		t.Errorf("Expected %s to be ignored", overlayFile)
+	}
+	if !w.isIgnored(filepath.Join(tempDir, ".", ".env.local")) {
+		t.Error("Expected an equivalent unclean path to be ignored")
+	}
+	if w.isIgnored(testFile) {
+		t.Errorf("Expected %s not to be ignored", testFile)
+	}
+}
+
+func TestFileWatcherIgnoresOwnWrites(t *testing.T) {
+	tempDir := t.TempDir()
+	testFile := filepath.Join(tempDir, ".env")
+
+	if err := os.WriteFile(testFile, []byte("TEST=value"), 0600); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	// Simulate a push that resolves a conflict by writing merged content back to the file
+	var pushes atomic.Int32
+	onChange := func() error {
+		pushes.Add(1)
+		return os.WriteFile(testFile, []byte("TEST=merged\nREMOTE=value"), 0600)
+	}
+	onPeriodic := func() error { return nil }
+
+	// No debounce, so only the own-write check can keep the merged write from being pushed
+	watcher, err := NewFileWatcher(testFile, time.Hour, 0, onChange, onPeriodic, true, false)
+	if err != nil {
+		t.Fatalf("NewFileWatcher failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- watcher.Start(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(testFile, []byte("TEST=edited"), 0600); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Watcher did not stop within timeout")
+	}
+	if count := pushes.Load(); count != 1 {
+		t.Errorf("Expected exactly one push for the user's edit, got %d", count)
+	}
+}
+
+func TestFileWatcherSyncHistory(t *testing.T) {
+	w, clock, _ := newClockedWatcher(t, 0)
+	pullErr := errors.New("vault unreachable")
+	w.OnPeriodicFunc = func() error { return pullErr }
+
+	if err := w.shutdownError(); err != nil {
+		t.Errorf("Expected no error before any sync, got %v", err)
+	}
+
+	w.handlePullTick()
+	clock.Advance(w.PostPullQuiet)
+	edit(t, w, "TEST=pushed")
+	if len(w.history) != 2 || w.history[1].Op != OpPush {
+		t.Fatalf("Expected a pull and a push in the history, got %+v", w.history)
+	}
+	err := w.shutdownError()
+	if !errors.Is(err, ErrSyncFailing) || !errors.Is(err, pullErr) {
+		t.Errorf("Expected a failed last pull to fail the shutdown even after a push, got %v", err)
+	}
+
+	w.OnPeriodicFunc = func() error { return nil }
+	w.handlePullTick()
+	if err := w.shutdownError(); err != nil {
+		t.Errorf("Expected a recovered pull to shut down cleanly, got %v", err)
+	}
+
+	for i := 0; i < 2*syncHistorySize; i++ {
+		w.handlePullTick()
+	}
+	if len(w.history) != syncHistorySize {
+		t.Errorf("Expected the history to keep %d results, got %d", syncHistorySize, len(w.history))
+	}
+}
+
+func TestFileWatcherFailOnError(t *testing.T) {
+	w, clock, _ := newClockedWatcher(t, 0)
+	w.handlePullTick()
+	if err := w.failOnError(); err != nil {
+		t.Errorf("Expected no error without FailOnError, got %v", err)
+	}
+
+	clock.Advance(w.PostPullQuiet)
+	pushErr := errors.New("forbidden")
+	w.OnChangeFunc = func() error { return pushErr }
+	edit(t, w, "TEST=edited")
+	if err := w.failOnError(); err != nil {
+		t.Errorf("Expected failures to be retried without FailOnError, got %v", err)
+	}
+
+	w.FailOnError = true
+	if err := w.failOnError(); !errors.Is(err, pushErr) {
+		t.Errorf("Expected the failed push to stop the watcher, got %v", err)
+	}
+}
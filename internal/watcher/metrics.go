@@ -0,0 +1,157 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/utils"
+)
+
+// metricsShutdownTimeout bounds how long the metrics server waits for requests in flight on shutdown
+const metricsShutdownTimeout = 5 * time.Second
+
+// Metrics counts the syncs of a running watcher for the /healthz and /metrics endpoints. The
+// methods are safe for concurrent use and do nothing on a nil *Metrics, so callers needn't check
+// whether metrics are enabled.
+type Metrics struct {
+	mu             sync.Mutex
+	active         bool
+	pushes         uint64
+	pulls          uint64
+	conflicts      uint64
+	pushErrors     uint64
+	pullErrors     uint64
+	lastSync       time.Time // Time of the last successful push or pull
+	lastPullFailed bool
+}
+
+// NewMetrics returns empty metrics for a watcher that hasn't started yet.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// SetActive records whether the watcher is running.
+func (m *Metrics) SetActive(active bool) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active = active
+}
+
+// RecordSync counts a push or pull (OpPush or OpPull) that finished at the given time.
+func (m *Metrics) RecordSync(op string, err error, at time.Time) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	switch op {
+	case OpPush:
+		m.pushes++
+		if err != nil {
+			m.pushErrors++
+		}
+	case OpPull:
+		m.pulls++
+		if err != nil {
+			m.pullErrors++
+		}
+		m.lastPullFailed = err != nil
+	}
+	if err == nil {
+		m.lastSync = at
+	}
+}
+
+// RecordConflict counts a conflict between the local file and the remote secret.
+func (m *Metrics) RecordConflict() {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conflicts++
+}
+
+// Handler returns an http.Handler serving /healthz, which answers 200 while the watcher is
+// healthy and 503 otherwise, and /metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", m.serveHealth)
+	mux.HandleFunc("/metrics", m.serveMetrics)
+	return mux
+}
+
+func (m *Metrics) serveHealth(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	active, lastPullFailed := m.active, m.lastPullFailed
+	m.mu.Unlock()
+
+	switch {
+	case !active:
+		http.Error(w, "watcher not running", http.StatusServiceUnavailable)
+	case lastPullFailed:
+		http.Error(w, "last periodic pull failed", http.StatusServiceUnavailable)
+	default:
+		fmt.Fprintln(w, "ok")
+	}
+}
+
+func (m *Metrics) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	lastSync := 0.0
+	if !m.lastSync.IsZero() {
+		lastSync = float64(m.lastSync.UnixNano()) / float64(time.Second)
+	}
+	up := 0
+	if m.active {
+		up = 1
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP envsync_watcher_up Whether the watcher is running.\n# TYPE envsync_watcher_up gauge\nenvsync_watcher_up %d\n", up)
+	fmt.Fprintf(w, "# HELP envsync_pushes_total Pushes triggered by file changes.\n# TYPE envsync_pushes_total counter\nenvsync_pushes_total %d\n", m.pushes)
+	fmt.Fprintf(w, "# HELP envsync_pulls_total Periodic pulls.\n# TYPE envsync_pulls_total counter\nenvsync_pulls_total %d\n", m.pulls)
+	fmt.Fprintf(w, "# HELP envsync_conflicts_total Conflicts between the env file and the remote secret.\n# TYPE envsync_conflicts_total counter\nenvsync_conflicts_total %d\n", m.conflicts)
+	fmt.Fprintf(w, "# HELP envsync_errors_total Failed pushes and pulls.\n# TYPE envsync_errors_total counter\n")
+	fmt.Fprintf(w, "envsync_errors_total{op=\"push\"} %d\nenvsync_errors_total{op=\"pull\"} %d\n", m.pushErrors, m.pullErrors)
+	fmt.Fprintf(w, "# HELP envsync_last_sync_timestamp_seconds Time of the last successful push or pull.\n# TYPE envsync_last_sync_timestamp_seconds gauge\nenvsync_last_sync_timestamp_seconds %g\n", lastSync)
+}
+
+// Serve serves Handler on addr until ctx is done, then shuts the server down. It returns once
+// addr is bound, so a port in use fails right away; the returned channel is closed when the
+// server has shut down.
+func (m *Metrics) Serve(ctx context.Context, addr string) (<-chan struct{}, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for metrics on %s: %w", addr, err)
+	}
+	server := &http.Server{Handler: m.Handler(), ReadHeaderTimeout: 10 * time.Second}
+
+	stopped := make(chan struct{})
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			utils.PrintError("❌ Metrics server failed: %v\n", err)
+		}
+	}()
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			utils.PrintWarning("⚠️ Metrics server did not shut down cleanly: %v\n", err)
+		}
+	}()
+	utils.PrintInfo("📈 Serving /healthz and /metrics on %s\n", listener.Addr())
+	return stopped, nil
+}
@@ -0,0 +1,105 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func get(t *testing.T, handler http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	body, _ := io.ReadAll(rec.Body)
+	return rec.Code, string(body)
+}
+
+func TestMetricsHealth(t *testing.T) {
+	m := NewMetrics()
+	handler := m.Handler()
+
+	if code, _ := get(t, handler, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 before the watcher starts, got %d", code)
+	}
+	m.SetActive(true)
+	if code, _ := get(t, handler, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected 200 for a running watcher, got %d", code)
+	}
+	m.RecordSync(OpPush, errors.New("push failed"), time.Now())
+	if code, _ := get(t, handler, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected a failed push to leave the watcher healthy, got %d", code)
+	}
+	m.RecordSync(OpPull, errors.New("vault unreachable"), time.Now())
+	if code, _ := get(t, handler, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after a failed pull, got %d", code)
+	}
+	m.RecordSync(OpPull, nil, time.Now())
+	if code, _ := get(t, handler, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected 200 once a pull succeeds again, got %d", code)
+	}
+	m.SetActive(false)
+	if code, _ := get(t, handler, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 after the watcher stops, got %d", code)
+	}
+}
+
+func TestMetricsCounters(t *testing.T) {
+	m := NewMetrics()
+	m.SetActive(true)
+	m.RecordSync(OpPush, nil, time.Unix(1700000000, 0))
+	m.RecordSync(OpPush, errors.New("push failed"), time.Unix(1700000100, 0))
+	m.RecordSync(OpPull, nil, time.Unix(1700000200, 0))
+	m.RecordConflict()
+
+	code, body := get(t, m.Handler(), "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("Expected 200 from /metrics, got %d", code)
+	}
+	for _, line := range []string{
+		"envsync_watcher_up 1",
+		"envsync_pushes_total 2",
+		"envsync_pulls_total 1",
+		"envsync_conflicts_total 1",
+		`envsync_errors_total{op="push"} 1`,
+		`envsync_errors_total{op="pull"} 0`,
+		"envsync_last_sync_timestamp_seconds 1.7000002e+09",
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected %q in the metrics, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsNil(t *testing.T) {
+	var m *Metrics
+	m.SetActive(true)
+	m.RecordSync(OpPush, nil, time.Now())
+	m.RecordConflict()
+}
+
+func TestMetricsServe(t *testing.T) {
+	m := NewMetrics()
+	m.SetActive(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopped, err := m.Serve(ctx, "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(metricsShutdownTimeout + time.Second):
+		t.Fatal("Expected the metrics server to shut down when the context is canceled")
+	}
+
+	if _, err := m.Serve(context.Background(), "not an address"); err == nil {
+		t.Error("Expected an error for an invalid address")
+	}
+}
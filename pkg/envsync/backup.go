@@ -0,0 +1,121 @@
+package envsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/auth"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+)
+
+// PushBackup holds a secret as it was before a push overwrote it. The value stays encrypted, so
+// neither saving nor restoring it needs the key.
+type PushBackup struct {
+	CreatedAt  time.Time         `json:"created_at"`
+	VaultURL   string            `json:"vault_url"`
+	SecretName string            `json:"secret_name"`
+	Version    string            `json:"version,omitempty"` // Version that was backed up
+	Value      string            `json:"value"`
+	Tags       map[string]string `json:"tags,omitempty"`
+}
+
+// RestoreOptions controls how Restore stores a backup.
+type RestoreOptions struct {
+	// Force restores a backup taken from another vault than the configured one.
+	Force bool
+	// Timeout bounds each vault call. Zero leaves the calls bounded by ctx only.
+	Timeout time.Duration
+}
+
+// SavePushBackup writes backup to path, readable only by the current user.
+func SavePushBackup(path string, backup *PushBackup) error {
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal backup: %w", err)
+	}
+	if err := os.WriteFile(path, data, utils.SecretFileMode); err != nil {
+		return fmt.Errorf("failed to write backup '%s': %w", path, err)
+	}
+	return nil
+}
+
+// LoadPushBackup reads a backup written by Push.
+func LoadPushBackup(path string) (*PushBackup, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no backup found at '%s'", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup '%s': %w", path, err)
+	}
+	var backup PushBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("failed to parse backup '%s': %w", path, err)
+	}
+	if backup.SecretName == "" || backup.Value == "" {
+		return nil, fmt.Errorf("'%s' is not a push backup: it has no secret name or value", path)
+	}
+	return &backup, nil
+}
+
+// Restore stores the value in backup as a new version of its secret, without decrypting it. The
+// new version gets the configured activation and expiry dates like a push, and keeps the backed
+// up content hash, but not its version tags, which stay on the versions carrying them. Restore
+// refuses read-only configurations, secrets outside cfg.SecretPrefix, and backups from another
+// vault unless opts.Force is set.
+func Restore(ctx context.Context, cfg *Config, store SecretStore, backup *PushBackup, opts RestoreOptions) error {
+	if err := cfg.CheckWritable("restore a backup"); err != nil {
+		return err
+	}
+	if err := cfg.CheckSecretPrefix(backup.SecretName); err != nil {
+		return err
+	}
+	if backup.VaultURL != "" && !sameVault(backup.VaultURL, cfg.VaultURL) && !opts.Force {
+		return fmt.Errorf("%w: '%s' was backed up from '%s', not the configured vault '%s'", ErrOtherVault, backup.SecretName, backup.VaultURL, cfg.VaultURL)
+	}
+	attrs, err := cfg.SecretAttributes(time.Now())
+	if err != nil {
+		return err
+	}
+
+	hostname, _ := os.Hostname()
+	tags := map[string]string{
+		vault.TagPushedBy: auth.CurrentUser(),
+		vault.TagHostname: hostname,
+		vault.TagMessage:  pushMessage(fmt.Sprintf("Restored from a backup taken %s", backup.CreatedAt.UTC().Format(time.RFC3339))),
+	}
+	if hash := backup.Tags[vault.TagContentHash]; hash != "" {
+		tags[vault.TagContentHash] = hash
+	}
+
+	storeCtx, cancel := callContext(ctx, opts.Timeout)
+	defer cancel()
+	err = store.StoreSecret(storeCtx, backup.SecretName, backup.Value, tags, attrs)
+	if err := withContextError(storeCtx, err); err != nil {
+		return fmt.Errorf("failed to restore secret '%s': %w", backup.SecretName, err)
+	}
+	return nil
+}
+
+// backupRemote saves secret, the remote version a push is about to replace, to path
+func backupRemote(cfg *Config, secretName, path string, secret *Secret) error {
+	backup := &PushBackup{
+		CreatedAt:  time.Now().UTC(),
+		VaultURL:   cfg.VaultURL,
+		SecretName: secretName,
+		Version:    secret.Version,
+		Value:      secret.Value,
+		Tags:       secret.Tags,
+	}
+	return SavePushBackup(path, backup)
+}
+
+// sameVault reports whether two vault URLs name the same vault, ignoring case and a trailing slash
+func sameVault(a, b string) bool {
+	return strings.EqualFold(strings.TrimSuffix(a, "/"), strings.TrimSuffix(b, "/"))
+}
@@ -0,0 +1,74 @@
+package envsync
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPushBackupAndRestore(t *testing.T) {
+	mapping := writeEnvFile(t, "KEY1=value1\n")
+	store := vault.NewFakeStore()
+	cfg := &Config{VaultURL: "https://myvault.vault.azure.net/"}
+	backupFile := filepath.Join(t.TempDir(), "before-push.json")
+
+	// There is nothing to back up before the first push
+	_, err := Push(context.Background(), cfg, store, testKey(1), mapping, PushOptions{BackupFile: backupFile})
+	assert.NoError(t, err)
+	assert.NoFileExists(t, backupFile)
+	previous := latestValue(t, store, mapping.SecretName)
+
+	assert.NoError(t, os.WriteFile(mapping.EnvFile, []byte("KEY1=wrong\n"), 0600))
+	overwrite := func(*Conflict) (bool, error) { return true, nil }
+	_, err = Push(context.Background(), cfg, store, testKey(1), mapping, PushOptions{BackupFile: backupFile, ResolveConflict: overwrite})
+	assert.NoError(t, err)
+	info, err := os.Stat(backupFile)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	backup, err := LoadPushBackup(backupFile)
+	assert.NoError(t, err)
+	assert.Equal(t, mapping.SecretName, backup.SecretName)
+	assert.Equal(t, previous, backup.Value)
+
+	assert.NoError(t, Restore(context.Background(), cfg, store, backup, RestoreOptions{}))
+	assert.Equal(t, previous, latestValue(t, store, mapping.SecretName))
+	decrypted, err := crypto.DecryptEnvContent(latestValue(t, store, mapping.SecretName), testKey(1))
+	assert.NoError(t, err)
+	assert.Equal(t, "KEY1=value1\n", string(decrypted))
+	properties, err := store.GetSecretProperties(context.Background(), mapping.SecretName)
+	assert.NoError(t, err)
+	assert.Equal(t, backup.Tags[vault.TagContentHash], properties.Tags[vault.TagContentHash])
+	assert.Contains(t, properties.Tags[vault.TagMessage], "Restored from a backup")
+
+	// The local file still holds the wrong content, so pushing it again needs a pull first
+	_, err = Push(context.Background(), cfg, store, testKey(1), mapping, PushOptions{})
+	assert.ErrorIs(t, err, ErrRemoteChanged)
+}
+
+func TestRestoreChecks(t *testing.T) {
+	backup := &PushBackup{VaultURL: "https://myvault.vault.azure.net/", SecretName: "app-env", Value: "encrypted"}
+	store := vault.NewFakeStore()
+
+	err := Restore(context.Background(), &Config{VaultURL: "https://othervault.vault.azure.net/"}, store, backup, RestoreOptions{})
+	assert.ErrorIs(t, err, ErrOtherVault)
+	assert.NoError(t, Restore(context.Background(), &Config{VaultURL: "https://othervault.vault.azure.net/"}, store, backup, RestoreOptions{Force: true}))
+	assert.NoError(t, Restore(context.Background(), &Config{VaultURL: "https://MyVault.vault.azure.net"}, store, backup, RestoreOptions{}))
+
+	err = Restore(context.Background(), &Config{VaultURL: backup.VaultURL, ReadOnly: true}, store, backup, RestoreOptions{})
+	assert.ErrorIs(t, err, ErrReadOnly)
+	err = Restore(context.Background(), &Config{VaultURL: backup.VaultURL, SecretPrefix: "team-"}, store, backup, RestoreOptions{})
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "backup.json")
+	_, err = LoadPushBackup(path)
+	assert.ErrorContains(t, err, "no backup found")
+	assert.NoError(t, os.WriteFile(path, []byte("{}"), 0600))
+	_, err = LoadPushBackup(path)
+	assert.ErrorContains(t, err, "is not a push backup")
+}
@@ -0,0 +1,765 @@
+// Package envsync is the programmatic API behind the env-sync CLI. It pushes, pulls, rotates
+// and reports on encrypted .env files stored in Azure Key Vault, using the same encryption,
+// conflict detection and sync state as the CLI, so the two can be mixed on one project.
+//
+// A typical caller loads a configuration and key, creates a vault client and pushes:
+//
+//	cfg, err := envsync.LoadConfig(".env-sync.yaml")
+//	...
+//	client, err := vault.NewClient(cfg.VaultURL, cred)
+//	...
+//	result, err := envsync.Push(ctx, cfg, client, key, cfg.Mappings()[0], envsync.PushOptions{})
+package envsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/config"
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/sync"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+)
+
+// Config is an env-sync configuration, as read from .env-sync.yaml.
+type Config = config.Config
+
+// FileMapping pairs a local env file with the secret it is synced to.
+type FileMapping = config.FileMapping
+
+// Secret is a secret value together with its tags and version.
+type Secret = vault.Secret
+
+// SecretProperties holds a secret's metadata without its value.
+type SecretProperties = vault.SecretProperties
+
+var (
+	// ErrConflict is returned by Push when the remote has conflicting values and no resolver accepts them.
+	ErrConflict = sync.ErrConflict
+	// ErrRemoteChanged is returned by Push when the remote changed since the last sync but the local file did not.
+	ErrRemoteChanged = sync.ErrRemoteChanged
+	// ErrSecretNotFound is returned when the remote secret does not exist.
+	ErrSecretNotFound = vault.ErrSecretNotFound
+	// ErrConcurrentModification is returned by Push when someone else stored the secret during the push.
+	ErrConcurrentModification = vault.ErrConcurrentModification
+	// ErrReadOnly is returned by Push and Rotate when the configuration sets read_only.
+	ErrReadOnly = config.ErrReadOnly
+	// ErrKeyNotFound is returned by Get when the secret has no such key.
+	ErrKeyNotFound = errors.New("key not found")
+	// ErrVersionTagNotFound is returned by Pull when no version of the secret carries PullOptions.Tag.
+	ErrVersionTagNotFound = vault.ErrVersionTagNotFound
+	// ErrOtherVault is returned by Restore when the backup was taken from another vault.
+	ErrOtherVault = errors.New("backup is from another vault")
+	// ErrEmptyContent is returned by Push when the content is empty or only whitespace and
+	// PushOptions.AllowEmpty is not set.
+	ErrEmptyContent = errors.New("content is empty")
+)
+
+// LoadConfig reads an env-sync configuration file. An empty path uses .env-sync.yaml.
+func LoadConfig(path string) (*Config, error) {
+	return config.LoadConfig(path)
+}
+
+// SecretStore is the secret storage used by the API. *vault.Client implements it against
+// Azure Key Vault, and vault.FakeStore in memory for tests.
+type SecretStore = vault.SecretStore
+
+// Conflict describes keys whose local and remote values differ at push time.
+type Conflict struct {
+	SecretName string
+	EnvFile    string
+	Keys       []string          // Keys present on both sides with different values
+	Local      map[string]string // Parsed local content
+	Remote     map[string]string // Parsed remote content
+}
+
+// ConflictReport is the JSON form of a Conflict, for pipelines that can't answer a prompt.
+type ConflictReport struct {
+	SecretName string           `json:"secret_name"`
+	EnvFile    string           `json:"env_file"`
+	Redacted   bool             `json:"redacted"` // Values are masked with utils.Redact
+	Keys       []ConflictingKey `json:"keys"`
+}
+
+// ConflictingKey is a key whose local and remote values differ.
+type ConflictingKey struct {
+	Key    string `json:"key"`
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// Report describes the conflict for a machine-readable report. Values are redacted unless
+// showValues is set.
+func (c *Conflict) Report(showValues bool) ConflictReport {
+	report := ConflictReport{SecretName: c.SecretName, EnvFile: c.EnvFile, Redacted: !showValues, Keys: []ConflictingKey{}}
+	for _, key := range c.Keys {
+		local, remote := c.Local[key], c.Remote[key]
+		if !showValues {
+			local, remote = utils.Redact(local), utils.Redact(remote)
+		}
+		report.Keys = append(report.Keys, ConflictingKey{Key: key, Local: local, Remote: remote})
+	}
+	return report
+}
+
+// PushOptions controls how Push handles unsafe content and conflicts.
+type PushOptions struct {
+	// Content is pushed instead of the mapping's env file when not nil.
+	Content []byte
+	// Force pushes despite conflict markers, plaintext key material or unpulled remote changes.
+	Force bool
+	// AllowEmpty pushes content that is empty or only whitespace, which clears the remote secret.
+	// Without it such a push fails with ErrEmptyContent, since it usually means the file wasn't
+	// populated yet.
+	AllowEmpty bool
+	// Message is a note on why the content changed, stored with the new version. Whitespace is
+	// collapsed and messages longer than vault.MaxTagValueLength are truncated with a warning.
+	Message string
+	// ResolveConflict decides whether to overwrite conflicting remote values. Returning false
+	// cancels the push. When nil, a conflict fails the push with ErrConflict.
+	ResolveConflict func(*Conflict) (bool, error)
+	// Timeout bounds each vault call separately, so time spent in ResolveConflict does not
+	// count against the store. Zero leaves the calls bounded by ctx only.
+	Timeout time.Duration
+	// WaitForPropagation re-reads the secret after storing it until the pushed content comes back,
+	// for at most this long. Zero returns as soon as the store succeeds.
+	WaitForPropagation time.Duration
+	// BackupFile receives the remote secret, still encrypted, before it is overwritten, for
+	// Restore. Nothing is written when the push stores nothing or there is no remote secret yet.
+	BackupFile string
+	// Tag moves this version tag to the pushed version, or to the remote version when it already
+	// has the content, taking it off every other version. The store must be a vault.VersionStore.
+	Tag string
+}
+
+// PushResult reports what Push did.
+type PushResult struct {
+	Pushed      bool   // The content was stored as a new secret version
+	Unchanged   bool   // The remote already held identical content
+	Cancelled   bool   // ResolveConflict declined the push
+	FirstPush   bool   // No remote secret existed before
+	Propagated  bool   // opts.WaitForPropagation read the pushed content back
+	ContentHash string // Hash of the local content
+}
+
+// propagationPollInterval is how long Push waits between reads while confirming propagation
+var propagationPollInterval = time.Second
+
+// Push encrypts the mapping's env file (or opts.Content) and stores it in its secret. It refuses
+// read-only configurations, secrets outside cfg.SecretPrefix and unsafe content, skips content identical to the remote, refuses to overwrite remote changes that
+// were never pulled, and consults opts.ResolveConflict when keys conflict. The sync state next to
+// the env file is updated after a successful push.
+func Push(ctx context.Context, cfg *Config, store SecretStore, key []byte, mapping FileMapping, opts PushOptions) (*PushResult, error) {
+	if err := cfg.CheckWritable("push"); err != nil {
+		return nil, err
+	}
+	if err := cfg.CheckSecretPrefix(mapping.SecretName); err != nil {
+		return nil, err
+	}
+	log := utils.With("secret", mapping.SecretName, "file", mapping.EnvFile)
+	tagStore, err := versionStore(store, opts.Tag)
+	if err != nil {
+		return nil, err
+	}
+	localContent := opts.Content
+	if localContent == nil {
+		var err error
+		localContent, err = os.ReadFile(mapping.EnvFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read .env file from '%s': %w", mapping.EnvFile, err)
+		}
+	}
+	result := &PushResult{ContentHash: sync.ContentHash(localContent)}
+
+	// An empty push would wipe the remote for everyone who pulls next
+	if len(bytes.TrimSpace(localContent)) == 0 {
+		if !opts.AllowEmpty {
+			return nil, fmt.Errorf("'%s': %w; pushing it would clear the remote secret '%s'", mapping.EnvFile, ErrEmptyContent, mapping.SecretName)
+		}
+		log.PrintWarning("⚠️ '%s' is empty; pushing it clears the remote secret '%s'.\n", mapping.EnvFile, mapping.SecretName)
+	}
+
+	// Refuse to store a half-merged file or one that leaks key material
+	if err := sync.CheckPushContent(string(localContent), key); err != nil {
+		if !opts.Force {
+			return nil, fmt.Errorf("'%s': %w", mapping.EnvFile, err)
+		}
+		log.PrintWarning("⚠️ Pushing '%s' despite problems (forced): %v\n", mapping.EnvFile, err)
+	}
+
+	// Keep other env-sync processes on this machine (e.g. a second watcher) from pushing the same file
+	lock, err := sync.AcquireLock(sync.LockPath(mapping.EnvFile))
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := lock.Release(); err != nil {
+			utils.PrintWarning("⚠️ %v\n", err)
+		}
+	}()
+
+	// Try to get the current remote version to check for conflicts
+	var remoteContent []byte
+	var hasRemote bool
+	var remoteVersion string // The version we based this push on; the store is rejected if it moves
+
+	getCtx, cancel := callContext(ctx, opts.Timeout)
+	secret, err := store.GetSecretWithProperties(getCtx, mapping.SecretName)
+	err = withContextError(getCtx, err)
+	cancel()
+	switch {
+	case errors.Is(err, vault.ErrSecretNotFound):
+		log.PrintInfo("ℹ️ No remote version of '%s' found, this will be the first push.\n", mapping.SecretName)
+		result.FirstPush = true
+	case err != nil:
+		// Anything else (forbidden, network, timeout) says nothing about whether the secret exists
+		return nil, fmt.Errorf("failed to read remote secret '%s' before pushing: %w", mapping.SecretName, err)
+	default:
+		// Overwriting a secret another tool owns would destroy it
+		if err := checkContentType(mapping.SecretName, secret.ContentType, opts.Force); err != nil {
+			return nil, err
+		}
+		remoteVersion = secret.Version
+		if decrypted, err := cfg.DecryptContent(secret.Value, key); err == nil {
+			remoteContent = decrypted
+			hasRemote = true
+		} else {
+			var mismatch *crypto.KeyMismatchError
+			var notRecipient *crypto.NotRecipientError
+			if errors.As(err, &mismatch) {
+				utils.PrintWarning("⚠️ Could not decrypt remote content: %v. Proceeding with push...\n", mismatch)
+			} else if errors.As(err, &notRecipient) {
+				utils.PrintWarning("⚠️ Could not decrypt remote content: %v. Proceeding with push...\n", notRecipient)
+			} else {
+				utils.PrintWarning("⚠️ Could not decrypt remote content (possible key mismatch), proceeding with push...\n")
+			}
+		}
+	}
+
+	// Identical content would only add a version to the secret's history, unless it has to be
+	// encrypted to a changed recipient list. With ignore_comments_for_sync only key/value pairs count.
+	localSync := sync.NormalizeContent(string(localContent), cfg.IgnoreCommentsForSync)
+	remoteSync := sync.NormalizeContent(string(remoteContent), cfg.IgnoreCommentsForSync)
+	if hasRemote && localSync == remoteSync && cfg.RecipientsMatch(secret.Value) {
+		log.PrintSuccess("✅ '%s' is already up to date with '%s', nothing to push.\n", mapping.EnvFile, mapping.SecretName)
+		if err := sync.RecordSyncState(sync.ConfiguredStatePath(cfg, mapping.EnvFile), cfg.StateFilePerm(), mapping.SecretName, localSync, "push"); err != nil {
+			utils.PrintWarning("⚠️ %v\n", err)
+		}
+		result.Unchanged = true
+		if err := moveTag(ctx, tagStore, mapping.SecretName, opts, remoteVersion); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	// Refuse to overwrite remote changes that were never pulled: the local content is still what
+	// was last synced, but the remote has moved on
+	if hasRemote {
+		state, err := sync.LoadState(sync.ConfiguredStatePath(cfg, mapping.EnvFile))
+		if err != nil {
+			utils.PrintWarning("⚠️ Could not load sync state, skipping the check for unpulled remote changes: %v\n", err)
+			state = &sync.SyncState{}
+		}
+		if err := sync.CheckRemoteChanged(localSync, remoteSync, state.KnownHash(mapping.SecretName)); err != nil {
+			if !opts.Force {
+				return nil, fmt.Errorf("'%s': %w", mapping.SecretName, err)
+			}
+			log.PrintWarning("⚠️ Overwriting remote changes to '%s' that were never pulled (forced)\n", mapping.SecretName)
+		}
+	}
+
+	// Check for conflicts if we have both local and remote content
+	if hasRemote && len(remoteContent) > 0 {
+		conflict, err := detectConflict(mapping, localContent, remoteContent)
+		if err != nil {
+			return nil, err
+		}
+		if conflict != nil {
+			if opts.ResolveConflict == nil {
+				return nil, fmt.Errorf("%w: remote secret '%s' has conflicting values for %s", sync.ErrConflict, mapping.SecretName, strings.Join(conflict.Keys, ", "))
+			}
+			proceed, err := opts.ResolveConflict(conflict)
+			if err != nil {
+				return nil, err
+			}
+			if !proceed {
+				result.Cancelled = true
+				return result, nil
+			}
+		} else {
+			utils.PrintInfo("✅ No conflicts detected with remote version.\n")
+		}
+	}
+
+	// Save the version about to be replaced; without the backup the push doesn't go ahead
+	if opts.BackupFile != "" && secret != nil {
+		if err := backupRemote(cfg, mapping.SecretName, opts.BackupFile, secret); err != nil {
+			return nil, err
+		}
+		log.PrintInfo("💾 Saved the current remote '%s' to '%s'.\n", mapping.SecretName, opts.BackupFile)
+	}
+
+	// Proceed with the push
+	encrypted, err := cfg.EncryptContent(localContent, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt .env file: %w", err)
+	}
+	attrs, err := cfg.SecretAttributes(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Start a fresh timeout so time spent resolving a conflict doesn't count against the store
+	storeCtx, cancel := callContext(ctx, opts.Timeout)
+	defer cancel()
+
+	log.PrintInfo("🔒 Pushing encrypted '%s' to Azure Key Vault secret '%s'...\n", mapping.EnvFile, mapping.SecretName)
+	tags := sync.PushTags(localContent)
+	if message := pushMessage(opts.Message); message != "" {
+		tags[vault.TagMessage] = message
+	}
+	// Tagged as it is stored, so the tag can be moved to it without knowing its version
+	if opts.Tag != "" {
+		tags[vault.VersionTagKey(opts.Tag)] = "true"
+	}
+	err = store.StoreSecretIfVersionBestEffort(storeCtx, mapping.SecretName, encrypted, tags, attrs, remoteVersion)
+	if err := withContextError(storeCtx, err); err != nil {
+		if errors.Is(err, vault.ErrConcurrentModification) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store secret in Key Vault: %w", err)
+	}
+	if err := sync.RecordSyncState(sync.ConfiguredStatePath(cfg, mapping.EnvFile), cfg.StateFilePerm(), mapping.SecretName, localSync, "push"); err != nil {
+		utils.PrintWarning("⚠️ %v\n", err)
+	}
+
+	result.Pushed = true
+	if err := moveTag(ctx, tagStore, mapping.SecretName, opts, ""); err != nil {
+		return nil, err
+	}
+	if opts.WaitForPropagation > 0 {
+		result.Propagated = waitForPropagation(ctx, store, key, mapping.SecretName, result.ContentHash, opts.WaitForPropagation)
+		if result.Propagated {
+			log.PrintSuccess("✅ Confirmed '%s' propagated.\n", mapping.SecretName)
+		} else {
+			log.PrintWarning("⚠️ Could not confirm '%s' propagated within %s; teammates pulling right now may still get the previous version.\n", mapping.SecretName, opts.WaitForPropagation)
+		}
+	}
+	return result, nil
+}
+
+// versionStore returns store as a vault.VersionStore when tag is set, failing if it isn't one
+func versionStore(store SecretStore, tag string) (vault.VersionStore, error) {
+	if tag == "" {
+		return nil, nil
+	}
+	if err := vault.ValidateVersionTag(tag); err != nil {
+		return nil, err
+	}
+	tagStore, ok := store.(vault.VersionStore)
+	if !ok {
+		return nil, fmt.Errorf("version tags need a store that can read single versions, which %T cannot", store)
+	}
+	return tagStore, nil
+}
+
+// moveTag moves opts.Tag, if set, to version, or to the newest version carrying it when version
+// is empty. The content is already stored, so a failure here leaves the tag where it was.
+func moveTag(ctx context.Context, store vault.VersionStore, secretName string, opts PushOptions, version string) error {
+	if opts.Tag == "" {
+		return nil
+	}
+	tagCtx, cancel := callContext(ctx, opts.Timeout)
+	defer cancel()
+	err := vault.MoveVersionTag(tagCtx, store, secretName, opts.Tag, version)
+	if err := withContextError(tagCtx, err); err != nil {
+		return fmt.Errorf("stored '%s', but failed to move the tag '%s' to it: %w", secretName, opts.Tag, err)
+	}
+	utils.With("secret", secretName, "tag", opts.Tag).PrintSuccess("🏷️ Tagged the current version of '%s' as '%s'.\n", secretName, opts.Tag)
+	return nil
+}
+
+// checkContentType refuses a secret whose content type isn't env-sync's, or only warns about it when forced
+func checkContentType(secretName, contentType string, force bool) error {
+	err := crypto.CheckContentType(contentType)
+	if err == nil {
+		return nil
+	}
+	if !force {
+		return fmt.Errorf("'%s': %w", secretName, err)
+	}
+	utils.PrintWarning("⚠️ Using '%s' although %v (forced)\n", secretName, err)
+	return nil
+}
+
+// pushMessage prepares a push message for storage as a tag: on a single line and no longer than
+// Key Vault allows
+func pushMessage(message string) string {
+	message = strings.Join(strings.Fields(message), " ")
+	if runes := []rune(message); len(runes) > vault.MaxTagValueLength {
+		utils.PrintWarning("⚠️ The push message is %d characters long; only the first %d are kept.\n", len(runes), vault.MaxTagValueLength)
+		message = string(runes[:vault.MaxTagValueLength])
+	}
+	return message
+}
+
+// waitForPropagation reads secretName until its decrypted content hashes to contentHash, giving up
+// after window. Read and decryption errors are retried like stale content, since a replica that
+// hasn't caught up may briefly report either.
+func waitForPropagation(ctx context.Context, store SecretStore, key []byte, secretName, contentHash string, window time.Duration) bool {
+	ctx, cancel := context.WithTimeout(ctx, window)
+	defer cancel()
+
+	for {
+		if secret, err := store.GetSecretWithProperties(ctx, secretName); err == nil {
+			if decrypted, err := crypto.DecryptEnvContent(secret.Value, key); err == nil && sync.ContentHash(decrypted) == contentHash {
+				return true
+			}
+		}
+		utils.PrintDebug("🐛 '%s' has not propagated yet, retrying in %s\n", secretName, propagationPollInterval)
+
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(propagationPollInterval):
+		}
+	}
+}
+
+// detectConflict finds keys that have different values locally and remotely. Keys added or
+// removed on one side are not conflicts, only changed values are.
+func detectConflict(mapping FileMapping, localContent, remoteContent []byte) (*Conflict, error) {
+	localEnv, err := parseEnvContent(string(localContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse local .env content: %w", err)
+	}
+
+	remoteEnv, err := parseEnvContent(string(remoteContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote .env content: %w", err)
+	}
+
+	var conflictingKeys []string
+	for key, localValue := range localEnv {
+		if remoteValue, exists := remoteEnv[key]; exists && localValue != remoteValue {
+			conflictingKeys = append(conflictingKeys, key)
+		}
+	}
+	if len(conflictingKeys) == 0 {
+		return nil, nil
+	}
+
+	return &Conflict{
+		SecretName: mapping.SecretName,
+		EnvFile:    mapping.EnvFile,
+		Keys:       conflictingKeys,
+		Local:      localEnv,
+		Remote:     remoteEnv,
+	}, nil
+}
+
+// parseEnvContent parses .env content into key-value pairs for conflict detection
+func parseEnvContent(content string) (map[string]string, error) {
+	env := make(map[string]string)
+	lines := strings.Split(content, "\n")
+
+	for lineNum, line := range lines {
+		line = strings.TrimSpace(line)
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// Find the first = sign
+		equalIndex := strings.Index(line, "=")
+		if equalIndex == -1 {
+			return nil, fmt.Errorf("invalid .env format at line %d: missing '=' in '%s'", lineNum+1, utils.Redact(line))
+		}
+
+		key := strings.TrimSpace(line[:equalIndex])
+		value := line[equalIndex+1:] // Keep the value as-is (including quotes)
+
+		// Remove surrounding quotes if present
+		if len(value) >= 2 {
+			if (value[0] == '"' && value[len(value)-1] == '"') ||
+				(value[0] == '\'' && value[len(value)-1] == '\'') {
+				value = value[1 : len(value)-1]
+			}
+		}
+
+		env[key] = value
+	}
+
+	return env, nil
+}
+
+// PullOptions controls where Pull writes the decrypted content.
+type PullOptions struct {
+	// Out receives the decrypted content instead of the mapping's env file when not nil.
+	// The sync state is only updated when the env file is written.
+	Out io.Writer
+	// Format converts the content written to Out: "dotenv" (the default), "json" or "yaml".
+	// The env file itself is always written as dotenv.
+	Format string
+	// Force decrypts secrets whose content type says they weren't written by env-sync.
+	Force bool
+	// Backup copies the env file to .env-sync-backups beside it before overwriting it, when its
+	// content differs from the remote content.
+	Backup bool
+	// Cache remembers what earlier pulls wrote, so a pull whose secret is still at the same
+	// version and whose env file still has that content reads only the secret's properties,
+	// skipping the decryption and the write. Long-running callers such as the watcher set it.
+	Cache *PullCache
+	// Tag pulls the newest version carrying this version tag instead of the latest version. The
+	// store must be a vault.VersionStore.
+	Tag string
+}
+
+// PullResult reports what Pull did.
+type PullResult struct {
+	ContentHash string // Hash of the decrypted content
+	BackupPath  string // Where the previous env file was copied to with Backup, or "" if it wasn't
+	Unchanged   bool   // The cache showed the env file already has the remote content; nothing was written
+}
+
+// PullCache holds the version and content hash each env file was last pulled at. It is safe for
+// concurrent use.
+type PullCache struct {
+	lock    chan struct{}             // Guards entries
+	entries map[string]pullCacheEntry // By env file
+}
+
+type pullCacheEntry struct {
+	secretName  string
+	version     string
+	contentHash string
+}
+
+// NewPullCache returns an empty cache.
+func NewPullCache() *PullCache {
+	return &PullCache{lock: make(chan struct{}, 1), entries: make(map[string]pullCacheEntry)}
+}
+
+// lookup returns the cached content hash if mapping's env file was last pulled from version and
+// still has the content pulled then
+func (c *PullCache) lookup(mapping FileMapping, version string) (string, bool) {
+	c.lock <- struct{}{}
+	entry, ok := c.entries[mapping.EnvFile]
+	<-c.lock
+	if !ok || version == "" || entry.secretName != mapping.SecretName || entry.version != version {
+		return "", false
+	}
+	local, err := os.ReadFile(mapping.EnvFile)
+	if err != nil || sync.ContentHash(local) != entry.contentHash {
+		return "", false
+	}
+	return entry.contentHash, true
+}
+
+func (c *PullCache) store(mapping FileMapping, version, contentHash string) {
+	c.lock <- struct{}{}
+	defer func() { <-c.lock }()
+	c.entries[mapping.EnvFile] = pullCacheEntry{secretName: mapping.SecretName, version: version, contentHash: contentHash}
+}
+
+// Pull fetches the mapping's secret, decrypts it and writes it to the env file (or opts.Out),
+// recording the sync state. It returns an error wrapping ErrSecretNotFound when nothing has been pushed yet.
+func Pull(ctx context.Context, cfg *Config, store SecretStore, key []byte, mapping FileMapping, opts PullOptions) (*PullResult, error) {
+	if err := cfg.CheckSecretPrefix(mapping.SecretName); err != nil {
+		return nil, err
+	}
+	if opts.Out == nil && opts.Format != "" && opts.Format != sync.FormatDotenv {
+		return nil, fmt.Errorf("format '%s' needs an Out writer; the env file is always dotenv", opts.Format)
+	}
+	tagStore, err := versionStore(store, opts.Tag)
+	if err != nil {
+		return nil, err
+	}
+	// The cache only knows the latest version, which a tagged version may not be
+	if opts.Cache != nil && opts.Out == nil && opts.Tag == "" {
+		props, err := store.GetSecretProperties(ctx, mapping.SecretName)
+		if err := withContextError(ctx, err); err != nil {
+			return nil, fmt.Errorf("failed to get secret properties from Key Vault: %w", err)
+		}
+		if err := props.Attributes.Check(time.Now()); err != nil {
+			return nil, fmt.Errorf("'%s': %w", mapping.SecretName, err)
+		}
+		if contentHash, ok := opts.Cache.lookup(mapping, props.Version); ok {
+			return &PullResult{ContentHash: contentHash, Unchanged: true}, nil
+		}
+	}
+	var secret *vault.Secret
+	if opts.Tag != "" {
+		secret, err = vault.GetTaggedSecret(ctx, tagStore, mapping.SecretName, opts.Tag)
+	} else {
+		secret, err = store.GetSecretWithProperties(ctx, mapping.SecretName)
+	}
+	if err := withContextError(ctx, err); err != nil {
+		return nil, fmt.Errorf("failed to get secret from Key Vault: %w", err)
+	}
+	// An inactive version's value isn't meant to be used yet, or any more
+	if err := secret.Attributes.Check(time.Now()); err != nil {
+		return nil, fmt.Errorf("'%s': %w", mapping.SecretName, err)
+	}
+	if err := checkContentType(mapping.SecretName, secret.ContentType, opts.Force); err != nil {
+		return nil, err
+	}
+
+	// Decrypt the content before writing to file
+	decrypted, err := cfg.DecryptContent(secret.Value, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret: %w", err)
+	}
+	result := &PullResult{ContentHash: sync.ContentHash(decrypted)}
+
+	if opts.Out != nil {
+		formatted, err := sync.FormatEnvContent(decrypted, opts.Format)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := opts.Out.Write(formatted); err != nil {
+			return nil, fmt.Errorf("failed to write decrypted content: %w", err)
+		}
+		return result, nil
+	}
+
+	if opts.Backup {
+		local, err := os.ReadFile(mapping.EnvFile)
+		if err == nil && !bytes.Equal(local, decrypted) {
+			if result.BackupPath, err = sync.BackupLocalFile(cfg, mapping.EnvFile, local, time.Now()); err != nil {
+				return nil, err
+			}
+		} else if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read env file '%s' for a backup: %w", mapping.EnvFile, err)
+		}
+	}
+	if err := utils.WriteFileMode(mapping.EnvFile, decrypted, cfg.EnvFilePerm()); err != nil {
+		return nil, fmt.Errorf("failed to write to env file '%s': %w", mapping.EnvFile, err)
+	}
+
+	if err := sync.RecordSyncState(sync.ConfiguredStatePath(cfg, mapping.EnvFile), cfg.StateFilePerm(), mapping.SecretName, sync.NormalizeContent(string(decrypted), cfg.IgnoreCommentsForSync), "pull"); err != nil {
+		utils.PrintWarning("⚠️ %v\n", err)
+	}
+	if opts.Cache != nil {
+		opts.Cache.store(mapping, secret.Version, result.ContentHash)
+	}
+	return result, nil
+}
+
+// Get fetches the mapping's secret, decrypts it and returns the value of a single key, without
+// writing anything to disk or touching the sync state. It returns an error wrapping
+// ErrKeyNotFound when the secret has no such key.
+func Get(ctx context.Context, cfg *Config, store SecretStore, key []byte, mapping FileMapping, name string) (string, error) {
+	var content bytes.Buffer
+	if _, err := Pull(ctx, cfg, store, key, mapping, PullOptions{Out: &content}); err != nil {
+		return "", err
+	}
+	env, err := sync.ParseEnvContent(content.String())
+	if err != nil {
+		return "", fmt.Errorf("failed to parse '%s': %w", mapping.SecretName, err)
+	}
+	value, ok := env[name]
+	if !ok {
+		return "", fmt.Errorf("%w: '%s' has no %s", ErrKeyNotFound, mapping.SecretName, name)
+	}
+	return value, nil
+}
+
+// Comparison says which side of a mapping changed last.
+type Comparison int
+
+const (
+	InSync Comparison = iota
+	LocalNewer
+	RemoteNewer
+	Unknown // The remote update time is unavailable
+)
+
+// StatusResult describes a mapping's local file and remote secret.
+type StatusResult struct {
+	LocalExists  bool
+	LocalModTime time.Time
+	RemoteExists bool
+	UpdatedOn    time.Time              // Last update of the remote secret
+	Tags         map[string]string      // Remote secret tags, e.g. vault.TagPushedBy
+	Attributes   vault.SecretAttributes // Activation and expiry dates of the remote secret
+	Comparison   Comparison             // Only meaningful when both sides exist
+}
+
+// Status compares a mapping's env file with its remote secret without reading the secret value.
+// The remote is not queried when the local file does not exist.
+func Status(ctx context.Context, cfg *Config, store SecretStore, mapping FileMapping) (*StatusResult, error) {
+	result := &StatusResult{Comparison: Unknown}
+
+	localFileInfo, err := os.Stat(mapping.EnvFile)
+	if os.IsNotExist(err) {
+		return result, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("could not stat local env file: %w", err)
+	}
+	result.LocalExists = true
+	result.LocalModTime = localFileInfo.ModTime()
+
+	props, err := store.GetSecretProperties(ctx, mapping.SecretName)
+	if errors.Is(err, vault.ErrSecretNotFound) {
+		return result, nil
+	}
+	if err := withContextError(ctx, err); err != nil {
+		return nil, err
+	}
+	result.RemoteExists = true
+	result.UpdatedOn = props.UpdatedOn
+	result.Tags = props.Tags
+	result.Attributes = props.Attributes
+
+	result.Comparison = compareSyncTimes(result.LocalModTime, props.UpdatedOn)
+	// A pull rewrites the local file after the secret was updated, so matching content wins over timestamps
+	if localContent, err := os.ReadFile(mapping.EnvFile); err == nil && props.Tags[vault.TagContentHash] == sync.ContentHash(localContent) {
+		result.Comparison = InSync
+	}
+	return result, nil
+}
+
+// syncTimeTolerance absorbs clock skew and the delay between writing the file and storing the secret
+const syncTimeTolerance = 2 * time.Second
+
+// compareSyncTimes compares the local file modification time with the remote secret update time
+func compareSyncTimes(localModTime, remoteUpdatedOn time.Time) Comparison {
+	if remoteUpdatedOn.IsZero() {
+		return Unknown
+	}
+	diff := localModTime.Sub(remoteUpdatedOn)
+	switch {
+	case diff > syncTimeTolerance:
+		return LocalNewer
+	case diff < -syncTimeTolerance:
+		return RemoteNewer
+	default:
+		return InSync
+	}
+}
+
+// callContext bounds a single vault call by timeout, when one is set
+func callContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// withContextError makes sure an error caused by ctx ending wraps the context's error,
+// so callers can tell a timeout from other vault failures with errors.Is
+func withContextError(ctx context.Context, err error) error {
+	if err == nil || ctx.Err() == nil || errors.Is(err, ctx.Err()) {
+		return err
+	}
+	return fmt.Errorf("%w (%w)", err, ctx.Err())
+}
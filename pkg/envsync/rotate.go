@@ -0,0 +1,257 @@
+package envsync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+)
+
+// RotatedSecret is a secret that Rotate stored re-encrypted with the new key.
+type RotatedSecret struct {
+	SecretName  string
+	EnvFile     string
+	ContentHash string // Content hash tag of the last push, kept through the rotation
+}
+
+// RotateOptions controls the backup Rotate keeps of the pre-rotation secrets.
+type RotateOptions struct {
+	// BackupFile receives the pre-rotation secrets before anything is stored, for Rollback.
+	// Empty skips the backup.
+	BackupFile string
+	// BackupSecrets are further secrets to back up and restore verbatim, such as the KMS wrapped
+	// data key. Rotate does not change them.
+	BackupSecrets []string
+	// DryRun fetches and re-encrypts every secret and checks the result, but neither writes the
+	// backup nor stores anything, so a rotation can be validated before it is committed to.
+	DryRun bool
+}
+
+// RotateResult reports which secrets Rotate moved to the new key.
+type RotateResult struct {
+	Stored   []RotatedSecret // Secrets now encrypted with the new key, in mapping order
+	Failed   string          // Secret whose store failed, if any; the ones after it were not attempted
+	Verified []string        // Secrets that re-encrypted cleanly, in mapping order; all of them on a dry run
+}
+
+// Rotate re-encrypts every mapped secret from oldKey to newKey. All secrets are re-encrypted and
+// checked to decrypt with newKey before any is stored, so a failure leaves the vault untouched.
+// If a store fails, the result lists the secrets already on the new key alongside the error.
+// Rotate refuses read-only configurations and those with recipients, which have no shared key.
+// With opts.DryRun it returns after the checks, with every secret in the result's Verified.
+func Rotate(ctx context.Context, cfg *Config, store SecretStore, oldKey, newKey []byte, opts RotateOptions) (*RotateResult, error) {
+	if err := cfg.CheckWritable("rotate the key"); err != nil {
+		return nil, err
+	}
+	if len(cfg.Recipients) > 0 {
+		return nil, fmt.Errorf("there is no shared key to rotate when recipients are configured; change the recipient list and push instead")
+	}
+	if err := crypto.ValidateEncryptionKey(newKey); err != nil {
+		return nil, fmt.Errorf("new key is invalid: %w", err)
+	}
+	if bytes.Equal(oldKey, newKey) {
+		return nil, fmt.Errorf("the new key cannot be the same as the old key")
+	}
+
+	mappings := cfg.Mappings()
+	backup := &RotationBackup{CreatedAt: time.Now().UTC()}
+	rotated := make([]*Secret, len(mappings))
+	reencryptProgress := utils.NewProgress("Re-encrypting", len(mappings))
+	defer reencryptProgress.Finish()
+	for i, mapping := range mappings {
+		secret, err := store.GetSecretWithProperties(ctx, mapping.SecretName)
+		if err := withContextError(ctx, err); err != nil {
+			return nil, fmt.Errorf("failed to get secret '%s' for rotation: %w", mapping.SecretName, err)
+		}
+		backup.Secrets = append(backup.Secrets, newBackupSecret(mapping.SecretName, mapping.EnvFile, secret))
+		plaintext, err := crypto.DecryptEnvContent(secret.Value, oldKey)
+		if err != nil {
+			return nil, fmt.Errorf("'%s' does not decrypt with the old key: %w", mapping.SecretName, err)
+		}
+
+		// Tags are kept so the audit trail still points at the last push, and the activation and
+		// expiry dates because rotation doesn't change the content
+		rotated[i] = secret
+		rotated[i].Value, err = crypto.RotateKey(oldKey, newKey, secret.Value)
+		if err != nil {
+			return nil, fmt.Errorf("key rotation failed during re-encryption of '%s': %w", mapping.SecretName, err)
+		}
+		// Never store a secret nobody could read back
+		reencrypted, err := crypto.DecryptEnvContent(rotated[i].Value, newKey)
+		if err != nil {
+			return nil, fmt.Errorf("re-encrypted '%s' does not decrypt with the new key: %w", mapping.SecretName, err)
+		}
+		if !bytes.Equal(plaintext, reencrypted) {
+			return nil, fmt.Errorf("re-encrypted '%s' decrypts to different content than before", mapping.SecretName)
+		}
+		reencryptProgress.Increment()
+	}
+	reencryptProgress.Finish()
+
+	result := &RotateResult{}
+	for _, mapping := range mappings {
+		result.Verified = append(result.Verified, mapping.SecretName)
+	}
+	if opts.DryRun {
+		return result, nil
+	}
+
+	if opts.BackupFile != "" {
+		for _, secretName := range opts.BackupSecrets {
+			secret, err := store.GetSecretWithProperties(ctx, secretName)
+			if err := withContextError(ctx, err); err != nil {
+				return nil, fmt.Errorf("failed to back up secret '%s': %w", secretName, err)
+			}
+			backup.Extra = append(backup.Extra, newBackupSecret(secretName, "", secret))
+		}
+		if err := SaveRotationBackup(opts.BackupFile, backup); err != nil {
+			return nil, err
+		}
+	}
+
+	storeProgress := utils.NewProgress("Storing", len(mappings))
+	defer storeProgress.Finish()
+	for i, mapping := range mappings {
+		err := store.StoreSecret(ctx, mapping.SecretName, rotated[i].Value, rotated[i].Tags, rotated[i].Attributes)
+		if err := withContextError(ctx, err); err != nil {
+			result.Failed = mapping.SecretName
+			return result, fmt.Errorf("failed to store re-encrypted secret '%s' in Key Vault: %w", mapping.SecretName, err)
+		}
+		result.Stored = append(result.Stored, RotatedSecret{
+			SecretName:  mapping.SecretName,
+			EnvFile:     mapping.EnvFile,
+			ContentHash: rotated[i].Tags[vault.TagContentHash],
+		})
+		storeProgress.Increment()
+	}
+	storeProgress.Finish()
+
+	return result, nil
+}
+
+// RotationBackup holds the encrypted secrets as they were before a rotation. It contains no
+// plaintext: restoring it needs the pre-rotation key.
+type RotationBackup struct {
+	CreatedAt time.Time      `json:"created_at"`
+	Secrets   []BackupSecret `json:"secrets"`         // Mapped secrets, encrypted with the old key
+	Extra     []BackupSecret `json:"extra,omitempty"` // Secrets from RotateOptions.BackupSecrets
+}
+
+// BackupSecret is one secret in a RotationBackup.
+type BackupSecret struct {
+	SecretName string            `json:"secret_name"`
+	EnvFile    string            `json:"env_file,omitempty"`
+	Value      string            `json:"value"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	NotBefore  *time.Time        `json:"not_before,omitempty"` // Activation date of the backed up version, if it had one
+	Expires    *time.Time        `json:"expires,omitempty"`    // Expiry date of the backed up version, if it had one
+}
+
+// newBackupSecret backs up secret, keeping its activation and expiry dates
+func newBackupSecret(secretName, envFile string, secret *Secret) BackupSecret {
+	backup := BackupSecret{SecretName: secretName, EnvFile: envFile, Value: secret.Value, Tags: secret.Tags}
+	if !secret.Attributes.NotBefore.IsZero() {
+		notBefore := secret.Attributes.NotBefore
+		backup.NotBefore = &notBefore
+	}
+	if !secret.Attributes.Expires.IsZero() {
+		expires := secret.Attributes.Expires
+		backup.Expires = &expires
+	}
+	return backup
+}
+
+// attributes returns the activation and expiry dates to restore the secret with
+func (b BackupSecret) attributes() vault.SecretAttributes {
+	var attrs vault.SecretAttributes
+	if b.NotBefore != nil {
+		attrs.NotBefore = *b.NotBefore
+	}
+	if b.Expires != nil {
+		attrs.Expires = *b.Expires
+	}
+	return attrs
+}
+
+// Find returns the backed up secret named secretName, or nil.
+func (b *RotationBackup) Find(secretName string) *BackupSecret {
+	for _, secrets := range [][]BackupSecret{b.Secrets, b.Extra} {
+		for i := range secrets {
+			if secrets[i].SecretName == secretName {
+				return &secrets[i]
+			}
+		}
+	}
+	return nil
+}
+
+// RotationBackupPath returns the rotation backup file kept alongside the configured env file.
+func RotationBackupPath(cfg *Config) string {
+	return filepath.Join(filepath.Dir(cfg.EnvFile), ".env-sync-rotation-backup.json")
+}
+
+// SaveRotationBackup writes backup to path, readable only by the current user.
+func SaveRotationBackup(path string, backup *RotationBackup) error {
+	data, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal rotation backup: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write rotation backup '%s': %w", path, err)
+	}
+	return nil
+}
+
+// LoadRotationBackup reads a backup written by Rotate.
+func LoadRotationBackup(path string) (*RotationBackup, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no rotation backup found at '%s'", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rotation backup '%s': %w", path, err)
+	}
+	var backup RotationBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, fmt.Errorf("failed to parse rotation backup '%s': %w", path, err)
+	}
+	return &backup, nil
+}
+
+// Rollback restores the secrets in backup. Every backed up secret must decrypt with oldKey, and none
+// may have been pushed since the rotation, before anything is stored. The extra secrets are restored
+// last, verbatim. It returns the names of the secrets restored, also when a store fails part way.
+func Rollback(ctx context.Context, store SecretStore, oldKey []byte, backup *RotationBackup) ([]string, error) {
+	for _, secret := range backup.Secrets {
+		if _, err := crypto.DecryptEnvContent(secret.Value, oldKey); err != nil {
+			return nil, fmt.Errorf("backup of '%s' does not decrypt with the given key (it must be the key from before the rotation): %w", secret.SecretName, err)
+		}
+
+		current, err := store.GetSecretProperties(ctx, secret.SecretName)
+		if err := withContextError(ctx, err); err != nil {
+			return nil, fmt.Errorf("failed to get secret '%s' for rollback: %w", secret.SecretName, err)
+		}
+		// Rotation keeps the content hash tag, so a different one means a push since
+		backedUpHash, currentHash := secret.Tags[vault.TagContentHash], current.Tags[vault.TagContentHash]
+		if backedUpHash != "" && currentHash != "" && backedUpHash != currentHash {
+			return nil, fmt.Errorf("'%s' was pushed after the rotation; rolling back would discard that push", secret.SecretName)
+		}
+	}
+
+	var restored []string
+	for _, secret := range append(backup.Secrets, backup.Extra...) {
+		err := store.StoreSecret(ctx, secret.SecretName, secret.Value, secret.Tags, secret.attributes())
+		if err := withContextError(ctx, err); err != nil {
+			return restored, fmt.Errorf("failed to restore secret '%s': %w", secret.SecretName, err)
+		}
+		restored = append(restored, secret.SecretName)
+	}
+	return restored, nil
+}
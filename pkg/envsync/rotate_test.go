@@ -0,0 +1,120 @@
+package envsync
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotate(t *testing.T) {
+	oldKey, newKey := testKey(1), testKey(2)
+	dir := t.TempDir()
+	cfg := &Config{
+		EnvFile:    filepath.Join(dir, ".env"),
+		SecretName: "app-env",
+		Files:      []FileMapping{{EnvFile: filepath.Join(dir, ".env.test"), SecretName: "app-env-test"}},
+	}
+	setup := func(t *testing.T) *vault.FakeStore {
+		t.Helper()
+		store := vault.NewFakeStore()
+		for _, mapping := range cfg.Mappings() {
+			encrypted, err := crypto.EncryptEnvContent([]byte("KEY="+mapping.SecretName+"\n"), oldKey)
+			if err != nil {
+				t.Fatalf("Failed to encrypt content: %v", err)
+			}
+			storeValue(t, store, mapping.SecretName, encrypted, map[string]string{vault.TagContentHash: "hash"})
+		}
+		return store
+	}
+
+	t.Run("all secrets", func(t *testing.T) {
+		store := setup(t)
+		result, err := Rotate(context.Background(), cfg, store, oldKey, newKey, RotateOptions{})
+		assert.NoError(t, err)
+		assert.Len(t, result.Stored, 2)
+		assert.Equal(t, "hash", result.Stored[0].ContentHash)
+		for _, mapping := range cfg.Mappings() {
+			decrypted, err := crypto.DecryptEnvContent(latestValue(t, store, mapping.SecretName), newKey)
+			assert.NoError(t, err)
+			assert.Equal(t, "KEY="+mapping.SecretName+"\n", string(decrypted))
+		}
+	})
+
+	t.Run("failed store reports progress", func(t *testing.T) {
+		store := &failingStore{FakeStore: setup(t), secretName: "app-env-test"}
+		result, err := Rotate(context.Background(), cfg, store, oldKey, newKey, RotateOptions{})
+		assert.Error(t, err)
+		assert.Len(t, result.Stored, 1)
+		assert.Equal(t, "app-env-test", result.Failed)
+	})
+
+	t.Run("rollback restores the old secrets", func(t *testing.T) {
+		store := setup(t)
+		storeValue(t, store, "app-env-dek", "wrapped-old-key", nil)
+		backupFile := filepath.Join(t.TempDir(), "backup.json")
+		_, err := Rotate(context.Background(), cfg, store, oldKey, newKey, RotateOptions{BackupFile: backupFile, BackupSecrets: []string{"app-env-dek"}})
+		assert.NoError(t, err)
+
+		backup, err := LoadRotationBackup(backupFile)
+		assert.NoError(t, err)
+		assert.Len(t, backup.Secrets, 2)
+		assert.Equal(t, "wrapped-old-key", backup.Find("app-env-dek").Value)
+
+		// The new key cannot restore the backup
+		_, err = Rollback(context.Background(), store, newKey, backup)
+		assert.Error(t, err)
+
+		storeValue(t, store, "app-env-dek", "wrapped-new-key", nil)
+		restored, err := Rollback(context.Background(), store, oldKey, backup)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"app-env", "app-env-test", "app-env-dek"}, restored)
+		assert.Equal(t, "wrapped-old-key", latestValue(t, store, "app-env-dek"))
+		decrypted, err := crypto.DecryptEnvContent(latestValue(t, store, "app-env"), oldKey)
+		assert.NoError(t, err)
+		assert.Equal(t, "KEY=app-env\n", string(decrypted))
+	})
+
+	t.Run("rollback refuses to discard a later push", func(t *testing.T) {
+		store := setup(t)
+		backupFile := filepath.Join(t.TempDir(), "backup.json")
+		_, err := Rotate(context.Background(), cfg, store, oldKey, newKey, RotateOptions{BackupFile: backupFile})
+		assert.NoError(t, err)
+		storeValue(t, store, "app-env-test", latestValue(t, store, "app-env-test"), map[string]string{vault.TagContentHash: "pushed-later"})
+
+		backup, err := LoadRotationBackup(backupFile)
+		assert.NoError(t, err)
+		_, err = Rollback(context.Background(), store, oldKey, backup)
+		assert.ErrorContains(t, err, "pushed after the rotation")
+		assert.Equal(t, 2, store.Versions("app-env"))
+	})
+
+	t.Run("dry run stores nothing", func(t *testing.T) {
+		store := setup(t)
+		backupFile := filepath.Join(t.TempDir(), "backup.json")
+		result, err := Rotate(context.Background(), cfg, store, oldKey, newKey, RotateOptions{BackupFile: backupFile, DryRun: true})
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"app-env", "app-env-test"}, result.Verified)
+		assert.Empty(t, result.Stored)
+		assert.Equal(t, 1, store.Versions("app-env"))
+		assert.Equal(t, 1, store.Versions("app-env-test"))
+		assert.NoFileExists(t, backupFile)
+	})
+
+	t.Run("dry run reports the failing step", func(t *testing.T) {
+		store := setup(t)
+		encrypted, err := crypto.EncryptEnvContent([]byte("KEY=other\n"), testKey(3))
+		assert.NoError(t, err)
+		storeValue(t, store, "app-env-test", encrypted, nil)
+		_, err = Rotate(context.Background(), cfg, store, oldKey, newKey, RotateOptions{DryRun: true})
+		assert.ErrorContains(t, err, "'app-env-test' does not decrypt with the old key")
+	})
+
+	t.Run("same key", func(t *testing.T) {
+		_, err := Rotate(context.Background(), cfg, setup(t), oldKey, oldKey, RotateOptions{})
+		assert.Error(t, err)
+	})
+}
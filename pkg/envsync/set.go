@@ -0,0 +1,135 @@
+package envsync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lliamscholtz/env-sync/internal/sync"
+	"github.com/lliamscholtz/env-sync/internal/utils"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+)
+
+// SetOptions lists the keys Set changes in the remote content.
+type SetOptions struct {
+	// Set adds keys or changes their values.
+	Set map[string]string
+	// Delete removes keys. Deleting a key the remote doesn't have is an error, to catch typos.
+	Delete []string
+	// Force edits secrets whose content type says they weren't written by env-sync and stores
+	// content with conflict markers or plaintext key material.
+	Force bool
+	// Message is a note on why the content changed, stored with the new version like a push message.
+	Message string
+	// Timeout bounds each vault call separately. Zero leaves the calls bounded by ctx only.
+	Timeout time.Duration
+}
+
+// SetResult reports what Set changed.
+type SetResult struct {
+	Added       []string // Keys that weren't in the remote content, sorted
+	Deleted     []string // Keys removed from the remote content, sorted
+	Changed     []string // Keys whose remote value changed, sorted
+	Pushed      bool     // The edited content was stored as a new secret version
+	FirstPush   bool     // No remote secret existed before
+	ContentHash string   // Hash of the edited content
+}
+
+// Set edits individual keys of the mapping's secret without touching its env file: the remote
+// content is read, decrypted, edited in memory and stored again. Other keys, comments and the
+// order of lines are kept as they are remotely, so local-only changes are never uploaded. The
+// store is conditional on the version that was read, so a concurrent push fails the edit with
+// ErrConcurrentModification instead of being overwritten. Content that doesn't change isn't stored.
+//
+// The sync state isn't updated, since the env file still holds the previous content: a later
+// push of the unchanged file is rejected with ErrRemoteChanged until the edit is pulled.
+func Set(ctx context.Context, cfg *Config, store SecretStore, key []byte, mapping FileMapping, opts SetOptions) (*SetResult, error) {
+	if err := cfg.CheckWritable("set keys"); err != nil {
+		return nil, err
+	}
+	if err := cfg.CheckSecretPrefix(mapping.SecretName); err != nil {
+		return nil, err
+	}
+	if len(opts.Set) == 0 && len(opts.Delete) == 0 {
+		return nil, fmt.Errorf("no keys to set or delete")
+	}
+	result := &SetResult{}
+
+	var remoteContent []byte
+	var remoteVersion string
+	getCtx, cancel := callContext(ctx, opts.Timeout)
+	secret, err := store.GetSecretWithProperties(getCtx, mapping.SecretName)
+	err = withContextError(getCtx, err)
+	cancel()
+	switch {
+	case errors.Is(err, vault.ErrSecretNotFound):
+		result.FirstPush = true
+	case err != nil:
+		return nil, fmt.Errorf("failed to read remote secret '%s': %w", mapping.SecretName, err)
+	default:
+		if err := checkContentType(mapping.SecretName, secret.ContentType, opts.Force); err != nil {
+			return nil, err
+		}
+		remoteVersion = secret.Version
+		if remoteContent, err = cfg.DecryptContent(secret.Value, key); err != nil {
+			return nil, fmt.Errorf("failed to decrypt remote secret '%s': %w", mapping.SecretName, err)
+		}
+	}
+
+	remoteEnv, err := sync.ParseEnvContent(string(remoteContent))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse remote .env content: %w", err)
+	}
+	for _, name := range opts.Delete {
+		if _, ok := remoteEnv[name]; !ok {
+			return nil, fmt.Errorf("cannot delete %s: '%s' has no such key", name, mapping.SecretName)
+		}
+	}
+	edited, err := sync.EditEnvContent(string(remoteContent), opts.Set, opts.Delete)
+	if err != nil {
+		return nil, err
+	}
+	editedEnv, err := sync.ParseEnvContent(edited)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse edited .env content: %w", err)
+	}
+	diff := sync.DiffEnv(remoteEnv, editedEnv)
+	result.Added, result.Deleted, result.Changed = diff.Added, diff.Removed, diff.Changed
+	result.ContentHash = sync.ContentHash([]byte(edited))
+	if diff.Empty() && !result.FirstPush {
+		utils.PrintSuccess("✅ '%s' already has these values, nothing to push.\n", mapping.SecretName)
+		return result, nil
+	}
+
+	if err := sync.CheckPushContent(edited, key); err != nil {
+		if !opts.Force {
+			return nil, fmt.Errorf("'%s': %w", mapping.SecretName, err)
+		}
+		utils.PrintWarning("⚠️ Pushing '%s' despite problems (forced): %v\n", mapping.SecretName, err)
+	}
+	encrypted, err := cfg.EncryptContent([]byte(edited), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt .env content: %w", err)
+	}
+	attrs, err := cfg.SecretAttributes(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	storeCtx, cancel := callContext(ctx, opts.Timeout)
+	defer cancel()
+	tags := sync.PushTags([]byte(edited))
+	if message := pushMessage(opts.Message); message != "" {
+		tags[vault.TagMessage] = message
+	}
+	err = store.StoreSecretIfVersionBestEffort(storeCtx, mapping.SecretName, encrypted, tags, attrs, remoteVersion)
+	if err := withContextError(storeCtx, err); err != nil {
+		if errors.Is(err, vault.ErrConcurrentModification) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to store secret in Key Vault: %w", err)
+	}
+	result.Pushed = true
+	return result, nil
+}
@@ -0,0 +1,73 @@
+package envsync
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/lliamscholtz/env-sync/internal/crypto"
+	"github.com/lliamscholtz/env-sync/internal/vault"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSet(t *testing.T) {
+	key := testKey(1)
+	remote := "# Payments\nSTRIPE_KEY=old\nLEGACY_TOKEN=x\nDEBUG=false\n"
+	mapping := writeEnvFile(t, remote)
+	store := vault.NewFakeStore()
+	_, err := Push(context.Background(), &Config{}, store, key, mapping, PushOptions{})
+	assert.NoError(t, err)
+
+	// Local drift is never uploaded
+	assert.NoError(t, os.WriteFile(mapping.EnvFile, []byte(remote+"LOCAL_ONLY=1\n"), 0600))
+
+	result, err := Set(context.Background(), &Config{}, store, key, mapping, SetOptions{
+		Set:     map[string]string{"STRIPE_KEY": "new", "FEATURE": "on"},
+		Delete:  []string{"LEGACY_TOKEN"},
+		Message: "Rotate Stripe",
+	})
+	assert.NoError(t, err)
+	assert.True(t, result.Pushed)
+	assert.Equal(t, []string{"FEATURE"}, result.Added)
+	assert.Equal(t, []string{"STRIPE_KEY"}, result.Changed)
+	assert.Equal(t, []string{"LEGACY_TOKEN"}, result.Deleted)
+
+	secret, err := store.GetSecretWithProperties(context.Background(), mapping.SecretName)
+	assert.NoError(t, err)
+	decrypted, err := crypto.DecryptEnvContent(secret.Value, key)
+	assert.NoError(t, err)
+	assert.Equal(t, "# Payments\nSTRIPE_KEY=new\nDEBUG=false\nFEATURE=on\n", string(decrypted))
+	assert.Equal(t, "Rotate Stripe", secret.Tags[vault.TagMessage])
+
+	// The env file still holds the old content, so pushing it needs a pull first
+	assert.NoError(t, os.WriteFile(mapping.EnvFile, []byte(remote), 0600))
+	_, err = Push(context.Background(), &Config{}, store, key, mapping, PushOptions{})
+	assert.ErrorIs(t, err, ErrRemoteChanged)
+
+	// Values already in place aren't stored again
+	result, err = Set(context.Background(), &Config{}, store, key, mapping, SetOptions{Set: map[string]string{"DEBUG": "false"}})
+	assert.NoError(t, err)
+	assert.False(t, result.Pushed)
+	assert.Equal(t, 2, store.Versions(mapping.SecretName))
+
+	_, err = Set(context.Background(), &Config{}, store, key, mapping, SetOptions{Delete: []string{"MISSING"}})
+	assert.ErrorContains(t, err, "cannot delete MISSING")
+
+	// Edits are refused where pushes are
+	_, err = Set(context.Background(), &Config{ReadOnly: true}, store, key, mapping, SetOptions{Set: map[string]string{"A": "1"}})
+	assert.ErrorIs(t, err, ErrReadOnly)
+}
+
+func TestSetCreatesSecret(t *testing.T) {
+	key := testKey(1)
+	store := vault.NewFakeStore()
+	mapping := FileMapping{EnvFile: ".env", SecretName: "new-env"}
+
+	result, err := Set(context.Background(), &Config{}, store, key, mapping, SetOptions{Set: map[string]string{"A": "1"}})
+	assert.NoError(t, err)
+	assert.True(t, result.FirstPush)
+	assert.True(t, result.Pushed)
+	decrypted, err := crypto.DecryptEnvContent(latestValue(t, store, mapping.SecretName), key)
+	assert.NoError(t, err)
+	assert.Equal(t, "A=1\n", string(decrypted))
+}